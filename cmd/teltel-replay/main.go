@@ -0,0 +1,303 @@
+// teltel-replay повторно отправляет события из dead-letter файлов teltel
+// после устранения причины отказа.
+//
+// Записи ingest (строки, отклонённые при приёме) отправляются в
+// POST /api/ingest сервера; записи storage.clickhouse (батчи, не записанные
+// batcher'ом) записываются напрямую в ClickHouse, минуя EventBus, чтобы
+// не дублировать события в live buffer'ах.
+//
+// Пример:
+//
+//	teltel-replay -dir ./deadletter -server http://localhost:8080 -clickhouse-url http://localhost:8123
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/teltel/teltel/internal/deadletter"
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/ingest"
+	"github.com/teltel/teltel/internal/storage"
+)
+
+// options - параметры командной строки.
+type options struct {
+	dir           string
+	file          string
+	server        string
+	token         string
+	clickhouseURL string
+	reason        string
+	origin        string
+	batchSize     int
+	dryRun        bool
+	remove        bool
+}
+
+// result - итог повторной отправки одного файла.
+type result struct {
+	// Replayed - количество принятых сервером или записанных в ClickHouse событий
+	Replayed int
+
+	// Failed - количество событий, снова отклонённых или не записанных
+	Failed int
+
+	// Skipped - записи без данных для повторной отправки или без -clickhouse-url
+	Skipped int
+
+	// Filtered - записи, не прошедшие фильтры -reason/-origin
+	Filtered int
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.dir, "dir", "", "Dead-letter directory (required)")
+	flag.StringVar(&opts.file, "file", "", "Replay only this dead-letter file (default: all files)")
+	flag.StringVar(&opts.server, "server", "http://localhost:8080", "teltel server URL for re-ingest")
+	flag.StringVar(&opts.token, "token", "", "Ingest API token (if server auth is enabled)")
+	flag.StringVar(&opts.clickhouseURL, "clickhouse-url", "", "ClickHouse URL for entries that failed to be stored (empty = skip them)")
+	flag.StringVar(&opts.reason, "reason", "", "Replay only entries with this reason (e.g. ErrSchemaViolation)")
+	flag.StringVar(&opts.origin, "origin", "", "Replay only entries with this origin (e.g. ingest.http, storage.clickhouse)")
+	flag.IntVar(&opts.batchSize, "batch-size", 500, "Events per ingest request / ClickHouse insert")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "Only print what would be replayed")
+	flag.BoolVar(&opts.remove, "remove", false, "Remove fully replayed files (except the newest one, which the server may still be writing)")
+	flag.Parse()
+
+	if opts.dir == "" {
+		fmt.Fprintln(os.Stderr, "teltel-replay: -dir is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if opts.batchSize < 1 {
+		opts.batchSize = 1
+	}
+
+	files, err := deadletter.ListFiles(opts.dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.file != "" {
+		if !deadletter.ValidFileName(opts.file) {
+			log.Fatalf("Invalid dead-letter file name: %s", opts.file)
+		}
+		files = filterFiles(files, opts.file)
+		if len(files) == 0 {
+			log.Fatalf("Dead-letter file not found: %s", opts.file)
+		}
+	}
+
+	r := &replayer{
+		opts: opts,
+		http: &http.Client{Timeout: 30 * time.Second},
+	}
+	if opts.clickhouseURL != "" {
+		r.clickhouse = storage.NewHTTPClient(opts.clickhouseURL)
+	}
+
+	ctx := context.Background()
+	var total result
+	for i, f := range files {
+		res, err := r.replayFile(ctx, filepath.Join(opts.dir, f.Name))
+		if err != nil {
+			log.Fatalf("%s: %v", f.Name, err)
+		}
+		log.Printf("%s: replayed %d, failed %d, skipped %d, filtered %d", f.Name, res.Replayed, res.Failed, res.Skipped, res.Filtered)
+
+		total.Replayed += res.Replayed
+		total.Failed += res.Failed
+		total.Skipped += res.Skipped
+		total.Filtered += res.Filtered
+
+		newest := i == len(files)-1 && opts.file == ""
+		if opts.remove && !opts.dryRun && !newest && res.Failed == 0 && res.Skipped == 0 && res.Filtered == 0 {
+			if err := os.Remove(filepath.Join(opts.dir, f.Name)); err != nil {
+				log.Printf("%s: remove failed: %v", f.Name, err)
+			} else {
+				log.Printf("%s: removed", f.Name)
+			}
+		}
+	}
+
+	log.Printf("Total: replayed %d, failed %d, skipped %d, filtered %d", total.Replayed, total.Failed, total.Skipped, total.Filtered)
+	if total.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// filterFiles оставляет файл с именем name.
+func filterFiles(files []deadletter.FileInfo, name string) []deadletter.FileInfo {
+	for _, f := range files {
+		if f.Name == name {
+			return []deadletter.FileInfo{f}
+		}
+	}
+	return nil
+}
+
+// replayer повторно отправляет записи dead-letter файлов.
+type replayer struct {
+	opts       options
+	http       *http.Client
+	clickhouse storage.Client
+}
+
+// replayFile отправляет записи одного файла.
+func (r *replayer) replayFile(ctx context.Context, path string) (result, error) {
+	var res result
+
+	f, err := os.Open(path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	var events []*event.Event
+	err = deadletter.ReadEntries(f, func(entry deadletter.Entry) error {
+		if (r.opts.reason != "" && entry.Reason != r.opts.reason) || (r.opts.origin != "" && entry.Origin != r.opts.origin) {
+			res.Filtered++
+			return nil
+		}
+
+		if entry.Origin == storage.DeadLetterOrigin {
+			if entry.Event == nil || r.clickhouse == nil {
+				res.Skipped++
+				return nil
+			}
+			events = append(events, entry.Event)
+			if len(events) >= r.opts.batchSize {
+				r.insert(ctx, events, &res)
+				events = events[:0]
+			}
+			return nil
+		}
+
+		line, ok := ingestLine(entry)
+		if !ok {
+			// Например, событие MessagePack, не прошедшее декодирование
+			res.Skipped++
+			return nil
+		}
+		lines = append(lines, line)
+		if len(lines) >= r.opts.batchSize {
+			if err := r.ingest(ctx, lines, &res); err != nil {
+				return err
+			}
+			lines = lines[:0]
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	r.insert(ctx, events, &res)
+	if err := r.ingest(ctx, lines, &res); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// ingestLine возвращает NDJSON строку для повторной отправки записи ingest:
+// исходную строку или, если её нет, сериализованное событие.
+func ingestLine(entry deadletter.Entry) ([]byte, bool) {
+	if entry.Raw != "" {
+		return []byte(entry.Raw), true
+	}
+	if entry.Event != nil {
+		line, err := json.Marshal(entry.Event)
+		return line, err == nil
+	}
+	return nil, false
+}
+
+// ingest отправляет строки в POST /api/ingest.
+// Ошибки авторизации и недоступность сервера прерывают работу.
+func (r *replayer) ingest(ctx context.Context, lines [][]byte, res *result) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if r.opts.dryRun {
+		res.Replayed += len(lines)
+		return nil
+	}
+
+	body := append(bytes.Join(lines, []byte{'\n'}), '\n')
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(r.opts.server, "/")+"/api/ingest", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if r.opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.opts.token)
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("ingest request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("ingest request rejected: %s", resp.Status)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// Батч не дошёл до EventBus целиком или частично; отчёт
+		// не используется, файл не должен удаляться с -remove
+		log.Printf("Ingest batch failed: %s", resp.Status)
+		res.Failed += len(lines)
+		return nil
+	}
+
+	var report ingest.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("invalid ingest response (%s): %w", resp.Status, err)
+	}
+
+	// Повторно отправленными считаются только опубликованные события и
+	// повторы уже принятых seq. Accepted включает Unpublished, а события
+	// сверх лимита при политике drop не входят ни в Accepted, ни в Rejected,
+	// поэтому всё остальное (Rejected + Unpublished + RateLimited без учёта
+	// вошедших в Rejected) считается неотправленным.
+	replayed := report.Published + report.Duplicates
+	res.Replayed += replayed
+	res.Failed += max(len(lines)-replayed, 0)
+	return nil
+}
+
+// insert записывает события в ClickHouse и обновляет метаданные run'ов.
+func (r *replayer) insert(ctx context.Context, events []*event.Event, res *result) {
+	if len(events) == 0 {
+		return
+	}
+	if r.opts.dryRun {
+		res.Replayed += len(events)
+		return
+	}
+
+	if err := storage.InsertEvents(ctx, r.clickhouse, events); err != nil {
+		log.Printf("ClickHouse insert failed: %v", err)
+		res.Failed += len(events)
+		return
+	}
+	res.Replayed += len(events)
+
+	runs := make(map[string][]*event.Event)
+	for _, e := range events {
+		runs[e.RunID] = append(runs[e.RunID], e)
+	}
+	metadata := storage.NewMetadataManager(r.clickhouse)
+	for runID, runEvents := range runs {
+		metadata.UpdateFromEvents(ctx, runID, runEvents)
+	}
+}
@@ -11,26 +11,51 @@ import (
 	"time"
 
 	"github.com/teltel/teltel/internal/api"
+	"github.com/teltel/teltel/internal/auth"
+	"github.com/teltel/teltel/internal/bridge"
 	"github.com/teltel/teltel/internal/buffer"
 	"github.com/teltel/teltel/internal/config"
+	"github.com/teltel/teltel/internal/deadletter"
 	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
 	"github.com/teltel/teltel/internal/ingest"
+	"github.com/teltel/teltel/internal/schema"
 	"github.com/teltel/teltel/internal/storage"
 )
 
-
 func main() {
 	cfg := config.Load()
 
+	// Опциональный журнал событий для durable подписок
+	var eventLog *eventlog.Log
+	if cfg.EventLogDir != "" {
+		var err error
+		eventLog, err = eventlog.Open(eventlog.Config{
+			Dir:             cfg.EventLogDir,
+			MaxSegmentBytes: cfg.EventLogMaxSegmentBytes,
+			MaxSegments:     cfg.EventLogMaxSegments,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open event log: %v", err)
+		}
+		defer eventLog.Close()
+		log.Printf("Event log enabled (dir: %s, offsets %d..%d)", cfg.EventLogDir, eventLog.Start(), eventLog.End())
+	}
+
 	// Инициализация EventBus
-	bus := eventbus.New()
+	bus := eventbus.NewWithConfig(eventbus.Config{
+		Log:    eventLog,
+		Shards: cfg.EventBusShards,
+	})
 	defer bus.Close()
 
 	// Инициализация Live Buffer Manager
 	bufferConfig := buffer.Config{
 		Capacity:        cfg.BufferCapacity,
-		MaxRuns:        cfg.BufferMaxRuns,
+		MaxRuns:         cfg.BufferMaxRuns,
 		CleanupInterval: cfg.BufferCleanupInterval,
+		IdleTTL:         cfg.BufferIdleTTL,
+		EndGrace:        cfg.BufferEndGrace,
 	}
 	bufferManager, err := buffer.NewManager(bus, bufferConfig)
 	if err != nil {
@@ -38,10 +63,99 @@ func main() {
 	}
 	defer bufferManager.Close()
 
+	// Опциональная аутентификация по токенам
+	var authenticator *auth.Authenticator
+	if cfg.AuthTokensFile != "" {
+		authenticator, err = auth.LoadFile(cfg.AuthTokensFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth tokens: %v", err)
+		}
+		log.Printf("Token authentication enabled")
+	}
+
+	// Опциональные лимиты ingest по sourceId и runId
+	var rateLimits ingest.RateLimitsConfig
+	if cfg.IngestRateLimitsFile != "" {
+		rateLimits, err = ingest.LoadRateLimitsFile(cfg.IngestRateLimitsFile)
+		if err != nil {
+			log.Fatalf("Failed to load ingest rate limits: %v", err)
+		}
+		log.Printf("Ingest rate limits enabled (policy: %s)", rateLimits.Policy)
+	}
+
+	// Опциональная цепочка processor'ов ingest
+	var processors []ingest.NamedProcessor
+	if cfg.IngestProcessorsFile != "" {
+		processors, err = ingest.LoadProcessorsFile(cfg.IngestProcessorsFile)
+		if err != nil {
+			log.Fatalf("Failed to load ingest processors: %v", err)
+		}
+		log.Printf("Ingest processors enabled (%d)", len(processors))
+	}
+
+	// Опциональный реестр схем payload
+	var schemas *schema.Registry
+	if cfg.SchemaRegistryFile != "" {
+		schemas, err = schema.LoadFile(cfg.SchemaRegistryFile)
+		if err != nil {
+			log.Fatalf("Failed to load schema registry: %v", err)
+		}
+		log.Printf("Payload schema validation enabled (mode: %s)", schemas.Mode())
+	}
+
+	// Опциональные bridge'и в другие экземпляры teltel
+	var bridges []*bridge.Bridge
+	if cfg.BridgesFile != "" {
+		bridgeConfigs, err := bridge.LoadFile(cfg.BridgesFile)
+		if err != nil {
+			log.Fatalf("Failed to load bridges: %v", err)
+		}
+		for _, bridgeConfig := range bridgeConfigs {
+			b, err := bridge.New(bus, bridgeConfig)
+			if err != nil {
+				log.Fatalf("Failed to create bridge %s: %v", bridgeConfig.Name, err)
+			}
+			if err := b.Start(context.Background()); err != nil {
+				log.Fatalf("Failed to start bridge %s: %v", bridgeConfig.Name, err)
+			}
+			bridges = append(bridges, b)
+			log.Printf("Bridge %s started (addr: %s, origin: %s)", bridgeConfig.Name, bridgeConfig.Addr, bridgeConfig.Origin)
+		}
+	}
+
+	// Опциональное dead-letter хранилище отклонённых и недоставленных событий
+	var deadLetters *deadletter.Store
+	if cfg.DeadLetterDir != "" {
+		deadLetters, err = deadletter.Open(deadletter.Config{
+			Dir:          cfg.DeadLetterDir,
+			MaxFileBytes: cfg.DeadLetterMaxFileBytes,
+			MaxFiles:     cfg.DeadLetterMaxFiles,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open dead-letter store: %v", err)
+		}
+		log.Printf("Dead-letter store enabled (dir: %s)", cfg.DeadLetterDir)
+	}
+
 	// Инициализация handlers
-	ingestHandler := ingest.NewHandler(bus)
+	ingestHandler := ingest.NewHandlerWithConfig(bus, ingest.Config{
+		MaxDecompressedBytes: cfg.IngestMaxDecompressedBytes,
+		FlowMaxLogLag:        cfg.IngestFlowMaxLogLag,
+		Pipeline: ingest.PipelineConfig{
+			DedupWindow: cfg.IngestDedupWindow,
+			RateLimits:  rateLimits,
+			Schemas:     schemas,
+			DeadLetter:  deadLetters,
+			Processors:  processors,
+		},
+		Auth: authenticator,
+	})
 	httpHandler := api.NewHTTPHandler(bufferManager)
+	httpHandler.SetSequenceSource(ingestHandler.Pipeline())
+	httpHandler.SetSchemaRegistry(schemas)
 	wsHandler := api.NewWSHandler(bus)
+	eventBusHandler := api.NewEventBusHandler(bus)
+	eventBusHandler.SetEventLog(eventLog)
 
 	// Опциональная инициализация ClickHouse и Batcher (Phase 2/3)
 	var analysisHandler *api.AnalysisHandler
@@ -72,39 +186,123 @@ func main() {
 				Policy:        eventbus.BackpressureBlock,
 				MaxRetries:    3,
 				RetryBackoff:  100 * time.Millisecond,
+				DeadLetter:    deadLetters,
+				Log:           eventLog,
 			}
 			batcher = storage.NewBatcher(bus, chClient, batcherConfig)
 			if err := batcher.Start(ctx); err != nil {
 				log.Printf("Warning: Failed to start batcher: %v", err)
 			} else {
 				log.Printf("Batcher started")
+				if eventLog != nil {
+					// В durable режиме batcher не блокирует EventBus:
+					// flow control учитывает его отставание по журналу
+					ingestHandler.SetFlowLog(eventLog, storage.DurableName)
+				}
 			}
 		}
 	}
 
+	// Опциональный UDP listener для fire-and-forget ingest
+	var udpListener *ingest.UDPListener
+	if cfg.UDPPort > 0 {
+		udpListener = ingest.NewUDPListener(ingestHandler.Pipeline(), ingest.UDPConfig{
+			Addr: fmt.Sprintf(":%d", cfg.UDPPort),
+			Auth: authenticator,
+		})
+		if err := udpListener.Start(context.Background()); err != nil {
+			log.Fatalf("Failed to start UDP listener: %v", err)
+		}
+		ingestHandler.SetUDPListener(udpListener)
+		log.Printf("UDP ingest listener started on port %d", cfg.UDPPort)
+	}
+
+	// Опциональные потоковые listener'ы (TCP и Unix сокет)
+	var streamListeners []*ingest.StreamListener
+	if cfg.TCPPort > 0 {
+		streamListeners = append(streamListeners, ingest.NewStreamListener(ingestHandler.Pipeline(), ingest.StreamConfig{
+			Network:     "tcp",
+			Addr:        fmt.Sprintf(":%d", cfg.TCPPort),
+			AckInterval: cfg.StreamAckInterval,
+			Auth:        authenticator,
+		}))
+	}
+	if cfg.UnixSocket != "" {
+		streamListeners = append(streamListeners, ingest.NewStreamListener(ingestHandler.Pipeline(), ingest.StreamConfig{
+			Network:     "unix",
+			Addr:        cfg.UnixSocket,
+			AckInterval: cfg.StreamAckInterval,
+			Auth:        authenticator,
+		}))
+	}
+	for _, l := range streamListeners {
+		if err := l.Start(context.Background()); err != nil {
+			log.Fatalf("Failed to start %s stream listener: %v", l.Network(), err)
+		}
+		ingestHandler.AddStreamListener(l)
+		log.Printf("%s stream ingest listener started on %s", l.Network(), l.Addr())
+	}
+
 	// Настройка HTTP роутинга
 	mux := http.NewServeMux()
 
+	// Чтение требует read токен (если аутентификация включена);
+	// ingest endpoints проверяют ingest токен сами
+	read := func(h http.HandlerFunc) http.HandlerFunc {
+		return authenticator.Require(auth.RoleRead, h)
+	}
+	// Изменение состояния сервера требует admin токен, чтение - read
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		readHandler := read(h)
+		adminHandler := authenticator.Require(auth.RoleAdmin, h)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				readHandler(w, r)
+				return
+			}
+			adminHandler(w, r)
+		}
+	}
+
 	// Ingest endpoint
 	mux.HandleFunc("/api/ingest", ingestHandler.HandleIngest)
+	mux.HandleFunc("/api/ingest/stats", read(ingestHandler.HandleStats))
 
 	// API endpoints (Phase 1 - live)
-	mux.HandleFunc("/api/runs", httpHandler.HandleRuns)
-	mux.HandleFunc("/api/run", httpHandler.HandleRun)
+	mux.HandleFunc("/api/runs", read(httpHandler.HandleRuns))
+	mux.HandleFunc("/api/run", read(httpHandler.HandleRun))
+	mux.HandleFunc("/api/run/pin", admin(httpHandler.HandlePin))
+	mux.HandleFunc("/api/schemas", read(httpHandler.HandleSchemas))
+	mux.HandleFunc("/api/buffer/stats", read(httpHandler.HandleBufferStats))
 	mux.HandleFunc("/api/health", httpHandler.HandleHealth)
+	mux.HandleFunc("/api/eventbus/subscriptions", read(eventBusHandler.HandleSubscriptions))
 
 	// Analysis API endpoints (Phase 3 - post-run)
 	if analysisHandler != nil {
-		mux.HandleFunc("/api/analysis/runs", analysisHandler.HandleRuns)
-		mux.HandleFunc("/api/analysis/run/", analysisHandler.HandleRun)
-		mux.HandleFunc("/api/analysis/series", analysisHandler.HandleSeries)
-		mux.HandleFunc("/api/analysis/compare", analysisHandler.HandleCompare)
-		mux.HandleFunc("/api/analysis/query", analysisHandler.HandleQuery)
+		mux.HandleFunc("/api/analysis/runs", read(analysisHandler.HandleRuns))
+		mux.HandleFunc("/api/analysis/run/", read(analysisHandler.HandleRun))
+		mux.HandleFunc("/api/analysis/series", read(analysisHandler.HandleSeries))
+		mux.HandleFunc("/api/analysis/compare", read(analysisHandler.HandleCompare))
+		mux.HandleFunc("/api/analysis/query", read(analysisHandler.HandleQuery))
 		log.Printf("Analysis API endpoints registered")
 	}
 
-	// WebSocket endpoint
-	mux.HandleFunc("/ws", wsHandler.HandleWebSocket)
+	// Dead-letter endpoints
+	if deadLetters != nil {
+		deadLetterHandler := api.NewDeadLetterHandler(deadLetters)
+		mux.HandleFunc("/api/deadletter", read(deadLetterHandler.HandleList))
+		mux.HandleFunc("/api/deadletter/entries", read(deadLetterHandler.HandleEntries))
+		mux.HandleFunc("/api/deadletter/download", read(deadLetterHandler.HandleDownload))
+	}
+
+	// Bridge endpoints
+	if len(bridges) > 0 {
+		mux.HandleFunc("/api/bridges", read(api.NewBridgeHandler(bridges).HandleBridges))
+	}
+
+	// WebSocket endpoints
+	mux.HandleFunc("/ws", read(wsHandler.HandleWebSocket))
+	mux.HandleFunc("/ws/ingest", ingestHandler.HandleWebSocket)
 
 	// Создание HTTP сервера
 	server := &http.Server{
@@ -141,6 +339,30 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
+	// Остановка UDP listener (если был запущен)
+	if udpListener != nil {
+		if err := udpListener.Stop(shutdownCtx); err != nil {
+			log.Printf("UDP listener stop error: %v", err)
+		}
+	}
+
+	// Остановка потоковых listener'ов
+	for _, l := range streamListeners {
+		if err := l.Stop(shutdownCtx); err != nil {
+			log.Printf("%s stream listener stop error: %v", l.Network(), err)
+		}
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	// Источники событий остановлены: EventBus доставляет остаток очередей
+	// шардов и закрывает подписки, batcher и bridge'и получают хвост
+	if err := bus.Close(); err != nil {
+		log.Printf("EventBus close error: %v", err)
+	}
+
 	// Остановка Batcher (если был запущен)
 	if batcher != nil {
 		log.Println("Stopping batcher...")
@@ -149,8 +371,16 @@ func main() {
 		}
 	}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+	// Остановка bridge'ей
+	for _, b := range bridges {
+		if err := b.Stop(shutdownCtx); err != nil {
+			log.Printf("Bridge %s stop error: %v", b.Name(), err)
+		}
+	}
+
+	// Закрытие dead-letter хранилища после остановки всех писателей
+	if err := deadLetters.Close(); err != nil {
+		log.Printf("Dead-letter store close error: %v", err)
 	}
 
 	log.Println("Server stopped")
@@ -2,4 +2,7 @@ module github.com/teltel/teltel
 
 go 1.25.6
 
-require github.com/gorilla/websocket v1.5.3
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.20.1
+)
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/teltel/teltel/internal/bridge"
+)
+
+// BridgeHandler обрабатывает HTTP запросы к состоянию bridge'ей.
+type BridgeHandler struct {
+	bridges []*bridge.Bridge
+}
+
+// NewBridgeHandler создаёт новый bridge handler.
+func NewBridgeHandler(bridges []*bridge.Bridge) *BridgeHandler {
+	return &BridgeHandler{
+		bridges: bridges,
+	}
+}
+
+// HandleBridges возвращает статистику bridge'ей.
+// GET /api/bridges
+func (h *BridgeHandler) HandleBridges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := make([]bridge.Stats, 0, len(h.bridges))
+	for _, b := range h.bridges {
+		stats = append(stats, b.Stats())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/teltel/teltel/internal/deadletter"
+)
+
+const (
+	// defaultDeadLetterLimit - количество записей в ответе по умолчанию
+	defaultDeadLetterLimit = 100
+
+	// maxDeadLetterLimit - максимальное количество записей в ответе
+	maxDeadLetterLimit = 1000
+)
+
+// errStopReading прекращает чтение записей после заполнения страницы.
+var errStopReading = errors.New("stop reading")
+
+// DeadLetterHandler обрабатывает HTTP запросы к dead-letter хранилищу.
+type DeadLetterHandler struct {
+	store *deadletter.Store
+}
+
+// NewDeadLetterHandler создаёт новый dead-letter handler.
+func NewDeadLetterHandler(store *deadletter.Store) *DeadLetterHandler {
+	return &DeadLetterHandler{
+		store: store,
+	}
+}
+
+// DeadLetterInfo - ответ GET /api/deadletter.
+type DeadLetterInfo struct {
+	Stats deadletter.Stats      `json:"stats"`
+	Files []deadletter.FileInfo `json:"files"`
+}
+
+// DeadLetterEntries - ответ GET /api/deadletter/entries.
+type DeadLetterEntries struct {
+	File    string             `json:"file"`
+	Offset  int                `json:"offset"`
+	Entries []deadletter.Entry `json:"entries"`
+
+	// More - true, если после страницы есть ещё записи
+	More bool `json:"more"`
+}
+
+// HandleList возвращает статистику и список dead-letter файлов.
+// GET /api/deadletter
+func (h *DeadLetterHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, err := h.store.Files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeadLetterInfo{
+		Stats: h.store.Stats(),
+		Files: files,
+	})
+}
+
+// HandleEntries возвращает записи dead-letter файла.
+// GET /api/deadletter/entries
+// Query params:
+//   - file: имя файла (обязательно)
+//   - reason, origin: фильтры по причине и источнику (опционально)
+//   - offset: количество пропускаемых записей после фильтрации (по умолчанию 0)
+//   - limit: количество записей (по умолчанию 100, максимум 1000)
+func (h *DeadLetterHandler) HandleEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), defaultDeadLetterLimit)
+	if err != nil || limit < 1 {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+	if limit > maxDeadLetterLimit {
+		limit = maxDeadLetterLimit
+	}
+
+	name := query.Get("file")
+	f, ok := h.openFile(w, name)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	reason, origin := query.Get("reason"), query.Get("origin")
+	result := DeadLetterEntries{
+		File:    name,
+		Offset:  offset,
+		Entries: make([]deadletter.Entry, 0),
+	}
+	skipped := 0
+	err = deadletter.ReadEntries(f, func(entry deadletter.Entry) error {
+		if (reason != "" && entry.Reason != reason) || (origin != "" && entry.Origin != origin) {
+			return nil
+		}
+		if skipped < offset {
+			skipped++
+			return nil
+		}
+		if len(result.Entries) == limit {
+			result.More = true
+			return errStopReading
+		}
+		result.Entries = append(result.Entries, entry)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopReading) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleDownload отдаёт dead-letter файл целиком (NDJSON).
+// GET /api/deadletter/download?file=...
+func (h *DeadLetterHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("file")
+	f, ok := h.openFile(w, name)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	io.Copy(w, f)
+}
+
+// openFile открывает файл хранилища, отвечая ошибкой клиенту при неудаче.
+func (h *DeadLetterHandler) openFile(w http.ResponseWriter, name string) (*os.File, bool) {
+	if name == "" {
+		http.Error(w, "Missing file parameter", http.StatusBadRequest)
+		return nil, false
+	}
+	f, err := h.store.OpenFile(name)
+	switch {
+	case errors.Is(err, deadletter.ErrInvalidFileName):
+		http.Error(w, "Invalid file parameter", http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "File not found", http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return f, true
+}
+
+// queryInt разбирает целочисленный query параметр со значением по умолчанию.
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
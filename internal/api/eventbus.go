@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
+)
+
+// EventBusHandler обрабатывает HTTP запросы к состоянию EventBus.
+type EventBusHandler struct {
+	bus eventbus.EventBus
+	log *eventlog.Log
+}
+
+// NewEventBusHandler создаёт новый EventBus handler.
+func NewEventBusHandler(bus eventbus.EventBus) *EventBusHandler {
+	return &EventBusHandler{
+		bus: bus,
+	}
+}
+
+// SetEventLog подключает журнал событий для вывода его статистики.
+func (h *EventBusHandler) SetEventLog(log *eventlog.Log) {
+	h.log = log
+}
+
+// EventBusInfo - ответ GET /api/eventbus/subscriptions.
+type EventBusInfo struct {
+	Stats         eventbus.BusStats           `json:"stats"`
+	Subscriptions []eventbus.SubscriptionInfo `json:"subscriptions"`
+
+	// Log - статистика журнала событий и позиции durable подписок
+	// (если журнал включён)
+	Log *eventlog.Stats `json:"log,omitempty"`
+}
+
+// HandleSubscriptions возвращает статистику EventBus и активные подписки.
+// GET /api/eventbus/subscriptions
+func (h *EventBusHandler) HandleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := EventBusInfo{
+		Stats:         h.bus.Stats(),
+		Subscriptions: h.bus.Subscriptions(),
+	}
+	if h.log != nil {
+		stats := h.log.Stats()
+		info.Log = &stats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -6,11 +6,21 @@ import (
 	"time"
 
 	"github.com/teltel/teltel/internal/buffer"
+	"github.com/teltel/teltel/internal/ingest"
+	"github.com/teltel/teltel/internal/schema"
 )
 
+// SequenceSource предоставляет состояние seq по источникам run'а.
+// Реализуется ingest.Pipeline.
+type SequenceSource interface {
+	RunSequences(runID string) []ingest.SourceSequence
+}
+
 // HTTPHandler обрабатывает HTTP запросы для API.
 type HTTPHandler struct {
 	bufferManager *buffer.Manager
+	sequences     SequenceSource
+	schemas       *schema.Registry
 }
 
 // NewHTTPHandler создаёт новый HTTP handler.
@@ -20,12 +30,35 @@ func NewHTTPHandler(bufferManager *buffer.Manager) *HTTPHandler {
 	}
 }
 
+// SetSequenceSource подключает источник состояния seq для /api/run.
+func (h *HTTPHandler) SetSequenceSource(src SequenceSource) {
+	h.sequences = src
+}
+
+// SetSchemaRegistry подключает реестр схем payload для /api/schemas.
+func (h *HTTPHandler) SetSchemaRegistry(registry *schema.Registry) {
+	h.schemas = registry
+}
+
 // RunInfo представляет метаданные run'а.
 type RunInfo struct {
 	RunID    string    `json:"runId"`
 	SourceID string    `json:"sourceId,omitempty"`
 	Size     int       `json:"size"`     // количество событий в buffer
-	Created  time.Time `json:"created"` // время создания (упрощённо)
+	Created  time.Time `json:"created"` // время первого события в buffer
+
+	// LastEvent - время последнего события run'а
+	LastEvent time.Time `json:"lastEvent"`
+
+	// Ended - получено событие run.end
+	Ended bool `json:"ended"`
+
+	// Pinned - run закреплён и не удаляется из Live Buffer
+	Pinned bool `json:"pinned"`
+
+	// Sequences - дубликаты и пропуски seq по источникам (только /api/run,
+	// если события run'а содержат seq)
+	Sequences []ingest.SourceSequence `json:"sequences,omitempty"`
 }
 
 // HandleRuns возвращает список всех run'ов.
@@ -51,12 +84,13 @@ func (h *HTTPHandler) HandleRuns(w http.ResponseWriter, r *http.Request) {
 			sourceID = events[0].SourceID
 		}
 
-		runInfos = append(runInfos, RunInfo{
+		runInfo := RunInfo{
 			RunID:    runID,
 			SourceID: sourceID,
 			Size:     buf.Size(),
-			Created:  time.Now(), // В Phase 1 упрощённо
-		})
+		}
+		h.setActivity(&runInfo)
+		runInfos = append(runInfos, runInfo)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -92,13 +126,90 @@ func (h *HTTPHandler) HandleRun(w http.ResponseWriter, r *http.Request) {
 		RunID:    runID,
 		SourceID: sourceID,
 		Size:     buf.Size(),
-		Created:  time.Now(),
+	}
+	h.setActivity(&runInfo)
+	if h.sequences != nil {
+		runInfo.Sequences = h.sequences.RunSequences(runID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(runInfo)
 }
 
+// setActivity заполняет время первого и последнего события run'а.
+func (h *HTTPHandler) setActivity(info *RunInfo) {
+	if activity, ok := h.bufferManager.GetActivity(info.RunID); ok {
+		info.Created = activity.Created
+		info.LastEvent = activity.LastEvent
+		info.Ended = activity.Ended
+	}
+	info.Pinned = h.bufferManager.IsPinned(info.RunID)
+}
+
+// HandlePin возвращает признак закрепления run'а в Live Buffer (GET),
+// закрепляет run (POST) или снимает закрепление (DELETE). Закреплённый
+// run не удаляется при MaxRuns и по TTL; если закреплено MaxRuns run'ов,
+// POST возвращает 409.
+// GET|POST|DELETE /api/run/pin?runId=...
+func (h *HTTPHandler) HandlePin(w http.ResponseWriter, r *http.Request) {
+	runID := r.URL.Query().Get("runId")
+	if runID == "" {
+		http.Error(w, "Missing runId parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := h.bufferManager.Pin(runID); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	case http.MethodDelete:
+		h.bufferManager.Unpin(runID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runId":  runID,
+		"pinned": h.bufferManager.IsPinned(runID),
+	})
+}
+
+// HandleBufferStats возвращает статистику Live Buffer.
+// GET /api/buffer/stats
+func (h *HTTPHandler) HandleBufferStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.bufferManager.Stats())
+}
+
+// HandleSchemas возвращает зарегистрированные схемы payload и пути к их
+// полям (jsonPath для /api/analysis/series).
+// Параметры sourceId и type фильтруют список; без реестра список пуст.
+func (h *HTTPHandler) HandleSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	schemas := []schema.Info{}
+	if h.schemas != nil {
+		query := r.URL.Query()
+		schemas = h.schemas.List(query.Get("sourceId"), query.Get("type"))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schemas)
+}
+
 // HandleHealth возвращает health check статус.
 func (h *HTTPHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/teltel/teltel/internal/event"
 	"github.com/teltel/teltel/internal/eventbus"
 )
 
@@ -21,11 +25,20 @@ const (
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 512
+
+	// Maximum close frame reason length (control frame payload limit minus status code)
+	maxCloseReason = 123
 )
 
+// WSSubprotocolMsgPack - subprotocol, при согласовании которого события
+// отправляются клиенту бинарными фреймами в формате MessagePack.
+// Без subprotocol события отправляются текстовыми фреймами в JSON.
+const WSSubprotocolMsgPack = "teltel.msgpack"
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{WSSubprotocolMsgPack},
 	CheckOrigin: func(r *http.Request) bool {
 		// В Phase 1 разрешаем все origin (локальный сервис)
 		return true
@@ -51,10 +64,31 @@ type WSRequest struct {
 	Channel  string            `json:"channel,omitempty"`
 	Types    []string          `json:"types,omitempty"`
 	Tags     map[string]string `json:"tags,omitempty"`
+
+	// Glob и regex шаблоны полей (см. eventbus.Filter)
+	RunIDGlob     string `json:"runIdGlob,omitempty"`
+	RunIDRegex    string `json:"runIdRegex,omitempty"`
+	SourceIDGlob  string `json:"sourceIdGlob,omitempty"`
+	SourceIDRegex string `json:"sourceIdRegex,omitempty"`
+	ChannelGlob   string `json:"channelGlob,omitempty"`
+	ChannelRegex  string `json:"channelRegex,omitempty"`
+	TypeGlob      string `json:"typeGlob,omitempty"`
+	TypeRegex     string `json:"typeRegex,omitempty"`
+
+	// Filter - выражение над полями, тегами и payload (см. eventbus.CompileExpr)
+	Filter string `json:"filter,omitempty"`
+
+	// Policy - политика очереди клиента: drop_old (по умолчанию) или
+	// coalesce (только последнее событие по ключу CoalesceKey)
+	Policy      eventbus.BackpressurePolicy `json:"policy,omitempty"`
+	CoalesceKey []string                    `json:"coalesceKey,omitempty"`
+
+	// Sampling - прореживание событий до очереди клиента (см. eventbus.Sampling)
+	Sampling *eventbus.Sampling `json:"sampling,omitempty"`
 }
 
 // HandleWebSocket обрабатывает WebSocket подключение.
-// Один клиент = одна EventBus подписка с policy drop_old.
+// Один клиент = одна EventBus подписка с policy drop_old или coalesce.
 func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -72,21 +106,49 @@ func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Создаём фильтр из запроса
 	filter := eventbus.Filter{
-		RunID:    req.RunID,
-		SourceID: req.SourceID,
-		Channel:  req.Channel,
-		Types:    req.Types,
-		TagsAll:  req.Tags,
+		RunID:         req.RunID,
+		RunIDGlob:     req.RunIDGlob,
+		RunIDRegex:    req.RunIDRegex,
+		SourceID:      req.SourceID,
+		SourceIDGlob:  req.SourceIDGlob,
+		SourceIDRegex: req.SourceIDRegex,
+		Channel:       req.Channel,
+		ChannelGlob:   req.ChannelGlob,
+		ChannelRegex:  req.ChannelRegex,
+		Types:         req.Types,
+		TypeGlob:      req.TypeGlob,
+		TypeRegex:     req.TypeRegex,
+		TagsAll:       req.Tags,
+		Expr:          req.Filter,
 	}
 
-	// Создаём подписку с policy drop_old
+	// Создаём подписку с policy drop_old (по умолчанию) или coalesce.
+	// Политики block и drop_new не допускаются: медленный браузер не должен
+	// тормозить ingest или терять свежие события
 	opt := eventbus.SubscriptionOptions{
 		BufferSize: 2048,
-		Policy:     eventbus.BackpressureDropOld, // всегда drop_old для UI
+		Policy:     eventbus.BackpressureDropOld,
 		Name:       "websocket-client",
 	}
+	if req.Sampling != nil {
+		opt.Sampling = *req.Sampling
+	}
+	switch req.Policy {
+	case "", eventbus.BackpressureDropOld:
+	case eventbus.BackpressureCoalesce:
+		opt.Policy = eventbus.BackpressureCoalesce
+		opt.CoalesceKey = req.CoalesceKey
+	default:
+		closeWithReason(conn, fmt.Errorf("%w: unsupported policy %q", eventbus.ErrInvalidOptions, req.Policy))
+		return
+	}
 
 	sub, err := h.bus.Subscribe(r.Context(), filter, opt)
+	if errors.Is(err, eventbus.ErrInvalidFilter) || errors.Is(err, eventbus.ErrInvalidOptions) {
+		// Сообщаем клиенту причину: ошибка в фильтре или параметрах подписки
+		closeWithReason(conn, err)
+		return
+	}
 	if err != nil {
 		log.Printf("EventBus subscribe error: %v", err)
 		return
@@ -126,6 +188,9 @@ func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// Формат событий определяется согласованным subprotocol
+	binary := conn.Subprotocol() == WSSubprotocolMsgPack
+
 	// Отправляем события из подписки
 	for {
 		select {
@@ -136,7 +201,7 @@ func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			}
 
 			conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := conn.WriteJSON(event); err != nil {
+			if err := writeEvent(conn, event, binary); err != nil {
 				log.Printf("WebSocket write error: %v", err)
 				return
 			}
@@ -155,3 +220,22 @@ func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// closeWithReason закрывает соединение с кодом policy violation и текстом ошибки.
+func closeWithReason(conn *websocket.Conn, err error) {
+	reason := err.Error()
+	if len(reason) > maxCloseReason {
+		reason = strings.ToValidUTF8(reason[:maxCloseReason], "")
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason),
+		time.Now().Add(writeWait))
+}
+
+// writeEvent отправляет событие клиенту в JSON или MessagePack.
+func writeEvent(conn *websocket.Conn, e *event.Event, binary bool) error {
+	if binary {
+		return conn.WriteMessage(websocket.BinaryMessage, event.MarshalMsgPack(e))
+	}
+	return conn.WriteJSON(e)
+}
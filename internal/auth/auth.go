@@ -0,0 +1,224 @@
+// Package auth реализует аутентификацию по токенам для ingest и API.
+//
+// Токены загружаются из JSON файла. Токен класса ingest разрешает
+// запись событий только для перечисленных sourceId; токен класса read
+// разрешает только чтение (/api/*, /ws). Если Authenticator не задан
+// (nil), аутентификация выключена и все запросы разрешены.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role - класс токена.
+type Role string
+
+const (
+	// RoleIngest - запись событий для разрешённых sourceId
+	RoleIngest Role = "ingest"
+
+	// RoleRead - только чтение (/api/*, /ws)
+	RoleRead Role = "read"
+
+	// RoleAdmin - управление состоянием сервера (закрепление run'ов)
+	RoleAdmin Role = "admin"
+)
+
+// AllSources в списке sources разрешает запись для любого sourceId.
+const AllSources = "*"
+
+var (
+	ErrUnauthorized    = errors.New("auth: missing or invalid token")
+	ErrForbidden       = errors.New("auth: token class does not permit this operation")
+	ErrSourceForbidden = errors.New("auth: token is not allowed to write this sourceId")
+)
+
+// TokenConfig описывает один токен в файле конфигурации.
+type TokenConfig struct {
+	// Token - секрет, передаваемый клиентом
+	Token string `json:"token"`
+
+	// Name - имя токена для логов и статистики (опционально)
+	Name string `json:"name,omitempty"`
+
+	// Role - класс токена: "ingest", "read" или "admin"
+	Role Role `json:"role"`
+
+	// Sources - sourceId, в которые разрешена запись ("*" = любые).
+	// Обязательно для ingest, игнорируется для read и admin.
+	Sources []string `json:"sources,omitempty"`
+}
+
+// FileConfig - формат файла токенов.
+//
+//	{
+//	  "tokens": [
+//	    {"name": "flight", "token": "s3cret", "role": "ingest", "sources": ["flight-engine"]},
+//	    {"name": "ui", "token": "r3ad", "role": "read"},
+//	    {"name": "ops", "token": "4dm1n", "role": "admin"}
+//	  ]
+//	}
+type FileConfig struct {
+	Tokens []TokenConfig `json:"tokens"`
+}
+
+// Token - проверенный токен клиента.
+// nil *Token означает, что аутентификация выключена, и разрешает всё.
+type Token struct {
+	Name string
+	Role Role
+
+	sources    map[string]struct{}
+	allSources bool
+}
+
+// AllowsSource сообщает, разрешена ли токену запись событий sourceID.
+func (t *Token) AllowsSource(sourceID string) bool {
+	if t == nil {
+		return true
+	}
+	if t.Role != RoleIngest {
+		return false
+	}
+	if t.allSources {
+		return true
+	}
+	_, ok := t.sources[sourceID]
+	return ok
+}
+
+// Authenticator проверяет токены.
+// Токены хранятся по SHA-256, чтобы поиск не зависел от содержимого секрета.
+type Authenticator struct {
+	tokens map[[sha256.Size]byte]*Token
+}
+
+// New создаёт Authenticator из конфигурации.
+func New(config FileConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens: make(map[[sha256.Size]byte]*Token, len(config.Tokens)),
+	}
+
+	for i, tc := range config.Tokens {
+		if tc.Token == "" {
+			return nil, fmt.Errorf("token %d: empty token", i)
+		}
+		name := tc.Name
+		if name == "" {
+			name = fmt.Sprintf("token-%d", i)
+		}
+
+		t := &Token{Name: name, Role: tc.Role}
+		switch tc.Role {
+		case RoleIngest:
+			if len(tc.Sources) == 0 {
+				return nil, fmt.Errorf("token %q: ingest token requires sources", name)
+			}
+			t.sources = make(map[string]struct{}, len(tc.Sources))
+			for _, s := range tc.Sources {
+				if s == AllSources {
+					t.allSources = true
+				}
+				t.sources[s] = struct{}{}
+			}
+		case RoleRead, RoleAdmin:
+		default:
+			return nil, fmt.Errorf("token %q: unknown role %q", name, tc.Role)
+		}
+
+		key := sha256.Sum256([]byte(tc.Token))
+		if _, exists := a.tokens[key]; exists {
+			return nil, fmt.Errorf("token %q: duplicate token", name)
+		}
+		a.tokens[key] = t
+	}
+
+	return a, nil
+}
+
+// LoadFile загружает Authenticator из JSON файла токенов.
+func LoadFile(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	var config FileConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens file: %w", err)
+	}
+
+	return New(config)
+}
+
+// Check проверяет токен и его класс.
+// Для nil Authenticator возвращает (nil, nil) - аутентификация выключена.
+func (a *Authenticator) Check(token string, role Role) (*Token, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+
+	t, ok := a.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if t.Role != role {
+		return nil, ErrForbidden
+	}
+	return t, nil
+}
+
+// Authenticate проверяет токен HTTP запроса (см. TokenFromRequest).
+func (a *Authenticator) Authenticate(r *http.Request, role Role) (*Token, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return a.Check(TokenFromRequest(r), role)
+}
+
+// Require оборачивает handler проверкой токена класса role.
+// Для nil Authenticator handler возвращается без изменений.
+func (a *Authenticator) Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.Authenticate(r, role); err != nil {
+			WriteError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// TokenFromRequest извлекает токен из заголовка "Authorization: Bearer <token>"
+// или, для WebSocket клиентов в браузере, из query параметра token.
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+// WriteError записывает ответ 401 или 403 для ошибки аутентификации.
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="teltel"`)
+		http.Error(w, "Unauthorized: missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "Forbidden: "+strings.TrimPrefix(err.Error(), "auth: "), http.StatusForbidden)
+}
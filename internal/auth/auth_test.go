@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testConfig - набор токенов для тестов.
+var testConfig = FileConfig{
+	Tokens: []TokenConfig{
+		{Name: "flight", Token: "ingest-flight", Role: RoleIngest, Sources: []string{"flight-engine"}},
+		{Name: "any", Token: "ingest-any", Role: RoleIngest, Sources: []string{AllSources}},
+		{Name: "ui", Token: "read-ui", Role: RoleRead},
+		{Name: "ops", Token: "admin-ops", Role: RoleAdmin},
+	},
+}
+
+// TestAuthenticator_Check проверяет проверку токенов и классов.
+func TestAuthenticator_Check(t *testing.T) {
+	a, err := New(testConfig)
+	if err != nil {
+		t.Fatalf("New() вернула ошибку: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		role    Role
+		wantErr error
+	}{
+		{"ingest токен для ingest", "ingest-flight", RoleIngest, nil},
+		{"read токен для чтения", "read-ui", RoleRead, nil},
+		{"ingest токен для чтения → ErrForbidden", "ingest-flight", RoleRead, ErrForbidden},
+		{"read токен для ingest → ErrForbidden", "read-ui", RoleIngest, ErrForbidden},
+		{"admin токен для управления", "admin-ops", RoleAdmin, nil},
+		{"read токен для управления → ErrForbidden", "read-ui", RoleAdmin, ErrForbidden},
+		{"неизвестный токен → ErrUnauthorized", "nope", RoleRead, ErrUnauthorized},
+		{"пустой токен → ErrUnauthorized", "", RoleIngest, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := a.Check(tt.token, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() = %v, ожидалась %v", err, tt.wantErr)
+			}
+			if err == nil && tok.Role != tt.role {
+				t.Errorf("Role = %q, ожидался %q", tok.Role, tt.role)
+			}
+		})
+	}
+
+	t.Run("ограничение по sourceId", func(t *testing.T) {
+		flight, _ := a.Check("ingest-flight", RoleIngest)
+		if !flight.AllowsSource("flight-engine") || flight.AllowsSource("drive-engine") {
+			t.Error("токен flight должен разрешать только flight-engine")
+		}
+		anySource, _ := a.Check("ingest-any", RoleIngest)
+		if !anySource.AllowsSource("drive-engine") {
+			t.Error("токен с \"*\" должен разрешать любой sourceId")
+		}
+		read, _ := a.Check("read-ui", RoleRead)
+		if read.AllowsSource("flight-engine") {
+			t.Error("read токен не должен разрешать запись")
+		}
+	})
+
+	t.Run("nil Authenticator разрешает всё", func(t *testing.T) {
+		var disabled *Authenticator
+		tok, err := disabled.Check("", RoleIngest)
+		if err != nil || tok != nil {
+			t.Fatalf("Check() = (%v, %v), ожидалось (nil, nil)", tok, err)
+		}
+		if !tok.AllowsSource("any") {
+			t.Error("nil токен должен разрешать любой sourceId")
+		}
+	})
+}
+
+// TestNew_InvalidConfig проверяет ошибки конфигурации токенов.
+func TestNew_InvalidConfig(t *testing.T) {
+	configs := map[string]FileConfig{
+		"пустой токен":        {Tokens: []TokenConfig{{Role: RoleRead}}},
+		"ingest без sources":  {Tokens: []TokenConfig{{Token: "t", Role: RoleIngest}}},
+		"неизвестная роль":    {Tokens: []TokenConfig{{Token: "t", Role: "root"}}},
+		"повторяющийся токен": {Tokens: []TokenConfig{{Token: "t", Role: RoleRead}, {Token: "t", Role: RoleRead}}},
+	}
+	for name, config := range configs {
+		if _, err := New(config); err == nil {
+			t.Errorf("%s: ожидалась ошибка", name)
+		}
+	}
+}
+
+// TestLoadFile проверяет загрузку токенов из файла.
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	data := `{"tokens":[{"token":"s3cret","role":"ingest","sources":["flight-engine"]}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() вернула ошибку: %v", err)
+	}
+	if _, err := a.Check("s3cret", RoleIngest); err != nil {
+		t.Errorf("Check() вернула ошибку: %v", err)
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("ожидалась ошибка для отсутствующего файла")
+	}
+}
+
+// TestRequire проверяет HTTP middleware.
+func TestRequire(t *testing.T) {
+	a, _ := New(testConfig)
+	handler := a.Require(RoleRead, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		target string
+		want   int
+	}{
+		{"без токена → 401", func(r *http.Request) {}, "/api/runs", http.StatusUnauthorized},
+		{"Bearer read токен → 200", func(r *http.Request) { r.Header.Set("Authorization", "Bearer read-ui") }, "/api/runs", http.StatusOK},
+		{"токен в query → 200", func(r *http.Request) {}, "/ws?token=read-ui", http.StatusOK},
+		{"ingest токен → 403", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ingest-any") }, "/api/runs", http.StatusForbidden},
+		{"другая схема → 401", func(r *http.Request) { r.Header.Set("Authorization", "Basic read-ui") }, "/api/runs", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("статус = %d, ожидался %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("для 401 ожидался заголовок WWW-Authenticate")
+			}
+		})
+	}
+}
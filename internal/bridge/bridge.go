@@ -0,0 +1,674 @@
+// Package bridge пересылает события EventBus одного экземпляра teltel
+// в потоковый ingest (TCP / Unix сокет) другого экземпляра.
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// OriginTag - тег с идентификатором экземпляра, на котором событие было
+// принято. Bridge добавляет его к пересылаемым событиям и не пересылает
+// события с чужим origin, поэтому встречные bridge'и не образуют петель.
+const OriginTag = "teltel.origin"
+
+const (
+	// DefaultMaxPending - количество неподтверждённых событий по умолчанию
+	DefaultMaxPending = 65536
+
+	// defaultBufferSize - размер очереди подписки по умолчанию
+	defaultBufferSize = 4096
+
+	// defaultDialTimeout - таймаут подключения по умолчанию
+	defaultDialTimeout = 5 * time.Second
+
+	// defaultWriteTimeout - таймаут записи в соединение по умолчанию
+	defaultWriteTimeout = 10 * time.Second
+
+	// defaultAckTimeout - время ожидания ack строки при неподтверждённых
+	// событиях по умолчанию
+	defaultAckTimeout = 30 * time.Second
+
+	// defaultMinBackoff, defaultMaxBackoff - пауза перед переподключением
+	// (удваивается после каждой неудачи)
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+
+	// sendBatchSize - событий, записываемых в соединение между flush
+	sendBatchSize = 256
+)
+
+// ErrInvalidConfig - некорректная конфигурация bridge'а.
+var ErrInvalidConfig = errors.New("bridge: invalid config")
+
+// Config определяет параметры bridge'а.
+type Config struct {
+	// Name - имя bridge'а в статистике и имени подписки
+	Name string `json:"name"`
+
+	// Network - "tcp" (по умолчанию) или "unix"
+	Network string `json:"network,omitempty"`
+
+	// Addr - адрес потокового ingest удалённого экземпляра
+	// (-tcp-port или -unix-socket). Удалённый экземпляр должен отправлять
+	// ack строки (-stream-ack-interval), иначе соединение разрывается
+	// по AckTimeout.
+	Addr string `json:"addr"`
+
+	// Token - ingest токен удалённого экземпляра. Задаётся, только если
+	// там включена аутентификация: иначе строка токена считается
+	// отклонённым событием и сдвигает подтверждения
+	Token string `json:"token,omitempty"`
+
+	// Filter - события локального EventBus, которые пересылаются
+	Filter eventbus.Filter `json:"filter"`
+
+	// Origin - идентификатор локального экземпляра для OriginTag
+	Origin string `json:"-"`
+
+	// MaxPending - максимальное количество событий, ожидающих подтверждения;
+	// при переполнении отбрасываются самые старые (0 = DefaultMaxPending)
+	MaxPending int `json:"maxPending,omitempty"`
+
+	// BufferSize - размер очереди подписки на EventBus (0 = 4096)
+	BufferSize int `json:"bufferSize,omitempty"`
+
+	// DialTimeout, WriteTimeout, MinBackoff, MaxBackoff - таймауты
+	// соединения и пауза перед переподключением (0 = по умолчанию)
+	DialTimeout  time.Duration `json:"-"`
+	WriteTimeout time.Duration `json:"-"`
+	MinBackoff   time.Duration `json:"-"`
+	MaxBackoff   time.Duration `json:"-"`
+
+	// AckTimeout - время без ack строк при неподтверждённых событиях,
+	// после которого соединение считается неисправным и переподключается
+	// (0 = 30s)
+	AckTimeout time.Duration `json:"-"`
+}
+
+// FileConfig - содержимое файла bridge'ей.
+//
+//	{
+//	  "origin": "bench-3",
+//	  "bridges": [
+//	    {"name": "control-room", "addr": "control:8091", "token": "...", "filter": {"runIdGlob": "bench3-*"}}
+//	  ]
+//	}
+type FileConfig struct {
+	// Origin - идентификатор экземпляра (по умолчанию имя хоста)
+	Origin string `json:"origin,omitempty"`
+
+	Bridges []Config `json:"bridges"`
+}
+
+// LoadFile загружает конфигурацию bridge'ей из JSON файла.
+func LoadFile(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bridges file: %w", err)
+	}
+	var file FileConfig
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse bridges file: %w", err)
+	}
+
+	origin := file.Origin
+	if origin == "" {
+		if origin, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname for origin: %w", err)
+		}
+	}
+
+	names := make(map[string]bool, len(file.Bridges))
+	for i := range file.Bridges {
+		config := &file.Bridges[i]
+		config.Origin = origin
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("bridge %d: %w", i, err)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("bridge %d: %w: duplicate name %q", i, ErrInvalidConfig, config.Name)
+		}
+		names[config.Name] = true
+	}
+	return file.Bridges, nil
+}
+
+func (c *Config) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidConfig)
+	}
+	if c.Addr == "" {
+		return fmt.Errorf("%w: addr is required", ErrInvalidConfig)
+	}
+	if c.Network != "" && c.Network != "tcp" && c.Network != "unix" {
+		return fmt.Errorf("%w: unknown network %q", ErrInvalidConfig, c.Network)
+	}
+	if c.Origin == "" {
+		return fmt.Errorf("%w: origin is required", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Stats содержит статистику bridge'а.
+type Stats struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+
+	// Connected - установлено ли соединение с удалённым экземпляром
+	Connected bool `json:"connected"`
+
+	// Connections - количество установленных соединений
+	// (больше 1 - были переподключения)
+	Connections uint64 `json:"connections"`
+
+	// Received - событий, полученных из локального EventBus
+	Received uint64 `json:"received"`
+
+	// Skipped - событий с чужим origin, которые не пересылаются
+	Skipped uint64 `json:"skipped"`
+
+	// Sent - событий, записанных в соединения (включая повторы)
+	Sent uint64 `json:"sent"`
+
+	// Resent - событий, повторно отправленных после переподключения
+	Resent uint64 `json:"resent"`
+
+	// Acked - событий, подтверждённых удалённым экземпляром
+	Acked uint64 `json:"acked"`
+
+	// Rejected - событий, отклонённых удалённым экземпляром
+	Rejected uint64 `json:"rejected"`
+
+	// Dropped - событий, отброшенных bridge'ем: переполнение MaxPending
+	// и очереди подписки
+	Dropped uint64 `json:"dropped"`
+
+	// Pending - событий, ожидающих отправки или подтверждения
+	Pending int `json:"pending"`
+
+	// LagMs - возраст самого старого неподтверждённого события
+	LagMs int64 `json:"lagMs"`
+
+	// LastError - последняя ошибка соединения
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Bridge подписывается на локальный EventBus и пересылает подходящие
+// события в потоковый ingest другого экземпляра.
+//
+// События хранятся в очереди до подтверждения ack строкой (поле lines):
+// после разрыва соединения bridge переподключается и повторяет
+// неподтверждённые события по порядку (at-least-once; события с seq
+// удалённый ingest дедуплицирует).
+type Bridge struct {
+	bus    eventbus.EventBus
+	config Config
+
+	// Очередь событий, ожидающих подтверждения, упорядочена по seq
+	mu        sync.Mutex
+	pending   []pendingEvent
+	nextSeq   uint64
+	connected bool
+	lastError string
+
+	// wake сигнализирует о новых событиях в очереди и подтверждениях
+	wake chan struct{}
+
+	// Состояние
+	sub     eventbus.Subscription
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+
+	// Статистика
+	connections atomic.Uint64
+	received    atomic.Uint64
+	skipped     atomic.Uint64
+	sent        atomic.Uint64
+	resent      atomic.Uint64
+	acked       atomic.Uint64
+	rejected    atomic.Uint64
+	dropped     atomic.Uint64
+}
+
+// pendingEvent - событие в очереди bridge'а.
+type pendingEvent struct {
+	seq      uint64
+	event    *event.Event
+	received time.Time
+	sent     bool
+}
+
+// New создаёт bridge. Пересылка начинается после Start.
+func New(bus eventbus.EventBus, config Config) (*Bridge, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = DefaultMaxPending
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = defaultAckTimeout
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = max(defaultMaxBackoff, config.MinBackoff)
+	}
+
+	return &Bridge{
+		bus:    bus,
+		config: config,
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Name возвращает имя bridge'а.
+func (b *Bridge) Name() string {
+	return b.config.Name
+}
+
+// Start подписывается на EventBus и начинает пересылку в фоне.
+func (b *Bridge) Start(ctx context.Context) error {
+	if b.started {
+		return fmt.Errorf("bridge %s already started", b.config.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub, err := b.bus.Subscribe(ctx, b.config.Filter, eventbus.SubscriptionOptions{
+		BufferSize: b.config.BufferSize,
+		Policy:     eventbus.BackpressureDropNew,
+		Name:       "bridge:" + b.config.Name,
+	})
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+	if sub == nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe: event bus closed")
+	}
+
+	b.sub = sub
+	b.cancel = cancel
+	b.started = true
+
+	b.wg.Add(2)
+	go b.receiveLoop()
+	go b.connectLoop(ctx)
+
+	return nil
+}
+
+// Stop останавливает пересылку и ждёт завершения goroutine bridge'а.
+// Неподтверждённые события теряются.
+func (b *Bridge) Stop(ctx context.Context) error {
+	if !b.started {
+		return nil
+	}
+	b.cancel()
+	_ = b.sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receiveLoop переносит события из подписки в очередь bridge'а.
+func (b *Bridge) receiveLoop() {
+	defer b.wg.Done()
+
+	for e := range b.sub.C() {
+		b.received.Add(1)
+
+		origin := e.Tags[OriginTag]
+		if origin != "" && origin != b.config.Origin {
+			// Событие пришло с другого экземпляра
+			b.skipped.Add(1)
+			continue
+		}
+		if origin == "" {
+			e = withOrigin(e, b.config.Origin)
+		}
+		b.enqueue(e)
+	}
+}
+
+// withOrigin возвращает копию события с тегом OriginTag. Событие из
+// EventBus общее для всех подписчиков и не изменяется.
+func withOrigin(e *event.Event, origin string) *event.Event {
+	out := *e
+	out.Tags = make(map[string]string, len(e.Tags)+1)
+	for k, v := range e.Tags {
+		out.Tags[k] = v
+	}
+	out.Tags[OriginTag] = origin
+	return &out
+}
+
+// enqueue добавляет событие в очередь, отбрасывая самое старое
+// при переполнении.
+func (b *Bridge) enqueue(e *event.Event) {
+	b.mu.Lock()
+	if len(b.pending) >= b.config.MaxPending {
+		b.pending[0] = pendingEvent{}
+		b.pending = b.pending[1:]
+		b.dropped.Add(1)
+	}
+	b.nextSeq++
+	b.pending = append(b.pending, pendingEvent{seq: b.nextSeq, event: e, received: time.Now()})
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// connectLoop поддерживает соединение с удалённым экземпляром до отмены ctx.
+func (b *Bridge) connectLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	backoff := b.config.MinBackoff
+	for {
+		established, err := b.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.mu.Lock()
+		b.lastError = err.Error()
+		b.mu.Unlock()
+		log.Printf("bridge %s: %v", b.config.Name, err)
+
+		if established {
+			backoff = b.config.MinBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, b.config.MaxBackoff)
+	}
+}
+
+// bridgeConn - состояние ack одного соединения.
+type bridgeConn struct {
+	// sent - seq событий, отправленных в соединение и ещё не подтверждённых
+	sent []uint64
+
+	// lines, rejected - значения из последнего ack
+	lines    uint64
+	rejected uint64
+
+	// lastAck - время последнего ack (или установки соединения)
+	lastAck time.Time
+}
+
+// serve подключается к удалённому экземпляру и пересылает события до
+// ошибки соединения. established - соединение было установлено.
+func (b *Bridge) serve(ctx context.Context) (established bool, err error) {
+	dialer := net.Dialer{Timeout: b.config.DialTimeout}
+	conn, err := dialer.DialContext(ctx, b.config.Network, b.config.Addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	b.connections.Add(1)
+	b.setConnected(true)
+	defer b.setConnected(false)
+
+	w := bufio.NewWriter(conn)
+	if b.config.Token != "" {
+		line, _ := json.Marshal(struct {
+			Token string `json:"token"`
+		}{b.config.Token})
+		w.Write(append(line, '\n'))
+	}
+
+	c := &bridgeConn{lastAck: time.Now()}
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- b.readAcks(conn, c)
+	}()
+
+	// Новое соединение начинает с самого старого неподтверждённого события
+	var lastSent uint64
+	for {
+		batch, last := b.unsent(c, lastSent)
+		if len(batch) == 0 {
+			conn.SetWriteDeadline(time.Now().Add(b.config.WriteTimeout))
+			if err := w.Flush(); err != nil {
+				return true, fmt.Errorf("write failed: %w", err)
+			}
+			// Без ack строк неподтверждённые события заполняют окно
+			// MaxPending, и пересылка останавливается
+			var ackTimeout <-chan time.Time
+			if deadline, ok := b.ackDeadline(c); ok {
+				if time.Until(deadline) <= 0 {
+					return true, fmt.Errorf("no ack within %v (is -stream-ack-interval set on the remote?)", b.config.AckTimeout)
+				}
+				ackTimeout = time.After(time.Until(deadline))
+			}
+			select {
+			case <-b.wake:
+				continue
+			case <-ackTimeout:
+				continue
+			case err := <-readErr:
+				return true, err
+			case <-ctx.Done():
+				return true, ctx.Err()
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(b.config.WriteTimeout))
+		for _, e := range batch {
+			data, err := json.Marshal(e)
+			if err != nil {
+				// Событие из EventBus всегда сериализуется; строка
+				// без события будет отклонена удалённым ingest
+				data = []byte("{}")
+			}
+			w.Write(data)
+			if err := w.WriteByte('\n'); err != nil {
+				return true, fmt.Errorf("write failed: %w", err)
+			}
+		}
+		b.sent.Add(uint64(len(batch)))
+		lastSent = last
+
+		select {
+		case err := <-readErr:
+			return true, err
+		default:
+		}
+	}
+}
+
+// unsent возвращает следующие события очереди после lastSent и seq
+// последнего из них и запоминает их как отправленные в соединение c.
+// Неподтверждённых событий в соединении не больше MaxPending: удалённый
+// экземпляр без ack строк не может бесконечно накапливать c.sent.
+func (b *Bridge) unsent(c *bridgeConn, lastSent uint64) ([]*event.Event, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := sort.Search(len(b.pending), func(i int) bool { return b.pending[i].seq > lastSent })
+	n := min(len(b.pending)-i, sendBatchSize, b.config.MaxPending-len(c.sent))
+	if n <= 0 {
+		return nil, lastSent
+	}
+
+	batch := make([]*event.Event, n)
+	for j := range batch {
+		p := &b.pending[i+j]
+		if p.sent {
+			b.resent.Add(1)
+		}
+		p.sent = true
+		batch[j] = p.event
+		c.sent = append(c.sent, p.seq)
+	}
+	return batch, c.sent[len(c.sent)-1]
+}
+
+// ackDeadline возвращает время, до которого соединение c должно прислать
+// ack; ok = false, если неподтверждённых событий в соединении нет.
+func (b *Bridge) ackDeadline(c *bridgeConn) (deadline time.Time, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(c.sent) == 0 {
+		return time.Time{}, false
+	}
+	return c.lastAck.Add(b.config.AckTimeout), true
+}
+
+// readAcks читает ack строки соединения до ошибки чтения.
+func (b *Bridge) readAcks(conn net.Conn, c *bridgeConn) error {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("connection closed by remote")
+			}
+			return fmt.Errorf("read failed: %w", err)
+		}
+
+		var msg struct {
+			Type     string `json:"type"`
+			Rejected uint64 `json:"rejected"`
+			Lines    uint64 `json:"lines"`
+			Code     int    `json:"code"`
+			Error    string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "ack":
+			b.ack(c, msg.Lines, msg.Rejected)
+		case "error":
+			return fmt.Errorf("remote error %d: %s", msg.Code, msg.Error)
+		}
+	}
+}
+
+// ack удаляет из очереди события, обработанные удалённым экземпляром.
+func (b *Bridge) ack(c *bridgeConn, lines, rejected uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c.lastAck = time.Now()
+	if rejected > c.rejected {
+		b.rejected.Add(rejected - c.rejected)
+		c.rejected = rejected
+	}
+	if lines <= c.lines {
+		return
+	}
+	n := min(lines-c.lines, uint64(len(c.sent)))
+	c.lines = lines
+	if n == 0 {
+		return
+	}
+	last := c.sent[n-1]
+	c.sent = c.sent[n:]
+
+	// События, отброшенные при переполнении, уже удалены из очереди
+	i := sort.Search(len(b.pending), func(i int) bool { return b.pending[i].seq > last })
+	clear(b.pending[:i])
+	b.pending = b.pending[i:]
+	b.acked.Add(uint64(i))
+
+	// Освободилось окно неподтверждённых событий
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bridge) setConnected(connected bool) {
+	b.mu.Lock()
+	b.connected = connected
+	if connected {
+		b.lastError = ""
+	}
+	b.mu.Unlock()
+}
+
+// Stats возвращает статистику bridge'а.
+func (b *Bridge) Stats() Stats {
+	b.mu.Lock()
+	pending := len(b.pending)
+	var lag int64
+	if pending > 0 {
+		lag = time.Since(b.pending[0].received).Milliseconds()
+	}
+	connected := b.connected
+	lastError := b.lastError
+	b.mu.Unlock()
+
+	dropped := b.dropped.Load()
+	if b.sub != nil {
+		dropped += b.sub.Dropped()
+	}
+
+	return Stats{
+		Name:        b.config.Name,
+		Addr:        b.config.Addr,
+		Connected:   connected,
+		Connections: b.connections.Load(),
+		Received:    b.received.Load(),
+		Skipped:     b.skipped.Load(),
+		Sent:        b.sent.Load(),
+		Resent:      b.resent.Load(),
+		Acked:       b.acked.Load(),
+		Rejected:    b.rejected.Load(),
+		Dropped:     dropped,
+		Pending:     pending,
+		LagMs:       lag,
+		LastError:   lastError,
+	}
+}
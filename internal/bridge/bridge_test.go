@@ -0,0 +1,294 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/ingest"
+)
+
+// instance - экземпляр teltel в тесте: EventBus и потоковый ingest.
+type instance struct {
+	bus      eventbus.EventBus
+	pipeline *ingest.Pipeline
+	listener *ingest.StreamListener
+}
+
+// startInstance запускает экземпляр с потоковым ingest на addr.
+func startInstance(t *testing.T, addr string) *instance {
+	t.Helper()
+	bus := eventbus.New()
+	t.Cleanup(func() { bus.Close() })
+
+	in := &instance{bus: bus, pipeline: ingest.NewPipeline(bus, ingest.PipelineConfig{})}
+	in.listen(t, addr)
+	return in
+}
+
+// listen запускает потоковый listener экземпляра.
+func (in *instance) listen(t *testing.T, addr string) {
+	t.Helper()
+	in.listener = ingest.NewStreamListener(in.pipeline, ingest.StreamConfig{
+		Network:     "tcp",
+		Addr:        addr,
+		AckInterval: 10 * time.Millisecond,
+	})
+	if err := in.listener.Start(context.Background()); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	l := in.listener
+	t.Cleanup(func() { l.Stop(context.Background()) })
+}
+
+func (in *instance) addr() string {
+	return in.listener.Addr().String()
+}
+
+// subscribe подписывается на все события экземпляра.
+func (in *instance) subscribe(t *testing.T) eventbus.Subscription {
+	t.Helper()
+	sub, err := in.bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 1000, Policy: eventbus.BackpressureDropNew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sub.Close() })
+	return sub
+}
+
+// startBridge запускает bridge из from в to.
+func startBridge(t *testing.T, from *instance, to string, config Config) *Bridge {
+	t.Helper()
+	config.Addr = to
+	config.MinBackoff = 10 * time.Millisecond
+	config.MaxBackoff = 50 * time.Millisecond
+	b, err := New(from.bus, config)
+	if err != nil {
+		t.Fatalf("New() вернула ошибку: %v", err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { b.Stop(context.Background()) })
+	return b
+}
+
+// publish публикует события run'а с frameIndex from..to-1.
+func publish(t *testing.T, in *instance, runID string, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		e := &event.Event{V: 1, RunID: runID, SourceID: "engine", Type: "body.state", FrameIndex: i, Payload: []byte(`{}`)}
+		if err := in.bus.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receive читает count событий из подписки.
+func receive(t *testing.T, sub eventbus.Subscription, count int) []*event.Event {
+	t.Helper()
+	var events []*event.Event
+	timeout := time.After(5 * time.Second)
+	for len(events) < count {
+		select {
+		case e := <-sub.C():
+			events = append(events, e)
+		case <-timeout:
+			t.Fatalf("получено %d событий, ожидалось %d", len(events), count)
+		}
+	}
+	return events
+}
+
+// waitStats ждёт, пока статистика bridge'а не удовлетворит условию.
+func waitStats(t *testing.T, b *Bridge, cond func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := b.Stats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("статистика bridge'а: %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// checkFrames проверяет порядок и origin пересланных событий.
+func checkFrames(t *testing.T, events []*event.Event, from int, origin string) {
+	t.Helper()
+	for i, e := range events {
+		if e.FrameIndex != from+i || e.Tags[OriginTag] != origin {
+			t.Fatalf("событие %d: frameIndex %d, origin %q", i, e.FrameIndex, e.Tags[OriginTag])
+		}
+	}
+}
+
+// TestBridge проверяет пересылку событий между двумя экземплярами.
+func TestBridge(t *testing.T) {
+	t.Run("пересылаются подходящие события с origin", func(t *testing.T) {
+		a := startInstance(t, "127.0.0.1:0")
+		b := startInstance(t, "127.0.0.1:0")
+		sub := b.subscribe(t)
+
+		br := startBridge(t, a, b.addr(), Config{Name: "control-room", Origin: "bench-a", Filter: eventbus.Filter{RunID: "run-1"}})
+		waitStats(t, br, func(s Stats) bool { return s.Connected })
+
+		publish(t, a, "run-2", 0, 5)
+		publish(t, a, "run-1", 0, 100)
+
+		events := receive(t, sub, 100)
+		checkFrames(t, events, 0, "bench-a")
+
+		stats := waitStats(t, br, func(s Stats) bool { return s.Acked == 100 })
+		if stats.Received != 100 || stats.Sent != 100 || stats.Pending != 0 || stats.Dropped != 0 || stats.Connections != 1 {
+			t.Errorf("статистика: %+v", stats)
+		}
+	})
+
+	t.Run("переподключение с повтором неподтверждённых событий", func(t *testing.T) {
+		a := startInstance(t, "127.0.0.1:0")
+		b := startInstance(t, "127.0.0.1:0")
+		addr := b.addr()
+		sub := b.subscribe(t)
+
+		br := startBridge(t, a, addr, Config{Name: "control-room", Origin: "bench-a"})
+		waitStats(t, br, func(s Stats) bool { return s.Connected })
+		publish(t, a, "run-1", 0, 20)
+		checkFrames(t, receive(t, sub, 20), 0, "bench-a")
+		waitStats(t, br, func(s Stats) bool { return s.Acked == 20 })
+
+		// Удалённый экземпляр недоступен: события копятся в очереди
+		b.listener.Stop(context.Background())
+		waitStats(t, br, func(s Stats) bool { return !s.Connected })
+		publish(t, a, "run-1", 20, 50)
+		stats := waitStats(t, br, func(s Stats) bool { return s.Pending == 30 && s.LastError != "" })
+		if stats.LagMs < 0 {
+			t.Errorf("LagMs = %d", stats.LagMs)
+		}
+
+		// После перезапуска bridge переподключается и досылает события
+		b.listen(t, addr)
+		checkFrames(t, receive(t, sub, 30), 20, "bench-a")
+		stats = waitStats(t, br, func(s Stats) bool { return s.Acked == 50 })
+		if stats.Pending != 0 || stats.Connections < 2 || stats.LagMs != 0 {
+			t.Errorf("статистика: %+v", stats)
+		}
+	})
+
+	t.Run("встречные bridge'и не образуют петлю", func(t *testing.T) {
+		a := startInstance(t, "127.0.0.1:0")
+		b := startInstance(t, "127.0.0.1:0")
+		subA := a.subscribe(t)
+		subB := b.subscribe(t)
+
+		ab := startBridge(t, a, b.addr(), Config{Name: "to-b", Origin: "bench-a"})
+		ba := startBridge(t, b, a.addr(), Config{Name: "to-a", Origin: "bench-b"})
+		waitStats(t, ab, func(s Stats) bool { return s.Connected })
+		waitStats(t, ba, func(s Stats) bool { return s.Connected })
+
+		publish(t, a, "run-a", 0, 10)
+		publish(t, b, "run-b", 0, 10)
+
+		// Каждый экземпляр получает свои 10 событий и 10 пересланных
+		for _, sub := range []eventbus.Subscription{subA, subB} {
+			origins := make(map[string]int)
+			for _, e := range receive(t, sub, 20) {
+				origins[e.Tags[OriginTag]]++
+			}
+			if origins[""] != 10 || len(origins) != 2 {
+				t.Errorf("origin событий: %v", origins)
+			}
+		}
+
+		waitStats(t, ab, func(s Stats) bool { return s.Acked == 10 && s.Skipped == 10 })
+		waitStats(t, ba, func(s Stats) bool { return s.Acked == 10 && s.Skipped == 10 })
+
+		// Повторной пересылки нет
+		time.Sleep(50 * time.Millisecond)
+		if len(subA.C()) != 0 || len(subB.C()) != 0 {
+			t.Errorf("лишние события: %d, %d", len(subA.C()), len(subB.C()))
+		}
+	})
+
+	t.Run("переполнение очереди отбрасывает самые старые события", func(t *testing.T) {
+		a := startInstance(t, "127.0.0.1:0")
+		b := startInstance(t, "127.0.0.1:0")
+		addr := b.addr()
+		b.listener.Stop(context.Background())
+
+		br := startBridge(t, a, addr, Config{Name: "control-room", Origin: "bench-a", MaxPending: 10})
+		publish(t, a, "run-1", 0, 25)
+		waitStats(t, br, func(s Stats) bool { return s.Received == 25 })
+
+		sub := b.subscribe(t)
+		b.listen(t, addr)
+		checkFrames(t, receive(t, sub, 10), 15, "bench-a")
+		stats := waitStats(t, br, func(s Stats) bool { return s.Acked == 10 })
+		if stats.Dropped != 15 {
+			t.Errorf("Dropped = %d, ожидалось 15", stats.Dropped)
+		}
+	})
+
+	t.Run("без ack строк соединение разрывается по таймауту", func(t *testing.T) {
+		a := startInstance(t, "127.0.0.1:0")
+		b := startInstance(t, "127.0.0.1:0")
+		addr := b.addr()
+		b.listener.Stop(context.Background())
+
+		// Удалённый экземпляр без -stream-ack-interval
+		listener := ingest.NewStreamListener(b.pipeline, ingest.StreamConfig{Network: "tcp", Addr: addr})
+		if err := listener.Start(context.Background()); err != nil {
+			t.Fatalf("Start() вернула ошибку: %v", err)
+		}
+		t.Cleanup(func() { listener.Stop(context.Background()) })
+
+		br := startBridge(t, a, addr, Config{Name: "control-room", Origin: "bench-a", MaxPending: 10, AckTimeout: 50 * time.Millisecond})
+		publish(t, a, "run-1", 0, 20)
+		stats := waitStats(t, br, func(s Stats) bool { return s.Connections >= 2 && strings.Contains(s.LastError, "no ack") })
+		if stats.Acked != 0 || stats.Pending != 10 {
+			t.Errorf("статистика: %+v", stats)
+		}
+	})
+}
+
+// TestLoadFile проверяет загрузку файла bridge'ей.
+func TestLoadFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "bridges.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configs, err := LoadFile(write(t, `{"origin": "bench-3", "bridges": [
+		{"name": "control-room", "addr": "control:8091", "filter": {"runIdGlob": "bench3-*"}}
+	]}`))
+	if err != nil {
+		t.Fatalf("LoadFile() вернула ошибку: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Origin != "bench-3" || configs[0].Filter.RunIDGlob != "bench3-*" {
+		t.Errorf("конфигурация: %+v", configs)
+	}
+
+	invalid := []string{
+		`{"bridges": [{"addr": "control:8091"}]}`,
+		`{"bridges": [{"name": "a"}]}`,
+		`{"bridges": [{"name": "a", "addr": "x", "network": "udp"}]}`,
+		`{"bridges": [{"name": "a", "addr": "x"}, {"name": "a", "addr": "y"}]}`,
+	}
+	for _, content := range invalid {
+		if _, err := LoadFile(write(t, content)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: ошибка %v, ожидалась ErrInvalidConfig", content, err)
+		}
+	}
+}
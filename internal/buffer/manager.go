@@ -2,6 +2,9 @@ package buffer
 
 import (
 	"context"
+	"errors"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,7 +16,7 @@ import (
 // Manager является подписчиком EventBus.
 type Manager struct {
 	mu       sync.RWMutex
-	buffers  map[string]*RingBuffer // runId -> buffer
+	runs     map[string]*liveRun // runId -> buffer и активность
 	capacity int
 
 	// Подписка на EventBus
@@ -21,7 +24,104 @@ type Manager struct {
 
 	// Очистка завершённых run'ов
 	cleanupInterval time.Duration
+	idleTTL         time.Duration
+	endGrace        time.Duration
 	maxRuns         int // максимальное количество run'ов
+	done            chan struct{}
+	closeOnce       sync.Once
+
+	// pinned - run'ы, которые не удаляются (могут ещё не иметь buffer'а)
+	pinned map[string]bool
+
+	// Счётчики и журнал удалённых run'ов (защищены mu)
+	evictedIdle    uint64
+	evictedEnded   uint64
+	evictedMaxRuns uint64
+	droppedMaxRuns uint64
+	evicted        []EvictedRun
+
+	// now - источник времени (подменяется в тестах)
+	now func() time.Time
+}
+
+// liveRun - buffer run'а и его активность.
+type liveRun struct {
+	buffer   *RingBuffer
+	activity RunActivity
+}
+
+// RunActivity описывает активность run'а в Live Buffer.
+type RunActivity struct {
+	// Created - время первого события run'а в buffer
+	Created time.Time
+
+	// LastEvent - время последнего события run'а
+	LastEvent time.Time
+
+	// Ended - получено событие run.end (сбрасывается событием run.start)
+	Ended bool
+
+	// EndedAt - время получения run.end
+	EndedAt time.Time
+}
+
+// Причины удаления run'а из Live Buffer (EvictedRun.Reason).
+const (
+	// EvictIdle - нет событий дольше IdleTTL
+	EvictIdle = "idle"
+
+	// EvictEnded - прошло EndGrace после run.end
+	EvictEnded = "ended"
+
+	// EvictMaxRuns - освобождено место для нового run'а при MaxRuns
+	EvictMaxRuns = "max_runs"
+)
+
+// maxEvictedHistory - количество последних удалённых run'ов в ManagerStats.
+const maxEvictedHistory = 100
+
+// defaultMaxPinned - максимальное количество закреплённых run'ов без MaxRuns.
+const defaultMaxPinned = 1000
+
+// ErrTooManyPinned - закреплено максимальное количество run'ов
+// (MaxRuns, без MaxRuns - 1000).
+var ErrTooManyPinned = errors.New("buffer: too many pinned runs")
+
+// EvictedRun описывает run, удалённый из Live Buffer.
+type EvictedRun struct {
+	RunID     string    `json:"runId"`
+	Reason    string    `json:"reason"`
+	EvictedAt time.Time `json:"evictedAt"`
+
+	// LastEvent, Ended, Size - состояние run'а в момент удаления
+	LastEvent time.Time `json:"lastEvent"`
+	Ended     bool      `json:"ended"`
+	Size      int       `json:"size"`
+}
+
+// ManagerStats содержит статистику Manager.
+type ManagerStats struct {
+	// Runs - количество run'ов в памяти
+	Runs int `json:"runs"`
+
+	// Pinned - закреплённые run'ы, которые не удаляются
+	Pinned []string `json:"pinned"`
+
+	// EvictedIdle - run'ы, удалённые после IdleTTL без событий
+	EvictedIdle uint64 `json:"evictedIdle"`
+
+	// EvictedEnded - run'ы, удалённые через EndGrace после run.end
+	EvictedEnded uint64 `json:"evictedEnded"`
+
+	// EvictedMaxRuns - run'ы, удалённые для нового run'а при MaxRuns
+	EvictedMaxRuns uint64 `json:"evictedMaxRuns"`
+
+	// DroppedMaxRuns - события новых run'ов, не сохранённые при MaxRuns,
+	// потому что все run'ы в памяти закреплены
+	DroppedMaxRuns uint64 `json:"droppedMaxRuns"`
+
+	// Evicted - последние удалённые run'ы, от новых к старым
+	Evicted []EvictedRun `json:"evicted"`
 }
 
 // Config содержит конфигурацию Manager.
@@ -32,7 +132,18 @@ type Config struct {
 	// CleanupInterval - интервал очистки завершённых run'ов
 	CleanupInterval time.Duration
 
-	// MaxRuns - максимальное количество run'ов (0 = без ограничений)
+	// IdleTTL - run без событий дольше IdleTTL удаляется (0 = не удалять)
+	IdleTTL time.Duration
+
+	// EndGrace - run удаляется через EndGrace после события run.end
+	// (0 = не удалять), чтобы UI успел дочитать хвост run'а
+	EndGrace time.Duration
+
+	// MaxRuns - максимальное количество run'ов (0 = без ограничений).
+	// Для нового run'а удаляется run с самым давним последним событием,
+	// завершённые run'ы (run.end) - в первую очередь, закреплённые - никогда.
+	// Если закреплены все run'ы, события нового run'а не сохраняются.
+	// Закрепить можно не больше MaxRuns run'ов
 	MaxRuns int
 }
 
@@ -49,10 +160,15 @@ func NewManager(bus eventbus.EventBus, config Config) (*Manager, error) {
 	}
 
 	m := &Manager{
-		buffers:         make(map[string]*RingBuffer),
+		runs:            make(map[string]*liveRun),
 		capacity:        capacity,
 		cleanupInterval: cleanupInterval,
+		idleTTL:         config.IdleTTL,
+		endGrace:        config.EndGrace,
 		maxRuns:         config.MaxRuns,
+		pinned:          make(map[string]bool),
+		done:            make(chan struct{}),
+		now:             time.Now,
 	}
 
 	// Подписываемся на EventBus (принимаем все события)
@@ -75,7 +191,7 @@ func NewManager(bus eventbus.EventBus, config Config) (*Manager, error) {
 	go m.readEvents()
 
 	// Запускаем goroutine для периодической очистки
-	if m.cleanupInterval > 0 {
+	if m.cleanupInterval > 0 && (m.idleTTL > 0 || m.endGrace > 0) {
 		go m.cleanupLoop()
 	}
 
@@ -94,30 +210,145 @@ func (m *Manager) appendEvent(e *event.Event) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	buf, exists := m.buffers[e.RunID]
+	now := m.now()
+	run, exists := m.runs[e.RunID]
 	if !exists {
 		// Проверяем ограничение на количество run'ов
-		if m.maxRuns > 0 && len(m.buffers) >= m.maxRuns {
-			// Удаляем самый старый run (простая стратегия)
-			// В Phase 1 это достаточно
-			for runID := range m.buffers {
-				delete(m.buffers, runID)
-				break
+		if m.maxRuns > 0 && len(m.runs) >= m.maxRuns {
+			victim := m.leastRecentRun()
+			if victim == "" {
+				// Все run'ы закреплены: новый run не помещается
+				m.droppedMaxRuns++
+				return
 			}
+			m.evict(victim, EvictMaxRuns, now)
+		}
+
+		run = &liveRun{
+			buffer:   NewRingBuffer(m.capacity),
+			activity: RunActivity{Created: now},
+		}
+		m.runs[e.RunID] = run
+	}
+
+	run.activity.LastEvent = now
+	switch e.Type {
+	case "run.end":
+		run.activity.Ended = true
+		run.activity.EndedAt = now
+	case "run.start":
+		run.activity.Ended = false
+		run.activity.EndedAt = time.Time{}
+	}
+
+	run.buffer.Append(e)
+}
+
+// leastRecentRun возвращает run для удаления при MaxRuns: незакреплённый
+// run с самым давним последним событием, среди завершённых в первую
+// очередь. Пустая строка - все run'ы закреплены.
+func (m *Manager) leastRecentRun() string {
+	var victim string
+	var victimActivity RunActivity
+	for runID, run := range m.runs {
+		if m.pinned[runID] {
+			continue
+		}
+		a := run.activity
+		if victim == "" ||
+			(a.Ended && !victimActivity.Ended) ||
+			(a.Ended == victimActivity.Ended && a.LastEvent.Before(victimActivity.LastEvent)) {
+			victim, victimActivity = runID, a
 		}
+	}
+	return victim
+}
+
+// evict удаляет run, учитывает и логирует удаление. Вызывается под mu.
+func (m *Manager) evict(runID, reason string, now time.Time) {
+	run := m.runs[runID]
+	delete(m.runs, runID)
+
+	switch reason {
+	case EvictIdle:
+		m.evictedIdle++
+	case EvictEnded:
+		m.evictedEnded++
+	case EvictMaxRuns:
+		m.evictedMaxRuns++
+	}
 
-		buf = NewRingBuffer(m.capacity)
-		m.buffers[e.RunID] = buf
+	if len(m.evicted) >= maxEvictedHistory {
+		m.evicted = append(m.evicted[:0], m.evicted[1:]...)
 	}
+	m.evicted = append(m.evicted, EvictedRun{
+		RunID:     runID,
+		Reason:    reason,
+		EvictedAt: now,
+		LastEvent: run.activity.LastEvent,
+		Ended:     run.activity.Ended,
+		Size:      run.buffer.Size(),
+	})
 
-	buf.Append(e)
+	log.Printf("Live buffer: run %s evicted (reason: %s, last event %s ago, %d events)",
+		runID, reason, now.Sub(run.activity.LastEvent).Round(time.Second), run.buffer.Size())
+}
+
+// Pin закрепляет run: он не удаляется ни по MaxRuns, ни по IdleTTL
+// и EndGrace. Run можно закрепить до его первого события.
+// Возвращает ErrTooManyPinned, если закреплено MaxRuns run'ов
+// (без MaxRuns - 1000).
+func (m *Manager) Pin(runID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := m.maxRuns
+	if limit <= 0 {
+		limit = defaultMaxPinned
+	}
+	if !m.pinned[runID] && len(m.pinned) >= limit {
+		return ErrTooManyPinned
+	}
+	m.pinned[runID] = true
+	return nil
+}
+
+// Unpin снимает закрепление run'а.
+func (m *Manager) Unpin(runID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pinned, runID)
+}
+
+// IsPinned сообщает, закреплён ли run.
+func (m *Manager) IsPinned(runID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pinned[runID]
 }
 
 // GetBuffer возвращает buffer для указанного run'а.
 func (m *Manager) GetBuffer(runID string) *RingBuffer {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.buffers[runID]
+
+	run := m.runs[runID]
+	if run == nil {
+		return nil
+	}
+	return run.buffer
+}
+
+// GetActivity возвращает активность run'а; false, если run'а нет в памяти.
+func (m *Manager) GetActivity(runID string) (RunActivity, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run := m.runs[runID]
+	if run == nil {
+		return RunActivity{}, false
+	}
+	return run.activity, true
 }
 
 // GetRuns возвращает список всех run'ов.
@@ -125,28 +356,80 @@ func (m *Manager) GetRuns() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	runs := make([]string, 0, len(m.buffers))
-	for runID := range m.buffers {
+	runs := make([]string, 0, len(m.runs))
+	for runID := range m.runs {
 		runs = append(runs, runID)
 	}
 	return runs
 }
 
-// cleanupLoop периодически очищает завершённые run'ы.
-// В Phase 1 используем простую стратегию: удаляем run'ы старше определённого времени.
+// Stats возвращает статистику Manager.
+func (m *Manager) Stats() ManagerStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pinned := make([]string, 0, len(m.pinned))
+	for runID := range m.pinned {
+		pinned = append(pinned, runID)
+	}
+	sort.Strings(pinned)
+
+	evicted := make([]EvictedRun, len(m.evicted))
+	for i, e := range m.evicted {
+		evicted[len(evicted)-1-i] = e
+	}
+
+	return ManagerStats{
+		Runs:           len(m.runs),
+		Pinned:         pinned,
+		EvictedIdle:    m.evictedIdle,
+		EvictedEnded:   m.evictedEnded,
+		EvictedMaxRuns: m.evictedMaxRuns,
+		DroppedMaxRuns: m.droppedMaxRuns,
+		Evicted:        evicted,
+	}
+}
+
+// cleanupLoop периодически удаляет завершённые и неактивные run'ы.
 func (m *Manager) cleanupLoop() {
 	ticker := time.NewTicker(m.cleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		// В Phase 1 очистка упрощена - можно удалять run'ы по TTL
-		// или по максимальному количеству. Реализация зависит от требований.
-		// Пока оставляем простую логику через maxRuns.
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanup()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// cleanup удаляет run'ы, завершённые дольше EndGrace назад,
+// и run'ы без событий дольше IdleTTL. Закреплённые run'ы не удаляются.
+func (m *Manager) cleanup() {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for runID, run := range m.runs {
+		if m.pinned[runID] {
+			continue
+		}
+		a := run.activity
+		switch {
+		case m.endGrace > 0 && a.Ended && now.Sub(a.EndedAt) >= m.endGrace:
+			m.evict(runID, EvictEnded, now)
+		case m.idleTTL > 0 && now.Sub(a.LastEvent) >= m.idleTTL:
+			m.evict(runID, EvictIdle, now)
+		}
 	}
 }
 
 // Close закрывает Manager и подписку.
 func (m *Manager) Close() error {
+	m.closeOnce.Do(func() { close(m.done) })
 	if m.subscription != nil {
 		return m.subscription.Close()
 	}
@@ -0,0 +1,245 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// fakeClock - управляемый источник времени для Manager.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestManager создаёт Manager без фоновой очистки с управляемым временем.
+func newTestManager(t *testing.T, config Config) (*Manager, eventbus.EventBus, *fakeClock) {
+	t.Helper()
+	bus := eventbus.New()
+	t.Cleanup(func() { bus.Close() })
+
+	config.CleanupInterval = -1 // очистка вызывается тестом
+	m, err := NewManager(bus, config)
+	if err != nil {
+		t.Fatalf("NewManager() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	m.now = clock.Now
+	return m, bus, clock
+}
+
+// publish публикует событие и ждёт, пока Manager его обработает.
+func publish(t *testing.T, m *Manager, bus eventbus.EventBus, runID, eventType string) {
+	t.Helper()
+	size := 0
+	if buf := m.GetBuffer(runID); buf != nil {
+		size = buf.Size()
+	}
+	bus.Publish(context.Background(), &event.Event{V: 1, RunID: runID, SourceID: "engine", Type: eventType})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if buf := m.GetBuffer(runID); buf != nil && buf.Size() > size {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("событие run'а %s не попало в buffer", runID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestManager_Cleanup проверяет удаление run'ов по IdleTTL и после run.end.
+func TestManager_Cleanup(t *testing.T) {
+	m, bus, clock := newTestManager(t, Config{Capacity: 10, IdleTTL: time.Hour, EndGrace: 10 * time.Minute})
+	start := clock.Now()
+
+	publish(t, m, bus, "run-active", "run.start")
+	publish(t, m, bus, "run-idle", "run.start")
+	publish(t, m, bus, "run-ended", "run.start")
+	publish(t, m, bus, "run-ended", "run.end")
+
+	activity, ok := m.GetActivity("run-ended")
+	if !ok || !activity.Ended || !activity.EndedAt.Equal(start) || !activity.Created.Equal(start) {
+		t.Errorf("активность run-ended: %+v", activity)
+	}
+
+	// До истечения EndGrace ничего не удаляется
+	clock.Advance(9 * time.Minute)
+	publish(t, m, bus, "run-active", "body.state")
+	m.cleanup()
+	if stats := m.Stats(); stats.Runs != 3 {
+		t.Fatalf("статистика: %+v", stats)
+	}
+
+	clock.Advance(time.Minute)
+	m.cleanup()
+	if m.GetBuffer("run-ended") != nil {
+		t.Error("run-ended не удалён после EndGrace")
+	}
+
+	// run-idle без событий час, run-active получил событие 51 минуту назад
+	clock.Advance(50 * time.Minute)
+	m.cleanup()
+	if m.GetBuffer("run-idle") != nil {
+		t.Error("run-idle не удалён после IdleTTL")
+	}
+	if m.GetBuffer("run-active") == nil {
+		t.Error("run-active удалён")
+	}
+	activity, _ = m.GetActivity("run-active")
+	if activity.Ended || !activity.LastEvent.Equal(start.Add(9*time.Minute)) {
+		t.Errorf("активность run-active: %+v", activity)
+	}
+
+	stats := m.Stats()
+	if stats.Runs != 1 || stats.EvictedIdle != 1 || stats.EvictedEnded != 1 || len(stats.Evicted) != 2 {
+		t.Fatalf("статистика: %+v", stats)
+	}
+	// Журнал удалений - от новых к старым
+	if e := stats.Evicted[0]; e.RunID != "run-idle" || e.Reason != EvictIdle || !e.EvictedAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("удаление run-idle: %+v", e)
+	}
+	if e := stats.Evicted[1]; e.RunID != "run-ended" || e.Reason != EvictEnded || !e.Ended || e.Size != 2 {
+		t.Errorf("удаление run-ended: %+v", e)
+	}
+}
+
+// TestManager_RunRestart проверяет, что run.start после run.end отменяет
+// удаление по EndGrace.
+func TestManager_RunRestart(t *testing.T) {
+	m, bus, clock := newTestManager(t, Config{Capacity: 10, EndGrace: time.Minute})
+
+	publish(t, m, bus, "run-1", "run.end")
+	publish(t, m, bus, "run-1", "run.start")
+	clock.Advance(time.Hour)
+	m.cleanup()
+
+	// Без IdleTTL неактивный run остаётся
+	if m.GetBuffer("run-1") == nil {
+		t.Error("run-1 удалён")
+	}
+}
+
+// TestManager_MaxRuns проверяет выбор удаляемого run'а при MaxRuns.
+func TestManager_MaxRuns(t *testing.T) {
+	m, bus, clock := newTestManager(t, Config{Capacity: 10, MaxRuns: 3})
+
+	// run-1 старее всех, но за ним следят: события продолжают приходить
+	publish(t, m, bus, "run-1", "run.start")
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-2", "run.start")
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-3", "run.start")
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-1", "body.state")
+
+	// Удаляется run с самым давним событием
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-4", "run.start")
+	if m.GetBuffer("run-2") != nil || m.GetBuffer("run-1") == nil {
+		t.Errorf("run'ы: %v", m.GetRuns())
+	}
+
+	// Завершённый run удаляется раньше более давнего активного
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-4", "run.end")
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-5", "run.start")
+	if m.GetBuffer("run-4") != nil || m.GetBuffer("run-3") == nil {
+		t.Errorf("run'ы: %v", m.GetRuns())
+	}
+
+	// Закреплённый run не удаляется, даже если он самый давний
+	m.Pin("run-3")
+	clock.Advance(time.Second)
+	publish(t, m, bus, "run-6", "run.start")
+	if m.GetBuffer("run-3") == nil || m.GetBuffer("run-1") != nil {
+		t.Errorf("run'ы: %v", m.GetRuns())
+	}
+
+	stats := m.Stats()
+	if stats.EvictedMaxRuns != 3 || len(stats.Pinned) != 1 || stats.Pinned[0] != "run-3" {
+		t.Errorf("статистика: %+v", stats)
+	}
+	var evicted []string
+	for _, e := range stats.Evicted {
+		if e.Reason != EvictMaxRuns {
+			t.Errorf("причина удаления %s: %s", e.RunID, e.Reason)
+		}
+		evicted = append(evicted, e.RunID)
+	}
+	if strings.Join(evicted, ",") != "run-1,run-4,run-2" {
+		t.Errorf("удалённые run'ы: %v", evicted)
+	}
+}
+
+// TestManager_Pin проверяет, что закреплённые run'ы не удаляются по TTL,
+// при закреплении всех run'ов события новых run'ов не сохраняются,
+// а закрепить можно не больше MaxRuns run'ов.
+func TestManager_Pin(t *testing.T) {
+	m, bus, clock := newTestManager(t, Config{Capacity: 10, MaxRuns: 2, IdleTTL: time.Minute})
+
+	if err := m.Pin("run-1"); err != nil {
+		t.Fatalf("Pin() вернул ошибку: %v", err)
+	}
+	publish(t, m, bus, "run-1", "run.start")
+	publish(t, m, bus, "run-2", "run.start")
+	clock.Advance(time.Hour)
+	m.cleanup()
+	if m.GetBuffer("run-1") == nil || m.GetBuffer("run-2") != nil {
+		t.Errorf("run'ы после очистки: %v", m.GetRuns())
+	}
+
+	// Закрепить можно не больше MaxRuns run'ов; повторное закрепление
+	// не учитывается
+	if err := m.Pin("run-2"); err != nil {
+		t.Fatalf("Pin() вернул ошибку: %v", err)
+	}
+	if err := m.Pin("run-2"); err != nil {
+		t.Errorf("повторный Pin() вернул ошибку: %v", err)
+	}
+	if err := m.Pin("run-3"); !errors.Is(err, ErrTooManyPinned) {
+		t.Errorf("Pin() сверх MaxRuns = %v, ожидалась ErrTooManyPinned", err)
+	}
+
+	// Все run'ы закреплены: MaxRuns не превышается, события нового run'а
+	// не сохраняются
+	publish(t, m, bus, "run-2", "run.start")
+	m.appendEvent(&event.Event{V: 1, RunID: "run-3", SourceID: "engine", Type: "run.start"})
+	if len(m.GetRuns()) != 2 || m.GetBuffer("run-3") != nil {
+		t.Errorf("run'ы: %v", m.GetRuns())
+	}
+	if stats := m.Stats(); stats.DroppedMaxRuns != 1 || stats.EvictedMaxRuns != 0 {
+		t.Errorf("статистика: %+v", stats)
+	}
+
+	m.Unpin("run-1")
+	m.cleanup()
+	if m.GetBuffer("run-1") != nil || m.IsPinned("run-1") {
+		t.Error("run-1 не удалён после Unpin")
+	}
+	if err := m.Pin("run-3"); err != nil {
+		t.Errorf("Pin() после Unpin вернул ошибку: %v", err)
+	}
+}
@@ -19,6 +19,74 @@ type Config struct {
 	// BufferCleanupInterval - интервал очистки завершённых run'ов
 	BufferCleanupInterval time.Duration
 
+	// BufferIdleTTL - run без событий дольше этого времени удаляется из
+	// Live Buffer (0 = не удалять)
+	BufferIdleTTL time.Duration
+
+	// BufferEndGrace - run удаляется из Live Buffer через это время после
+	// run.end (0 = не удалять)
+	BufferEndGrace time.Duration
+
+	// UDPPort - порт UDP listener'а для fire-and-forget ingest (0 = выключен)
+	UDPPort int
+
+	// TCPPort - порт TCP listener'а для потокового NDJSON ingest (0 = выключен)
+	TCPPort int
+
+	// UnixSocket - путь к Unix сокету для потокового NDJSON ingest ("" = выключен)
+	UnixSocket string
+
+	// StreamAckInterval - период отправки ack строк в потоковых соединениях (0 = без ack)
+	StreamAckInterval time.Duration
+
+	// IngestMaxDecompressedBytes - лимит распакованного тела сжатого ingest запроса
+	IngestMaxDecompressedBytes int64
+
+	// IngestDedupWindow - окно дедупликации по seq на (runId, sourceId)
+	IngestDedupWindow int
+
+	// IngestRateLimitsFile - JSON файл лимитов ingest по sourceId/runId ("" = без лимитов)
+	IngestRateLimitsFile string
+
+	// IngestProcessorsFile - JSON файл цепочки processor'ов ingest ("" = без преобразований)
+	IngestProcessorsFile string
+
+	// IngestFlowMaxLogLag - отставание batcher'а от конца журнала событий,
+	// при котором /ws/ingest считается полностью заполненным
+	IngestFlowMaxLogLag uint64
+
+	// AuthTokensFile - JSON файл токенов ingest/read ("" = аутентификация выключена)
+	AuthTokensFile string
+
+	// SchemaRegistryFile - JSON файл реестра схем payload ("" = payload не проверяется)
+	SchemaRegistryFile string
+
+	// DeadLetterDir - каталог dead-letter файлов ("" = отклонённые события не сохраняются)
+	DeadLetterDir string
+
+	// DeadLetterMaxFileBytes - размер dead-letter файла для ротации
+	DeadLetterMaxFileBytes int64
+
+	// DeadLetterMaxFiles - количество хранимых dead-letter файлов
+	DeadLetterMaxFiles int
+
+	// EventLogDir - каталог журнала событий EventBus ("" = журнал выключен)
+	EventLogDir string
+
+	// EventLogMaxSegmentBytes - размер сегмента журнала для ротации
+	EventLogMaxSegmentBytes int64
+
+	// EventLogMaxSegments - количество хранимых сегментов журнала
+	EventLogMaxSegments int
+
+	// EventBusShards - количество шардов асинхронного fan-out EventBus
+	// (0 = синхронный fan-out)
+	EventBusShards int
+
+	// BridgesFile - JSON файл bridge'ей в другие экземпляры teltel
+	// ("" = без bridge'ей)
+	BridgesFile string
+
 	// ClickHouseURL - URL для подключения к ClickHouse (опционально, для Phase 2)
 	ClickHouseURL string
 
@@ -38,8 +106,29 @@ func Load() *Config {
 
 	flag.IntVar(&cfg.HTTPPort, "port", 8080, "HTTP server port")
 	flag.IntVar(&cfg.BufferCapacity, "buffer-capacity", 10000, "Ring buffer capacity per run")
-	flag.IntVar(&cfg.BufferMaxRuns, "buffer-max-runs", 0, "Maximum number of runs (0 = unlimited)")
+	flag.IntVar(&cfg.BufferMaxRuns, "buffer-max-runs", 0, "Maximum number of runs; the least recently active unpinned run is evicted first (0 = unlimited)")
 	flag.DurationVar(&cfg.BufferCleanupInterval, "buffer-cleanup-interval", 5*time.Minute, "Buffer cleanup interval")
+	flag.DurationVar(&cfg.BufferIdleTTL, "buffer-idle-ttl", time.Hour, "Evict a run's live buffer after this long without events (0 = never)")
+	flag.DurationVar(&cfg.BufferEndGrace, "buffer-end-grace", 10*time.Minute, "Evict a run's live buffer this long after run.end (0 = never)")
+	flag.IntVar(&cfg.UDPPort, "udp-port", 0, "UDP ingest port (0 = disabled)")
+	flag.IntVar(&cfg.TCPPort, "tcp-port", 0, "TCP NDJSON stream ingest port (0 = disabled)")
+	flag.StringVar(&cfg.UnixSocket, "unix-socket", "", "Unix socket path for NDJSON stream ingest (empty = disabled)")
+	flag.DurationVar(&cfg.StreamAckInterval, "stream-ack-interval", 0, "Ack interval for stream ingest connections (0 = no acks)")
+	flag.Int64Var(&cfg.IngestMaxDecompressedBytes, "ingest-max-decompressed-bytes", 512<<20, "Maximum decompressed size of a gzip/zstd ingest body")
+	flag.IntVar(&cfg.IngestDedupWindow, "ingest-dedup-window", 4096, "Number of recent seq numbers per (runId, sourceId) checked for duplicates")
+	flag.StringVar(&cfg.IngestRateLimitsFile, "ingest-rate-limits", "", "JSON file with per-source and per-run ingest rate limits (empty = unlimited)")
+	flag.StringVar(&cfg.IngestProcessorsFile, "ingest-processors", "", "JSON file with the chain of event processors applied before publishing (empty = none)")
+	flag.Uint64Var(&cfg.IngestFlowMaxLogLag, "ingest-flow-max-log-lag", 100000, "Batcher lag behind the event log (in events) treated as full for /ws/ingest flow control")
+	flag.StringVar(&cfg.AuthTokensFile, "auth-tokens-file", "", "JSON file with ingest/read API tokens (empty = auth disabled)")
+	flag.StringVar(&cfg.SchemaRegistryFile, "schema-registry", "", "JSON file with payload schemas per (sourceId, type, v) (empty = no validation)")
+	flag.StringVar(&cfg.DeadLetterDir, "deadletter-dir", "", "Directory for dead-letter NDJSON files with rejected and undeliverable events (empty = disabled)")
+	flag.Int64Var(&cfg.DeadLetterMaxFileBytes, "deadletter-max-file-bytes", 64<<20, "Dead-letter file size that triggers rotation")
+	flag.IntVar(&cfg.DeadLetterMaxFiles, "deadletter-max-files", 20, "Number of dead-letter files to keep")
+	flag.StringVar(&cfg.EventLogDir, "eventlog-dir", "", "Directory for the on-disk EventBus log used by durable subscriptions (empty = disabled)")
+	flag.Int64Var(&cfg.EventLogMaxSegmentBytes, "eventlog-max-segment-bytes", 64<<20, "Event log segment size that triggers rotation")
+	flag.IntVar(&cfg.EventLogMaxSegments, "eventlog-max-segments", 16, "Number of event log segments to keep")
+	flag.IntVar(&cfg.EventBusShards, "eventbus-shards", 0, "Number of EventBus fan-out shards partitioned by runId (0 = synchronous fan-out)")
+	flag.StringVar(&cfg.BridgesFile, "bridges", "", "JSON file with bridges forwarding EventBus events to other teltel instances (empty = none)")
 
 	// Phase 2: ClickHouse storage
 	flag.StringVar(&cfg.ClickHouseURL, "clickhouse-url", "", "ClickHouse URL (e.g., http://localhost:8123)")
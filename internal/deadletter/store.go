@@ -0,0 +1,380 @@
+// Package deadletter сохраняет события, которые не удалось принять или
+// доставить, в ротируемые локальные NDJSON файлы.
+//
+// Каждая запись содержит причину (машиночитаемый код ошибки), источник
+// (транспорт ingest или хранилище) и время. Записи можно просмотреть через
+// API и повторно отправить утилитой teltel-replay после исправления причины.
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+const (
+	// DefaultMaxFileBytes - размер файла, после которого открывается новый
+	DefaultMaxFileBytes = 64 << 20
+
+	// DefaultMaxFiles - количество хранимых файлов; самые старые удаляются
+	DefaultMaxFiles = 20
+
+	// DefaultFlushInterval - период сброса буфера записи в файл
+	DefaultFlushInterval = time.Second
+
+	filePrefix = "deadletter-"
+	fileSuffix = ".ndjson"
+
+	// fileTimeLayout - время создания в имени файла (сортируется лексикографически)
+	fileTimeLayout = "20060102T150405.000000000Z"
+
+	// maxEntryLineSize - максимальная длина строки файла при чтении
+	maxEntryLineSize = 16 << 20
+)
+
+// ErrInvalidFileName - имя не является именем dead-letter файла хранилища.
+var ErrInvalidFileName = errors.New("deadletter: invalid file name")
+
+// Entry - запись dead-letter файла.
+type Entry struct {
+	// Time - время, когда событие было отклонено
+	Time time.Time `json:"time"`
+
+	// Origin - где событие было отклонено (например, "ingest.http", "storage.clickhouse")
+	Origin string `json:"origin"`
+
+	// Reason - машиночитаемый код причины (ErrInvalidJSON, ErrSchemaViolation, ...)
+	Reason string `json:"reason"`
+
+	// Error - текст ошибки
+	Error string `json:"error"`
+
+	// Line - номер строки (или события MessagePack) во входном потоке
+	Line int `json:"line,omitempty"`
+
+	// Raw - исходная строка NDJSON, если она есть
+	Raw string `json:"raw,omitempty"`
+
+	// Event - разобранное событие, если ошибка возникла после парсинга
+	Event *event.Event `json:"event,omitempty"`
+}
+
+// Config определяет параметры хранилища.
+type Config struct {
+	// Dir - каталог dead-letter файлов (создаётся при необходимости)
+	Dir string
+
+	// MaxFileBytes - размер файла для ротации (0 = DefaultMaxFileBytes)
+	MaxFileBytes int64
+
+	// MaxFiles - количество хранимых файлов (0 = DefaultMaxFiles)
+	MaxFiles int
+
+	// FlushInterval - период сброса буфера записи в файл
+	// (0 = DefaultFlushInterval); Close и OpenFile сбрасывают его сразу
+	FlushInterval time.Duration
+}
+
+// FileInfo описывает dead-letter файл.
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Stats содержит статистику хранилища.
+type Stats struct {
+	// Written - количество записанных записей
+	Written uint64 `json:"written"`
+
+	// Failed - количество записей, которые не удалось записать
+	Failed uint64 `json:"failed"`
+
+	// Rotations - количество ротаций файлов
+	Rotations uint64 `json:"rotations"`
+
+	// Removed - количество файлов, удалённых по MaxFiles
+	Removed uint64 `json:"removed"`
+}
+
+// Store - хранилище dead-letter записей. Nil *Store отбрасывает записи,
+// что позволяет не проверять, включено ли хранилище.
+type Store struct {
+	config Config
+	now    func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	stats  Stats
+	closed bool
+
+	// done останавливает flushLoop
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open создаёт хранилище в config.Dir. Файл открывается при первой записи.
+func Open(config Config) (*Store, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("deadletter: directory is required")
+	}
+	if config.MaxFileBytes <= 0 {
+		config.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultMaxFiles
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("deadletter: failed to create directory: %w", err)
+	}
+
+	s := &Store{
+		config: config,
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s, nil
+}
+
+// flushLoop каждые FlushInterval сбрасывает буфер записи в файл.
+func (s *Store) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.writer != nil {
+				s.writer.Flush()
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Write добавляет записи в текущий файл, выполняя ротацию по размеру.
+// Пустое поле Time заполняется текущим временем. Записи попадают в файл
+// не позже чем через FlushInterval.
+func (s *Store) Write(entries ...Entry) error {
+	if s == nil || len(entries) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.stats.Failed += uint64(len(entries))
+		return fmt.Errorf("deadletter: store is closed")
+	}
+
+	for i, entry := range entries {
+		if entry.Time.IsZero() {
+			entry.Time = s.now().UTC()
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			s.stats.Failed++
+			continue
+		}
+		line = append(line, '\n')
+
+		if err := s.ensureFile(int64(len(line))); err != nil {
+			s.stats.Failed += uint64(len(entries) - i)
+			return err
+		}
+		n, err := s.writer.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			s.stats.Failed += uint64(len(entries) - i)
+			return fmt.Errorf("deadletter: write failed: %w", err)
+		}
+		s.stats.Written++
+	}
+	return nil
+}
+
+// ensureFile открывает файл, если его нет или запись n байт превысит MaxFileBytes.
+func (s *Store) ensureFile(n int64) error {
+	if s.file != nil && (s.size == 0 || s.size+n <= s.config.MaxFileBytes) {
+		return nil
+	}
+
+	if s.file != nil {
+		s.writer.Flush()
+		s.file.Close()
+		s.file = nil
+		s.stats.Rotations++
+	}
+
+	name := filePrefix + s.now().UTC().Format(fileTimeLayout) + fileSuffix
+	f, err := os.OpenFile(filepath.Join(s.config.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("deadletter: failed to open file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("deadletter: failed to open file: %w", err)
+	}
+
+	s.file = f
+	s.writer = bufio.NewWriter(f)
+	s.size = info.Size()
+	s.removeOld()
+	return nil
+}
+
+// removeOld удаляет самые старые файлы сверх MaxFiles.
+func (s *Store) removeOld() {
+	files, err := s.files()
+	if err != nil {
+		return
+	}
+	for len(files) > s.config.MaxFiles {
+		if err := os.Remove(filepath.Join(s.config.Dir, files[0].Name)); err == nil {
+			s.stats.Removed++
+		}
+		files = files[1:]
+	}
+}
+
+// Files возвращает dead-letter файлы от старых к новым.
+func (s *Store) Files() ([]FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files()
+}
+
+func (s *Store) files() ([]FileInfo, error) {
+	return ListFiles(s.config.Dir)
+}
+
+// ListFiles возвращает dead-letter файлы каталога dir от старых к новым.
+func ListFiles(dir string) ([]FileInfo, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("deadletter: failed to list files: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if de.IsDir() || !ValidFileName(de.Name()) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, FileInfo{
+			Name:     de.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// ValidFileName сообщает, является ли name именем dead-letter файла
+// (без компонентов пути).
+func ValidFileName(name string) bool {
+	return strings.HasPrefix(name, filePrefix) &&
+		strings.HasSuffix(name, fileSuffix) &&
+		filepath.Base(name) == name
+}
+
+// OpenFile открывает dead-letter файл для чтения.
+// Возвращает ErrInvalidFileName для имён вне хранилища.
+func (s *Store) OpenFile(name string) (*os.File, error) {
+	if !ValidFileName(name) {
+		return nil, ErrInvalidFileName
+	}
+
+	// Данные текущего файла должны быть видны читателю
+	s.mu.Lock()
+	if s.writer != nil {
+		s.writer.Flush()
+	}
+	s.mu.Unlock()
+
+	return os.Open(filepath.Join(s.config.Dir, name))
+}
+
+// ReadEntries читает записи из r и вызывает fn для каждой.
+// Чтение прекращается при первой ошибке fn.
+func ReadEntries(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntryLineSize)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("deadletter: invalid entry: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Stats возвращает статистику хранилища.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close сбрасывает буфер и закрывает текущий файл.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	s.writer.Flush()
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
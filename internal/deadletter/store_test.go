@@ -0,0 +1,192 @@
+package deadletter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// newTestStore создаёт хранилище с управляемыми часами:
+// каждый вызов now сдвигает время на 1 секунду, чтобы имена файлов различались.
+func newTestStore(t *testing.T, config Config) *Store {
+	t.Helper()
+	config.Dir = t.TempDir()
+	s, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() вернула ошибку: %v", err)
+	}
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// readAll читает все записи файла хранилища.
+func readAll(t *testing.T, s *Store, name string) []Entry {
+	t.Helper()
+	f, err := s.OpenFile(name)
+	if err != nil {
+		t.Fatalf("OpenFile() вернула ошибку: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	if err := ReadEntries(f, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadEntries() вернула ошибку: %v", err)
+	}
+	return entries
+}
+
+// TestStore_WriteRead проверяет запись и чтение записей.
+func TestStore_WriteRead(t *testing.T) {
+	s := newTestStore(t, Config{})
+
+	seq := uint64(7)
+	err := s.Write(
+		Entry{Origin: "ingest.http", Reason: "ErrInvalidJSON", Error: "event: invalid JSON format", Line: 3, Raw: "not json"},
+		Entry{Origin: "storage.clickhouse", Reason: "ErrInsertFailed", Error: "timeout", Event: &event.Event{V: 1, RunID: "run-1", SourceID: "engine", Seq: &seq}},
+	)
+	if err != nil {
+		t.Fatalf("Write() вернула ошибку: %v", err)
+	}
+
+	files, err := s.Files()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Files() = %v, %v; ожидался один файл", files, err)
+	}
+
+	entries := readAll(t, s, files[0].Name)
+	if len(entries) != 2 {
+		t.Fatalf("прочитано %d записей, ожидалось 2", len(entries))
+	}
+	if entries[0].Raw != "not json" || entries[0].Line != 3 || entries[0].Time.IsZero() {
+		t.Errorf("первая запись: %+v", entries[0])
+	}
+	if entries[1].Event == nil || entries[1].Event.RunID != "run-1" || *entries[1].Event.Seq != 7 {
+		t.Errorf("вторая запись: %+v", entries[1])
+	}
+	if stats := s.Stats(); stats.Written != 2 || stats.Failed != 0 {
+		t.Errorf("статистика: %+v", stats)
+	}
+}
+
+// TestStore_Rotation проверяет ротацию по размеру и удаление старых файлов.
+func TestStore_Rotation(t *testing.T) {
+	s := newTestStore(t, Config{MaxFileBytes: 200, MaxFiles: 3})
+
+	raw := strings.Repeat("x", 100)
+	for i := 0; i < 10; i++ {
+		if err := s.Write(Entry{Origin: "ingest.udp", Reason: "ErrInvalidJSON", Raw: raw}); err != nil {
+			t.Fatalf("Write() вернула ошибку: %v", err)
+		}
+	}
+
+	files, _ := s.Files()
+	if len(files) != 3 {
+		t.Fatalf("файлов: %d, ожидалось 3", len(files))
+	}
+	stats := s.Stats()
+	if stats.Rotations != 9 || stats.Removed != 7 {
+		t.Errorf("статистика: %+v", stats)
+	}
+	// Самый новый файл - последний в списке и содержит последнюю запись
+	if entries := readAll(t, s, files[2].Name); len(entries) != 1 {
+		t.Errorf("в последнем файле %d записей, ожидалась 1", len(entries))
+	}
+}
+
+// TestStore_Flush проверяет, что записи сбрасываются в файл по таймеру
+// и при Close, а не при каждой записи.
+func TestStore_Flush(t *testing.T) {
+	fileSize := func(t *testing.T, s *Store) int64 {
+		t.Helper()
+		info, err := os.Stat(s.file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	t.Run("Close сбрасывает буфер", func(t *testing.T) {
+		s := newTestStore(t, Config{FlushInterval: time.Hour})
+		if err := s.Write(Entry{Origin: "ingest.udp", Reason: "ErrInvalidJSON", Raw: "not json"}); err != nil {
+			t.Fatalf("Write() вернула ошибку: %v", err)
+		}
+		if size := fileSize(t, s); size != 0 {
+			t.Errorf("размер файла до flush = %d, ожидался 0", size)
+		}
+
+		name := s.file.Name()
+		s.Close()
+		data, err := os.ReadFile(name)
+		if err != nil || !strings.Contains(string(data), "not json") {
+			t.Errorf("файл после Close: %q, %v", data, err)
+		}
+	})
+
+	t.Run("буфер сбрасывается через FlushInterval", func(t *testing.T) {
+		s := newTestStore(t, Config{FlushInterval: 10 * time.Millisecond})
+		if err := s.Write(Entry{Origin: "ingest.udp", Reason: "ErrInvalidJSON", Raw: "not json"}); err != nil {
+			t.Fatalf("Write() вернула ошибку: %v", err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			s.mu.Lock()
+			size := fileSize(t, s)
+			s.mu.Unlock()
+			if size > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("буфер не сброшен за FlushInterval")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+// TestStore_OpenFile проверяет защиту от чтения файлов вне хранилища.
+func TestStore_OpenFile(t *testing.T) {
+	s := newTestStore(t, Config{})
+	os.WriteFile(filepath.Join(s.config.Dir, "secret.txt"), []byte("secret"), 0o600)
+
+	for _, name := range []string{"secret.txt", "../deadletter-x.ndjson", "deadletter-x.ndjson/../secret.txt"} {
+		if _, err := s.OpenFile(name); !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("OpenFile(%q) = %v, ожидалась ErrInvalidFileName", name, err)
+		}
+	}
+	if _, err := s.OpenFile("deadletter-missing.ndjson"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenFile() = %v, ожидалась os.ErrNotExist", err)
+	}
+}
+
+// TestStore_Disabled проверяет nil и закрытое хранилище.
+func TestStore_Disabled(t *testing.T) {
+	var disabled *Store
+	if err := disabled.Write(Entry{Reason: "ErrInvalidJSON"}); err != nil {
+		t.Errorf("nil Store: Write() = %v", err)
+	}
+	if err := disabled.Close(); err != nil {
+		t.Errorf("nil Store: Close() = %v", err)
+	}
+
+	s := newTestStore(t, Config{})
+	s.Close()
+	if err := s.Write(Entry{Reason: "ErrInvalidJSON"}); err == nil {
+		t.Error("ожидалась ошибка записи в закрытое хранилище")
+	}
+	if stats := s.Stats(); stats.Failed != 1 {
+		t.Errorf("Failed = %d, ожидалось 1", stats.Failed)
+	}
+}
@@ -1,13 +1,104 @@
 package event
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrMissingVersion    = errors.New("event: missing required field 'v'")
 	ErrMissingRunID      = errors.New("event: missing required field 'runId'")
 	ErrMissingSourceID   = errors.New("event: missing required field 'sourceId'")
 	ErrInvalidFrameIndex = errors.New("event: invalid frameIndex (must be >= 0)")
-	ErrInvalidSimTime    = errors.New("event: invalid simTime (must be >= 0)")
+	ErrInvalidSimTime    = errors.New("event: invalid simTime (must be finite and >= 0)")
 	ErrInvalidJSON       = errors.New("event: invalid JSON format")
 	ErrEmptyLine         = errors.New("event: empty line")
+	ErrInvalidMsgPack    = errors.New("event: invalid MessagePack format")
+	ErrInvalidPayload    = errors.New("event: payload is not valid JSON")
+
+	ErrUnsupportedVersion = errors.New("event: unsupported version")
+	ErrMigrationFailed    = errors.New("event: version migration failed")
 )
+
+// errorCodes сопоставляет sentinel-ошибки с их машиночитаемыми кодами.
+var errorCodes = map[error]string{
+	ErrMissingVersion:    "ErrMissingVersion",
+	ErrMissingRunID:      "ErrMissingRunID",
+	ErrMissingSourceID:   "ErrMissingSourceID",
+	ErrInvalidFrameIndex: "ErrInvalidFrameIndex",
+	ErrInvalidSimTime:    "ErrInvalidSimTime",
+	ErrInvalidJSON:       "ErrInvalidJSON",
+	ErrEmptyLine:         "ErrEmptyLine",
+	ErrInvalidMsgPack:    "ErrInvalidMsgPack",
+	ErrInvalidPayload:    "ErrInvalidPayload",
+
+	ErrUnsupportedVersion: "ErrUnsupportedVersion",
+	ErrMigrationFailed:    "ErrMigrationFailed",
+}
+
+// ErrorCode возвращает машиночитаемый код ошибки парсинга/валидации.
+// Для ошибок, не относящихся к пакету event, возвращается "ErrUnknown".
+func ErrorCode(err error) string {
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return "ErrUnknown"
+}
+
+// maxExcerptLen - максимальная длина фрагмента строки в LineError.
+const maxExcerptLen = 120
+
+// LineError описывает ошибку разбора конкретной строки NDJSON.
+type LineError struct {
+	// Line - номер строки во входном потоке (начиная с 1)
+	Line int
+
+	// Excerpt - усечённый фрагмент исходной строки
+	Excerpt string
+
+	// Err - исходная ошибка (ErrInvalidJSON, ErrMissingRunID, ...)
+	Err error
+}
+
+// NewLineError создаёт LineError, усекая исходную строку до maxExcerptLen байт.
+func NewLineError(line int, raw string, err error) *LineError {
+	return &LineError{
+		Line:    line,
+		Excerpt: Excerpt(raw),
+		Err:     err,
+	}
+}
+
+// Error реализует интерфейс error.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap возвращает исходную ошибку для errors.Is/errors.As.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Code возвращает машиночитаемый код исходной ошибки.
+func (e *LineError) Code() string {
+	return ErrorCode(e.Err)
+}
+
+// Excerpt усекает строку до maxExcerptLen байт, не разрывая UTF-8 символы.
+func Excerpt(raw string) string {
+	if len(raw) <= maxExcerptLen {
+		return raw
+	}
+	cut := maxExcerptLen
+	for cut > 0 && !isRuneStart(raw[cut]) {
+		cut--
+	}
+	return raw[:cut] + "..."
+}
+
+// isRuneStart сообщает, является ли байт началом UTF-8 символа.
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
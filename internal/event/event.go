@@ -2,6 +2,7 @@ package event
 
 import (
 	"encoding/json"
+	"math"
 	"time"
 )
 
@@ -32,11 +33,33 @@ type Event struct {
 	// Время на хосте (epoch ms), опционально
 	WallTimeMs *int64 `json:"wallTimeMs,omitempty"`
 
+	// wallTimeMs, приведённое к часам сервера с учётом оценки смещения часов
+	// источника. Устанавливается ingest; значение клиента игнорируется.
+	WallTimeCorrectedMs *int64 `json:"wallTimeCorrectedMs,omitempty"`
+
+	// Порядковый номер события у источника в рамках run'а, опционально.
+	// Используется ingest для дедупликации повторных отправок и поиска пропусков.
+	Seq *uint64 `json:"seq,omitempty"`
+
 	// Произвольные теги для фильтрации
 	Tags map[string]string `json:"tags,omitempty"`
 
 	// Payload события (opaque, не парсится)
 	Payload json.RawMessage `json:"payload"`
+
+	// sourcePayload - payload до upgrade'ов Migrator'а
+	// (nil, если событие не приводилось к канонической версии)
+	sourcePayload json.RawMessage
+}
+
+// SourcePayload возвращает payload в том виде, в каком его отправил
+// источник: для события, приведённого Migrator'ом к канонической
+// версии, - payload до upgrade'ов, иначе Payload.
+func (e *Event) SourcePayload() json.RawMessage {
+	if e.sourcePayload != nil {
+		return e.sourcePayload
+	}
+	return e.Payload
 }
 
 // Validate проверяет обязательные поля события.
@@ -53,7 +76,9 @@ func (e *Event) Validate() error {
 	if e.FrameIndex < 0 {
 		return ErrInvalidFrameIndex
 	}
-	if e.SimTime < 0 {
+	// NaN и ±Inf из MessagePack не сериализуются в JSON (WebSocket,
+	// ClickHouse, dead-letter), поэтому отклоняются здесь
+	if e.SimTime < 0 || math.IsNaN(e.SimTime) || math.IsInf(e.SimTime, 0) {
 		return ErrInvalidSimTime
 	}
 	return nil
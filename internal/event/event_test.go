@@ -1,8 +1,12 @@
 package event
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 // TestEvent_Validate проверяет валидацию событий.
@@ -436,3 +440,66 @@ invalid json
 		}
 	})
 }
+
+// TestParseNDJSON_LineErrors проверяет номера строк и коды ошибок ParseNDJSON.
+func TestParseNDJSON_LineErrors(t *testing.T) {
+	data := []byte(`{"v":1,"runId":"run-123","sourceId":"flight-engine","frameIndex":0,"simTime":0.0}
+
+invalid json
+{"v":1,"sourceId":"flight-engine","frameIndex":0,"simTime":0.0}`)
+
+	_, errs := ParseNDJSON(data)
+	if len(errs) != 2 {
+		t.Fatalf("ParseNDJSON() вернула %d ошибок, ожидалось 2", len(errs))
+	}
+
+	expected := []struct {
+		line int
+		code string
+		err  error
+	}{
+		{3, "ErrInvalidJSON", ErrInvalidJSON},
+		{4, "ErrMissingRunID", ErrMissingRunID},
+	}
+
+	for i, exp := range expected {
+		var le *LineError
+		if !errors.As(errs[i], &le) {
+			t.Fatalf("ошибка %d: ожидался *LineError, получено %T", i, errs[i])
+		}
+		if le.Line != exp.line {
+			t.Errorf("ошибка %d: Line = %d, ожидалось %d", i, le.Line, exp.line)
+		}
+		if le.Code() != exp.code {
+			t.Errorf("ошибка %d: Code() = %q, ожидалось %q", i, le.Code(), exp.code)
+		}
+		if !errors.Is(errs[i], exp.err) {
+			t.Errorf("ошибка %d: errors.Is(%v) = false", i, exp.err)
+		}
+	}
+}
+
+// TestExcerpt проверяет усечение строк для отчётов об ошибках.
+func TestExcerpt(t *testing.T) {
+	t.Run("короткая строка не изменяется", func(t *testing.T) {
+		if got := Excerpt("short"); got != "short" {
+			t.Errorf("Excerpt() = %q, ожидалось %q", got, "short")
+		}
+	})
+
+	t.Run("длинная строка усекается без разрыва UTF-8", func(t *testing.T) {
+		got := Excerpt(strings.Repeat("ж", 200))
+		if !utf8.ValidString(got) {
+			t.Errorf("Excerpt() вернула невалидную UTF-8 строку: %q", got)
+		}
+		if len(got) > maxExcerptLen+3 {
+			t.Errorf("длина Excerpt() = %d, ожидалось не более %d", len(got), maxExcerptLen+3)
+		}
+	})
+
+	t.Run("неизвестная ошибка → ErrUnknown", func(t *testing.T) {
+		if got := ErrorCode(io.EOF); got != "ErrUnknown" {
+			t.Errorf("ErrorCode() = %q, ожидалось %q", got, "ErrUnknown")
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurrentVersion - каноническая версия события (поле v), в которой события
+// публикуются в EventBus и хранятся.
+const CurrentVersion = 3
+
+// RawEvent - конверт события до строгого разбора: поля верхнего уровня
+// с исходными JSON-значениями. Upgrade'ы работают с RawEvent, поэтому
+// конверт старой версии может отличаться от канонического именами
+// и типами полей.
+type RawEvent map[string]json.RawMessage
+
+// Version возвращает версию конверта (поле v). Конверт без поля v
+// (или с v: null, v: 0) даёт ErrMissingVersion, как и Event.Validate.
+func (r RawEvent) Version() (int, error) {
+	data, ok := r["v"]
+	if !ok || string(data) == "null" {
+		return 0, ErrMissingVersion
+	}
+	var v int
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, ErrInvalidJSON
+	}
+	if v == 0 {
+		return 0, ErrMissingVersion
+	}
+	return v, nil
+}
+
+// UpgradeFunc переводит конверт версии from в версию from+1.
+// Функция изменяет конверт на месте; поле v выставляет Migrator.
+type UpgradeFunc func(raw RawEvent) error
+
+// Migrator приводит события старых версий к канонической форме
+// цепочкой зарегистрированных UpgradeFunc (v1 → v2 → ... → current).
+// Upgrade'ы применяются к RawEvent до строгого разбора в Event.
+// События версий новее канонической и версий без пути upgrade'ов
+// отклоняются с ErrUnsupportedVersion.
+// Регистрация выполняется при инициализации; после этого Migrator
+// безопасен для конкурентного использования.
+type Migrator struct {
+	current  int
+	upgrades map[int]UpgradeFunc
+}
+
+// NewMigrator создаёт Migrator с канонической версией current.
+// Без зарегистрированных upgrade'ов поддерживается только current.
+func NewMigrator(current int) *Migrator {
+	return &Migrator{
+		current:  current,
+		upgrades: make(map[int]UpgradeFunc),
+	}
+}
+
+// DefaultMigrator возвращает Migrator с upgrade'ами, встроенными в сервер
+// (см. registerMigrations).
+func DefaultMigrator() *Migrator {
+	m := NewMigrator(CurrentVersion)
+	registerMigrations(m)
+	return m
+}
+
+// registerMigrations регистрирует upgrade'ы предыдущих версий события.
+// Когда каноническая форма меняется, CurrentVersion увеличивается, а здесь
+// добавляется upgrade с предыдущей версии.
+func registerMigrations(m *Migrator) {
+	m.Register(1, upgradeV1)
+	m.Register(2, upgradeV2)
+}
+
+// upgradeV1 переводит конверт v1 в v2: движки первого поколения
+// передавали время хоста в секундах в поле wallTime.
+func upgradeV1(raw RawEvent) error {
+	data, ok := raw["wallTime"]
+	if !ok {
+		return nil
+	}
+	delete(raw, "wallTime")
+	if _, exists := raw["wallTimeMs"]; exists || string(data) == "null" {
+		return nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("wallTime: %w", err)
+	}
+	ms := math.Round(seconds * 1000)
+	if ms < math.MinInt64 || ms >= math.MaxInt64 {
+		return fmt.Errorf("wallTime out of range: %s", data)
+	}
+	raw["wallTimeMs"] = json.RawMessage(strconv.FormatInt(int64(ms), 10))
+	return nil
+}
+
+// upgradeV2 переводит конверт v2 в v3: движки второго поколения
+// передавали значения тегов числами и логическими значениями.
+// Такие значения приводятся к строкам, теги со значением null удаляются.
+func upgradeV2(raw RawEvent) error {
+	data, ok := raw["tags"]
+	if !ok || string(data) == "null" {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tags map[string]any
+	if err := dec.Decode(&tags); err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	converted := make(map[string]string, len(tags))
+	for key, value := range tags {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			converted[key] = value
+		case json.Number:
+			converted[key] = value.String()
+		case bool:
+			converted[key] = strconv.FormatBool(value)
+		default:
+			return fmt.Errorf("tag %q: unsupported value type %T", key, value)
+		}
+	}
+	encoded, err := json.Marshal(converted)
+	if err != nil {
+		return err
+	}
+	raw["tags"] = encoded
+	return nil
+}
+
+// Register регистрирует upgrade с версии from на from+1.
+// Паникует, если from вне диапазона [1, current) или upgrade уже
+// зарегистрирован: это ошибка программы, а не входных данных.
+func (m *Migrator) Register(from int, fn UpgradeFunc) {
+	if from < 1 || from >= m.current {
+		panic(fmt.Sprintf("event: cannot register upgrade from v%d (current v%d)", from, m.current))
+	}
+	if _, exists := m.upgrades[from]; exists {
+		panic(fmt.Sprintf("event: upgrade from v%d already registered", from))
+	}
+	m.upgrades[from] = fn
+}
+
+// Current возвращает каноническую версию.
+func (m *Migrator) Current() int {
+	return m.current
+}
+
+// Supports сообщает, принимается ли событие версии v: версия
+// каноническая или приводится к ней цепочкой upgrade'ов.
+func (m *Migrator) Supports(v int) bool {
+	if v < 1 || v > m.current {
+		return false
+	}
+	for ; v < m.current; v++ {
+		if _, ok := m.upgrades[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Versions возвращает каноническую версию и старые версии, для которых
+// есть путь upgrade'ов, по возрастанию.
+func (m *Migrator) Versions() []int {
+	versions := []int{m.current}
+	for v := m.current - 1; v >= 1; v-- {
+		if _, ok := m.upgrades[v]; !ok {
+			break
+		}
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Migrate приводит конверт к канонической версии и возвращает исходную
+// версию. Возвращает ErrMissingVersion для конверта без v,
+// ErrUnsupportedVersion для версии новее канонической или версии без
+// пути upgrade'ов и ErrMigrationFailed, если upgrade вернул ошибку.
+// При ошибке конверт может быть изменён частично.
+func (m *Migrator) Migrate(raw RawEvent) (int, error) {
+	from, err := raw.Version()
+	if err != nil {
+		return 0, err
+	}
+	if !m.Supports(from) {
+		return from, m.unsupported(from)
+	}
+
+	for v := from; v < m.current; v++ {
+		if err := m.upgrades[v](raw); err != nil {
+			return from, fmt.Errorf("%w: v%d → v%d: %v", ErrMigrationFailed, v, v+1, err)
+		}
+	}
+	if from < m.current {
+		raw["v"] = json.RawMessage(strconv.Itoa(m.current))
+	}
+	return from, nil
+}
+
+// unsupported возвращает ошибку неподдерживаемой версии v.
+func (m *Migrator) unsupported(v int) error {
+	return fmt.Errorf("%w: v%d", ErrUnsupportedVersion, v)
+}
+
+// ParseRaw приводит конверт к канонической версии и разбирает его в Event.
+// Возвращает событие и исходную версию конверта; payload до upgrade'ов
+// доступен через Event.SourcePayload. Конверт после upgrade'ов
+// разбирается и проверяется так же, как канонический: ошибки разбора
+// дают ErrInvalidJSON, ошибки Validate возвращаются как есть.
+func (m *Migrator) ParseRaw(raw RawEvent) (*Event, int, error) {
+	// upgrade'ы заменяют значения конверта, а не изменяют их байты
+	payload := raw["payload"]
+	from, err := m.Migrate(raw)
+	if err != nil {
+		return nil, from, err
+	}
+
+	var e Event
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &e)
+	}
+	if err != nil {
+		return nil, from, ErrInvalidJSON
+	}
+	if err := e.Validate(); err != nil {
+		return nil, from, err
+	}
+	if from < m.current {
+		e.sourcePayload = payload
+		if e.sourcePayload == nil {
+			e.sourcePayload = json.RawMessage("null")
+		}
+	}
+	return &e, from, nil
+}
+
+// ParseNDJSONLine парсит строку NDJSON, приводя событие к канонической
+// версии. Возвращает событие и исходную версию; ошибки - как у
+// ParseNDJSONLine и Migrate. Событие канонической версии разбирается
+// один раз; RawEvent строится только для поддерживаемых старых версий
+// и строк, которые не разбираются в Event.
+func (m *Migrator) ParseNDJSONLine(line string) (*Event, int, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, 0, ErrEmptyLine
+	}
+
+	var e Event
+	if err := json.Unmarshal([]byte(line), &e); err == nil {
+		switch {
+		case e.V == m.current:
+			if err := e.Validate(); err != nil {
+				return nil, e.V, err
+			}
+			return &e, e.V, nil
+		case e.V == 0:
+			return nil, 0, ErrMissingVersion
+		case !m.Supports(e.V):
+			return nil, e.V, m.unsupported(e.V)
+		}
+	}
+
+	// Старая версия может отличаться типами полей, поэтому строгий
+	// разбор выполняется после upgrade'ов
+	var raw RawEvent
+	if err := json.Unmarshal([]byte(line), &raw); err != nil || raw == nil {
+		return nil, 0, ErrInvalidJSON
+	}
+	v, err := raw.Version()
+	if err != nil {
+		return nil, 0, err
+	}
+	if v == m.current {
+		// Событие канонической версии не разобралось в Event
+		return nil, v, ErrInvalidJSON
+	}
+	return m.ParseRaw(raw)
+}
+
+// DecodeMsgPack читает следующее событие из потока MessagePack, приводя
+// его к канонической версии. Возвращает событие и исходную версию;
+// ошибки - как у MsgPackDecoder.Decode и Migrate.
+//
+// Поля канонического конверта читаются строго, поэтому в MessagePack они
+// должны иметь канонические типы во всех версиях; остальные поля
+// передаются upgrade'ам как JSON.
+func (m *Migrator) DecodeMsgPack(d *MsgPackDecoder) (*Event, int, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, 0, err
+	}
+
+	var e Event
+	raw := make(RawEvent)
+	if err := d.decodeEvent(&e, raw); err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case e.V == m.current:
+		if err := e.Validate(); err != nil {
+			return nil, e.V, err
+		}
+		return &e, e.V, nil
+	case e.V == 0:
+		return nil, 0, ErrMissingVersion
+	case !m.Supports(e.V):
+		return nil, e.V, m.unsupported(e.V)
+	}
+
+	// Конверт собирается из полей, которые были в исходной map
+	data, err := json.Marshal(&e)
+	if err != nil {
+		return nil, e.V, err
+	}
+	var decoded RawEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, e.V, err
+	}
+	for key, value := range raw {
+		if value == nil {
+			raw[key] = decoded[key]
+		}
+	}
+	return m.ParseRaw(raw)
+}
@@ -0,0 +1,337 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// newTestMigrator создаёт Migrator с канонической версией 3:
+// v1 хранил канал в тегах, v2 - payload без обёртки "state".
+func newTestMigrator() *Migrator {
+	m := NewMigrator(3)
+	m.Register(1, func(raw RawEvent) error {
+		var tags map[string]string
+		if err := json.Unmarshal(raw["tags"], &tags); err != nil {
+			return err
+		}
+		channel, _ := json.Marshal(tags["channel"])
+		raw["channel"] = channel
+		delete(tags, "channel")
+		raw["tags"], _ = json.Marshal(tags)
+		return nil
+	})
+	m.Register(2, func(raw RawEvent) error {
+		if len(raw["payload"]) == 0 {
+			return errors.New("missing payload")
+		}
+		raw["payload"] = json.RawMessage(`{"state":` + string(raw["payload"]) + `}`)
+		return nil
+	})
+	return m
+}
+
+// TestMigrator_ParseNDJSONLine проверяет цепочку upgrade'ов.
+func TestMigrator_ParseNDJSONLine(t *testing.T) {
+	m := newTestMigrator()
+
+	t.Run("v1 проходит всю цепочку", func(t *testing.T) {
+		e, from, err := m.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"flight-engine","tags":{"channel":"physics"},"payload":{"x":1}}`)
+		if err != nil {
+			t.Fatalf("ParseNDJSONLine() вернула ошибку: %v", err)
+		}
+		if from != 1 || e.V != 3 || e.Channel != "physics" || len(e.Tags) != 0 || string(e.Payload) != `{"state":{"x":1}}` {
+			t.Errorf("событие после миграции: v%d → %+v (payload %s)", from, e, e.Payload)
+		}
+		if string(e.SourcePayload()) != `{"x":1}` {
+			t.Errorf("SourcePayload() = %s, ожидался payload до upgrade'ов", e.SourcePayload())
+		}
+	})
+
+	t.Run("каноническая версия не изменяется", func(t *testing.T) {
+		e, from, err := m.ParseNDJSONLine(`{"v":3,"runId":"run-1","sourceId":"flight-engine","payload":{"x":1}}`)
+		if err != nil || from != 3 || string(e.Payload) != `{"x":1}` || string(e.SourcePayload()) != `{"x":1}` {
+			t.Errorf("ParseNDJSONLine() = %+v, v%d, %v", e, from, err)
+		}
+	})
+
+	t.Run("upgrade получает конверт до строгого разбора", func(t *testing.T) {
+		// В v1 frameIndex передавался строкой
+		m := NewMigrator(2)
+		m.Register(1, func(raw RawEvent) error {
+			var frame string
+			if err := json.Unmarshal(raw["frameIndex"], &frame); err != nil {
+				return err
+			}
+			raw["frameIndex"] = json.RawMessage(frame)
+			return nil
+		})
+		e, _, err := m.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"flight-engine","frameIndex":"42"}`)
+		if err != nil || e.FrameIndex != 42 {
+			t.Errorf("ParseNDJSONLine() = %+v, %v", e, err)
+		}
+	})
+
+	t.Run("версия новее канонической → ErrUnsupportedVersion", func(t *testing.T) {
+		for _, line := range []string{
+			`{"v":4,"runId":"run-1","sourceId":"flight-engine","payload":{"x":1}}`,
+			`{"v":4,"runId":1}`,
+		} {
+			if _, from, err := m.ParseNDJSONLine(line); !errors.Is(err, ErrUnsupportedVersion) || from != 4 {
+				t.Errorf("%s: ParseNDJSONLine() = v%d, %v, ожидалась ErrUnsupportedVersion", line, from, err)
+			}
+		}
+	})
+
+	t.Run("неподдерживаемые версии → ErrUnsupportedVersion", func(t *testing.T) {
+		// Без upgrade'а v2 → v3 старые версии не приводятся к канонической
+		partial := NewMigrator(3)
+		partial.Register(1, func(raw RawEvent) error { return nil })
+		for _, line := range []string{
+			`{"v":1,"runId":"run-1","sourceId":"flight-engine"}`,
+			`{"v":2,"runId":"run-1","sourceId":"flight-engine"}`,
+			`{"v":-1,"runId":"run-1","sourceId":"flight-engine"}`,
+		} {
+			if _, _, err := partial.ParseNDJSONLine(line); !errors.Is(err, ErrUnsupportedVersion) {
+				t.Errorf("%s: ParseNDJSONLine() = %v, ожидалась ErrUnsupportedVersion", line, err)
+			}
+		}
+		if _, _, err := m.ParseNDJSONLine(`{"v":-1}`); ErrorCode(err) != "ErrUnsupportedVersion" {
+			t.Errorf("код = %q", ErrorCode(err))
+		}
+	})
+
+	t.Run("конверт без v → ErrMissingVersion", func(t *testing.T) {
+		for _, line := range []string{
+			`{"runId":"run-1","sourceId":"flight-engine"}`,
+			`{"v":null,"runId":"run-1","sourceId":"flight-engine"}`,
+			`{"v":0,"runId":"run-1","sourceId":"flight-engine"}`,
+			`{"runId":1}`,
+		} {
+			if _, _, err := m.ParseNDJSONLine(line); !errors.Is(err, ErrMissingVersion) {
+				t.Errorf("%s: ParseNDJSONLine() = %v, ожидалась ErrMissingVersion", line, err)
+			}
+		}
+	})
+
+	t.Run("ошибка upgrade → ErrMigrationFailed", func(t *testing.T) {
+		if _, _, err := m.ParseNDJSONLine(`{"v":2,"runId":"run-1","sourceId":"flight-engine"}`); !errors.Is(err, ErrMigrationFailed) {
+			t.Errorf("ParseNDJSONLine() = %v, ожидалась ErrMigrationFailed", err)
+		}
+	})
+
+	t.Run("результат upgrade разбирается и проверяется как канонический", func(t *testing.T) {
+		if _, _, err := m.ParseNDJSONLine(`{"v":1,"sourceId":"flight-engine","tags":{},"payload":{}}`); !errors.Is(err, ErrMissingRunID) {
+			t.Errorf("ParseNDJSONLine() = %v, ожидалась ErrMissingRunID", err)
+		}
+		if _, _, err := m.ParseNDJSONLine(`{"v":2,"runId":1,"payload":{}}`); !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("ParseNDJSONLine() = %v, ожидалась ErrInvalidJSON", err)
+		}
+	})
+
+	t.Run("ошибки разбора канонической версии", func(t *testing.T) {
+		cases := map[string]error{
+			"":                                   ErrEmptyLine,
+			`{"v":3,`:                            ErrInvalidJSON,
+			`null`:                               ErrMissingVersion,
+			`{"v":3,"runId":1}`:                  ErrInvalidJSON,
+			`{"v":"3","runId":"run-1"}`:          ErrInvalidJSON,
+			`{"v":3,"sourceId":"flight-engine"}`: ErrMissingRunID,
+		}
+		for line, want := range cases {
+			if _, _, err := m.ParseNDJSONLine(line); !errors.Is(err, want) {
+				t.Errorf("%q: ParseNDJSONLine() = %v, ожидалась %v", line, err, want)
+			}
+		}
+	})
+}
+
+// TestDefaultMigrator проверяет встроенные upgrade'ы конвертов v1 и v2.
+func TestDefaultMigrator(t *testing.T) {
+	m := DefaultMigrator()
+
+	t.Run("v1: wallTime в секундах → wallTimeMs", func(t *testing.T) {
+		e, from, err := m.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"flight-engine","frameIndex":7,"wallTime":1700000000.1234,"tags":{"gear":3},"payload":{"x":1}}`)
+		if err != nil {
+			t.Fatalf("ParseNDJSONLine() вернула ошибку: %v", err)
+		}
+		if from != 1 || e.V != CurrentVersion || e.FrameIndex != 7 || e.WallTimeMs == nil || *e.WallTimeMs != 1700000000123 || e.Tags["gear"] != "3" {
+			t.Errorf("событие после миграции: v%d → %+v", from, e)
+		}
+		if string(e.Payload) != `{"x":1}` {
+			t.Errorf("Payload = %s", e.Payload)
+		}
+	})
+
+	t.Run("v1: wallTimeMs имеет приоритет над wallTime", func(t *testing.T) {
+		e, _, err := m.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"flight-engine","wallTime":1,"wallTimeMs":5}`)
+		if err != nil || e.WallTimeMs == nil || *e.WallTimeMs != 5 {
+			t.Errorf("ParseNDJSONLine() = %+v, %v", e, err)
+		}
+	})
+
+	t.Run("v2: значения тегов приводятся к строкам", func(t *testing.T) {
+		e, from, err := m.ParseNDJSONLine(`{"v":2,"runId":"run-1","sourceId":"flight-engine","tags":{"gear":3,"ratio":1.50,"abs":true,"driver":"a","none":null}}`)
+		if err != nil {
+			t.Fatalf("ParseNDJSONLine() вернула ошибку: %v", err)
+		}
+		want := map[string]string{"gear": "3", "ratio": "1.50", "abs": "true", "driver": "a"}
+		if from != 2 || e.V != CurrentVersion || !reflect.DeepEqual(e.Tags, want) {
+			t.Errorf("событие после миграции: v%d → %+v", from, e)
+		}
+	})
+
+	t.Run("конверт v1 в канонической форме не изменяется", func(t *testing.T) {
+		e, from, err := m.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"flight-engine","channel":"physics","type":"body.state","frameIndex":7,"simTime":0.5,"wallTimeMs":42,"tags":{"a":"b"},"payload":{"x":1}}`)
+		if err != nil || from != 1 || e.V != CurrentVersion || e.Channel != "physics" || *e.WallTimeMs != 42 || e.Tags["a"] != "b" || string(e.Payload) != `{"x":1}` {
+			t.Errorf("ParseNDJSONLine() = %+v, v%d, %v", e, from, err)
+		}
+	})
+
+	t.Run("ошибки upgrade'ов → ErrMigrationFailed", func(t *testing.T) {
+		for _, line := range []string{
+			`{"v":1,"runId":"run-1","sourceId":"flight-engine","wallTime":"now"}`,
+			`{"v":1,"runId":"run-1","sourceId":"flight-engine","wallTime":1e300}`,
+			`{"v":2,"runId":"run-1","sourceId":"flight-engine","tags":{"a":{"b":1}}}`,
+			`{"v":2,"runId":"run-1","sourceId":"flight-engine","tags":[1]}`,
+		} {
+			if _, _, err := m.ParseNDJSONLine(line); !errors.Is(err, ErrMigrationFailed) {
+				t.Errorf("%s: ParseNDJSONLine() = %v, ожидалась ErrMigrationFailed", line, err)
+			}
+		}
+	})
+
+	t.Run("неподдерживаемые версии отклоняются", func(t *testing.T) {
+		for _, v := range []int{-1, CurrentVersion + 1, CurrentVersion + 2} {
+			line := fmt.Sprintf(`{"v":%d,"runId":"run-1","sourceId":"flight-engine","payload":{"x":1}}`, v)
+			if _, from, err := m.ParseNDJSONLine(line); !errors.Is(err, ErrUnsupportedVersion) || from != v {
+				t.Errorf("v%d: ParseNDJSONLine() = v%d, %v, ожидалась ErrUnsupportedVersion", v, from, err)
+			}
+		}
+		if _, _, err := m.ParseNDJSONLine(`{"run_id":"run-1","source_id":"flight-engine"}`); !errors.Is(err, ErrMissingVersion) {
+			t.Errorf("ParseNDJSONLine() = %v, ожидалась ErrMissingVersion", err)
+		}
+	})
+}
+
+// TestMigrator_DecodeMsgPack проверяет приведение версий событий MessagePack.
+func TestMigrator_DecodeMsgPack(t *testing.T) {
+	// В v1 frameIndex передавался в поле frame
+	m := NewMigrator(2)
+	m.Register(1, func(raw RawEvent) error {
+		raw["frameIndex"] = raw["frame"]
+		delete(raw, "frame")
+		return nil
+	})
+
+	var data []byte
+	data = appendMsgPackMapHeader(data, 4)
+	data = appendMsgPackString(data, "v")
+	data = appendMsgPackInt(data, 1)
+	data = appendMsgPackString(data, "runId")
+	data = appendMsgPackString(data, "run-1")
+	data = appendMsgPackString(data, "sourceId")
+	data = appendMsgPackString(data, "flight-engine")
+	data = appendMsgPackString(data, "frame")
+	data = appendMsgPackInt(data, 7)
+	// Каноническое событие следом
+	data = append(data, MarshalMsgPack(&Event{V: 2, RunID: "run-2", SourceID: "drive-engine", Payload: json.RawMessage(`{}`)})...)
+	// Событие версии новее канонической
+	data = append(data, MarshalMsgPack(&Event{V: 3, RunID: "run-4", SourceID: "drive-engine", Payload: json.RawMessage(`{}`)})...)
+	// Событие без v
+	data = appendMsgPackMapHeader(data, 1)
+	data = appendMsgPackString(data, "runId")
+	data = appendMsgPackString(data, "run-3")
+
+	d := NewMsgPackDecoder(bytes.NewReader(data))
+	e, from, err := m.DecodeMsgPack(d)
+	if err != nil {
+		t.Fatalf("DecodeMsgPack() вернула ошибку: %v", err)
+	}
+	if from != 1 || e.V != 2 || e.RunID != "run-1" || e.SourceID != "flight-engine" || e.FrameIndex != 7 {
+		t.Errorf("событие v%d: %+v", from, e)
+	}
+
+	e, from, err = m.DecodeMsgPack(d)
+	if err != nil || from != 2 || e.RunID != "run-2" {
+		t.Errorf("DecodeMsgPack() = %+v, v%d, %v", e, from, err)
+	}
+
+	if _, from, err := m.DecodeMsgPack(d); !errors.Is(err, ErrUnsupportedVersion) || from != 3 {
+		t.Errorf("DecodeMsgPack() = v%d, %v, ожидалась ErrUnsupportedVersion", from, err)
+	}
+
+	if _, _, err := m.DecodeMsgPack(d); !errors.Is(err, ErrMissingVersion) {
+		t.Errorf("DecodeMsgPack() = %v, ожидалась ErrMissingVersion", err)
+	}
+}
+
+// TestMsgPackDecoder_readJSON проверяет преобразование значений MessagePack в JSON.
+func TestMsgPackDecoder_readJSON(t *testing.T) {
+	var data []byte
+	data = appendMsgPackMapHeader(data, 5)
+	data = appendMsgPackString(data, "n")
+	data = appendMsgPackInt(data, -3)
+	data = appendMsgPackString(data, "s")
+	data = appendMsgPackString(data, "x")
+	data = appendMsgPackString(data, "a")
+	data = append(data, 0x93, 0xc0, 0xc3, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0) // [nil, true, 1.5]
+	data = appendMsgPackString(data, "b")
+	data = appendMsgPackBin(data, []byte("hi"))
+	data = appendMsgPackString(data, "e")
+	data = append(data, 0xd4, 0x01, 0x00) // fixext1
+
+	got, err := NewMsgPackDecoder(bytes.NewReader(data)).readJSON()
+	if err != nil {
+		t.Fatalf("readJSON() вернула ошибку: %v", err)
+	}
+	if want := `{"a":[null,true,1.5],"b":"aGk=","e":null,"n":-3,"s":"x"}`; string(got) != want {
+		t.Errorf("readJSON() = %s, ожидалось %s", got, want)
+	}
+}
+
+// TestMigrator_Versions проверяет список поддерживаемых версий.
+func TestMigrator_Versions(t *testing.T) {
+	if got := newTestMigrator().Versions(); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("Versions() = %v, ожидалось [1 2 3]", got)
+	}
+
+	// Без upgrade'а v2 → v3 версии 1 и 2 не поддерживаются
+	m := NewMigrator(3)
+	m.Register(1, func(raw RawEvent) error { return nil })
+	if got := m.Versions(); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("Versions() = %v, ожидалось [3]", got)
+	}
+	if m.Supports(1) {
+		t.Error("v1 не должна поддерживаться без полной цепочки")
+	}
+
+	if got := DefaultMigrator().Versions(); !reflect.DeepEqual(got, []int{1, 2, CurrentVersion}) {
+		t.Errorf("DefaultMigrator().Versions() = %v", got)
+	}
+}
+
+// TestMigrator_Register проверяет ошибки регистрации.
+func TestMigrator_Register(t *testing.T) {
+	registrations := map[string]func(m *Migrator){
+		"upgrade с канонической версии": func(m *Migrator) { m.Register(2, func(raw RawEvent) error { return nil }) },
+		"upgrade с v0": func(m *Migrator) { m.Register(0, func(raw RawEvent) error { return nil }) },
+		"повторная регистрация": func(m *Migrator) {
+			m.Register(1, func(raw RawEvent) error { return nil })
+			m.Register(1, func(raw RawEvent) error { return nil })
+		},
+	}
+	for name, register := range registrations {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("ожидалась паника")
+				}
+			}()
+			register(NewMigrator(2))
+		})
+	}
+}
@@ -0,0 +1,842 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+)
+
+// MessagePack - бинарный формат события, альтернативный NDJSON.
+//
+// Событие кодируется как MessagePack map с теми же ключами, что и JSON
+// представление (v, runId, sourceId, channel, type, frameIndex, simTime,
+// wallTimeMs, wallTimeCorrectedMs, seq, tags, payload). Payload передаётся как bin (или str) с
+// JSON-байтами и не декодируется - так же, как json.RawMessage в NDJSON.
+// Поток событий - конкатенация таких map без разделителей.
+
+// Ограничения декодера для защиты от некорректных входных данных.
+const (
+	// maxMsgPackLen - максимальная длина строки, bin или контейнера
+	maxMsgPackLen = 16 << 20
+
+	// maxMsgPackDepth - максимальная вложенность пропускаемых значений
+	maxMsgPackDepth = 32
+
+	// msgPackPrealloc - сколько байт или элементов выделяется заранее по
+	// заголовку длины. Длина из заголовка не проверена: большие значения
+	// читаются с ростом буфера по мере поступления данных.
+	msgPackPrealloc = 4096
+)
+
+// Маркеры формата MessagePack.
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt2  = 0xd5
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+)
+
+// MsgPackDecoder читает поток событий в формате MessagePack.
+type MsgPackDecoder struct {
+	r *bufio.Reader
+}
+
+// NewMsgPackDecoder создаёт декодер потока MessagePack событий.
+func NewMsgPackDecoder(r io.Reader) *MsgPackDecoder {
+	return &MsgPackDecoder{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Decode читает следующее событие из потока.
+// Возвращает io.EOF, если поток закончился между событиями.
+// Ошибки валидации (ErrMissingRunID и т.п.) не нарушают синхронизацию
+// потока - после них можно продолжать чтение. После ErrInvalidMsgPack
+// или ошибки чтения продолжать чтение нельзя.
+func (d *MsgPackDecoder) Decode() (*Event, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	var e Event
+	if err := d.decodeEvent(&e, nil); err != nil {
+		return nil, err
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// ParseMsgPack декодирует одно событие из MessagePack.
+// Аналог ParseNDJSONLine для бинарного формата: данные должны содержать
+// ровно одно событие.
+func ParseMsgPack(data []byte) (*Event, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyLine
+	}
+
+	r := bytes.NewReader(data)
+	d := NewMsgPackDecoder(r)
+	e, err := d.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.r.Buffered() > 0 || r.Len() > 0 {
+		return nil, ErrInvalidMsgPack
+	}
+	return e, nil
+}
+
+// ParseMsgPackStream парсит поток MessagePack событий.
+// Аналог ParseNDJSON: ошибки валидации возвращаются как *LineError с
+// порядковым номером события (начиная с 1) и не прерывают разбор.
+// Структурная ошибка формата прерывает разбор.
+func ParseMsgPackStream(data []byte) ([]*Event, []error) {
+	var events []*Event
+	var errs []error
+
+	d := NewMsgPackDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		e, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, &LineError{Line: i, Err: err})
+			if errors.Is(err, ErrInvalidMsgPack) {
+				break
+			}
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return events, errs
+}
+
+// decodeEvent декодирует MessagePack map в Event. Если raw не nil,
+// в него записываются ключи всех полей map: известные - с пустым
+// значением, неизвестные - со значением в JSON.
+func (d *MsgPackDecoder) decodeEvent(e *Event, raw RawEvent) error {
+	n, err := d.readMapLen()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := d.readString()
+		if err != nil {
+			return err
+		}
+
+		if raw != nil {
+			raw[key] = nil
+		}
+		switch key {
+		case "v":
+			e.V, err = d.readInt()
+		case "runId":
+			e.RunID, err = d.readString()
+		case "sourceId":
+			e.SourceID, err = d.readString()
+		case "channel":
+			e.Channel, err = d.readString()
+		case "type":
+			e.Type, err = d.readString()
+		case "frameIndex":
+			e.FrameIndex, err = d.readInt()
+		case "simTime":
+			e.SimTime, err = d.readFloat()
+		case "wallTimeMs":
+			e.WallTimeMs, err = d.readOptionalInt64()
+		case "wallTimeCorrectedMs":
+			e.WallTimeCorrectedMs, err = d.readOptionalInt64()
+		case "seq":
+			e.Seq, err = d.readOptionalUint64()
+		case "tags":
+			e.Tags, err = d.readTags()
+		case "payload":
+			e.Payload, err = d.readPayload()
+		default:
+			// Неизвестные поля пропускаются, как и в encoding/json
+			if raw != nil {
+				raw[key], err = d.readJSON()
+			} else {
+				err = d.skip(0)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Payload не парсится, но должен быть валидным JSON, чтобы событие
+	// можно было отдать в WebSocket и ClickHouse без изменений.
+	// Проверка выполняется после чтения всей map, чтобы не нарушить
+	// синхронизацию потока.
+	if e.Payload != nil && !json.Valid(e.Payload) {
+		return ErrInvalidPayload
+	}
+
+	return nil
+}
+
+// readByte читает один байт. Конец потока внутри объекта - ошибка формата.
+func (d *MsgPackDecoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == io.EOF {
+		return 0, ErrInvalidMsgPack
+	}
+	return b, err
+}
+
+// readN читает ровно n байт. Буфер больше msgPackPrealloc растёт
+// по мере чтения, поэтому ложный заголовок длины не выделяет память
+// сверх фактических данных.
+func (d *MsgPackDecoder) readN(n int) ([]byte, error) {
+	if n > maxMsgPackLen {
+		return nil, ErrInvalidMsgPack
+	}
+	if n <= msgPackPrealloc {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(d.r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrInvalidMsgPack
+			}
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(d.r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < n {
+		return nil, ErrInvalidMsgPack
+	}
+	return buf, nil
+}
+
+// discard пропускает ровно n байт без копирования.
+func (d *MsgPackDecoder) discard(n int) error {
+	if _, err := d.r.Discard(n); err != nil {
+		if err == io.EOF {
+			return ErrInvalidMsgPack
+		}
+		return err
+	}
+	return nil
+}
+
+// readUint читает беззнаковое целое размером size байт (big-endian).
+func (d *MsgPackDecoder) readUint(size int) (uint64, error) {
+	buf, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	default:
+		return binary.BigEndian.Uint64(buf), nil
+	}
+}
+
+// readLen читает длину строки/bin/контейнера размером size байт.
+func (d *MsgPackDecoder) readLen(size int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxMsgPackLen {
+		return 0, ErrInvalidMsgPack
+	}
+	return int(n), nil
+}
+
+// readMapLen читает заголовок map.
+func (d *MsgPackDecoder) readMapLen() (int, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == mpMap16:
+		return d.readLen(2)
+	case b == mpMap32:
+		return d.readLen(4)
+	default:
+		return 0, ErrInvalidMsgPack
+	}
+}
+
+// readString читает str (или bin, содержащий UTF-8).
+func (d *MsgPackDecoder) readString() (string, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return "", err
+	}
+	buf, err := d.readBytesAfter(b)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// readBytesAfter читает содержимое str/bin после маркера b.
+func (d *MsgPackDecoder) readBytesAfter(b byte) ([]byte, error) {
+	var n int
+	var err error
+	switch {
+	case b&0xe0 == 0xa0:
+		n = int(b & 0x1f)
+	case b == mpStr8 || b == mpBin8:
+		n, err = d.readLen(1)
+	case b == mpStr16 || b == mpBin16:
+		n, err = d.readLen(2)
+	case b == mpStr32 || b == mpBin32:
+		n, err = d.readLen(4)
+	default:
+		return nil, ErrInvalidMsgPack
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.readN(n)
+}
+
+// readInt64After читает целое число после маркера b.
+func (d *MsgPackDecoder) readInt64After(b byte) (int64, error) {
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	}
+
+	switch b {
+	case mpUint8:
+		v, err := d.readUint(1)
+		return int64(v), err
+	case mpUint16:
+		v, err := d.readUint(2)
+		return int64(v), err
+	case mpUint32:
+		v, err := d.readUint(4)
+		return int64(v), err
+	case mpUint64:
+		v, err := d.readUint(8)
+		if err == nil && v > math.MaxInt64 {
+			return 0, ErrInvalidMsgPack
+		}
+		return int64(v), err
+	case mpInt8:
+		v, err := d.readUint(1)
+		return int64(int8(v)), err
+	case mpInt16:
+		v, err := d.readUint(2)
+		return int64(int16(v)), err
+	case mpInt32:
+		v, err := d.readUint(4)
+		return int64(int32(v)), err
+	case mpInt64:
+		v, err := d.readUint(8)
+		return int64(v), err
+	default:
+		return 0, ErrInvalidMsgPack
+	}
+}
+
+// readInt читает целое число, помещающееся в int.
+func (d *MsgPackDecoder) readInt() (int, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	v, err := d.readInt64After(b)
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxInt || v < math.MinInt {
+		return 0, ErrInvalidMsgPack
+	}
+	return int(v), nil
+}
+
+// readOptionalInt64 читает целое число или nil.
+func (d *MsgPackDecoder) readOptionalInt64() (*int64, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if b == mpNil {
+		return nil, nil
+	}
+	v, err := d.readInt64After(b)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// readOptionalUint64 читает неотрицательное целое число или nil.
+func (d *MsgPackDecoder) readOptionalUint64() (*uint64, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if b == mpNil {
+		return nil, nil
+	}
+	if b == mpUint64 {
+		// Полный диапазон uint64 не помещается в int64
+		v, err := d.readUint(8)
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}
+	v, err := d.readInt64After(b)
+	if err != nil {
+		return nil, err
+	}
+	if v < 0 {
+		return nil, ErrInvalidMsgPack
+	}
+	u := uint64(v)
+	return &u, nil
+}
+
+// readFloat читает float32/float64 или целое число.
+func (d *MsgPackDecoder) readFloat() (float64, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch b {
+	case mpFloat32:
+		v, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case mpFloat64:
+		v, err := d.readUint(8)
+		return math.Float64frombits(v), err
+	default:
+		v, err := d.readInt64After(b)
+		return float64(v), err
+	}
+}
+
+// readTags читает map строк или nil.
+func (d *MsgPackDecoder) readTags() (map[string]string, error) {
+	b, err := d.r.Peek(1)
+	if err == io.EOF {
+		return nil, ErrInvalidMsgPack
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b[0] == mpNil {
+		_, _ = d.r.ReadByte()
+		return nil, nil
+	}
+
+	n, err := d.readMapLen()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, min(n, msgPackPrealloc))
+	for i := 0; i < n; i++ {
+		k, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// readPayload читает opaque payload (bin или str с JSON) или nil.
+func (d *MsgPackDecoder) readPayload() (json.RawMessage, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if b == mpNil {
+		return nil, nil
+	}
+	buf, err := d.readBytesAfter(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(buf), nil
+}
+
+// readJSON читает значение любого типа и возвращает его в виде JSON.
+// bin кодируется в base64, как []byte в encoding/json; ext заменяется на null.
+func (d *MsgPackDecoder) readJSON() (json.RawMessage, error) {
+	v, err := d.readValue(0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, ErrInvalidMsgPack
+	}
+	return data, nil
+}
+
+// readValue читает значение любого типа в виде, пригодном для json.Marshal.
+func (d *MsgPackDecoder) readValue(depth int) (any, error) {
+	if depth > maxMsgPackDepth {
+		return nil, ErrInvalidMsgPack
+	}
+
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var items int
+	isMap := false
+	switch {
+	case b <= 0x7f || b >= 0xe0:
+		return d.readInt64After(b)
+	case b&0xf0 == 0x80:
+		items, isMap = int(b&0x0f), true
+	case b&0xf0 == 0x90:
+		items = int(b & 0x0f)
+	case b&0xe0 == 0xa0:
+		buf, err := d.readBytesAfter(b)
+		return string(buf), err
+	default:
+		switch b {
+		case mpNil:
+			return nil, nil
+		case mpFalse:
+			return false, nil
+		case mpTrue:
+			return true, nil
+		case mpUint64:
+			return d.readUint(8)
+		case mpUint8, mpUint16, mpUint32, mpInt8, mpInt16, mpInt32, mpInt64:
+			return d.readInt64After(b)
+		case mpFloat32:
+			v, err := d.readUint(4)
+			return math.Float32frombits(uint32(v)), err
+		case mpFloat64:
+			v, err := d.readUint(8)
+			return math.Float64frombits(v), err
+		case mpStr8, mpStr16, mpStr32:
+			buf, err := d.readBytesAfter(b)
+			return string(buf), err
+		case mpBin8, mpBin16, mpBin32:
+			return d.readBytesAfter(b)
+		case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16:
+			return nil, d.discard(1 + (1 << (b - mpFixExt1)))
+		case mpExt8, mpExt16, mpExt32:
+			n, err := d.readLen(1 << (b - mpExt8))
+			if err != nil {
+				return nil, err
+			}
+			return nil, d.discard(n + 1)
+		case mpArray16, mpArray32:
+			if items, err = d.readLen(2 << (b - mpArray16)); err != nil {
+				return nil, err
+			}
+		case mpMap16, mpMap32:
+			if items, err = d.readLen(2 << (b - mpMap16)); err != nil {
+				return nil, err
+			}
+			isMap = true
+		default:
+			return nil, ErrInvalidMsgPack
+		}
+	}
+
+	if isMap {
+		m := make(map[string]any, min(items, msgPackPrealloc))
+		for i := 0; i < items; i++ {
+			k, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = d.readValue(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	a := make([]any, 0, min(items, msgPackPrealloc))
+	for i := 0; i < items; i++ {
+		v, err := d.readValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// skip пропускает одно значение любого типа.
+func (d *MsgPackDecoder) skip(depth int) error {
+	if depth > maxMsgPackDepth {
+		return ErrInvalidMsgPack
+	}
+
+	b, err := d.readByte()
+	if err != nil {
+		return err
+	}
+
+	var skipBytes, items int
+	switch {
+	case b <= 0x7f || b >= 0xe0, b == mpNil, b == mpFalse, b == mpTrue:
+		return nil
+	case b&0xf0 == 0x80:
+		items = 2 * int(b&0x0f)
+	case b&0xf0 == 0x90:
+		items = int(b & 0x0f)
+	case b&0xe0 == 0xa0:
+		skipBytes = int(b & 0x1f)
+	default:
+		switch b {
+		case mpUint8, mpInt8:
+			skipBytes = 1
+		case mpUint16, mpInt16:
+			skipBytes = 2
+		case mpUint32, mpInt32, mpFloat32:
+			skipBytes = 4
+		case mpUint64, mpInt64, mpFloat64:
+			skipBytes = 8
+		case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16:
+			skipBytes = 1 + (1 << (b - mpFixExt1))
+		case mpStr8, mpBin8, mpStr16, mpBin16, mpStr32, mpBin32:
+			size := 1
+			switch b {
+			case mpStr16, mpBin16:
+				size = 2
+			case mpStr32, mpBin32:
+				size = 4
+			}
+			n, err := d.readLen(size)
+			if err != nil {
+				return err
+			}
+			skipBytes = n
+		case mpExt8, mpExt16, mpExt32:
+			size := 1 << (b - mpExt8)
+			n, err := d.readLen(size)
+			if err != nil {
+				return err
+			}
+			skipBytes = n + 1
+		case mpArray16, mpArray32:
+			n, err := d.readLen(2 << (b - mpArray16))
+			if err != nil {
+				return err
+			}
+			items = n
+		case mpMap16, mpMap32:
+			n, err := d.readLen(2 << (b - mpMap16))
+			if err != nil {
+				return err
+			}
+			items = 2 * n
+		default:
+			return ErrInvalidMsgPack
+		}
+	}
+
+	if skipBytes > 0 {
+		if err := d.discard(skipBytes); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < items; i++ {
+		if err := d.skip(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalMsgPack кодирует событие в MessagePack.
+// Payload записывается как bin без изменений.
+func MarshalMsgPack(e *Event) []byte {
+	fields := 8
+	if e.WallTimeMs != nil {
+		fields++
+	}
+	if e.WallTimeCorrectedMs != nil {
+		fields++
+	}
+	if e.Seq != nil {
+		fields++
+	}
+	if len(e.Tags) > 0 {
+		fields++
+	}
+
+	b := make([]byte, 0, 96+len(e.Payload))
+	b = appendMsgPackMapHeader(b, fields)
+	b = appendMsgPackString(b, "v")
+	b = appendMsgPackInt(b, int64(e.V))
+	b = appendMsgPackString(b, "runId")
+	b = appendMsgPackString(b, e.RunID)
+	b = appendMsgPackString(b, "sourceId")
+	b = appendMsgPackString(b, e.SourceID)
+	b = appendMsgPackString(b, "channel")
+	b = appendMsgPackString(b, e.Channel)
+	b = appendMsgPackString(b, "type")
+	b = appendMsgPackString(b, e.Type)
+	b = appendMsgPackString(b, "frameIndex")
+	b = appendMsgPackInt(b, int64(e.FrameIndex))
+	b = appendMsgPackString(b, "simTime")
+	b = append(b, mpFloat64)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(e.SimTime))
+	if e.WallTimeMs != nil {
+		b = appendMsgPackString(b, "wallTimeMs")
+		b = appendMsgPackInt(b, *e.WallTimeMs)
+	}
+	if e.WallTimeCorrectedMs != nil {
+		b = appendMsgPackString(b, "wallTimeCorrectedMs")
+		b = appendMsgPackInt(b, *e.WallTimeCorrectedMs)
+	}
+	if e.Seq != nil {
+		b = appendMsgPackString(b, "seq")
+		b = appendMsgPackUint(b, *e.Seq)
+	}
+	if len(e.Tags) > 0 {
+		b = appendMsgPackString(b, "tags")
+		b = appendMsgPackMapHeader(b, len(e.Tags))
+		for k, v := range e.Tags {
+			b = appendMsgPackString(b, k)
+			b = appendMsgPackString(b, v)
+		}
+	}
+	b = appendMsgPackString(b, "payload")
+	if e.Payload == nil {
+		b = append(b, mpNil)
+	} else {
+		b = appendMsgPackBin(b, e.Payload)
+	}
+	return b
+}
+
+// appendMsgPackInt кодирует целое число в минимальном представлении.
+func appendMsgPackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(int8(v)))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		b = append(b, mpInt32)
+		return binary.BigEndian.AppendUint32(b, uint32(int32(v)))
+	default:
+		b = append(b, mpInt64)
+		return binary.BigEndian.AppendUint64(b, uint64(v))
+	}
+}
+
+// appendMsgPackUint кодирует беззнаковое целое число.
+func appendMsgPackUint(b []byte, v uint64) []byte {
+	if v <= math.MaxInt64 {
+		return appendMsgPackInt(b, int64(v))
+	}
+	b = append(b, mpUint64)
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// appendMsgPackString кодирует строку.
+func appendMsgPackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, mpStr8, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, mpStr16)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, mpStr32)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgPackBin кодирует bin.
+func appendMsgPackBin(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, mpBin8, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, mpBin16)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, mpBin32)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, data...)
+}
+
+// appendMsgPackMapHeader кодирует заголовок map.
+func appendMsgPackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, mpMap16)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, mpMap32)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
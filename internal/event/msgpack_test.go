@@ -0,0 +1,204 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// ndjsonFixtures - строки NDJSON, покрывающие все поля Event.
+var ndjsonFixtures = []string{
+	`{"v":1,"runId":"run-123","sourceId":"flight-engine","channel":"physics","type":"body.state","frameIndex":100,"simTime":12.5,"payload":{"pos":{"x":1,"y":2,"z":3}}}`,
+	`{"v":2,"runId":"run-123","sourceId":"drive-engine","channel":"drivetrain","type":"run.start","frameIndex":0,"simTime":0,"wallTimeMs":1730000000000,"tags":{"vehicle":"car01","scene":"freeflight"},"payload":{"seed":42}}`,
+	`{"v":1,"runId":"run-456","sourceId":"flight-engine","frameIndex":5000000,"simTime":0.016,"wallTimeMs":-5}`,
+	`{"v":1,"runId":"run-456","sourceId":"flight-engine","frameIndex":0,"simTime":0,"wallTimeMs":1730000000000,"wallTimeCorrectedMs":1730000002000}`,
+	`{"v":1,"runId":"run-456","sourceId":"flight-engine","frameIndex":1,"simTime":0.032,"seq":0}`,
+	`{"v":1,"runId":"run-456","sourceId":"flight-engine","frameIndex":2,"simTime":0.048,"seq":18446744073709551615}`,
+	`{"v":1,"runId":"` + strings.Repeat("r", 300) + `","sourceId":"s","type":"t","frameIndex":70000,"simTime":1e-9,"payload":[1,2,"три"]}`,
+}
+
+// TestMsgPack_RoundTrip проверяет, что MessagePack даёт тот же Event, что и NDJSON.
+func TestMsgPack_RoundTrip(t *testing.T) {
+	for i, line := range ndjsonFixtures {
+		fromJSON, err := ParseNDJSONLine(line)
+		if err != nil {
+			t.Fatalf("фикстура %d: ParseNDJSONLine() вернула ошибку: %v", i, err)
+		}
+
+		fromMsgPack, err := ParseMsgPack(MarshalMsgPack(fromJSON))
+		if err != nil {
+			t.Fatalf("фикстура %d: ParseMsgPack() вернула ошибку: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(fromJSON, fromMsgPack) {
+			t.Errorf("фикстура %d: события различаются\nNDJSON:  %+v\nMsgPack: %+v", i, fromJSON, fromMsgPack)
+		}
+	}
+}
+
+// TestMsgPack_Stream проверяет разбор потока MessagePack событий.
+func TestMsgPack_Stream(t *testing.T) {
+	t.Run("поток событий → список событий в исходном порядке", func(t *testing.T) {
+		var stream []byte
+		var expected []*Event
+		for _, line := range ndjsonFixtures {
+			e, _ := ParseNDJSONLine(line)
+			expected = append(expected, e)
+			stream = append(stream, MarshalMsgPack(e)...)
+		}
+
+		events, errs := ParseMsgPackStream(stream)
+		if len(errs) != 0 {
+			t.Fatalf("ParseMsgPackStream() вернула ошибки: %v", errs)
+		}
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("события различаются: получено %d, ожидалось %d", len(events), len(expected))
+		}
+	})
+
+	t.Run("ошибка валидации не нарушает синхронизацию потока", func(t *testing.T) {
+		valid, _ := ParseNDJSONLine(ndjsonFixtures[0])
+		invalid := *valid
+		invalid.RunID = ""
+		badPayload := *valid
+		badPayload.Payload = []byte(`{not json`)
+
+		var stream []byte
+		stream = append(stream, MarshalMsgPack(&invalid)...)
+		stream = append(stream, MarshalMsgPack(&badPayload)...)
+		stream = append(stream, MarshalMsgPack(valid)...)
+
+		events, errs := ParseMsgPackStream(stream)
+		if len(events) != 1 {
+			t.Errorf("ожидалось 1 событие, получено %d", len(events))
+		}
+		if len(errs) != 2 {
+			t.Fatalf("ожидалось 2 ошибки, получено %d", len(errs))
+		}
+		if !errors.Is(errs[0], ErrMissingRunID) {
+			t.Errorf("первая ошибка: %v, ожидалась %v", errs[0], ErrMissingRunID)
+		}
+		if !errors.Is(errs[1], ErrInvalidPayload) {
+			t.Errorf("вторая ошибка: %v, ожидалась %v", errs[1], ErrInvalidPayload)
+		}
+		var le *LineError
+		if errors.As(errs[1], &le) && le.Line != 2 {
+			t.Errorf("номер события = %d, ожидалось 2", le.Line)
+		}
+	})
+
+	t.Run("обрезанный поток → ErrInvalidMsgPack", func(t *testing.T) {
+		e, _ := ParseNDJSONLine(ndjsonFixtures[1])
+		data := MarshalMsgPack(e)
+
+		events, errs := ParseMsgPackStream(append(data, data[:len(data)/2]...))
+		if len(events) != 1 {
+			t.Errorf("ожидалось 1 событие, получено %d", len(events))
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidMsgPack) {
+			t.Errorf("ожидалась ошибка ErrInvalidMsgPack, получено %v", errs)
+		}
+	})
+
+	t.Run("пустой поток → пустой результат", func(t *testing.T) {
+		d := NewMsgPackDecoder(bytes.NewReader(nil))
+		if _, err := d.Decode(); err != io.EOF {
+			t.Errorf("Decode() = %v, ожидалось io.EOF", err)
+		}
+	})
+}
+
+// TestParseMsgPack проверяет декодирование отдельных MessagePack объектов.
+func TestParseMsgPack(t *testing.T) {
+	t.Run("неизвестные поля и альтернативные типы чисел", func(t *testing.T) {
+		// {"v":uint8 1,"runId":"r","sourceId":"s","extra":[nil,{"k":true}],
+		//  "frameIndex":uint16 300,"simTime":float32 1.5,"payload":str "{}"}
+		data := []byte{0x87,
+			0xa1, 'v', 0xcc, 0x01,
+			0xa5, 'r', 'u', 'n', 'I', 'd', 0xa1, 'r',
+			0xa8, 's', 'o', 'u', 'r', 'c', 'e', 'I', 'd', 0xa1, 's',
+			0xa5, 'e', 'x', 't', 'r', 'a', 0x92, 0xc0, 0x81, 0xa1, 'k', 0xc3,
+			0xaa, 'f', 'r', 'a', 'm', 'e', 'I', 'n', 'd', 'e', 'x', 0xcd, 0x01, 0x2c,
+			0xa7, 's', 'i', 'm', 'T', 'i', 'm', 'e', 0xca, 0x3f, 0xc0, 0x00, 0x00,
+			0xa7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', 0xa2, '{', '}',
+		}
+
+		e, err := ParseMsgPack(data)
+		if err != nil {
+			t.Fatalf("ParseMsgPack() вернула ошибку: %v", err)
+		}
+		if e.V != 1 || e.RunID != "r" || e.SourceID != "s" || e.FrameIndex != 300 || e.SimTime != 1.5 {
+			t.Errorf("неожиданное событие: %+v", e)
+		}
+		if string(e.Payload) != "{}" {
+			t.Errorf("Payload = %q, ожидалось %q", e.Payload, "{}")
+		}
+	})
+
+	t.Run("NaN и Inf в simTime → ErrInvalidSimTime", func(t *testing.T) {
+		for _, simTime := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+			data := MarshalMsgPack(&Event{V: 1, RunID: "r", SourceID: "s", SimTime: simTime, Payload: json.RawMessage(`{}`)})
+			if _, err := ParseMsgPack(data); !errors.Is(err, ErrInvalidSimTime) {
+				t.Errorf("simTime %v: ParseMsgPack() = %v, ожидалась %v", simTime, err, ErrInvalidSimTime)
+			}
+		}
+	})
+
+	t.Run("не map → ErrInvalidMsgPack", func(t *testing.T) {
+		if _, err := ParseMsgPack([]byte{0x92, 0x01, 0x02}); !errors.Is(err, ErrInvalidMsgPack) {
+			t.Errorf("ParseMsgPack() = %v, ожидалась %v", err, ErrInvalidMsgPack)
+		}
+	})
+
+	t.Run("лишние данные после события → ErrInvalidMsgPack", func(t *testing.T) {
+		e, _ := ParseNDJSONLine(ndjsonFixtures[0])
+		data := append(MarshalMsgPack(e), 0x01)
+		if _, err := ParseMsgPack(data); !errors.Is(err, ErrInvalidMsgPack) {
+			t.Errorf("ParseMsgPack() = %v, ожидалась %v", err, ErrInvalidMsgPack)
+		}
+	})
+
+	t.Run("пустые данные → ErrEmptyLine", func(t *testing.T) {
+		if _, err := ParseMsgPack(nil); err != ErrEmptyLine {
+			t.Errorf("ParseMsgPack() = %v, ожидалась %v", err, ErrEmptyLine)
+		}
+	})
+
+	t.Run("огромная длина строки → ErrInvalidMsgPack без выделения памяти", func(t *testing.T) {
+		data := []byte{0x81, 0xdb, 0xff, 0xff, 0xff, 0xff}
+		if _, err := ParseMsgPack(data); !errors.Is(err, ErrInvalidMsgPack) {
+			t.Errorf("ParseMsgPack() = %v, ожидалась %v", err, ErrInvalidMsgPack)
+		}
+	})
+
+	t.Run("ложный заголовок длины не выделяет память сверх данных", func(t *testing.T) {
+		cases := map[string][]byte{
+			// map32 на 16M элементов без самих элементов
+			"tags": {0x81, 0xa4, 't', 'a', 'g', 's', 0xdf, 0x00, 0xff, 0xff, 0xff},
+			// bin32 и str32 на 16M байт
+			"payload": {0x81, 0xa7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', 0xc6, 0x00, 0xff, 0xff, 0xff, 'x'},
+			"runId":   {0x81, 0xa5, 'r', 'u', 'n', 'I', 'd', 0xdb, 0x00, 0xff, 0xff, 0xff, 'x'},
+			// неизвестное поле: ext32 пропускается
+			"unknown": {0x81, 0xa1, 'x', 0xc9, 0x00, 0xff, 0xff, 0xff, 0x01},
+		}
+		for name, data := range cases {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := ParseMsgPack(data)
+			runtime.ReadMemStats(&after)
+
+			if !errors.Is(err, ErrInvalidMsgPack) {
+				t.Errorf("%s: ParseMsgPack() = %v, ожидалась %v", name, err, ErrInvalidMsgPack)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("%s: выделено %d байт", name, allocated)
+			}
+		}
+	})
+}
@@ -30,6 +30,7 @@ func ParseNDJSONLine(line string) (*Event, error) {
 // ParseNDJSON парсит многострочный NDJSON.
 // Каждая строка обрабатывается независимо.
 // Возвращает слайс успешно распарсенных событий и слайс ошибок.
+// Каждая ошибка имеет тип *LineError с номером строки (начиная с 1).
 func ParseNDJSON(data []byte) ([]*Event, []error) {
 	lines := strings.Split(string(data), "\n")
 	var events []*Event
@@ -42,12 +43,11 @@ func ParseNDJSON(data []byte) ([]*Event, []error) {
 
 		event, err := ParseNDJSONLine(line)
 		if err != nil {
-			errors = append(errors, err)
+			errors = append(errors, NewLineError(i+1, line, err))
 			continue
 		}
 
 		events = append(events, event)
-		_ = i // для будущего логирования номера строки
 	}
 
 	return events, errors
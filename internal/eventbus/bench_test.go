@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// benchmarkPublish измеряет fan-out Publish на subscribers подписчиков с фильтром filter.
+// Подписчики не совпадают с событием, чтобы измерялась стоимость проверки
+// фильтров, а не отправки в очереди.
+func benchmarkPublish(b *testing.B, subscribers int, filter func(i int) Filter) {
+	bus := New()
+	defer bus.Close()
+
+	for i := 0; i < subscribers; i++ {
+		if _, err := bus.Subscribe(context.Background(), filter(i), SubscriptionOptions{BufferSize: 1, Policy: BackpressureDropNew}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	e := makeEvent("campaign42-000001", "flight-engine", "physics", "body.state", map[string]string{"vehicle": "car01"})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bus.Publish(ctx, e)
+	}
+}
+
+// BenchmarkPublish_Filters сравнивает стоимость fan-out для точных фильтров,
+// glob и regex шаблонов и выражений.
+func BenchmarkPublish_Filters(b *testing.B) {
+	filters := map[string]func(i int) Filter{
+		"exact":       func(i int) Filter { return Filter{RunID: fmt.Sprintf("campaign%d-000001", i)} },
+		"glob_prefix": func(i int) Filter { return Filter{RunIDGlob: fmt.Sprintf("campaign%d-*", i)} },
+		"glob":        func(i int) Filter { return Filter{RunIDGlob: fmt.Sprintf("campaign%d-??????", i)} },
+		"regex":       func(i int) Filter { return Filter{RunIDRegex: fmt.Sprintf(`^campaign%d-\d+$`, i)} },
+		"expr":        func(i int) Filter { return Filter{Expr: fmt.Sprintf(`runId == "campaign%d-000001"`, i)} },
+	}
+	for _, name := range []string{"exact", "glob_prefix", "glob", "regex", "expr"} {
+		b.Run(name, func(b *testing.B) {
+			benchmarkPublish(b, 100, filters[name])
+		})
+	}
+}
+
+// BenchmarkPublish_Subscribers измеряет fan-out при росте числа подписчиков.
+// run: каждая подписка следит за своим run'ом (dashboard'ы, индекс RunID);
+// glob: подписки только с шаблоном, которые проверяются для каждого события.
+func BenchmarkPublish_Subscribers(b *testing.B) {
+	for _, n := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("run/%d", n), func(b *testing.B) {
+			benchmarkPublish(b, n, func(i int) Filter { return Filter{RunID: fmt.Sprintf("run-%d", i)} })
+		})
+		b.Run(fmt.Sprintf("glob/%d", n), func(b *testing.B) {
+			benchmarkPublish(b, n, func(i int) Filter { return Filter{RunIDGlob: fmt.Sprintf("run-%d-*", i)} })
+		})
+	}
+}
+
+// benchmarkThroughput измеряет пропускную способность публикации событий
+// runs run'ов из producers goroutine до завершения fan-out. На каждый run
+// подписаны два подписчика (точный фильтр и выражение), ещё два
+// подписчика с выражениями получают все события; подписчики BackpressureBlock
+// читают свои очереди.
+func benchmarkThroughput(b *testing.B, config Config, producers, runs int) {
+	bus := NewWithConfig(config)
+	defer bus.Close()
+
+	ctx := context.Background()
+	subscribe := func(filter Filter) {
+		sub, err := bus.Subscribe(ctx, filter, SubscriptionOptions{BufferSize: 1024, Policy: BackpressureBlock})
+		if err != nil {
+			b.Fatal(err)
+		}
+		go func() {
+			for range sub.C() {
+			}
+		}()
+	}
+	events := make([]*event.Event, runs)
+	for i := range events {
+		runID := fmt.Sprintf("run-%d", i)
+		events[i] = makeEvent(runID, "flight-engine", "physics", "body.state", map[string]string{"vehicle": "car01"})
+		events[i].Payload = []byte(`{"speed":42.5,"altitude":1200}`)
+		subscribe(Filter{RunID: runID})
+		subscribe(Filter{RunID: runID, Expr: `payload.speed > 10`})
+	}
+	subscribe(Filter{Expr: `type == "body.state" && payload.altitude > 1000`})
+	subscribe(Filter{Expr: `tags.vehicle == "car01"`})
+
+	var next atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	done := make(chan struct{})
+	for p := 0; p < producers; p++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				i := next.Add(1)
+				if i > uint64(b.N) {
+					return
+				}
+				bus.Publish(ctx, events[int(i)%runs])
+			}
+		}()
+	}
+	for p := 0; p < producers; p++ {
+		<-done
+	}
+	// Для шардированной шины ждём завершения fan-out из очередей
+	for bus.Stats().TotalPublished < uint64(b.N) {
+		runtime.Gosched()
+	}
+}
+
+// BenchmarkPublish_Throughput сравнивает синхронный fan-out с шардированным
+// при разном числе producer'ов:
+//
+//	go test ./internal/eventbus -run '^$' -bench Throughput -cpu 8
+func BenchmarkPublish_Throughput(b *testing.B) {
+	const runs = 64
+	shards := runtime.GOMAXPROCS(0)
+	for _, producers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("sync/producers-%d", producers), func(b *testing.B) {
+			benchmarkThroughput(b, Config{}, producers, runs)
+		})
+		b.Run(fmt.Sprintf("sharded-%d/producers-%d", shards, producers), func(b *testing.B) {
+			benchmarkThroughput(b, Config{Shards: shards}, producers, runs)
+		})
+	}
+}
@@ -2,16 +2,47 @@ package eventbus
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventlog"
 )
 
+// Config определяет параметры EventBus.
+type Config struct {
+	// Log - журнал, в который записываются все опубликованные события
+	// до fan-out (nil = без журнала). Из журнала читают durable подписки
+	// (SubscribeDurable).
+	Log *eventlog.Log
+
+	// Shards - количество шардов асинхронного fan-out (0 = синхронный
+	// fan-out в goroutine Publish). События распределяются по шардам по
+	// RunID, у каждого шарда своя очередь и goroutine fan-out: порядок
+	// событий run'а сохраняется, а подписчик BackpressureBlock замедляет
+	// только шарды с событиями, которые он получает.
+	Shards int
+
+	// ShardQueueSize - ёмкость очереди шарда в batch'ах (0 = 256).
+	// Publish блокируется, когда очередь шарда заполнена.
+	ShardQueueSize int
+
+	// DrainTimeout - сколько Close ждёт доставки событий из очередей
+	// шардов, прежде чем закрыть подписки (0 = 5s). Ограничивает Close
+	// при подписчике BackpressureBlock, который не читает.
+	DrainTimeout time.Duration
+}
+
 // bus реализует EventBus интерфейс.
 type bus struct {
-	mu          sync.RWMutex
-	subscribers []*subscription
+	// mu сериализует изменения списка подписчиков; Publish его не берёт
+	mu     sync.Mutex
+	table  atomic.Pointer[routingTable]
+	nextID uint64 // под mu
+
+	log *eventlog.Log
 
 	totalPublished atomic.Uint64
 	totalDropped   atomic.Uint64
@@ -20,9 +51,21 @@ type bus struct {
 
 // New создаёт новый EventBus.
 func New() EventBus {
-	return &bus{
-		subscribers: make([]*subscription, 0),
+	return NewWithConfig(Config{})
+}
+
+// NewWithConfig создаёт новый EventBus с конфигурацией.
+func NewWithConfig(config Config) EventBus {
+	if config.Shards > 0 {
+		return newShardedBus(config)
 	}
+	return newBus(config)
+}
+
+func newBus(config Config) *bus {
+	b := &bus{log: config.Log}
+	b.table.Store(emptyRoutingTable)
+	return b
 }
 
 // Publish публикует одно событие, выполняя синхронный fan-out.
@@ -32,22 +75,12 @@ func (b *bus) Publish(ctx context.Context, e *event.Event) error {
 		return nil
 	}
 
-	b.mu.RLock()
-	subs := make([]*subscription, len(b.subscribers))
-	copy(subs, b.subscribers)
-	b.mu.RUnlock()
-
-	// Синхронный fan-out: проверяем фильтры и отправляем в очереди подписчиков
-	for _, sub := range subs {
-		if sub.filter.Matches(e) {
-			if !sub.send(e) {
-				b.totalDropped.Add(1)
-			}
-		}
+	err := b.append(e)
+	if dropped := b.fanOut(b.table.Load(), e); dropped > 0 {
+		b.totalDropped.Add(dropped)
 	}
-
 	b.totalPublished.Add(1)
-	return nil
+	return err
 }
 
 // PublishBatch публикует несколько событий за один вызов.
@@ -56,26 +89,48 @@ func (b *bus) PublishBatch(ctx context.Context, events []*event.Event) (int, err
 		return 0, nil
 	}
 
-	b.mu.RLock()
-	subs := make([]*subscription, len(b.subscribers))
-	copy(subs, b.subscribers)
-	b.mu.RUnlock()
-
+	err := b.append(events...)
+	table := b.table.Load()
 	published := 0
 	for _, e := range events {
-		// Синхронный fan-out для каждого события
-		for _, sub := range subs {
-			if sub.filter.Matches(e) {
-				if !sub.send(e) {
-					b.totalDropped.Add(1)
-				}
-			}
+		if dropped := b.fanOut(table, e); dropped > 0 {
+			b.totalDropped.Add(dropped)
 		}
 		published++
 		b.totalPublished.Add(1)
 	}
 
-	return published, nil
+	return published, err
+}
+
+// append записывает события в журнал. Ошибка журнала не останавливает
+// fan-out: live подписчики получают события и при отказе диска.
+func (b *bus) append(events ...*event.Event) error {
+	if b.log == nil {
+		return nil
+	}
+	if _, err := b.log.Append(events...); err != nil {
+		return fmt.Errorf("eventbus: log append failed: %w", err)
+	}
+	return nil
+}
+
+// fanOut синхронно отправляет событие в очереди подписчиков-кандидатов,
+// фильтр которых совпадает с событием. Возвращает количество подписчиков,
+// которые не приняли событие.
+func (b *bus) fanOut(table *routingTable, e *event.Event) (dropped uint64) {
+	// Общий для подписчиков контекст: payload декодируется не больше раза
+	ctx := evalContext{event: e}
+	for _, group := range table.candidates(e) {
+		for _, sub := range group {
+			if sub.filter.matches(&ctx) {
+				if !sub.send(e) {
+					dropped++
+				}
+			}
+		}
+	}
+	return dropped
 }
 
 // Subscribe создаёт подписку с фильтром и параметрами.
@@ -84,43 +139,91 @@ func (b *bus) Subscribe(ctx context.Context, filter Filter, opt SubscriptionOpti
 		return nil, nil // TODO: вернуть ошибку
 	}
 
-	sub := newSubscription(ctx, filter, opt)
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := newSubscription(ctx, compiled, opt)
+	if err != nil {
+		return nil, err
+	}
 
 	b.mu.Lock()
-	b.subscribers = append(b.subscribers, sub)
+	if b.closed.Load() {
+		// Close успел выполниться после проверки выше
+		b.mu.Unlock()
+		_ = sub.Close()
+		return nil, nil
+	}
+	b.nextID++
+	sub.id = b.nextID
+	sub.unregister = b.unregister
+	b.table.Store(b.table.Load().with(sub))
 	b.mu.Unlock()
 
+	go sub.closeOnDone()
+
 	return sub, nil
 }
 
+// unregister удаляет закрытую подписку из списка подписчиков.
+func (b *bus) unregister(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if table := b.table.Load(); table.contains(sub) {
+		b.table.Store(table.without(sub))
+	}
+}
+
 // Stats возвращает статистику EventBus.
 func (b *bus) Stats() BusStats {
-	b.mu.RLock()
-	subsCount := len(b.subscribers)
-	b.mu.RUnlock()
+	subs := b.table.Load().all
+	maxFill := 0.0
+	for _, sub := range subs {
+		if sub.options.Policy != BackpressureBlock {
+			continue
+		}
+		if fill := sub.queueFill(); fill > maxFill {
+			maxFill = fill
+		}
+	}
 
 	return BusStats{
-		SubscribersCount: subsCount,
-		TotalPublished:   b.totalPublished.Load(),
-		TotalDropped:     b.totalDropped.Load(),
+		SubscribersCount:     len(subs),
+		TotalPublished:       b.totalPublished.Load(),
+		TotalDropped:         b.totalDropped.Load(),
+		MaxBlockingQueueFill: maxFill,
 	}
 }
 
+// Subscriptions возвращает состояние активных подписок в порядке создания.
+func (b *bus) Subscriptions() []SubscriptionInfo {
+	subs := b.table.Load().all
+	infos := make([]SubscriptionInfo, 0, len(subs))
+	for _, sub := range subs {
+		infos = append(infos, sub.info())
+	}
+	return infos
+}
+
 // Close закрывает EventBus и все подписки.
 func (b *bus) Close() error {
 	if b.closed.Swap(true) {
 		return nil
 	}
 
+	b.closeSubscriptions()
+	return nil
+}
+
+// closeSubscriptions удаляет все подписки из таблицы и закрывает их.
+func (b *bus) closeSubscriptions() {
 	b.mu.Lock()
-	subs := b.subscribers
-	b.subscribers = nil
+	subs := b.table.Swap(emptyRoutingTable).all
 	b.mu.Unlock()
 
-	// Закрываем все подписки
 	for _, sub := range subs {
 		_ = sub.Close()
 	}
-
-	return nil
 }
@@ -0,0 +1,114 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// defaultCoalesceKeys - количество ключей, ожидающих доставки,
+// если BufferSize не задан.
+const defaultCoalesceKeys = 1024
+
+// coalescer - очередь политики BackpressureCoalesce: для каждого ключа
+// хранится только последнее событие. Ключи доставляются в порядке
+// появления; новое событие с ключом, ожидающим доставки, заменяет
+// предыдущее, не меняя его места в очереди.
+type coalescer struct {
+	key   eventKey
+	limit int
+
+	mu      sync.Mutex
+	pending map[string]*event.Event
+	order   []string
+
+	// notify будит run после push в пустую очередь
+	notify chan struct{}
+
+	// done закрывается при завершении run
+	done chan struct{}
+}
+
+func newCoalescer(key eventKey, limit int) *coalescer {
+	return &coalescer{
+		key:     key,
+		limit:   limit,
+		pending: make(map[string]*event.Event),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// push добавляет событие. replaced - событие заменило ожидающее
+// доставки событие того же ключа; ok == false - событие отброшено,
+// так как ожидают доставки limit ключей.
+func (c *coalescer) push(e *event.Event) (replaced, ok bool) {
+	k := c.key.of(e)
+
+	c.mu.Lock()
+	if _, exists := c.pending[k]; exists {
+		c.pending[k] = e
+		c.mu.Unlock()
+		return true, true
+	}
+	if len(c.pending) >= c.limit {
+		c.mu.Unlock()
+		return false, false
+	}
+	c.pending[k] = e
+	c.order = append(c.order, k)
+	c.mu.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return false, true
+}
+
+// pop извлекает последнее событие самого старого ключа.
+func (c *coalescer) pop() (*event.Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.order) == 0 {
+		return nil, false
+	}
+	k := c.order[0]
+	c.order = c.order[1:]
+	e := c.pending[k]
+	delete(c.pending, k)
+	return e, true
+}
+
+// len возвращает количество ключей, ожидающих доставки.
+func (c *coalescer) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// run передаёт события в канал подписки, пока ctx не отменён.
+// Канал подписки небуферизованный: вне очереди, в ожидании потребителя,
+// находится не более одного события, поэтому медленный потребитель
+// получает актуальные значения, а не накопленную очередь.
+func (c *coalescer) run(ctx context.Context, out chan<- *event.Event) {
+	defer close(c.done)
+	for {
+		e, ok := c.pop()
+		if !ok {
+			select {
+			case <-c.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case out <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// TestBackpressure_Coalesce проверяет политику "coalesce".
+func TestBackpressure_Coalesce(t *testing.T) {
+	frame := func(runID, eventType string, frameIndex int) *event.Event {
+		e := makeEvent(runID, "engine", "physics", eventType, nil)
+		e.FrameIndex = frameIndex
+		return e
+	}
+
+	t.Run("медленный потребитель получает последнее событие по ключу", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{Policy: BackpressureCoalesce})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		// Потребитель не читает, пока публикуется 100 кадров двух типов
+		ctx := context.Background()
+		for i := 0; i < 100; i++ {
+			bus.Publish(ctx, frame("run-1", "body.state", i))
+			bus.Publish(ctx, frame("run-1", "aero.state", i))
+		}
+
+		// Одно событие могло быть извлечено до того, как его заменили
+		events := readAllAvailableEvents(sub, 50*time.Millisecond)
+		if len(events) < 2 || len(events) > 3 {
+			t.Fatalf("получено %d событий, ожидалось 2..3", len(events))
+		}
+		latest := map[string]int{}
+		for _, e := range events {
+			latest[e.Type] = e.FrameIndex
+		}
+		if latest["body.state"] != 99 || latest["aero.state"] != 99 {
+			t.Errorf("последние кадры: %v, ожидалось 99 для обоих типов", latest)
+		}
+		if sub.Dropped() < 197 {
+			t.Errorf("Dropped = %d, ожидалось не меньше 197", sub.Dropped())
+		}
+	})
+
+	t.Run("ключ по runId", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{
+			Policy:      BackpressureCoalesce,
+			CoalesceKey: []string{"runId"},
+		})
+		defer sub.Close()
+
+		ctx := context.Background()
+		for i := 0; i < 10; i++ {
+			bus.Publish(ctx, frame("run-1", "body.state", i))
+			bus.Publish(ctx, frame("run-1", "aero.state", i))
+			bus.Publish(ctx, frame("run-2", "body.state", i))
+		}
+
+		events := readAllAvailableEvents(sub, 50*time.Millisecond)
+		runs := map[string]*event.Event{}
+		for _, e := range events {
+			runs[e.RunID] = e
+		}
+		if len(runs) != 2 || runs["run-1"].Type != "aero.state" || runs["run-1"].FrameIndex != 9 || runs["run-2"].FrameIndex != 9 {
+			t.Errorf("получено %d событий: %v", len(events), runs)
+		}
+	})
+
+	t.Run("лимит ключей → новые ключи отбрасываются", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{
+			Policy:      BackpressureCoalesce,
+			BufferSize:  2,
+			CoalesceKey: []string{"tags.vehicle"},
+		})
+		defer sub.Close()
+
+		ctx := context.Background()
+		// Первое событие может сразу уйти в ожидание потребителя и освободить место
+		for _, vehicle := range []string{"car01", "car02", "car03", "car04"} {
+			bus.Publish(ctx, makeEvent("run-1", "s", "c", "t", map[string]string{"vehicle": vehicle}))
+		}
+
+		events := readAllAvailableEvents(sub, 50*time.Millisecond)
+		if len(events) < 2 || len(events) > 3 || events[0].Tags["vehicle"] != "car01" {
+			t.Errorf("получено %d событий, ожидалось 2..3 начиная с car01", len(events))
+		}
+		if stats := bus.Stats(); stats.TotalDropped != uint64(4-len(events)) {
+			t.Errorf("TotalDropped = %d, ожидалось %d", stats.TotalDropped, 4-len(events))
+		}
+	})
+
+	t.Run("неизвестное поле ключа → ошибка Subscribe", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		for _, key := range [][]string{{"payload.x"}, {"tags."}} {
+			_, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{Policy: BackpressureCoalesce, CoalesceKey: key})
+			if !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("CoalesceKey %v: Subscribe() = %v, ожидалась ErrInvalidOptions", key, err)
+			}
+		}
+	})
+
+	t.Run("Close во время ожидания потребителя", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{Policy: BackpressureCoalesce})
+		bus.Publish(context.Background(), frame("run-1", "body.state", 0))
+		sub.Close()
+
+		// Канал закрыт; событие, ожидавшее потребителя, не доставляется
+		for range sub.C() {
+		}
+	})
+}
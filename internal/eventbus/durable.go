@@ -0,0 +1,202 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/teltel/teltel/internal/eventlog"
+)
+
+// DurableOptions определяет параметры durable подписки.
+type DurableOptions struct {
+	// Name - имя потребителя. Позиция, сохранённая Commit, переживает
+	// перезапуск: подписка с тем же Name продолжает с неё. Пустое имя -
+	// разовое чтение журнала без сохранения позиции.
+	Name string
+
+	// From - offset, с которого начинается чтение (nil = сохранённая
+	// позиция Name, а если её нет - начало журнала)
+	From *uint64
+
+	// FromRunID - начать с первого хранимого события run'а
+	FromRunID string
+
+	// BufferSize - размер канала подписки (по умолчанию 0)
+	BufferSize int
+}
+
+// DurableSubscription - подписка на журнал событий (см. Config.Log).
+// В отличие от Subscription, события не отбрасываются: подписка читает
+// журнал со своей скоростью, а после перезапуска продолжает с позиции,
+// сохранённой Commit, поэтому события доставляются at-least-once.
+type DurableSubscription interface {
+	// C возвращает канал записей журнала, совпавших с фильтром. Канал
+	// закрывается при Close, отмене контекста или ошибке чтения (см. Err).
+	C() <-chan eventlog.Record
+
+	// Commit сохраняет позицию: offset - последняя обработанная запись.
+	// Для подписки без Name ничего не делает.
+	Commit(offset uint64) error
+
+	// Err возвращает ошибку, из-за которой закрыт канал (nil при Close
+	// или отмене контекста). Если такой ошибки нет, а подписка пропустила
+	// записи, удалённые по MaxSegments до чтения, Err возвращает ошибку,
+	// совместимую с eventlog.ErrSkipped; канал при этом не закрывается.
+	// Сохранённая позиция за концом журнала (журнал потерял хвост, а
+	// позиция сохранилась) переносится на конец журнала, и Err так же
+	// возвращает ошибку, совместимую с eventlog.ErrOffsetOutOfRange.
+	Err() error
+
+	// Close останавливает чтение журнала.
+	Close() error
+}
+
+// SubscribeDurable создаёт подписку на журнал log с фильтром filter.
+// Некорректный фильтр даёт ошибку, совместимую с ErrInvalidFilter,
+// одновременно заданные From и FromRunID - с ErrInvalidOptions.
+func SubscribeDurable(ctx context.Context, log *eventlog.Log, filter Filter, opt DurableOptions) (DurableSubscription, error) {
+	if log == nil {
+		return nil, fmt.Errorf("%w: event log is not configured", ErrInvalidOptions)
+	}
+	if opt.From != nil && opt.FromRunID != "" {
+		return nil, fmt.Errorf("%w: From and FromRunID are mutually exclusive", ErrInvalidOptions)
+	}
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var from, committed uint64
+	switch {
+	case opt.From != nil:
+		from = *opt.From
+	case opt.FromRunID != "":
+		if from, err = log.RunStart(opt.FromRunID); err != nil {
+			return nil, err
+		}
+	default:
+		var ok bool
+		if from, ok = log.Committed(opt.Name); !ok || opt.Name == "" {
+			from = log.Start()
+		} else if end := log.End(); from > end {
+			committed, from = from, end
+		}
+	}
+	reader, err := log.NewReader(from)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize := opt.BufferSize
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &durableSubscription{
+		log:    log,
+		name:   opt.Name,
+		filter: compiled,
+		ch:     make(chan eventlog.Record, bufferSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		committed: committed,
+		from:      from,
+	}
+	go sub.run(subCtx, reader)
+	return sub, nil
+}
+
+// durableSubscription реализует DurableSubscription.
+type durableSubscription struct {
+	log    *eventlog.Log
+	name   string
+	filter compiledFilter
+	ch     chan eventlog.Record
+	cancel context.CancelFunc
+
+	// done закрывается при завершении run
+	done chan struct{}
+
+	// committed - сохранённая позиция за концом журнала, перенесённая
+	// на from (0 - позиция не переносилась)
+	committed uint64
+	from      uint64
+
+	mu      sync.Mutex
+	err     error
+	skipped uint64
+}
+
+// run читает журнал и передаёт совпавшие записи в канал подписки.
+func (s *durableSubscription) run(ctx context.Context, reader *eventlog.Reader) {
+	defer close(s.done)
+	defer close(s.ch)
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next(ctx)
+		if skipped := reader.Skipped(); skipped > 0 {
+			s.mu.Lock()
+			s.skipped = skipped
+			s.mu.Unlock()
+		}
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, eventlog.ErrClosed) {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+			return
+		}
+		if !s.filter.matches(&evalContext{event: record.Event}) {
+			continue
+		}
+		select {
+		case s.ch <- record:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// C возвращает канал записей журнала.
+func (s *durableSubscription) C() <-chan eventlog.Record {
+	return s.ch
+}
+
+// Commit сохраняет позицию подписки.
+func (s *durableSubscription) Commit(offset uint64) error {
+	if s.name == "" {
+		return nil
+	}
+	return s.log.Commit(s.name, offset)
+}
+
+// Err возвращает ошибку чтения журнала, пропуска записей или переноса
+// сохранённой позиции.
+func (s *durableSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	var errs []error
+	if s.committed > 0 {
+		errs = append(errs, fmt.Errorf("%w: committed %d > end %d",
+			eventlog.ErrOffsetOutOfRange, s.committed, s.from))
+	}
+	if s.skipped > 0 {
+		errs = append(errs, fmt.Errorf("%w: %d records", eventlog.ErrSkipped, s.skipped))
+	}
+	return errors.Join(errs...)
+}
+
+// Close останавливает чтение журнала и ждёт закрытия канала.
+func (s *durableSubscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
@@ -0,0 +1,182 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventlog"
+)
+
+// receiveRecord читает запись durable подписки с таймаутом.
+func receiveRecord(t *testing.T, sub DurableSubscription) eventlog.Record {
+	t.Helper()
+	select {
+	case record, ok := <-sub.C():
+		if !ok {
+			t.Fatalf("канал закрыт: %v", sub.Err())
+		}
+		return record
+	case <-time.After(time.Second):
+		t.Fatal("запись не получена")
+		return eventlog.Record{}
+	}
+}
+
+// TestSubscribeDurable проверяет чтение журнала, сохранение позиции
+// и продолжение после повторного открытия журнала.
+func TestSubscribeDurable(t *testing.T) {
+	dir := t.TempDir()
+	log, err := eventlog.Open(eventlog.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := NewWithConfig(Config{Log: log})
+	ctx := context.Background()
+	bus.PublishBatch(ctx, []*event.Event{
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "body.state", FrameIndex: 0},
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "run.end", FrameIndex: 1},
+		{V: 1, RunID: "run-2", SourceID: "engine", Type: "body.state", FrameIndex: 0},
+	})
+	bus.Publish(ctx, &event.Event{V: 1, RunID: "run-2", SourceID: "engine", Type: "body.state", FrameIndex: 1})
+
+	t.Run("фильтр и commit", func(t *testing.T) {
+		sub, err := SubscribeDurable(ctx, log, Filter{Types: []string{"body.state"}}, DurableOptions{Name: "storage"})
+		if err != nil {
+			t.Fatalf("SubscribeDurable() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		if r := receiveRecord(t, sub); r.Offset != 0 {
+			t.Errorf("offset: %d, ожидался 0", r.Offset)
+		}
+		r := receiveRecord(t, sub)
+		if r.Offset != 2 || r.Event.RunID != "run-2" {
+			t.Errorf("запись: %d %+v, ожидался offset 2", r.Offset, r.Event)
+		}
+		if err := sub.Commit(r.Offset); err != nil {
+			t.Fatalf("Commit() вернула ошибку: %v", err)
+		}
+	})
+
+	t.Run("с начала run'а", func(t *testing.T) {
+		sub, err := SubscribeDurable(ctx, log, Filter{}, DurableOptions{FromRunID: "run-2"})
+		if err != nil {
+			t.Fatalf("SubscribeDurable() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		if r := receiveRecord(t, sub); r.Offset != 2 {
+			t.Errorf("offset: %d, ожидался 2", r.Offset)
+		}
+		if _, err := SubscribeDurable(ctx, log, Filter{}, DurableOptions{FromRunID: "run-3"}); !errors.Is(err, eventlog.ErrRunNotFound) {
+			t.Errorf("неизвестный run: %v", err)
+		}
+	})
+
+	t.Run("некорректные параметры", func(t *testing.T) {
+		from := uint64(0)
+		if _, err := SubscribeDurable(ctx, log, Filter{}, DurableOptions{From: &from, FromRunID: "run-1"}); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("From и FromRunID: %v", err)
+		}
+		if _, err := SubscribeDurable(ctx, nil, Filter{}, DurableOptions{}); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("без журнала: %v", err)
+		}
+	})
+
+	bus.Close()
+	log.Close()
+
+	t.Run("продолжение после перезапуска", func(t *testing.T) {
+		log, err := eventlog.Open(eventlog.Config{Dir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer log.Close()
+
+		sub, err := SubscribeDurable(ctx, log, Filter{Types: []string{"body.state"}}, DurableOptions{Name: "storage"})
+		if err != nil {
+			t.Fatalf("SubscribeDurable() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		r := receiveRecord(t, sub)
+		if r.Offset != 3 || r.Event.FrameIndex != 1 {
+			t.Errorf("запись: %d %+v, ожидался offset 3", r.Offset, r.Event)
+		}
+
+		// Закрытие журнала закрывает канал без ошибки
+		log.Close()
+		select {
+		case _, ok := <-sub.C():
+			if ok {
+				t.Error("канал не закрыт после закрытия журнала")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("канал не закрыт после закрытия журнала")
+		}
+		if err := sub.Err(); err != nil {
+			t.Errorf("Err() = %v", err)
+		}
+	})
+}
+
+// TestSubscribeDurable_Skipped проверяет, что записи, удалённые
+// по MaxSegments до чтения, видны в Err.
+func TestSubscribeDurable_Skipped(t *testing.T) {
+	// Каждое событие - в отдельном сегменте
+	log, err := eventlog.Open(eventlog.Config{Dir: t.TempDir(), MaxSegmentBytes: 1, MaxSegments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	for i := 0; i < 5; i++ {
+		log.Append(&event.Event{V: 1, RunID: "run-1", SourceID: "engine", FrameIndex: i})
+	}
+	log.Commit("storage", 0)
+
+	sub, err := SubscribeDurable(context.Background(), log, Filter{}, DurableOptions{Name: "storage"})
+	if err != nil {
+		t.Fatalf("SubscribeDurable() вернула ошибку: %v", err)
+	}
+	defer sub.Close()
+
+	if r := receiveRecord(t, sub); r.Offset != 3 {
+		t.Errorf("offset: %d, ожидался 3", r.Offset)
+	}
+	if err := sub.Err(); !errors.Is(err, eventlog.ErrSkipped) {
+		t.Errorf("Err() = %v, ожидалась eventlog.ErrSkipped", err)
+	}
+}
+
+// TestSubscribeDurable_CommittedPastEnd проверяет, что сохранённая позиция
+// за концом журнала переносится на его конец и видна в Err.
+func TestSubscribeDurable_CommittedPastEnd(t *testing.T) {
+	log, err := eventlog.Open(eventlog.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Append(&event.Event{V: 1, RunID: "run-1", SourceID: "engine", FrameIndex: 0})
+	// Позиция сохранилась, а хвост журнала потерян
+	log.Commit("storage", 9)
+
+	sub, err := SubscribeDurable(context.Background(), log, Filter{}, DurableOptions{Name: "storage"})
+	if err != nil {
+		t.Fatalf("SubscribeDurable() вернула ошибку: %v", err)
+	}
+	defer sub.Close()
+
+	if err := sub.Err(); !errors.Is(err, eventlog.ErrOffsetOutOfRange) {
+		t.Errorf("Err() = %v, ожидалась eventlog.ErrOffsetOutOfRange", err)
+	}
+	log.Append(&event.Event{V: 1, RunID: "run-1", SourceID: "engine", FrameIndex: 1})
+	if r := receiveRecord(t, sub); r.Offset != 1 {
+		t.Errorf("offset: %d, ожидался 1", r.Offset)
+	}
+}
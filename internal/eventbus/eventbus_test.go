@@ -2,6 +2,7 @@ package eventbus
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -379,6 +380,99 @@ func TestFilter_Matches(t *testing.T) {
 			t.Error("фильтр не должен совпадать с событием с другим Type")
 		}
 	})
+
+	t.Run("glob и regex фильтры", func(t *testing.T) {
+		cases := []struct {
+			name   string
+			filter Filter
+			match  []string // runId, sourceId, channel, type
+			miss   []string
+		}{
+			{"RunIDGlob префикс", Filter{RunIDGlob: "campaign42-*"}, []string{"campaign42-007", "s", "c", "t"}, []string{"campaign43-007", "s", "c", "t"}},
+			{"RunIDGlob префикс не захватывает /", Filter{RunIDGlob: "campaign42-*"}, []string{"campaign42-", "s", "c", "t"}, []string{"campaign42-a/b", "s", "c", "t"}},
+			{"RunIDRegex", Filter{RunIDRegex: `^campaign4[0-2]-\d+$`}, []string{"campaign41-12", "s", "c", "t"}, []string{"campaign41-x", "s", "c", "t"}},
+			{"SourceIDGlob", Filter{SourceIDGlob: "*-engine"}, []string{"r", "flight-engine", "c", "t"}, []string{"r", "flight-ui", "c", "t"}},
+			{"SourceIDRegex ищет подстроку", Filter{SourceIDRegex: "engine"}, []string{"r", "drive-engine-2", "c", "t"}, []string{"r", "ui", "c", "t"}},
+			{"ChannelGlob", Filter{ChannelGlob: "phys?cs"}, []string{"r", "s", "physics", "t"}, []string{"r", "s", "aero", "t"}},
+			{"ChannelRegex", Filter{ChannelRegex: "^(aero|physics)$"}, []string{"r", "s", "aero", "t"}, []string{"r", "s", "aero2", "t"}},
+			{"TypeGlob", Filter{TypeGlob: "*.state"}, []string{"r", "s", "c", "body.state"}, []string{"r", "s", "c", "frame.start"}},
+			{"TypeRegex", Filter{TypeRegex: `^(body|aero)\.`}, []string{"r", "s", "c", "aero.state"}, []string{"r", "s", "c", "wheel.force"}},
+			{"glob и regex одного поля", Filter{RunIDGlob: "run-*", RunIDRegex: "7$"}, []string{"run-17", "s", "c", "t"}, []string{"run-18", "s", "c", "t"}},
+			{"шаблон вместе с точным полем", Filter{RunIDGlob: "run-*", SourceID: "s1"}, []string{"run-1", "s1", "c", "t"}, []string{"run-1", "s2", "c", "t"}},
+		}
+		for _, tc := range cases {
+			match := makeEvent(tc.match[0], tc.match[1], tc.match[2], tc.match[3], nil)
+			miss := makeEvent(tc.miss[0], tc.miss[1], tc.miss[2], tc.miss[3], nil)
+			if !tc.filter.Matches(match) {
+				t.Errorf("%s: фильтр должен совпадать с %v", tc.name, tc.match)
+			}
+			if tc.filter.Matches(miss) {
+				t.Errorf("%s: фильтр не должен совпадать с %v", tc.name, tc.miss)
+			}
+		}
+	})
+
+	t.Run("некорректный шаблон → ошибка Subscribe", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		for _, filter := range []Filter{{RunIDGlob: "run-[1"}, {TypeRegex: "("}} {
+			if _, err := bus.Subscribe(context.Background(), filter, SubscriptionOptions{}); !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("Subscribe(%+v) = %v, ожидалась ErrInvalidFilter", filter, err)
+			}
+			if filter.Matches(makeEvent("run-1", "s", "c", "t", nil)) {
+				t.Errorf("некорректный фильтр %+v не должен совпадать", filter)
+			}
+		}
+	})
+}
+
+// TestFilter_Compile проверяет скомпилированный фильтр Matcher.
+func TestFilter_Compile(t *testing.T) {
+	t.Run("Matcher совпадает с теми же событиями, что и Matches", func(t *testing.T) {
+		filters := []Filter{
+			{},
+			{RunID: "run-1", Types: []string{"body.state"}},
+			{RunIDGlob: "run-*", SourceIDRegex: "engine$"},
+			{TypeGlob: "*.state", Expr: `tags.vehicle == "car01"`},
+			{Channel: "physics", Expr: `type == "body.state" || runId == "run-2"`},
+		}
+		events := []*event.Event{
+			makeEvent("run-1", "flight-engine", "physics", "body.state", map[string]string{"vehicle": "car01"}),
+			makeEvent("run-2", "ui", "physics", "frame.start", nil),
+			makeEvent("other", "drive-engine", "aero", "aero.state", map[string]string{"vehicle": "car02"}),
+		}
+		for _, filter := range filters {
+			m, err := filter.Compile()
+			if err != nil {
+				t.Fatalf("Compile(%+v) вернула ошибку: %v", filter, err)
+			}
+			for _, e := range events {
+				if got, want := m.Matches(e), filter.Matches(e); got != want {
+					t.Errorf("фильтр %+v, событие %s/%s/%s: Matcher.Matches() = %v, Filter.Matches() = %v", filter, e.RunID, e.SourceID, e.Type, got, want)
+				}
+			}
+		}
+	})
+
+	t.Run("некорректный фильтр → ErrInvalidFilter", func(t *testing.T) {
+		for _, filter := range []Filter{{RunIDGlob: "run-[1"}, {TypeRegex: "("}, {Expr: `payload.speed >`}} {
+			if m, err := filter.Compile(); !errors.Is(err, ErrInvalidFilter) || m != nil {
+				t.Errorf("Compile(%+v) = %v, %v, ожидалась ErrInvalidFilter", filter, m, err)
+			}
+			if filter.Matches(makeEvent("run-1", "s", "c", "t", nil)) {
+				t.Errorf("некорректный фильтр %+v не должен совпадать", filter)
+			}
+		}
+	})
+
+	t.Run("Matches не компилирует точный фильтр", func(t *testing.T) {
+		filter := Filter{RunID: "run-1", SourceID: "s", TagsAll: map[string]string{"vehicle": "car01"}}
+		e := makeEvent("run-1", "s", "c", "t", map[string]string{"vehicle": "car01"})
+		if allocs := testing.AllocsPerRun(100, func() { filter.Matches(e) }); allocs != 0 {
+			t.Errorf("Matches() выделяет память: %v", allocs)
+		}
+	})
 }
 
 // TestBackpressure_Block проверяет политику backpressure "block".
@@ -911,8 +1005,8 @@ func TestEventBus_Stats(t *testing.T) {
 
 		sub1.Close()
 		stats = bus.Stats()
-		if stats.SubscribersCount != 2 {
-			t.Errorf("после закрытия подписки ожидалось 2 подписчика (подписки не удаляются), получено %d", stats.SubscribersCount)
+		if stats.SubscribersCount != 1 {
+			t.Errorf("после закрытия подписки ожидался 1 подписчик, получено %d", stats.SubscribersCount)
 		}
 	})
 
@@ -934,4 +1028,34 @@ func TestEventBus_Stats(t *testing.T) {
 			t.Errorf("ожидалось %d опубликованных событий, получено %d", len(events), stats.TotalPublished)
 		}
 	})
+	t.Run("заполненность очередей block-подписчиков", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		ctx := context.Background()
+		blocking, _ := bus.Subscribe(ctx, Filter{}, SubscriptionOptions{
+			BufferSize: 10,
+			Policy:     BackpressureBlock,
+		})
+		defer blocking.Close()
+
+		// drop_old подписчик не учитывается
+		dropping, _ := bus.Subscribe(ctx, Filter{}, SubscriptionOptions{
+			BufferSize: 2,
+			Policy:     BackpressureDropOld,
+		})
+		defer dropping.Close()
+
+		if fill := bus.Stats().MaxBlockingQueueFill; fill != 0 {
+			t.Errorf("начальная заполненность = %f, ожидалось 0", fill)
+		}
+
+		for i := 0; i < 5; i++ {
+			bus.Publish(ctx, makeEvent("run-1", "source-1", "channel-1", "type-1", nil))
+		}
+
+		if fill := bus.Stats().MaxBlockingQueueFill; fill != 0.5 {
+			t.Errorf("заполненность = %f, ожидалось 0.5", fill)
+		}
+	})
 }
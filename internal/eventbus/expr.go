@@ -0,0 +1,872 @@
+package eventbus
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// Выражение фильтра - условие над полями события, тегами и payload.
+//
+// Примеры:
+//
+//	type == "body.state" && payload.speed > 30
+//	tags.vehicle in ("car01", "car02")
+//	tags.scene ~ "city-*" and not payload.wheels[0].slip >= 0.2
+//	payload["engine temp"] != null
+//
+// Грамматика:
+//
+//	expr       = or
+//	or         = and { ("||" | "or") and }
+//	and        = unary { ("&&" | "and") unary }
+//	unary      = ("!" | "not") unary | "(" expr ")" | condition
+//	condition  = operand [ cmp operand | ["not"] "in" "(" literal { "," literal } ")" | ("~" | "!~") string ]
+//	cmp        = "==" | "!=" | "<" | "<=" | ">" | ">="
+//	operand    = literal | path
+//	literal    = number | string | "true" | "false" | "null"
+//	path       = field | "tags." key | "payload" { "." key | "[" index "]" | "[" string "]" }
+//	field      = "runId" | "sourceId" | "channel" | "type" | "frameIndex" | "simTime" | "wallTimeMs" | "seq" | "v"
+//
+// Строки записываются в двойных или одинарных кавычках. Отсутствующее поле
+// равно null. Сравнения <, <=, >, >= определены для пар чисел и пар строк,
+// для остальных пар они ложны. Целые числа сравниваются точно во всём
+// диапазоне int64 и uint64, остальные - как float64. "~" сопоставляет строку с glob-шаблоном
+// (*, ?, [a-z]). Операнд без сравнения истинен, если он не null, не false,
+// не 0 и не пустая строка.
+
+// ErrInvalidFilter - фильтр подписки не удалось скомпилировать.
+var ErrInvalidFilter = errors.New("eventbus: invalid filter")
+
+const (
+	// maxExprLen - максимальная длина выражения фильтра
+	maxExprLen = 4096
+
+	// maxExprDepth - максимальная вложенность скобок и отрицаний
+	maxExprDepth = 64
+)
+
+// Expr - скомпилированное выражение фильтра.
+// Безопасно для одновременного использования из нескольких goroutine.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// CompileExpr компилирует выражение фильтра.
+// Ошибка совместима с ErrInvalidFilter и содержит позицию в выражении.
+func CompileExpr(src string) (*Expr, error) {
+	if len(src) > maxExprLen {
+		return nil, fmt.Errorf("%w: expression longer than %d bytes", ErrInvalidFilter, maxExprLen)
+	}
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String возвращает исходный текст выражения.
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Eval проверяет, выполняется ли выражение для события.
+// Payload декодируется при первом обращении к нему.
+func (x *Expr) Eval(e *event.Event) bool {
+	return x.eval(&evalContext{event: e})
+}
+
+func (x *Expr) eval(ctx *evalContext) bool {
+	return x.root.eval(ctx)
+}
+
+// evalContext - событие, для которого вычисляются выражения. Fan-out
+// создаёт один контекст на событие, поэтому payload декодируется
+// не более одного раза для всех подписчиков и только если хотя бы одно
+// выражение до него дошло. Контекст используется одной goroutine.
+type evalContext struct {
+	event *event.Event
+
+	payload any
+	decoded bool
+}
+
+// decodedPayload возвращает payload события, декодированный при первом
+// вызове. Числа остаются json.Number, чтобы целые сравнивались точно.
+// Некорректный payload равен null.
+func (ctx *evalContext) decodedPayload() any {
+	if !ctx.decoded {
+		ctx.decoded = true
+		if len(ctx.event.Payload) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(ctx.event.Payload))
+			dec.UseNumber()
+			if err := dec.Decode(&ctx.payload); err != nil {
+				ctx.payload = nil
+			}
+		}
+	}
+	return ctx.payload
+}
+
+// exprNode - логический узел выражения.
+type exprNode interface {
+	eval(ctx *evalContext) bool
+}
+
+// exprOperand - значение, участвующее в сравнении: nil, bool, number,
+// string, []any или map[string]any.
+type exprOperand interface {
+	value(ctx *evalContext) any
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) eval(ctx *evalContext) bool { return n.left.eval(ctx) && n.right.eval(ctx) }
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) eval(ctx *evalContext) bool { return n.left.eval(ctx) || n.right.eval(ctx) }
+
+type notNode struct{ node exprNode }
+
+func (n notNode) eval(ctx *evalContext) bool { return !n.node.eval(ctx) }
+
+// cmpNode - сравнение двух операндов.
+type cmpNode struct {
+	op          string
+	left, right exprOperand
+}
+
+func (n cmpNode) eval(ctx *evalContext) bool {
+	a, b := n.left.value(ctx), n.right.value(ctx)
+	switch n.op {
+	case "==":
+		return valuesEqual(a, b)
+	case "!=":
+		return !valuesEqual(a, b)
+	}
+
+	c, ok := compareValues(a, b)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // ">="
+		return c >= 0
+	}
+}
+
+// inNode - принадлежность множеству литералов.
+type inNode struct {
+	operand exprOperand
+	values  []any
+	negate  bool
+}
+
+func (n inNode) eval(ctx *evalContext) bool {
+	v := n.operand.value(ctx)
+	for _, candidate := range n.values {
+		if valuesEqual(v, candidate) {
+			return !n.negate
+		}
+	}
+	return n.negate
+}
+
+// globNode - сопоставление строки с glob-шаблоном.
+type globNode struct {
+	operand exprOperand
+	pattern string
+	negate  bool
+}
+
+func (n globNode) eval(ctx *evalContext) bool {
+	s, ok := n.operand.value(ctx).(string)
+	if !ok {
+		return n.negate
+	}
+	matched, _ := path.Match(n.pattern, s)
+	return matched != n.negate
+}
+
+// truthyNode - операнд без сравнения.
+type truthyNode struct{ operand exprOperand }
+
+func (n truthyNode) eval(ctx *evalContext) bool {
+	switch v := n.operand.value(ctx).(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case number:
+		return !v.isZero()
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+type literalOperand struct{ v any }
+
+func (o literalOperand) value(*evalContext) any { return o.v }
+
+// fieldOperand - поле конверта события.
+type fieldOperand struct{ name string }
+
+func (o fieldOperand) value(ctx *evalContext) any {
+	e := ctx.event
+	switch o.name {
+	case "runId":
+		return e.RunID
+	case "sourceId":
+		return e.SourceID
+	case "channel":
+		return e.Channel
+	case "type":
+		return e.Type
+	case "frameIndex":
+		return intNumber(int64(e.FrameIndex))
+	case "simTime":
+		return floatNumber(e.SimTime)
+	case "wallTimeMs":
+		if e.WallTimeMs == nil {
+			return nil
+		}
+		return intNumber(*e.WallTimeMs)
+	case "seq":
+		if e.Seq == nil {
+			return nil
+		}
+		return uintNumber(*e.Seq)
+	default: // "v"
+		return intNumber(int64(e.V))
+	}
+}
+
+// envelopeFields - поля конверта, доступные в выражении.
+var envelopeFields = map[string]bool{
+	"runId": true, "sourceId": true, "channel": true, "type": true,
+	"frameIndex": true, "simTime": true, "wallTimeMs": true, "seq": true, "v": true,
+}
+
+// tagOperand - значение тега.
+type tagOperand struct{ key string }
+
+func (o tagOperand) value(ctx *evalContext) any {
+	v, ok := ctx.event.Tags[o.key]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// pathStep - шаг пути в payload: ключ объекта или индекс массива.
+type pathStep struct {
+	key   string
+	index int // -1 для ключа
+}
+
+// payloadOperand - значение по пути в payload.
+type payloadOperand struct{ steps []pathStep }
+
+func (o payloadOperand) value(ctx *evalContext) any {
+	v := ctx.decodedPayload()
+	for _, step := range o.steps {
+		if step.index >= 0 {
+			arr, ok := v.([]any)
+			if !ok || step.index >= len(arr) {
+				return nil
+			}
+			v = arr[step.index]
+			continue
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[step.key]
+	}
+	if n, ok := v.(json.Number); ok {
+		num, ok := parseNumber(string(n))
+		if !ok {
+			return nil
+		}
+		return num
+	}
+	return v
+}
+
+// number - числовое значение выражения. Целые числа, представимые
+// в int64 или uint64, хранятся точно; остальные - как float64.
+type number struct {
+	kind numberKind
+	i    int64
+	u    uint64
+	f    float64
+}
+
+type numberKind uint8
+
+const (
+	numberFloat numberKind = iota
+	numberInt              // i
+	numberUint             // u > math.MaxInt64
+)
+
+func intNumber(i int64) number { return number{kind: numberInt, i: i} }
+
+func floatNumber(f float64) number { return number{kind: numberFloat, f: f} }
+
+func uintNumber(u uint64) number {
+	if u <= math.MaxInt64 {
+		return intNumber(int64(u))
+	}
+	return number{kind: numberUint, u: u}
+}
+
+// parseNumber разбирает число литерала или payload.
+func parseNumber(s string) (number, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return intNumber(i), true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return uintNumber(u), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return number{}, false
+	}
+	return floatNumber(f), true
+}
+
+func (n number) isZero() bool {
+	switch n.kind {
+	case numberInt:
+		return n.i == 0
+	case numberUint:
+		return false
+	default:
+		return n.f == 0
+	}
+}
+
+// float возвращает значение как float64 (с потерей точности для больших целых).
+func (n number) float() float64 {
+	switch n.kind {
+	case numberInt:
+		return float64(n.i)
+	case numberUint:
+		return float64(n.u)
+	default:
+		return n.f
+	}
+}
+
+// exact приводит целое float64 из диапазона int64 к numberInt,
+// чтобы сравнение с целым было точным.
+func (n number) exact() number {
+	if n.kind == numberFloat && n.f == math.Trunc(n.f) && n.f >= math.MinInt64 && n.f < math.MaxInt64 {
+		return intNumber(int64(n.f))
+	}
+	return n
+}
+
+// compare упорядочивает два числа. Возвращает false, если одно из них NaN.
+func (n number) compare(m number) (int, bool) {
+	if n.kind != numberFloat || m.kind != numberFloat {
+		n, m = n.exact(), m.exact()
+	}
+	switch {
+	case n.kind == numberFloat || m.kind == numberFloat:
+		a, b := n.float(), m.float()
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		default:
+			return 0, a == b // NaN не упорядочен
+		}
+	case n.kind == numberUint && m.kind == numberUint:
+		return cmp.Compare(n.u, m.u), true
+	case n.kind == numberUint:
+		return 1, true
+	case m.kind == numberUint:
+		return -1, true
+	default:
+		return cmp.Compare(n.i, m.i), true
+	}
+}
+
+// valuesEqual сравнивает значения одного типа; значения разных типов не равны.
+func valuesEqual(a, b any) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case number:
+		b, ok := b.(number)
+		if !ok {
+			return false
+		}
+		c, ok := a.compare(b)
+		return ok && c == 0
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	default:
+		// Объекты и массивы не сравниваются
+		return false
+	}
+}
+
+// compareValues упорядочивает пару чисел или пару строк.
+func compareValues(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case number:
+		b, ok := b.(number)
+		if !ok {
+			return 0, false
+		}
+		return a.compare(b)
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	default:
+		return 0, false
+	}
+}
+
+// Лексер
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp // ==, !=, <, <=, >, >=, ~, !~, &&, ||, !
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokDot
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string // для tokString - значение без кавычек
+	num  float64
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+func lexExpr(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		case isDigit(c) || (c == '-' && i+1 < len(src) && (isDigit(src[i+1]) || src[i+1] == '.')) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			i++
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid number %q at %d", ErrInvalidFilter, src[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: num, pos: start})
+
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v at %d", ErrInvalidFilter, err, start)
+			}
+			i += n
+			tokens = append(tokens, token{kind: tokString, text: s, pos: start})
+
+		default:
+			kind, n := lexPunct(src[i:])
+			if n == 0 {
+				return nil, fmt.Errorf("%w: unexpected character %q at %d", ErrInvalidFilter, c, start)
+			}
+			i += n
+			tokens = append(tokens, token{kind: kind, text: src[start:i], pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexString читает строку в кавычках, начинающуюся с s[0].
+// Возвращает значение и количество прочитанных байт.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, errors.New("unterminated string")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				// \", \', \\ и любой другой символ - как есть
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+func lexPunct(s string) (tokenKind, int) {
+	if len(s) >= 2 {
+		switch s[:2] {
+		case "==", "!=", "<=", ">=", "!~", "&&", "||":
+			return tokOp, 2
+		}
+	}
+	switch s[0] {
+	case '<', '>', '~', '!':
+		return tokOp, 1
+	case '(':
+		return tokLParen, 1
+	case ')':
+		return tokRParen, 1
+	case '[':
+		return tokLBracket, 1
+	case ']':
+		return tokRBracket, 1
+	case '.':
+		return tokDot, 1
+	case ',':
+		return tokComma, 1
+	}
+	return tokEOF, 0
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '-'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Парсер
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// is проверяет вид и текст токена (ключевое слово или оператор).
+func (tok token) is(kind tokenKind, text string) bool {
+	return tok.kind == kind && tok.text == text
+}
+
+func (p *exprParser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("%w: %s at %d", ErrInvalidFilter, fmt.Sprintf(format, args...), tok.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.is(tokOp, "||") || tok.is(tokIdent, "or"); tok = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.is(tokOp, "&&") || tok.is(tokIdent, "and"); tok = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	tok := p.peek()
+	if tok.is(tokOp, "!") || tok.is(tokIdent, "not") || tok.kind == tokLParen {
+		if p.depth++; p.depth > maxExprDepth {
+			return nil, p.errorf(tok, "expression nested deeper than %d", maxExprDepth)
+		}
+		defer func() { p.depth-- }()
+	}
+
+	switch {
+	case tok.is(tokOp, "!") || tok.is(tokIdent, "not"):
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+
+	case tok.kind == tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, p.errorf(tok, "expected \")\", got %s", tok)
+		}
+		return node, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *exprParser) parseCondition() (exprNode, error) {
+	operand, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" || tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return cmpNode{op: tok.text, left: operand, right: right}, nil
+
+	case tok.is(tokOp, "~") || tok.is(tokOp, "!~"):
+		p.next()
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, p.errorf(pattern, "expected glob pattern string, got %s", pattern)
+		}
+		if _, err := path.Match(pattern.text, ""); err != nil {
+			return nil, p.errorf(pattern, "invalid glob pattern %q", pattern.text)
+		}
+		return globNode{operand: operand, pattern: pattern.text, negate: tok.text == "!~"}, nil
+
+	case tok.is(tokIdent, "in"):
+		p.next()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{operand: operand, values: values}, nil
+
+	case tok.is(tokIdent, "not") && p.tokens[p.pos+1].is(tokIdent, "in"):
+		p.next()
+		p.next()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{operand: operand, values: values, negate: true}, nil
+	}
+	return truthyNode{operand}, nil
+}
+
+// parseList разбирает "(" literal { "," literal } ")".
+func (p *exprParser) parseList() ([]any, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return nil, p.errorf(tok, "expected \"(\" after in, got %s", tok)
+	}
+	var values []any
+	for {
+		tok := p.next()
+		v, ok := literalValue(tok)
+		if !ok {
+			return nil, p.errorf(tok, "expected literal in list, got %s", tok)
+		}
+		values = append(values, v)
+
+		switch tok := p.next(); tok.kind {
+		case tokComma:
+		case tokRParen:
+			return values, nil
+		default:
+			return nil, p.errorf(tok, "expected \",\" or \")\", got %s", tok)
+		}
+	}
+}
+
+// literalValue возвращает значение литерала.
+func literalValue(tok token) (any, bool) {
+	switch {
+	case tok.kind == tokNumber:
+		n, ok := parseNumber(tok.text)
+		return n, ok
+	case tok.kind == tokString:
+		return tok.text, true
+	case tok.is(tokIdent, "true"):
+		return true, true
+	case tok.is(tokIdent, "false"):
+		return false, true
+	case tok.is(tokIdent, "null"):
+		return nil, true
+	}
+	return nil, false
+}
+
+func (p *exprParser) parseOperand() (exprOperand, error) {
+	tok := p.next()
+	if v, ok := literalValue(tok); ok {
+		return literalOperand{v}, nil
+	}
+	if tok.kind != tokIdent {
+		return nil, p.errorf(tok, "expected field, payload path or literal, got %s", tok)
+	}
+
+	switch tok.text {
+	case "payload":
+		var steps []pathStep
+		for {
+			step, ok, err := p.parseStep()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return payloadOperand{steps}, nil
+			}
+			steps = append(steps, step)
+		}
+
+	case "tags":
+		step, ok, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || step.index >= 0 {
+			return nil, p.errorf(p.peek(), "expected tag key after tags")
+		}
+		return tagOperand{step.key}, nil
+	}
+
+	if !envelopeFields[tok.text] {
+		return nil, p.errorf(tok, "unknown field %s", tok)
+	}
+	return fieldOperand{tok.text}, nil
+}
+
+// parseStep разбирает "." key, "[" index "]" или "[" string "]".
+// Возвращает false, если следующий токен не начинает шаг пути.
+func (p *exprParser) parseStep() (pathStep, bool, error) {
+	switch p.peek().kind {
+	case tokDot:
+		p.next()
+		tok := p.next()
+		if tok.kind != tokIdent {
+			return pathStep{}, false, p.errorf(tok, "expected key after \".\", got %s", tok)
+		}
+		return pathStep{key: tok.text, index: -1}, true, nil
+
+	case tokLBracket:
+		p.next()
+		tok := p.next()
+		var step pathStep
+		switch {
+		case tok.kind == tokString:
+			step = pathStep{key: tok.text, index: -1}
+		case tok.kind == tokNumber && tok.num >= 0 && tok.num == float64(int(tok.num)):
+			step = pathStep{index: int(tok.num)}
+		default:
+			return pathStep{}, false, p.errorf(tok, "expected array index or quoted key, got %s", tok)
+		}
+		if end := p.next(); end.kind != tokRBracket {
+			return pathStep{}, false, p.errorf(end, "expected \"]\", got %s", end)
+		}
+		return step, true, nil
+	}
+	return pathStep{}, false, nil
+}
@@ -0,0 +1,188 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// TestExpr_Eval проверяет вычисление выражений фильтра.
+func TestExpr_Eval(t *testing.T) {
+	seq := uint64(42)
+	e := makeEvent("run-1", "flight-engine", "physics", "body.state", map[string]string{"vehicle": "car01", "scene": "city-night"})
+	e.FrameIndex = 100
+	e.SimTime = 1.5
+	e.Seq = &seq
+	e.Payload = []byte(`{"speed":35.5,"gear":3,"name":"alpha","on":true,"wheels":[{"slip":0.1},{"slip":0.3}],"engine temp":90,"none":null}`)
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`payload.speed > 30`, true},
+		{`payload.speed > 40`, false},
+		{`payload.speed >= 35.5 && payload.speed <= 35.5`, true},
+		{`type == "body.state" and payload.gear == 3`, true},
+		{`type == 'aero.state' or payload.gear != 3`, false},
+		{`frameIndex >= 100 && simTime < 2 && seq == 42 && v == 1`, true},
+		{`payload.wheels[1].slip > 0.2`, true},
+		{`payload.wheels[5].slip > 0.2`, false},
+		{`payload["engine temp"] == 90`, true},
+		{`payload.name > "a" && payload.name < "b"`, true},
+		{`payload.on`, true},
+		{`!payload.on`, false},
+		{`payload.missing`, false},
+		{`payload.missing == null && payload.none == null`, true},
+		{`payload.missing != null`, false},
+		{`payload.speed > "30"`, false},
+		{`payload.speed == "35.5"`, false},
+		{`tags.vehicle in ("car01", "car02")`, true},
+		{`tags.vehicle not in ("car01", "car02")`, false},
+		{`payload.gear in (1, 2, 3)`, true},
+		{`tags.scene ~ "city-*"`, true},
+		{`tags.scene !~ "city-*"`, false},
+		{`tags.vehicle ~ "car0?"`, true},
+		{`tags.missing ~ "*"`, false},
+		{`not (tags.vehicle == "car02" || payload.speed < 10)`, true},
+		{`(payload.speed > 30 || payload.gear > 5) && not tags.scene ~ "rural*"`, true},
+		{`payload.speed > -1 && payload.speed < 1e3`, true},
+		{`wallTimeMs == null`, true},
+	}
+	for _, tc := range cases {
+		expr, err := CompileExpr(tc.expr)
+		if err != nil {
+			t.Errorf("CompileExpr(%q) вернула ошибку: %v", tc.expr, err)
+			continue
+		}
+		if got := expr.Eval(e); got != tc.want {
+			t.Errorf("%s = %v, ожидалось %v", tc.expr, got, tc.want)
+		}
+	}
+
+	t.Run("целые больше 2^53 сравниваются точно", func(t *testing.T) {
+		big := makeEvent("run-1", "s", "c", "t", nil)
+		big.Payload = []byte(`{"id":9007199254740993,"u":18446744073709551615,"neg":-9223372036854775808,"f":2.5}`)
+		seq := uint64(18446744073709551615)
+		big.Seq = &seq
+		for src, want := range map[string]bool{
+			`payload.id == 9007199254740993`:        true,
+			`payload.id == 9007199254740992`:        false,
+			`payload.id > 9007199254740992`:         true,
+			`payload.u == 18446744073709551615`:     true,
+			`payload.u > 9223372036854775807`:       true,
+			`payload.u > payload.neg`:               true,
+			`payload.neg == -9223372036854775808`:   true,
+			`seq == 18446744073709551615`:           true,
+			`seq > payload.id`:                      true,
+			`payload.f > 2 && payload.f < 3`:        true,
+			`payload.id in (1, 9007199254740993)`:   true,
+			`payload.id == 9.007199254740993e15`:    false,
+			`payload.f == 2.5 && payload.id != 2.5`: true,
+		} {
+			expr, err := CompileExpr(src)
+			if err != nil {
+				t.Fatalf("CompileExpr(%q) вернула ошибку: %v", src, err)
+			}
+			if got := expr.Eval(big); got != want {
+				t.Errorf("%s = %v, ожидалось %v", src, got, want)
+			}
+		}
+	})
+
+	t.Run("payload декодируется лениво и один раз на событие", func(t *testing.T) {
+		e := makeEvent("run-1", "s", "c", "body.state", nil)
+		e.Payload = []byte(`{"speed":40}`)
+		ctx := &evalContext{event: e}
+
+		skip, _ := CompileExpr(`type == "aero.state" && payload.speed > 30`)
+		if skip.eval(ctx) || ctx.decoded {
+			t.Fatal("payload не должен декодироваться, если выражение не дошло до него")
+		}
+
+		fast, _ := CompileExpr(`payload.speed > 30`)
+		if !fast.eval(ctx) || !ctx.decoded {
+			t.Fatal("ожидалось true")
+		}
+		// Следующие выражения используют уже декодированный payload
+		e.Payload = []byte(`{"speed":10}`)
+		if !fast.eval(ctx) {
+			t.Error("payload декодирован повторно")
+		}
+	})
+
+	t.Run("некорректный payload → значения payload равны null", func(t *testing.T) {
+		broken := makeEvent("run-1", "s", "c", "t", nil)
+		broken.Payload = []byte(`{not json`)
+		expr, _ := CompileExpr(`payload.speed == null`)
+		if !expr.Eval(broken) {
+			t.Error("ожидалось true")
+		}
+	})
+}
+
+// TestCompileExpr_Errors проверяет ошибки компиляции выражений.
+func TestCompileExpr_Errors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`payload.speed >`,
+		`payload.speed > 30 &&`,
+		`(payload.speed > 30`,
+		`unknown == 1`,
+		`tags == "x"`,
+		`tags[0] == "x"`,
+		`payload.speed ~ 30`,
+		`tags.scene ~ "[a-"`,
+		`tags.vehicle in "car01"`,
+		`tags.vehicle in (payload.x)`,
+		`payload[-1] == 1`,
+		`"unterminated`,
+		`payload.speed # 1`,
+		strings.Repeat("(", maxExprDepth+1) + "true" + strings.Repeat(")", maxExprDepth+1),
+		strings.Repeat("x", maxExprLen+1),
+	} {
+		if _, err := CompileExpr(src); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("CompileExpr(%.40q) = %v, ожидалась ErrInvalidFilter", src, err)
+		}
+	}
+}
+
+// TestSubscribe_Expr проверяет фильтрацию подписки по выражению.
+func TestSubscribe_Expr(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	t.Run("некорректное выражение → ошибка Subscribe", func(t *testing.T) {
+		sub, err := bus.Subscribe(context.Background(), Filter{Expr: `payload.speed >`}, SubscriptionOptions{})
+		if !errors.Is(err, ErrInvalidFilter) || sub != nil {
+			t.Errorf("Subscribe() = %v, %v; ожидалась ErrInvalidFilter", sub, err)
+		}
+	})
+
+	t.Run("выражение применяется вместе с полями фильтра", func(t *testing.T) {
+		sub, err := bus.Subscribe(context.Background(), Filter{
+			RunID: "run-1",
+			Expr:  `payload.speed > 30`,
+		}, SubscriptionOptions{BufferSize: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+
+		fast := makeEvent("run-1", "s", "c", "body.state", nil)
+		fast.Payload = []byte(`{"speed":40}`)
+		slow := makeEvent("run-1", "s", "c", "body.state", nil)
+		slow.Payload = []byte(`{"speed":10}`)
+		otherRun := makeEvent("run-2", "s", "c", "body.state", nil)
+		otherRun.Payload = []byte(`{"speed":50}`)
+		bus.PublishBatch(context.Background(), []*event.Event{fast, slow, otherRun})
+
+		events := readAllAvailableEvents(sub, 50*time.Millisecond)
+		if len(events) != 1 || events[0] != fast {
+			t.Errorf("получено %d событий, ожидалось только быстрое событие run-1", len(events))
+		}
+	})
+}
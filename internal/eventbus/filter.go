@@ -1,9 +1,189 @@
 package eventbus
 
-import "github.com/teltel/teltel/internal/event"
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/teltel/teltel/internal/event"
+)
 
 // Matches проверяет, соответствует ли событие фильтру.
+// Фильтр не компилируется: точные условия проверяются первыми, glob -
+// через path.Match, а regex и Expr разбираются при каждом вызове, только
+// если до них дошла проверка. Некорректный фильтр не совпадает ни с одним
+// событием.
+//
+// Deprecated: ошибка некорректного фильтра скрывается, а regex и Expr
+// разбираются заново для каждого события. Используйте Compile
+// и Matcher.Matches.
 func (f Filter) Matches(e *event.Event) bool {
+	if !f.matchFields(e) {
+		return false
+	}
+	if !matchPattern(f.RunIDGlob, f.RunIDRegex, e.RunID) ||
+		!matchPattern(f.SourceIDGlob, f.SourceIDRegex, e.SourceID) ||
+		!matchPattern(f.ChannelGlob, f.ChannelRegex, e.Channel) ||
+		!matchPattern(f.TypeGlob, f.TypeRegex, e.Type) {
+		return false
+	}
+	if f.Expr == "" {
+		return true
+	}
+	expr, err := CompileExpr(f.Expr)
+	return err == nil && expr.Eval(e)
+}
+
+// matchPattern проверяет glob и regex одного поля без предварительной
+// компиляции. Некорректный шаблон не совпадает ни с одной строкой.
+func matchPattern(glob, expr, s string) bool {
+	if glob != "" {
+		if matched, err := path.Match(glob, s); err != nil || !matched {
+			return false
+		}
+	}
+	if expr != "" {
+		matched, err := regexp.MatchString(expr, s)
+		return err == nil && matched
+	}
+	return true
+}
+
+// Matcher - скомпилированный фильтр. Безопасен для одновременного
+// использования из нескольких goroutine.
+type Matcher struct {
+	c compiledFilter
+}
+
+// Compile компилирует шаблоны и выражение фильтра, как Subscribe.
+// Ошибка совместима с ErrInvalidFilter.
+func (f Filter) Compile() (*Matcher, error) {
+	c, err := compileFilter(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{c: c}, nil
+}
+
+// Matches проверяет, соответствует ли событие фильтру.
+func (m *Matcher) Matches(e *event.Event) bool {
+	return m.c.matches(&evalContext{event: e})
+}
+
+// compiledFilter - фильтр подписки со скомпилированными шаблонами и выражением.
+type compiledFilter struct {
+	filter Filter
+
+	runID    patternMatcher
+	sourceID patternMatcher
+	channel  patternMatcher
+	typ      patternMatcher
+
+	// patterns - задан хотя бы один glob или regex
+	patterns bool
+
+	expr *Expr
+}
+
+// compileFilter компилирует шаблоны и выражение фильтра.
+// Ошибка совместима с ErrInvalidFilter.
+func compileFilter(f Filter) (compiledFilter, error) {
+	c := compiledFilter{filter: f}
+
+	var err error
+	if c.runID, err = compilePattern("RunID", f.RunIDGlob, f.RunIDRegex); err != nil {
+		return c, err
+	}
+	if c.sourceID, err = compilePattern("SourceID", f.SourceIDGlob, f.SourceIDRegex); err != nil {
+		return c, err
+	}
+	if c.channel, err = compilePattern("Channel", f.ChannelGlob, f.ChannelRegex); err != nil {
+		return c, err
+	}
+	if c.typ, err = compilePattern("Type", f.TypeGlob, f.TypeRegex); err != nil {
+		return c, err
+	}
+	c.patterns = !c.runID.empty() || !c.sourceID.empty() || !c.channel.empty() || !c.typ.empty()
+
+	if f.Expr != "" {
+		expr, err := CompileExpr(f.Expr)
+		if err != nil {
+			return c, err
+		}
+		c.expr = expr
+	}
+	return c, nil
+}
+
+// matches проверяет, соответствует ли событие ctx фильтру.
+// Дешёвые точные сравнения проверяются первыми.
+func (c *compiledFilter) matches(ctx *evalContext) bool {
+	e := ctx.event
+	if !c.filter.matchFields(e) {
+		return false
+	}
+	if c.patterns && !(c.runID.match(e.RunID) && c.sourceID.match(e.SourceID) &&
+		c.channel.match(e.Channel) && c.typ.match(e.Type)) {
+		return false
+	}
+	return c.expr == nil || c.expr.eval(ctx)
+}
+
+// patternMatcher - скомпилированные glob и regex условия одного поля.
+// Пустой matcher совпадает с любой строкой.
+type patternMatcher struct {
+	glob string
+
+	// prefix - glob вида "campaign42-*", который сводится к проверке префикса
+	prefix    string
+	hasPrefix bool
+
+	re *regexp.Regexp
+}
+
+// compilePattern проверяет glob и компилирует regex поля field.
+func compilePattern(field, glob, expr string) (patternMatcher, error) {
+	var m patternMatcher
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return m, fmt.Errorf("%w: %sGlob %q: %v", ErrInvalidFilter, field, glob, err)
+		}
+		if prefix, ok := strings.CutSuffix(glob, "*"); ok && !strings.ContainsAny(prefix, `*?[\`) {
+			m.prefix, m.hasPrefix = prefix, true
+		} else {
+			m.glob = glob
+		}
+	}
+	if expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return m, fmt.Errorf("%w: %sRegex: %v", ErrInvalidFilter, field, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+func (m *patternMatcher) empty() bool {
+	return m.glob == "" && !m.hasPrefix && m.re == nil
+}
+
+func (m *patternMatcher) match(s string) bool {
+	// Как и в path.Match, "*" не совпадает с "/"
+	if m.hasPrefix && (!strings.HasPrefix(s, m.prefix) || strings.IndexByte(s[len(m.prefix):], '/') >= 0) {
+		return false
+	}
+	if m.glob != "" {
+		if matched, _ := path.Match(m.glob, s); !matched {
+			return false
+		}
+	}
+	return m.re == nil || m.re.MatchString(s)
+}
+
+// matchFields проверяет точные и префиксные условия фильтра.
+func (f Filter) matchFields(e *event.Event) bool {
 	// RunID
 	if f.RunID != "" && e.RunID != f.RunID {
 		return false
@@ -0,0 +1,65 @@
+package eventbus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// defaultEventKey - ключ coalesce и sampling по умолчанию.
+var defaultEventKey = []string{"runId", "sourceId", "type"}
+
+// eventKeyField - поле события, входящее в ключ.
+type eventKeyField struct {
+	name string
+	tag  string // ключ тега для "tags.<key>"
+}
+
+// eventKey - скомпилированный ключ, по которому подписка группирует
+// события (BackpressureCoalesce, Sampling).
+type eventKey []eventKeyField
+
+// compileEventKey проверяет поля ключа: runId, sourceId, channel, type
+// и tags.<key>. Пустой список - ключ по умолчанию. option - имя параметра
+// для сообщения об ошибке.
+func compileEventKey(option string, fields []string) (eventKey, error) {
+	if len(fields) == 0 {
+		fields = defaultEventKey
+	}
+	key := make(eventKey, 0, len(fields))
+	for _, name := range fields {
+		switch {
+		case name == "runId" || name == "sourceId" || name == "channel" || name == "type":
+			key = append(key, eventKeyField{name: name})
+		case strings.HasPrefix(name, "tags.") && len(name) > len("tags."):
+			key = append(key, eventKeyField{name: "tags", tag: name[len("tags."):]})
+		default:
+			return nil, fmt.Errorf("%w: unknown %s field %q", ErrInvalidOptions, option, name)
+		}
+	}
+	return key, nil
+}
+
+// of возвращает ключ события.
+func (k eventKey) of(e *event.Event) string {
+	var b strings.Builder
+	for i, f := range k {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		switch f.name {
+		case "runId":
+			b.WriteString(e.RunID)
+		case "sourceId":
+			b.WriteString(e.SourceID)
+		case "channel":
+			b.WriteString(e.Channel)
+		case "type":
+			b.WriteString(e.Type)
+		default:
+			b.WriteString(e.Tags[f.tag])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package eventbus
+
+import "github.com/teltel/teltel/internal/event"
+
+// routingTable - неизменяемый снимок подписчиков с индексами по точным
+// полям фильтра. Publish читает текущий снимок без блокировок, Subscribe
+// и закрытие подписки строят новый (copy-on-write).
+//
+// Каждая подписка попадает ровно в одну группу, по самому селективному
+// точному полю фильтра: RunID, затем SourceID, затем Types. Подписки без
+// точных полей (в том числе только с шаблонами или выражением) проверяются
+// для каждого события. Для события кандидаты - подписки групп его RunID,
+// SourceID и Type плюс wildcard-подписки; каждая из них встречается один
+// раз, так как событие имеет один Type.
+type routingTable struct {
+	// all - все подписки в порядке создания
+	all []*subscription
+
+	byRunID    map[string][]*subscription
+	bySourceID map[string][]*subscription
+	byType     map[string][]*subscription
+	wildcard   []*subscription
+}
+
+// emptyRoutingTable - таблица без подписок.
+var emptyRoutingTable = &routingTable{}
+
+// newRoutingTable строит индексы для подписок subs.
+func newRoutingTable(subs []*subscription) *routingTable {
+	t := &routingTable{
+		all:        subs,
+		byRunID:    make(map[string][]*subscription),
+		bySourceID: make(map[string][]*subscription),
+		byType:     make(map[string][]*subscription),
+	}
+	for _, sub := range subs {
+		f := &sub.filter.filter
+		switch {
+		case f.RunID != "":
+			t.byRunID[f.RunID] = append(t.byRunID[f.RunID], sub)
+		case f.SourceID != "":
+			t.bySourceID[f.SourceID] = append(t.bySourceID[f.SourceID], sub)
+		case len(f.Types) > 0:
+			for _, typ := range uniqueStrings(f.Types) {
+				t.byType[typ] = append(t.byType[typ], sub)
+			}
+		default:
+			t.wildcard = append(t.wildcard, sub)
+		}
+	}
+	return t
+}
+
+// with возвращает новую таблицу с добавленной подпиской.
+func (t *routingTable) with(sub *subscription) *routingTable {
+	subs := make([]*subscription, len(t.all), len(t.all)+1)
+	copy(subs, t.all)
+	return newRoutingTable(append(subs, sub))
+}
+
+// contains проверяет, есть ли подписка в таблице.
+func (t *routingTable) contains(sub *subscription) bool {
+	for _, s := range t.all {
+		if s == sub {
+			return true
+		}
+	}
+	return false
+}
+
+// without возвращает новую таблицу без подписки.
+func (t *routingTable) without(sub *subscription) *routingTable {
+	subs := make([]*subscription, 0, len(t.all))
+	for _, s := range t.all {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	return newRoutingTable(subs)
+}
+
+// candidates возвращает группы подписок, которые могут совпасть с событием.
+// Фильтр каждой подписки всё равно проверяется полностью.
+func (t *routingTable) candidates(e *event.Event) [4][]*subscription {
+	return [4][]*subscription{
+		t.byRunID[e.RunID],
+		t.bySourceID[e.SourceID],
+		t.byType[e.Type],
+		t.wildcard,
+	}
+}
+
+// uniqueStrings возвращает значения без повторов, сохраняя порядок.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
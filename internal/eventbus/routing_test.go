@@ -0,0 +1,51 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestRouting проверяет, что индексная маршрутизация доставляет каждое
+// событие ровно тем подписчикам, чей фильтр с ним совпадает, и ровно один раз.
+func TestRouting(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	filters := map[string]Filter{
+		"run":          {RunID: "run-1"},
+		"run+type":     {RunID: "run-1", Types: []string{"body.state"}},
+		"source":       {SourceID: "engine"},
+		"types":        {Types: []string{"body.state", "aero.state", "body.state"}},
+		"wildcard":     {},
+		"glob":         {RunIDGlob: "run-*"},
+		"channel":      {Channel: "physics"},
+		"other-run":    {RunID: "run-2"},
+		"other-source": {SourceID: "ui"},
+	}
+	subs := make(map[string]Subscription, len(filters))
+	for name, filter := range filters {
+		sub, err := bus.Subscribe(context.Background(), filter, SubscriptionOptions{BufferSize: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+		subs[name] = sub
+	}
+
+	bus.Publish(context.Background(), makeEvent("run-1", "engine", "physics", "body.state", nil))
+
+	want := map[string]int{
+		"run": 1, "run+type": 1, "source": 1, "types": 1, "wildcard": 1, "glob": 1, "channel": 1,
+		"other-run": 0, "other-source": 0,
+	}
+	for name, sub := range subs {
+		if got := len(readAllAvailableEvents(sub, 20*time.Millisecond)); got != want[name] {
+			t.Errorf("%s: получено %d событий, ожидалось %d", name, got, want[name])
+		}
+	}
+
+	if stats := bus.Stats(); stats.SubscribersCount != len(filters) {
+		t.Errorf("SubscribersCount = %d, ожидалось %d", stats.SubscribersCount, len(filters))
+	}
+}
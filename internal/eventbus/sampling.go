@@ -0,0 +1,151 @@
+package eventbus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// SamplingMode определяет способ прореживания событий подписки.
+type SamplingMode string
+
+const (
+	// SamplingEveryN - каждое N-е событие ключа
+	SamplingEveryN SamplingMode = "every_n"
+
+	// SamplingRate - не более Rate событий в секунду на ключ
+	SamplingRate SamplingMode = "rate"
+
+	// SamplingFrames - одно событие ключа на Frames кадров (по FrameIndex)
+	SamplingFrames SamplingMode = "frames"
+)
+
+// samplerMaxKeys - количество ключей, после которого состояние sampler'а
+// сбрасывается (защита от неограниченного роста для долгих подписок)
+const samplerMaxKeys = 4096
+
+// Sampling - прореживание событий подписки. Применяется в bus после
+// фильтра и до очереди подписки, поэтому отброшенные события не занимают
+// очередь и не учитываются в Dropped(). Каждый ключ (Key) прореживается
+// независимо: например, каждое 10-е body.state каждого источника.
+type Sampling struct {
+	// Mode - способ прореживания (пустая строка = без прореживания)
+	Mode SamplingMode `json:"mode"`
+
+	// N - для SamplingEveryN: пропускается первое событие и затем каждое N-е
+	N int `json:"n,omitempty"`
+
+	// Rate - для SamplingRate: максимум событий в секунду на ключ
+	Rate float64 `json:"rate,omitempty"`
+
+	// Frames - для SamplingFrames: пропускается первое событие ключа
+	// в каждом интервале [k*Frames, (k+1)*Frames) значений FrameIndex
+	Frames int `json:"frames,omitempty"`
+
+	// Key - поля ключа: runId, sourceId, channel, type, tags.<key>
+	// (по умолчанию runId, sourceId, type)
+	Key []string `json:"key,omitempty"`
+}
+
+// samplerState - состояние прореживания одного ключа.
+type samplerState struct {
+	count  uint64    // SamplingEveryN: событий с последнего пропущенного
+	last   time.Time // SamplingRate: время последнего пропущенного события
+	bucket int       // SamplingFrames: интервал кадров последнего пропущенного события
+}
+
+// sampler прореживает события подписки.
+type sampler struct {
+	config   Sampling
+	key      eventKey
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*samplerState
+}
+
+// newSampler проверяет параметры прореживания. Возвращает nil, если
+// прореживание не задано.
+func newSampler(config Sampling) (*sampler, error) {
+	if config.Mode == "" {
+		return nil, nil
+	}
+
+	s := &sampler{
+		config: config,
+		now:    time.Now,
+		states: make(map[string]*samplerState),
+	}
+	switch config.Mode {
+	case SamplingEveryN:
+		if config.N < 1 {
+			return nil, fmt.Errorf("%w: sampling every_n requires n >= 1", ErrInvalidOptions)
+		}
+	case SamplingRate:
+		if !(config.Rate > 0) {
+			return nil, fmt.Errorf("%w: sampling rate requires rate > 0", ErrInvalidOptions)
+		}
+		s.interval = time.Duration(float64(time.Second) / config.Rate)
+	case SamplingFrames:
+		if config.Frames < 1 {
+			return nil, fmt.Errorf("%w: sampling frames requires frames >= 1", ErrInvalidOptions)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown sampling mode %q", ErrInvalidOptions, config.Mode)
+	}
+
+	key, err := compileEventKey("sampling key", config.Key)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return s, nil
+}
+
+// allow решает, пропустить ли событие в очередь подписки.
+func (s *sampler) allow(e *event.Event) bool {
+	k := s.key.of(e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[k]
+	if !ok {
+		if len(s.states) >= samplerMaxKeys {
+			s.states = make(map[string]*samplerState)
+		}
+		state = &samplerState{}
+		s.states[k] = state
+	}
+
+	switch s.config.Mode {
+	case SamplingEveryN:
+		pass := state.count == 0
+		state.count++
+		if state.count == uint64(s.config.N) {
+			state.count = 0
+		}
+		return pass
+
+	case SamplingRate:
+		now := s.now()
+		if ok && now.Sub(state.last) < s.interval {
+			return false
+		}
+		state.last = now
+		return true
+
+	default: // SamplingFrames
+		// Пропускается событие любого другого интервала: следующего или,
+		// после перезапуска источника, меньшего
+		bucket := e.FrameIndex / s.config.Frames
+		if ok && bucket == state.bucket {
+			return false
+		}
+		state.bucket = bucket
+		return true
+	}
+}
@@ -0,0 +1,131 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// sampleFrames возвращает FrameIndex событий, пропущенных sampler'ом.
+func sampleFrames(s *sampler, events []*event.Event) []int {
+	var frames []int
+	for _, e := range events {
+		if s.allow(e) {
+			frames = append(frames, e.FrameIndex)
+		}
+	}
+	return frames
+}
+
+// frameEvents создаёт события кадров from..to-1 источника sourceID.
+func frameEvents(sourceID string, from, to int) []*event.Event {
+	var events []*event.Event
+	for i := from; i < to; i++ {
+		e := makeEvent("run-1", sourceID, "physics", "body.state", nil)
+		e.FrameIndex = i
+		events = append(events, e)
+	}
+	return events
+}
+
+// TestSampler проверяет режимы прореживания.
+func TestSampler(t *testing.T) {
+	t.Run("every_n → первое и каждое N-е событие ключа", func(t *testing.T) {
+		s, _ := newSampler(Sampling{Mode: SamplingEveryN, N: 4})
+		got := sampleFrames(s, frameEvents("engine", 0, 10))
+		if want := []int{0, 4, 8}; !slices.Equal(got, want) {
+			t.Errorf("пропущены кадры %v, ожидалось %v", got, want)
+		}
+	})
+
+	t.Run("ключи прореживаются независимо", func(t *testing.T) {
+		s, _ := newSampler(Sampling{Mode: SamplingEveryN, N: 2})
+		a, b := frameEvents("a", 0, 4), frameEvents("b", 0, 4)
+		var mixed []*event.Event
+		for i := range a {
+			mixed = append(mixed, a[i], b[i])
+		}
+		if got := sampleFrames(s, mixed); !slices.Equal(got, []int{0, 0, 2, 2}) {
+			t.Errorf("пропущены кадры %v", got)
+		}
+	})
+
+	t.Run("frames → одно событие на интервал кадров", func(t *testing.T) {
+		s, _ := newSampler(Sampling{Mode: SamplingFrames, Frames: 10})
+		events := frameEvents("engine", 5, 35)
+		// Перезапуск источника: FrameIndex снова с нуля
+		events = append(events, frameEvents("engine", 0, 3)...)
+		if got := sampleFrames(s, events); !slices.Equal(got, []int{5, 10, 20, 30, 0}) {
+			t.Errorf("пропущены кадры %v", got)
+		}
+	})
+
+	t.Run("rate → не более Rate событий в секунду на ключ", func(t *testing.T) {
+		s, _ := newSampler(Sampling{Mode: SamplingRate, Rate: 10})
+		clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		s.now = func() time.Time { return clock }
+
+		// 1 кГц в течение 2 секунд
+		passed := 0
+		for _, e := range frameEvents("engine", 0, 2000) {
+			clock = clock.Add(time.Millisecond)
+			if s.allow(e) {
+				passed++
+			}
+		}
+		if passed != 20 {
+			t.Errorf("пропущено %d событий, ожидалось 20", passed)
+		}
+	})
+
+	t.Run("некорректные параметры → ErrInvalidOptions", func(t *testing.T) {
+		for _, config := range []Sampling{
+			{Mode: "random"},
+			{Mode: SamplingEveryN},
+			{Mode: SamplingRate, Rate: -1},
+			{Mode: SamplingRate, Rate: math.NaN()},
+			{Mode: SamplingFrames, Frames: 0},
+			{Mode: SamplingEveryN, N: 2, Key: []string{"payload"}},
+		} {
+			if _, err := newSampler(config); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("newSampler(%+v) = %v, ожидалась ErrInvalidOptions", config, err)
+			}
+		}
+	})
+}
+
+// TestSubscribe_Sampling проверяет прореживание до очереди подписки.
+func TestSubscribe_Sampling(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	sub, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{
+		BufferSize: 100,
+		Policy:     BackpressureDropNew,
+		Sampling:   Sampling{Mode: SamplingFrames, Frames: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	bus.PublishBatch(context.Background(), frameEvents("engine", 0, 1000))
+
+	events := readAllAvailableEvents(sub, 50*time.Millisecond)
+	if len(events) != 10 {
+		t.Errorf("получено %d событий, ожидалось 10", len(events))
+	}
+
+	info := bus.Subscriptions()[0]
+	if info.Sampled != 990 || info.Delivered != 10 || info.Dropped != 0 || info.Sampling == nil || info.Sampling.Frames != 100 {
+		t.Errorf("состояние подписки: %+v", info)
+	}
+	if stats := bus.Stats(); stats.TotalDropped != 0 {
+		t.Errorf("TotalDropped = %d, ожидалось 0", stats.TotalDropped)
+	}
+}
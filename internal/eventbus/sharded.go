@@ -0,0 +1,284 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+const (
+	// defaultShardQueueSize - ёмкость очереди шарда в batch'ах по умолчанию
+	defaultShardQueueSize = 256
+
+	// defaultDrainTimeout - ожидание доставки очередей шардов в Close
+	defaultDrainTimeout = 5 * time.Second
+)
+
+// shardedBus - EventBus с асинхронным fan-out по шардам.
+//
+// Publish только записывает событие в журнал и ставит его в очередь шарда,
+// выбранного по RunID; fan-out выполняет goroutine шарда. Все события
+// одного run'а проходят через одну очередь и одну goroutine, поэтому их
+// порядок сохраняется. Подписчик BackpressureBlock, который не успевает
+// читать, блокирует только goroutine шардов с подходящими ему событиями;
+// Publish блокируется, лишь когда заполнена очередь такого шарда.
+//
+// Подписки, таблица маршрутизации и журнал - общие, из bus.
+type shardedBus struct {
+	*bus
+
+	shards       []*shard
+	drainTimeout time.Duration
+
+	// publishers - количество выполняющихся Publish и PublishBatch.
+	// Publish не берёт блокировок: он увеличивает счётчик и проверяет
+	// closed, а Close выставляет closed и ждёт, пока счётчик обнулится,
+	// чтобы после него в очереди ничего не добавлялось
+	publishers atomic.Int64
+	idle       chan struct{}
+	markIdle   func()
+
+	// done освобождает Publish, ожидающие места в очереди; drain
+	// сообщает goroutine шардов, что после очереди событий не будет
+	done  chan struct{}
+	drain chan struct{}
+	wg    sync.WaitGroup
+}
+
+// shard - очередь и счётчики шарда. Счётчики изменяет только goroutine шарда.
+type shard struct {
+	queue     chan []*event.Event
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func newShardedBus(config Config) *shardedBus {
+	queueSize := config.ShardQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultShardQueueSize
+	}
+	drainTimeout := config.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+
+	b := &shardedBus{
+		bus:          newBus(config),
+		shards:       make([]*shard, config.Shards),
+		drainTimeout: drainTimeout,
+		idle:         make(chan struct{}),
+		done:         make(chan struct{}),
+		drain:        make(chan struct{}),
+	}
+	b.markIdle = sync.OnceFunc(func() { close(b.idle) })
+	for i := range b.shards {
+		s := &shard{queue: make(chan []*event.Event, queueSize)}
+		b.shards[i] = s
+		b.wg.Add(1)
+		go b.runShard(s)
+	}
+	return b
+}
+
+// shardIndex выбирает шард по RunID (FNV-1a).
+func (b *shardedBus) shardIndex(runID string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(runID); i++ {
+		h ^= uint32(runID[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(b.shards)))
+}
+
+// enter регистрирует начатую публикацию. Возвращает false после Close.
+// Счётчик увеличивается до проверки closed, а Close выставляет closed
+// до чтения счётчика, поэтому Close либо дождётся публикации, либо
+// публикация увидит closed.
+func (b *shardedBus) enter() bool {
+	b.publishers.Add(1)
+	if b.closed.Load() {
+		b.leave()
+		return false
+	}
+	return true
+}
+
+// leave завершает публикацию; последняя публикация после Close
+// освобождает Close.
+func (b *shardedBus) leave() {
+	if b.publishers.Add(-1) == 0 && b.closed.Load() {
+		b.markIdle()
+	}
+}
+
+// Publish ставит событие в очередь шарда его run'а. Блокируется, пока
+// очередь шарда заполнена; отмена ctx прерывает ожидание, Close
+// прерывает его с ErrClosed.
+func (b *shardedBus) Publish(ctx context.Context, e *event.Event) error {
+	if !b.enter() {
+		return nil
+	}
+	defer b.leave()
+
+	err := b.append(e)
+	if qerr := b.enqueue(ctx, b.shards[b.shardIndex(e.RunID)], []*event.Event{e}); qerr != nil {
+		return qerr
+	}
+	return err
+}
+
+// PublishBatch раскладывает события по очередям шардов, сохраняя порядок
+// внутри каждого run'а. При отмене ctx или Close остальные события
+// не публикуются, а возвращается ошибка и количество n, для которого
+// первые n событий гарантированно поставлены в очереди. Из событий
+// после первых n часть могла быть поставлена в очереди: при повторной
+// публикации они будут доставлены ещё раз, но не потеряются.
+func (b *shardedBus) PublishBatch(ctx context.Context, events []*event.Event) (int, error) {
+	if !b.enter() {
+		return 0, nil
+	}
+	defer b.leave()
+
+	err := b.append(events...)
+
+	// Вызывающий может переиспользовать events после возврата,
+	// поэтому каждый шард получает свою копию. Шарды ставятся в очереди
+	// в порядке первого события, поэтому при ошибке все события до первого
+	// события прерванного шарда уже в очередях.
+	type shardBatch struct {
+		shard int
+		first int
+	}
+	batches := make([][]*event.Event, len(b.shards))
+	var order []shardBatch
+	for i, e := range events {
+		s := b.shardIndex(e.RunID)
+		if batches[s] == nil {
+			order = append(order, shardBatch{shard: s, first: i})
+		}
+		batches[s] = append(batches[s], e)
+	}
+
+	for _, sb := range order {
+		if qerr := b.enqueue(ctx, b.shards[sb.shard], batches[sb.shard]); qerr != nil {
+			return sb.first, qerr
+		}
+	}
+	return len(events), err
+}
+
+// enqueue ставит batch в очередь шарда. Возвращает ошибку ctx, если
+// ожидание прервано его отменой, и ErrClosed, если его прервал Close.
+func (b *shardedBus) enqueue(ctx context.Context, s *shard, batch []*event.Event) error {
+	select {
+	case s.queue <- batch:
+		return nil
+	default:
+	}
+
+	select {
+	case s.queue <- batch:
+		return nil
+	case <-b.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runShard выполняет fan-out событий из очереди шарда; после Close
+// доставляет оставшиеся в очереди события и завершается.
+func (b *shardedBus) runShard(s *shard) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case batch := <-s.queue:
+			b.deliver(s, batch)
+		case <-b.drain:
+			for {
+				select {
+				case batch := <-s.queue:
+					b.deliver(s, batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver выполняет fan-out batch'а шарда.
+func (b *shardedBus) deliver(s *shard, batch []*event.Event) {
+	table := b.table.Load()
+	for _, e := range batch {
+		if dropped := b.fanOut(table, e); dropped > 0 {
+			s.dropped.Add(dropped)
+		}
+	}
+	s.published.Add(uint64(len(batch)))
+}
+
+// Stats возвращает статистику EventBus. TotalPublished учитывает события,
+// для которых fan-out уже выполнен; события в очередях шардов видны
+// в Shards[].QueueDepth.
+func (b *shardedBus) Stats() BusStats {
+	stats := b.bus.Stats()
+	stats.Shards = make([]ShardStats, len(b.shards))
+	for i, s := range b.shards {
+		shardStats := ShardStats{
+			Published:  s.published.Load(),
+			Dropped:    s.dropped.Load(),
+			QueueDepth: len(s.queue),
+			QueueSize:  cap(s.queue),
+		}
+		stats.Shards[i] = shardStats
+		stats.TotalPublished += shardStats.Published
+		stats.TotalDropped += shardStats.Dropped
+
+		// Заполненная очередь шарда блокирует Publish так же,
+		// как очередь подписчика BackpressureBlock
+		if fill := float64(shardStats.QueueDepth) / float64(shardStats.QueueSize); fill > stats.MaxBlockingQueueFill {
+			stats.MaxBlockingQueueFill = fill
+		}
+	}
+	return stats
+}
+
+// Close закрывает EventBus: доставляет события, оставшиеся в очередях
+// шардов, затем закрывает все подписки и останавливает goroutine шардов.
+// Если доставка не завершилась за DrainTimeout (подписчик
+// BackpressureBlock не читает), подписки закрываются раньше и остаток
+// очередей отбрасывается.
+func (b *shardedBus) Close() error {
+	if b.closed.Swap(true) {
+		return nil
+	}
+
+	// Освобождаем ожидающие Publish и дожидаемся уже начатых
+	close(b.done)
+	if b.publishers.Load() == 0 {
+		b.markIdle()
+	}
+	<-b.idle
+	close(b.drain)
+
+	drained := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(b.drainTimeout):
+	}
+
+	// Закрытие подписок освобождает goroutine шардов, заблокированные
+	// на подписчиках BackpressureBlock
+	b.closeSubscriptions()
+	<-drained
+	return nil
+}
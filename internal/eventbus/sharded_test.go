@@ -0,0 +1,280 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// runOnOtherShard возвращает runId, попадающий в другой шард, чем runID.
+func runOnOtherShard(t *testing.T, b *shardedBus, runID string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		other := fmt.Sprintf("other-%d", i)
+		if b.shardIndex(other) != b.shardIndex(runID) {
+			return other
+		}
+	}
+	t.Fatal("не найден run в другом шарде")
+	return ""
+}
+
+// TestShardedBus_Ordering проверяет порядок событий каждого run'а
+// при конкурентных producer'ах.
+func TestShardedBus_Ordering(t *testing.T) {
+	bus := NewWithConfig(Config{Shards: 4})
+	defer bus.Close()
+
+	const runs, perRun = 8, 500
+	sub, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{BufferSize: runs * perRun, Policy: BackpressureBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	var wg sync.WaitGroup
+	for r := 0; r < runs; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			runID := fmt.Sprintf("run-%d", r)
+			// Чередуем Publish и PublishBatch
+			for i := 0; i < perRun; i += 2 {
+				e1 := makeEvent(runID, "src", "ch", "t", nil)
+				e1.FrameIndex = i
+				e2 := makeEvent(runID, "src", "ch", "t", nil)
+				e2.FrameIndex = i + 1
+				if i%4 == 0 {
+					bus.Publish(context.Background(), e1)
+					bus.Publish(context.Background(), e2)
+				} else {
+					bus.PublishBatch(context.Background(), []*event.Event{e1, e2})
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	events := readEvents(sub, runs*perRun, 5*time.Second)
+	if len(events) != runs*perRun {
+		t.Fatalf("получено %d событий, ожидалось %d", len(events), runs*perRun)
+	}
+	next := make(map[string]int)
+	for _, e := range events {
+		if e.FrameIndex != next[e.RunID] {
+			t.Fatalf("run %s: frameIndex %d, ожидался %d", e.RunID, e.FrameIndex, next[e.RunID])
+		}
+		next[e.RunID]++
+	}
+
+	stats := bus.Stats()
+	if stats.TotalPublished != runs*perRun || len(stats.Shards) != 4 {
+		t.Errorf("статистика: %+v", stats)
+	}
+}
+
+// TestShardedBus_BlockIsolation проверяет, что заблокированный подписчик
+// одного run'а не останавливает доставку событий run'ов других шардов.
+func TestShardedBus_BlockIsolation(t *testing.T) {
+	bus := NewWithConfig(Config{Shards: 4, ShardQueueSize: 2}).(*shardedBus)
+	defer bus.Close()
+
+	slowRun := "run-slow"
+	fastRun := runOnOtherShard(t, bus, slowRun)
+
+	// Подписчик slowRun не читает свою очередь
+	slow, err := bus.Subscribe(context.Background(), Filter{RunID: slowRun}, SubscriptionOptions{BufferSize: 1, Policy: BackpressureBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := bus.Subscribe(context.Background(), Filter{RunID: fastRun}, SubscriptionOptions{BufferSize: 100, Policy: BackpressureBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	// Заполняем очередь подписчика, goroutine шарда и очередь шарда
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var publishErr error
+	for i := 0; i < 10 && publishErr == nil; i++ {
+		publishErr = bus.Publish(ctx, makeEvent(slowRun, "src", "ch", "t", nil))
+	}
+	if !errors.Is(publishErr, context.DeadlineExceeded) {
+		t.Fatalf("Publish в заполненный шард: %v, ожидалась context.DeadlineExceeded", publishErr)
+	}
+
+	// Другой шард продолжает работать
+	for i := 0; i < 50; i++ {
+		if err := bus.Publish(context.Background(), makeEvent(fastRun, "src", "ch", "t", nil)); err != nil {
+			t.Fatalf("Publish вернул ошибку: %v", err)
+		}
+	}
+	if events := readEvents(fast, 50, time.Second); len(events) != 50 {
+		t.Fatalf("fast получил %d событий, ожидалось 50", len(events))
+	}
+
+	stats := bus.Stats()
+	if stats.MaxBlockingQueueFill != 1 {
+		t.Errorf("MaxBlockingQueueFill = %v, ожидалось 1", stats.MaxBlockingQueueFill)
+	}
+
+	// Чтение освобождает заблокированный шард
+	if events := readEvents(slow, 4, time.Second); len(events) != 4 {
+		t.Errorf("slow получил %d событий, ожидалось 4", len(events))
+	}
+}
+
+// TestShardedBus_Close проверяет, что Close не зависает на заблокированном
+// подписчике и останавливает публикацию.
+func TestShardedBus_Close(t *testing.T) {
+	bus := NewWithConfig(Config{Shards: 2, ShardQueueSize: 1, DrainTimeout: 50 * time.Millisecond})
+
+	sub, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{BufferSize: 1, Policy: BackpressureBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Publish блокируется на заполненном шарде до Close
+	published := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			err = bus.Publish(context.Background(), makeEvent("run-1", "src", "ch", "t", nil))
+		}
+		published <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close завис")
+	}
+	select {
+	case err := <-published:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("прерванный Publish вернул %v, ожидалась ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish не разблокирован после Close")
+	}
+
+	// Канал подписки закрыт после доставленных до Close событий
+	for range sub.C() {
+	}
+	if err := bus.Publish(context.Background(), makeEvent("run-1", "src", "ch", "t", nil)); err != nil {
+		t.Errorf("Publish после Close вернул ошибку: %v", err)
+	}
+}
+
+// TestShardedBus_PublishBatchPrefix проверяет, что прерванный PublishBatch
+// возвращает количество гарантированно опубликованных первых событий.
+func TestShardedBus_PublishBatchPrefix(t *testing.T) {
+	bus := newShardedBus(Config{Shards: 2, ShardQueueSize: 1, DrainTimeout: 50 * time.Millisecond})
+	defer bus.Close()
+
+	blocked := "run-0"
+	free := runOnOtherShard(t, bus, blocked)
+
+	// Подписчик, который не читает, блокирует шард run'а blocked
+	if _, err := bus.Subscribe(context.Background(), Filter{RunID: blocked}, SubscriptionOptions{BufferSize: 1, Policy: BackpressureBlock}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := bus.Publish(ctx, makeEvent(blocked, "src", "ch", "t", nil))
+		cancel()
+		if err != nil {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	events := []*event.Event{
+		makeEvent(free, "src", "ch", "t", nil),
+		makeEvent(blocked, "src", "ch", "t", nil),
+		makeEvent(free, "src", "ch", "t", nil),
+	}
+	n, err := bus.PublishBatch(ctx, events)
+	if n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PublishBatch() = %d, %v; ожидалось 1, DeadlineExceeded", n, err)
+	}
+}
+
+// TestShardedBus_CloseDrains проверяет, что Close доставляет события,
+// оставшиеся в очередях шардов.
+func TestShardedBus_CloseDrains(t *testing.T) {
+	bus := NewWithConfig(Config{Shards: 4})
+
+	const count = 1000
+	sub, err := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{BufferSize: count, Policy: BackpressureBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		if err := bus.Publish(context.Background(), makeEvent(fmt.Sprintf("run-%d", i%16), "src", "ch", "t", nil)); err != nil {
+			t.Fatalf("Publish() вернул ошибку: %v", err)
+		}
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close() вернул ошибку: %v", err)
+	}
+
+	received := 0
+	for range sub.C() {
+		received++
+	}
+	if received != count {
+		t.Errorf("получено %d событий, ожидалось %d", received, count)
+	}
+	if stats := bus.Stats(); stats.TotalPublished != count {
+		t.Errorf("TotalPublished = %d, ожидалось %d", stats.TotalPublished, count)
+	}
+}
+
+// TestShardedBus_CloseWaitsPublish проверяет, что Close дожидается
+// выполняющихся Publish, а Publish после Close ничего не публикует.
+func TestShardedBus_CloseWaitsPublish(t *testing.T) {
+	bus := newShardedBus(Config{Shards: 2})
+
+	// Публикация, начатая до Close
+	if !bus.enter() {
+		t.Fatal("enter() до Close вернул false")
+	}
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close не дождался выполняющегося Publish")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if bus.enter() {
+		t.Error("enter() после Close вернул true")
+	}
+	bus.leave()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close не завершился после Publish")
+	}
+	if n, err := bus.PublishBatch(context.Background(), []*event.Event{makeEvent("run-1", "src", "ch", "t", nil)}); n != 0 || err != nil {
+		t.Errorf("PublishBatch() после Close = %d, %v", n, err)
+	}
+}
@@ -4,25 +4,54 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/teltel/teltel/internal/event"
 )
 
 // subscription реализует Subscription интерфейс.
 type subscription struct {
-	filter  Filter
-	options SubscriptionOptions
-	ch      chan *event.Event
-	ctx     context.Context
-	cancel  context.CancelFunc
-
-	dropped atomic.Uint64
-	closed  atomic.Bool
-	wg      sync.WaitGroup
+	id        uint64
+	filter    compiledFilter
+	options   SubscriptionOptions
+	createdAt time.Time
+	ch        chan *event.Event
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// coalescer - очередь BackpressureCoalesce (nil для остальных политик)
+	coalescer *coalescer
+
+	// sampler - прореживание до очереди (nil = без прореживания)
+	sampler *sampler
+
+	// unregister удаляет подписку из bus при закрытии (nil вне bus)
+	unregister func(*subscription)
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	sampled   atomic.Uint64
+	closed    atomic.Bool
+
+	// sendMu не даёт закрыть канал, пока send в него пишет:
+	// send держит RLock, Close берёт Lock после отмены ctx
+	sendMu sync.RWMutex
 }
 
 // newSubscription создаёт новую подписку.
-func newSubscription(ctx context.Context, filter Filter, opt SubscriptionOptions) *subscription {
+func newSubscription(ctx context.Context, filter compiledFilter, opt SubscriptionOptions) (*subscription, error) {
+	var key eventKey
+	if opt.Policy == BackpressureCoalesce {
+		var err error
+		if key, err = compileEventKey("CoalesceKey", opt.CoalesceKey); err != nil {
+			return nil, err
+		}
+	}
+	sampler, err := newSampler(opt.Sampling)
+	if err != nil {
+		return nil, err
+	}
+
 	subCtx, cancel := context.WithCancel(ctx)
 
 	// Минимальный размер буфера - 1
@@ -32,14 +61,34 @@ func newSubscription(ctx context.Context, filter Filter, opt SubscriptionOptions
 	}
 
 	sub := &subscription{
-		filter:  filter,
-		options: opt,
-		ch:      make(chan *event.Event, bufferSize),
-		ctx:     subCtx,
-		cancel:  cancel,
+		filter:    filter,
+		options:   opt,
+		createdAt: time.Now(),
+		ctx:       subCtx,
+		cancel:    cancel,
+		sampler:   sampler,
 	}
 
-	return sub
+	if opt.Policy == BackpressureCoalesce {
+		// Очередь - ключи coalescer'а; канал небуферизованный
+		if opt.BufferSize < 1 {
+			bufferSize = defaultCoalesceKeys
+		}
+		sub.ch = make(chan *event.Event)
+		sub.coalescer = newCoalescer(key, bufferSize)
+		go sub.coalescer.run(subCtx, sub.ch)
+	} else {
+		sub.ch = make(chan *event.Event, bufferSize)
+	}
+
+	return sub, nil
+}
+
+// closeOnDone закрывает подписку при отмене контекста Subscribe.
+// Завершается и при явном Close, который отменяет контекст подписки.
+func (s *subscription) closeOnDone() {
+	<-s.ctx.Done()
+	_ = s.Close()
 }
 
 // C возвращает канал для чтения событий.
@@ -52,25 +101,91 @@ func (s *subscription) Dropped() uint64 {
 	return s.dropped.Load()
 }
 
-// Close закрывает подписку.
+// queueFill возвращает заполненность очереди подписки (0..1).
+// Закрытая подписка считается пустой.
+func (s *subscription) queueFill() float64 {
+	if s.closed.Load() {
+		return 0
+	}
+	return float64(len(s.ch)) / float64(cap(s.ch))
+}
+
+// info возвращает состояние подписки.
+func (s *subscription) info() SubscriptionInfo {
+	depth, size := 0, cap(s.ch)
+	if s.coalescer != nil {
+		size = s.coalescer.limit
+	}
+	if !s.closed.Load() {
+		if s.coalescer != nil {
+			depth = s.coalescer.len()
+		} else {
+			depth = len(s.ch)
+		}
+	}
+	info := SubscriptionInfo{
+		ID:         s.id,
+		Name:       s.options.Name,
+		Filter:     s.filter.filter,
+		Policy:     s.options.Policy,
+		BufferSize: size,
+		QueueDepth: depth,
+		Delivered:  s.delivered.Load(),
+		Dropped:    s.dropped.Load(),
+		Sampled:    s.sampled.Load(),
+		CreatedAt:  s.createdAt,
+	}
+	if s.sampler != nil {
+		sampling := s.sampler.config
+		info.Sampling = &sampling
+	}
+	return info
+}
+
+// Close закрывает подписку и удаляет её из bus.
 func (s *subscription) Close() error {
 	if s.closed.Swap(true) {
 		return nil // уже закрыта
 	}
 
+	// Отмена ctx освобождает send, заблокированный политикой block
 	s.cancel()
+	if s.unregister != nil {
+		s.unregister(s)
+	}
+
+	s.sendMu.Lock()
+	if s.coalescer != nil {
+		<-s.coalescer.done
+	}
 	close(s.ch)
-	s.wg.Wait()
+	s.sendMu.Unlock()
 	return nil
 }
 
 // send пытается отправить событие в очередь подписки.
-// Возвращает true, если событие отправлено, false если отброшено.
+// Возвращает true, если событие отправлено или прорежено, false если отброшено.
 func (s *subscription) send(e *event.Event) bool {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+
 	if s.closed.Load() {
 		return false
 	}
+	if s.sampler != nil && !s.sampler.allow(e) {
+		// Прореженное событие не считается отброшенным
+		s.sampled.Add(1)
+		return true
+	}
+	if s.trySend(e) {
+		s.delivered.Add(1)
+		return true
+	}
+	return false
+}
 
+// trySend отправляет событие в соответствии с политикой backpressure.
+func (s *subscription) trySend(e *event.Event) bool {
 	switch s.options.Policy {
 	case BackpressureBlock:
 		// Блокируемся, пока не освободится место
@@ -116,6 +231,14 @@ func (s *subscription) send(e *event.Event) bool {
 			}
 		}
 
+	case BackpressureCoalesce:
+		// Заменённое событие того же ключа считается отброшенным
+		replaced, ok := s.coalescer.push(e)
+		if replaced || !ok {
+			s.dropped.Add(1)
+		}
+		return ok
+
 	default:
 		// Неизвестная политика, используем drop_new
 		select {
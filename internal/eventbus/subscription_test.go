@@ -0,0 +1,110 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitSubscribers ждёт, пока количество подписчиков станет равным n.
+func waitSubscribers(t *testing.T, bus EventBus, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for bus.Stats().SubscribersCount != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("SubscribersCount = %d, ожидалось %d", bus.Stats().SubscribersCount, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSubscription_Unregister проверяет удаление подписки из bus.
+func TestSubscription_Unregister(t *testing.T) {
+	t.Run("Close удаляет подписку и она больше не получает события", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), Filter{RunID: "run-1"}, SubscriptionOptions{BufferSize: 10})
+		sub.Close()
+		waitSubscribers(t, bus, 0)
+
+		// Publish после Close не паникует и не считает событие отброшенным
+		bus.Publish(context.Background(), makeEvent("run-1", "s", "c", "t", nil))
+		if stats := bus.Stats(); stats.TotalDropped != 0 {
+			t.Errorf("TotalDropped = %d, ожидалось 0", stats.TotalDropped)
+		}
+	})
+
+	t.Run("отмена контекста закрывает и удаляет подписку", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, _ := bus.Subscribe(ctx, Filter{}, SubscriptionOptions{BufferSize: 10})
+		cancel()
+
+		waitSubscribers(t, bus, 0)
+		select {
+		case _, ok := <-sub.C():
+			if ok {
+				t.Error("ожидался закрытый канал")
+			}
+		case <-time.After(time.Second):
+			t.Error("канал подписки не закрыт после отмены контекста")
+		}
+	})
+
+	t.Run("закрытие во время заблокированного Publish", func(t *testing.T) {
+		bus := New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), Filter{}, SubscriptionOptions{BufferSize: 1, Policy: BackpressureBlock})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				bus.Publish(context.Background(), makeEvent("run-1", "s", "c", "t", nil))
+			}
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		sub.Close()
+		wg.Wait()
+	})
+}
+
+// TestEventBus_Subscriptions проверяет состояние подписок.
+func TestEventBus_Subscriptions(t *testing.T) {
+	bus := New()
+	defer bus.Close()
+
+	ctx := context.Background()
+	ui, _ := bus.Subscribe(ctx, Filter{RunID: "run-1"}, SubscriptionOptions{BufferSize: 2, Policy: BackpressureDropNew, Name: "ui"})
+	defer ui.Close()
+	closed, _ := bus.Subscribe(ctx, Filter{}, SubscriptionOptions{Name: "closed"})
+	closed.Close()
+	all, _ := bus.Subscribe(ctx, Filter{}, SubscriptionOptions{BufferSize: 10, Name: "all"})
+	defer all.Close()
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(ctx, makeEvent("run-1", "s", "c", "t", nil))
+	}
+	<-all.C()
+
+	infos := bus.Subscriptions()
+	if len(infos) != 2 || infos[0].Name != "ui" || infos[1].Name != "all" {
+		t.Fatalf("подписки: %+v", infos)
+	}
+
+	got := infos[0]
+	if got.Filter.RunID != "run-1" || got.Policy != BackpressureDropNew || got.BufferSize != 2 ||
+		got.QueueDepth != 2 || got.Delivered != 2 || got.Dropped != 1 || got.Dropped != ui.Dropped() {
+		t.Errorf("ui: %+v", got)
+	}
+	if got := infos[1]; got.QueueDepth != 2 || got.Delivered != 3 || got.Dropped != 0 || got.ID <= infos[0].ID {
+		t.Errorf("all: %+v", got)
+	}
+}
@@ -2,28 +2,57 @@ package eventbus
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"github.com/teltel/teltel/internal/event"
 )
 
 // Filter определяет условия фильтрации событий для подписки.
+// Все заданные условия должны выполняться одновременно.
+//
+// Glob-поля используют синтаксис path.Match (*, ?, [a-z]) и сопоставляются
+// со всей строкой. Regex-поля используют синтаксис regexp и, как grep,
+// ищут совпадение в любом месте строки (для полного совпадения - ^...$).
 type Filter struct {
 	// RunID - фильтр по идентификатору run'а (пустая строка = wildcard)
-	RunID string
+	RunID string `json:"runId,omitempty"`
+
+	// RunIDGlob, RunIDRegex - шаблоны идентификатора run'а (например, "campaign42-*")
+	RunIDGlob  string `json:"runIdGlob,omitempty"`
+	RunIDRegex string `json:"runIdRegex,omitempty"`
 
 	// SourceID - фильтр по источнику (пустая строка = wildcard)
-	SourceID string
+	SourceID string `json:"sourceId,omitempty"`
+
+	// SourceIDGlob, SourceIDRegex - шаблоны источника
+	SourceIDGlob  string `json:"sourceIdGlob,omitempty"`
+	SourceIDRegex string `json:"sourceIdRegex,omitempty"`
 
 	// Channel - фильтр по каналу (пустая строка = wildcard)
-	Channel string
+	Channel string `json:"channel,omitempty"`
+
+	// ChannelGlob, ChannelRegex - шаблоны канала
+	ChannelGlob  string `json:"channelGlob,omitempty"`
+	ChannelRegex string `json:"channelRegex,omitempty"`
 
 	// Types - точное совпадение типов событий
-	Types []string
+	Types []string `json:"types,omitempty"`
 
 	// TypePrefix - префиксное совпадение типа события
-	TypePrefix string
+	TypePrefix string `json:"typePrefix,omitempty"`
+
+	// TypeGlob, TypeRegex - шаблоны типа события
+	TypeGlob  string `json:"typeGlob,omitempty"`
+	TypeRegex string `json:"typeRegex,omitempty"`
 
 	// TagsAll - событие должно содержать все указанные теги
-	TagsAll map[string]string
+	TagsAll map[string]string `json:"tagsAll,omitempty"`
+
+	// Expr - выражение над полями, тегами и payload события
+	// (пустая строка = без выражения), см. CompileExpr.
+	// Шаблоны и выражение компилируются один раз при Subscribe.
+	Expr string `json:"expr,omitempty"`
 }
 
 // BackpressurePolicy определяет политику обработки backpressure.
@@ -38,49 +67,128 @@ const (
 
 	// BackpressureDropOld - старые события удаляются, очередь работает как ring buffer
 	BackpressureDropOld BackpressurePolicy = "drop_old"
+
+	// BackpressureCoalesce - для каждого ключа (SubscriptionOptions.CoalesceKey)
+	// в очереди хранится только последнее событие: медленный потребитель
+	// получает актуальные значения вместо устаревшей очереди
+	BackpressureCoalesce BackpressurePolicy = "coalesce"
 )
 
+// ErrInvalidOptions - некорректные параметры подписки.
+var ErrInvalidOptions = errors.New("eventbus: invalid subscription options")
+
+// ErrClosed - EventBus закрыт, пока Publish ожидал места в очереди шарда;
+// событие не опубликовано.
+var ErrClosed = errors.New("eventbus: closed")
+
 // SubscriptionOptions определяет параметры подписки.
 type SubscriptionOptions struct {
-	// BufferSize - размер буфера подписки
+	// BufferSize - размер буфера подписки; для BackpressureCoalesce -
+	// максимальное количество ключей, ожидающих доставки (по умолчанию 1024)
 	BufferSize int
 
 	// Policy - политика backpressure
 	Policy BackpressurePolicy
 
+	// CoalesceKey - поля ключа BackpressureCoalesce: runId, sourceId,
+	// channel, type, tags.<key> (по умолчанию runId, sourceId, type)
+	CoalesceKey []string
+
+	// Sampling - прореживание событий до очереди (по умолчанию выключено)
+	Sampling Sampling
+
 	// Name - имя подписки для отладки и метрик
 	Name string
 }
 
 // BusStats содержит статистику EventBus.
 type BusStats struct {
-	// SubscribersCount - количество активных подписчиков
-	SubscribersCount int
+	// SubscribersCount - количество активных (не закрытых) подписчиков
+	SubscribersCount int `json:"subscribersCount"`
 
 	// TotalPublished - общее количество опубликованных событий
-	TotalPublished uint64
+	TotalPublished uint64 `json:"totalPublished"`
 
 	// TotalDropped - общее количество отброшенных событий
-	TotalDropped uint64
+	TotalDropped uint64 `json:"totalDropped"`
+
+	// MaxBlockingQueueFill - максимальная заполненность очереди (0..1) среди
+	// подписчиков с политикой BackpressureBlock. Значение, близкое к 1,
+	// означает, что Publish вот-вот начнёт блокироваться.
+	MaxBlockingQueueFill float64 `json:"maxBlockingQueueFill"`
+
+	// Shards - статистика шардов (только при Config.Shards > 0)
+	Shards []ShardStats `json:"shards,omitempty"`
+}
+
+// ShardStats содержит статистику шарда асинхронного fan-out.
+type ShardStats struct {
+	// Published - событий, для которых шард выполнил fan-out
+	Published uint64 `json:"published"`
+
+	// Dropped - отправок подписчикам шарда, которые не были приняты
+	Dropped uint64 `json:"dropped"`
+
+	// QueueDepth - batch'ей в очереди шарда
+	QueueDepth int `json:"queueDepth"`
+
+	// QueueSize - ёмкость очереди шарда в batch'ах
+	QueueSize int `json:"queueSize"`
+}
+
+// SubscriptionInfo - состояние активной подписки.
+type SubscriptionInfo struct {
+	// ID - номер подписки в bus (в порядке создания)
+	ID uint64 `json:"id"`
+
+	// Name - имя из SubscriptionOptions
+	Name string `json:"name"`
+
+	Filter Filter             `json:"filter"`
+	Policy BackpressurePolicy `json:"policy"`
+
+	// BufferSize - ёмкость очереди, QueueDepth - событий в очереди сейчас
+	BufferSize int `json:"bufferSize"`
+	QueueDepth int `json:"queueDepth"`
+
+	// Delivered - события, поставленные в очередь подписки
+	Delivered uint64 `json:"delivered"`
+
+	// Dropped - события, отброшенные политикой backpressure (см. Subscription.Dropped)
+	Dropped uint64 `json:"dropped"`
+
+	// Sampled - события, отброшенные прореживанием, и его параметры
+	Sampled  uint64    `json:"sampled"`
+	Sampling *Sampling `json:"sampling,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // EventBus - интерфейс для маршрутизации событий.
 type EventBus interface {
 	// Publish публикует одно событие, выполняя fan-out всем подходящим подписчикам.
-	// Fan-out выполняется синхронно, без создания goroutine.
+	// Fan-out выполняется синхронно, без создания goroutine; при Config.Shards > 0
+	// событие ставится в очередь шарда своего run'а.
+	// Ошибка записи в журнал (Config.Log) возвращается после fan-out.
 	Publish(ctx context.Context, e *event.Event) error
 
 	// PublishBatch публикует несколько событий за один вызов.
-	// Возвращает количество успешно опубликованных событий.
+	// Возвращает количество успешно опубликованных событий; если
+	// опубликованы не все, первые n событий опубликованы гарантированно.
 	PublishBatch(ctx context.Context, events []*event.Event) (int, error)
 
 	// Subscribe создаёт подписку с фильтром и параметрами.
 	// Каждая подписка имеет свою очередь и goroutine для чтения.
+	// Некорректный фильтр даёт ошибку, совместимую с ErrInvalidFilter,
+	// некорректные параметры - с ErrInvalidOptions.
 	Subscribe(ctx context.Context, filter Filter, opt SubscriptionOptions) (Subscription, error)
 
 	// Stats возвращает статистику EventBus.
 	Stats() BusStats
 
+	// Subscriptions возвращает состояние активных подписок в порядке создания.
+	Subscriptions() []SubscriptionInfo
+
 	// Close закрывает EventBus и все подписки.
 	Close() error
 }
@@ -93,6 +201,7 @@ type Subscription interface {
 	// Dropped возвращает количество отброшенных событий.
 	Dropped() uint64
 
-	// Close закрывает подписку.
+	// Close закрывает подписку и удаляет её из EventBus.
+	// Подписка закрывается и при отмене контекста, переданного в Subscribe.
 	Close() error
 }
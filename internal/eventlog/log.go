@@ -0,0 +1,756 @@
+// Package eventlog - журнал событий EventBus: append-only сегменты на диске.
+//
+// Каждое событие получает offset - сквозной номер в журнале. Читатели
+// (Reader) проходят журнал с любого offset'а и ждут новые записи, что
+// позволяет повторно проигрывать события и продолжать чтение после
+// перезапуска процесса. Позиции именованных потребителей сохраняются
+// в журнале (Commit), так потребитель получает доставку at-least-once.
+//
+// Формат сегмента: записи подряд, каждая - длина (uint32 big endian),
+// CRC32 (IEEE) данных и событие в MessagePack. Имя сегмента - offset
+// его первой записи. Недописанный хвост последнего сегмента (падение
+// процесса во время записи) отрезается при открытии журнала.
+package eventlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+const (
+	// DefaultMaxSegmentBytes - размер сегмента, после которого открывается новый
+	DefaultMaxSegmentBytes = 64 << 20
+
+	// DefaultMaxSegments - количество хранимых сегментов; самые старые удаляются
+	DefaultMaxSegments = 16
+
+	segmentSuffix = ".log"
+
+	// offsetsFile - файл позиций потребителей
+	offsetsFile = "offsets.json"
+
+	// recordHeaderSize - длина и CRC32 записи
+	recordHeaderSize = 8
+
+	// maxRecordSize - максимальный размер события в записи
+	maxRecordSize = 16 << 20
+)
+
+var (
+	// ErrClosed - журнал закрыт.
+	ErrClosed = errors.New("eventlog: log is closed")
+
+	// ErrOffsetOutOfRange - offset больше offset'а следующей записи журнала.
+	ErrOffsetOutOfRange = errors.New("eventlog: offset out of range")
+
+	// ErrRunNotFound - в журнале нет событий run'а.
+	ErrRunNotFound = errors.New("eventlog: run not found")
+
+	// ErrCorrupted - запись сегмента повреждена.
+	ErrCorrupted = errors.New("eventlog: corrupted record")
+
+	// ErrSkipped - читатель пропустил записи, удалённые по MaxSegments
+	// до того, как он их прочитал.
+	ErrSkipped = errors.New("eventlog: records removed before being read")
+
+	// ErrRecordTooLarge - событие в MessagePack больше maxRecordSize
+	// и не записывается: при чтении такая запись считалась бы повреждённой.
+	ErrRecordTooLarge = errors.New("eventlog: record too large")
+)
+
+// Config определяет параметры журнала.
+type Config struct {
+	// Dir - каталог сегментов (создаётся при необходимости)
+	Dir string
+
+	// MaxSegmentBytes - размер сегмента для ротации (0 = DefaultMaxSegmentBytes)
+	MaxSegmentBytes int64
+
+	// MaxSegments - количество хранимых сегментов (0 = DefaultMaxSegments)
+	MaxSegments int
+}
+
+// Record - событие журнала с его offset'ом.
+type Record struct {
+	Offset uint64
+	Event  *event.Event
+}
+
+// Stats содержит статистику журнала.
+type Stats struct {
+	// Start - offset самой старой хранимой записи, End - offset следующей записи
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+
+	// Segments - количество сегментов, Bytes - их суммарный размер
+	Segments int   `json:"segments"`
+	Bytes    int64 `json:"bytes"`
+
+	// Appended - записано событий с открытия журнала
+	Appended uint64 `json:"appended"`
+
+	// Failed - событий, которые не удалось записать
+	Failed uint64 `json:"failed"`
+
+	// Removed - сегментов, удалённых по MaxSegments
+	Removed uint64 `json:"removed"`
+
+	// Skipped - записей, пропущенных читателями: сегменты удалены
+	// по MaxSegments, пока читатель отставал
+	Skipped uint64 `json:"skipped"`
+
+	// Consumers - позиции потребителей (offset следующего непрочитанного события)
+	Consumers map[string]uint64 `json:"consumers"`
+}
+
+// segment - файл журнала с записями [base, base+count).
+type segment struct {
+	base  uint64
+	count uint64
+	size  int64
+	path  string
+}
+
+// runSpan - offset'ы первого и последнего события run'а.
+type runSpan struct {
+	first, last uint64
+}
+
+// Log - журнал событий. Безопасен для конкурентного использования.
+type Log struct {
+	config Config
+
+	mu       sync.Mutex
+	segments []*segment
+	file     *os.File
+	writer   *bufio.Writer
+	next     uint64
+
+	// truncate - после ошибки записи файл последнего сегмента может
+	// содержать недописанный хвост за seg.size; он отрезается перед
+	// следующей записью
+	truncate bool
+	runs     map[string]runSpan
+	offsets  map[string]uint64
+	stats    Stats
+	closed   bool
+
+	// appended закрывается и заменяется после каждой записи,
+	// пробуждая ожидающих читателей
+	appended chan struct{}
+}
+
+// Open открывает журнал в config.Dir, восстанавливая сегменты, индекс
+// run'ов и позиции потребителей.
+func Open(config Config) (*Log, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("eventlog: directory is required")
+	}
+	if config.MaxSegmentBytes <= 0 {
+		config.MaxSegmentBytes = DefaultMaxSegmentBytes
+	}
+	if config.MaxSegments <= 0 {
+		config.MaxSegments = DefaultMaxSegments
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("eventlog: failed to create directory: %w", err)
+	}
+
+	l := &Log{
+		config:   config,
+		runs:     make(map[string]runSpan),
+		offsets:  make(map[string]uint64),
+		appended: make(chan struct{}),
+	}
+	if err := l.loadSegments(); err != nil {
+		return nil, err
+	}
+	if err := l.loadOffsets(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadSegments находит сегменты и сканирует их записи. Повреждённый или
+// недописанный хвост последнего сегмента отрезается.
+func (l *Log) loadSegments() error {
+	entries, err := os.ReadDir(l.config.Dir)
+	if err != nil {
+		return fmt.Errorf("eventlog: failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, &segment{
+			base: base,
+			path: filepath.Join(l.config.Dir, name),
+		})
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].base < l.segments[j].base })
+
+	for i, seg := range l.segments {
+		valid, err := l.scanSegment(seg)
+		if err != nil {
+			return err
+		}
+		if valid < seg.size && i == len(l.segments)-1 {
+			if err := os.Truncate(seg.path, valid); err != nil {
+				return fmt.Errorf("eventlog: failed to repair segment: %w", err)
+			}
+			seg.size = valid
+		}
+		l.next = seg.base + seg.count
+	}
+	return nil
+}
+
+// scanSegment считает записи сегмента и индексирует run'ы.
+// Возвращает размер корректной части сегмента.
+func (l *Log) scanSegment(seg *segment) (int64, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return 0, fmt.Errorf("eventlog: failed to open segment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("eventlog: failed to open segment: %w", err)
+	}
+	seg.size = info.Size()
+
+	r := bufio.NewReader(f)
+	var valid int64
+	for {
+		e, n, err := readRecord(r)
+		if err != nil {
+			// io.EOF - конец сегмента, иначе повреждённый или недописанный хвост
+			return valid, nil
+		}
+		l.indexRun(e.RunID, seg.base+seg.count)
+		seg.count++
+		valid += n
+	}
+}
+
+// indexRun учитывает событие run'а с данным offset'ом.
+func (l *Log) indexRun(runID string, offset uint64) {
+	span, ok := l.runs[runID]
+	if !ok {
+		span.first = offset
+	}
+	span.last = offset
+	l.runs[runID] = span
+}
+
+// loadOffsets читает позиции потребителей.
+func (l *Log) loadOffsets() error {
+	data, err := os.ReadFile(filepath.Join(l.config.Dir, offsetsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("eventlog: failed to read offsets: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.offsets); err != nil {
+		return fmt.Errorf("eventlog: failed to parse offsets: %w", err)
+	}
+	return nil
+}
+
+// Append записывает события и возвращает offset первого из них.
+// Записанные события переживают падение процесса (данные переданы ОС),
+// но не отказ питания: fsync не выполняется.
+// События больше maxRecordSize не записываются: остальные события
+// записываются, а Append возвращает ErrRecordTooLarge. При ошибке записи
+// недописанные записи отрезаются от сегмента, и следующий Append
+// продолжает запись с последней переданной ОС записи.
+func (l *Log) Append(events ...*event.Event) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	first := l.next
+	if l.closed {
+		l.stats.Failed += uint64(len(events))
+		return first, ErrClosed
+	}
+	if len(events) == 0 {
+		return first, nil
+	}
+
+	// Записи в буфере writer'а попадают в индекс только после flush
+	var (
+		seg          *segment
+		pending      []*event.Event
+		pendingBytes int64
+		tooLarge     int
+	)
+	fail := func(i int, err error) (uint64, error) {
+		l.stats.Failed += uint64(len(pending) + len(events) - i)
+		l.wake()
+		return first, err
+	}
+
+	for i, e := range events {
+		data := event.MarshalMsgPack(e)
+		if len(data) > maxRecordSize {
+			tooLarge++
+			l.stats.Failed++
+			continue
+		}
+		record := make([]byte, recordHeaderSize, recordHeaderSize+len(data))
+		binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+		binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+		record = append(record, data...)
+
+		// Перед ротацией записи текущего сегмента передаются ОС
+		if len(pending) > 0 && seg.size+pendingBytes+int64(len(record)) > l.config.MaxSegmentBytes {
+			if err := l.commit(seg, pending, pendingBytes); err != nil {
+				return fail(i, err)
+			}
+			pending, pendingBytes = pending[:0], 0
+		}
+
+		var err error
+		if seg, err = l.ensureSegment(int64(len(record))); err != nil {
+			return fail(i, err)
+		}
+		if _, err := l.writer.Write(record); err != nil {
+			l.discardPending(seg)
+			return fail(i, fmt.Errorf("eventlog: write failed: %w", err))
+		}
+		pending = append(pending, e)
+		pendingBytes += int64(len(record))
+	}
+
+	if len(pending) > 0 {
+		if err := l.commit(seg, pending, pendingBytes); err != nil {
+			return fail(len(events), err)
+		}
+	}
+	l.wake()
+	if tooLarge > 0 {
+		return first, fmt.Errorf("%w: %d events over %d bytes", ErrRecordTooLarge, tooLarge, maxRecordSize)
+	}
+	return first, nil
+}
+
+// commit передаёт ОС записи pending (n байт) сегмента seg и добавляет
+// их в индекс. При ошибке записи они отрезаются от сегмента.
+func (l *Log) commit(seg *segment, pending []*event.Event, n int64) error {
+	if err := l.writer.Flush(); err != nil {
+		l.discardPending(seg)
+		return fmt.Errorf("eventlog: write failed: %w", err)
+	}
+	seg.size += n
+	for _, e := range pending {
+		l.indexRun(e.RunID, l.next)
+		seg.count++
+		l.next++
+		l.stats.Appended++
+	}
+	return nil
+}
+
+// discardPending закрывает сегмент после ошибки записи: bufio.Writer
+// запоминает первую ошибку и возвращал бы её при каждой следующей записи.
+// Часть записей могла дойти до файла, поэтому он обрезается до seg.size -
+// конца последней переданной ОС записи; если обрезать не удалось,
+// это повторяется перед следующей записью (см. ensureSegment).
+func (l *Log) discardPending(seg *segment) {
+	l.file.Close()
+	l.file, l.writer = nil, nil
+	l.truncate = os.Truncate(seg.path, seg.size) != nil
+}
+
+// wake пробуждает читателей, ожидающих новые записи. Вызывается под mu
+// после commit: читатели видят только переданные ОС записи.
+func (l *Log) wake() {
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// ensureSegment возвращает сегмент для записи n байт, открывая новый,
+// если сегмента нет или запись превысит MaxSegmentBytes.
+func (l *Log) ensureSegment(n int64) (*segment, error) {
+	var seg *segment
+	if len(l.segments) > 0 {
+		seg = l.segments[len(l.segments)-1]
+	}
+	if seg != nil && l.truncate {
+		// Недописанный хвост не должен остаться перед новыми записями
+		if err := os.Truncate(seg.path, seg.size); err != nil {
+			return nil, fmt.Errorf("eventlog: failed to repair segment: %w", err)
+		}
+		l.truncate = false
+	}
+	if seg != nil && l.file != nil && (seg.size == 0 || seg.size+n <= l.config.MaxSegmentBytes) {
+		return seg, nil
+	}
+
+	if seg != nil && l.file == nil && (seg.size == 0 || seg.size+n <= l.config.MaxSegmentBytes) {
+		// Продолжаем последний сегмент, найденный при открытии или
+		// закрытый после ошибки записи
+		f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("eventlog: failed to open segment: %w", err)
+		}
+		l.file = f
+		l.writer = bufio.NewWriter(f)
+		return seg, nil
+	}
+
+	if l.file != nil {
+		if err := l.writer.Flush(); err != nil {
+			return nil, fmt.Errorf("eventlog: write failed: %w", err)
+		}
+		l.file.Close()
+		l.file = nil
+	}
+
+	path := filepath.Join(l.config.Dir, fmt.Sprintf("%020d%s", l.next, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("eventlog: failed to create segment: %w", err)
+	}
+	l.file = f
+	l.writer = bufio.NewWriter(f)
+	seg = &segment{base: l.next, path: path}
+	l.segments = append(l.segments, seg)
+	l.removeOldSegments()
+	return seg, nil
+}
+
+// removeOldSegments удаляет самые старые сегменты сверх MaxSegments
+// и run'ы, события которых больше не хранятся.
+func (l *Log) removeOldSegments() {
+	for len(l.segments) > l.config.MaxSegments {
+		if err := os.Remove(l.segments[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		l.segments = l.segments[1:]
+		l.stats.Removed++
+	}
+
+	start := l.start()
+	for runID, span := range l.runs {
+		if span.last < start {
+			delete(l.runs, runID)
+		}
+	}
+}
+
+// start возвращает offset самой старой хранимой записи. Вызывается под mu.
+func (l *Log) start() uint64 {
+	if len(l.segments) == 0 {
+		return l.next
+	}
+	return l.segments[0].base
+}
+
+// Start возвращает offset самой старой хранимой записи.
+func (l *Log) Start() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.start()
+}
+
+// End возвращает offset следующей записи.
+func (l *Log) End() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next
+}
+
+// RunStart возвращает offset первого хранимого события run'а.
+func (l *Log) RunStart(runID string) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	span, ok := l.runs[runID]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrRunNotFound, runID)
+	}
+	return max(span.first, l.start()), nil
+}
+
+// Commit сохраняет позицию потребителя name: offset - последнее
+// обработанное событие, чтение продолжится с offset+1. Файл позиций
+// перезаписывается целиком через rename, как и Append, без fsync: после
+// отказа питания позиция может откатиться или оказаться за концом журнала.
+func (l *Log) Commit(name string, offset uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	l.offsets[name] = offset + 1
+
+	data, err := json.Marshal(l.offsets)
+	if err != nil {
+		return fmt.Errorf("eventlog: failed to write offsets: %w", err)
+	}
+	// Запись во временный файл и rename: файл позиций не бывает недописанным
+	path := filepath.Join(l.config.Dir, offsetsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("eventlog: failed to write offsets: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("eventlog: failed to write offsets: %w", err)
+	}
+	return nil
+}
+
+// Lag возвращает количество хранимых записей, которые потребитель name
+// ещё не обработал. Потребитель без сохранённой позиции читает журнал
+// с начала.
+func (l *Log) Lag(name string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	offset, ok := l.offsets[name]
+	if !ok || offset < l.start() {
+		offset = l.start()
+	}
+	if offset > l.next {
+		return 0
+	}
+	return l.next - offset
+}
+
+// Committed возвращает offset, с которого продолжает чтение потребитель name.
+func (l *Log) Committed(name string) (uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	offset, ok := l.offsets[name]
+	return offset, ok
+}
+
+// Stats возвращает статистику журнала.
+func (l *Log) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats
+	stats.Start = l.start()
+	stats.End = l.next
+	stats.Segments = len(l.segments)
+	for _, seg := range l.segments {
+		stats.Bytes += seg.size
+	}
+	stats.Consumers = make(map[string]uint64, len(l.offsets))
+	for name, offset := range l.offsets {
+		stats.Consumers[name] = offset
+	}
+	return stats
+}
+
+// Close сбрасывает буфер, закрывает текущий сегмент и завершает
+// ожидающих читателей с ErrClosed.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.appended)
+	if l.file == nil {
+		return nil
+	}
+	l.writer.Flush()
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// NewReader создаёт читателя с offset'а from. Если события с from уже
+// удалены по MaxSegments, чтение начинается с самой старой хранимой записи.
+func (l *Log) NewReader(from uint64) (*Reader, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if from > l.next {
+		return nil, fmt.Errorf("%w: %d > %d", ErrOffsetOutOfRange, from, l.next)
+	}
+	return &Reader{log: l, pos: from}, nil
+}
+
+// Reader последовательно читает журнал. Не безопасен для конкурентного
+// использования.
+type Reader struct {
+	log     *Log
+	pos     uint64
+	skipped uint64
+
+	// Открытый сегмент: читатель находится на записи pos
+	file   *os.File
+	reader *bufio.Reader
+	base   uint64
+}
+
+// Next возвращает следующую запись, ожидая её появления. Возвращает
+// ошибку контекста, ErrClosed после закрытия журнала или ErrCorrupted.
+// Записи, удалённые по MaxSegments до чтения, пропускаются и учитываются
+// в Skipped и Stats.Skipped.
+func (r *Reader) Next(ctx context.Context) (Record, error) {
+	for {
+		l := r.log
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+		if start := l.start(); r.pos < start {
+			// Записи удалены по MaxSegments, пока читатель отставал
+			r.skipped += start - r.pos
+			l.stats.Skipped += start - r.pos
+			r.pos = start
+			r.closeSegment()
+		}
+		if r.pos < l.next {
+			seg := l.segmentFor(r.pos)
+			if seg.base > r.pos {
+				// Пропуск на месте повреждённого хвоста старого сегмента
+				r.pos = seg.base
+			}
+			path, base := seg.path, seg.base
+			l.mu.Unlock()
+
+			return r.read(path, base)
+		}
+		wait := l.appended
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		}
+	}
+}
+
+// segmentFor возвращает сегмент записи offset или, если её нет,
+// первый сегмент после неё. Вызывается под mu при offset < next.
+func (l *Log) segmentFor(offset uint64) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		seg := l.segments[i]
+		return seg.base+seg.count > offset
+	})
+	return l.segments[i]
+}
+
+// read читает запись r.pos из сегмента path с первой записью base.
+func (r *Reader) read(path string, base uint64) (Record, error) {
+	if r.file == nil || r.base != base {
+		r.closeSegment()
+		f, err := os.Open(path)
+		if err != nil {
+			return Record{}, fmt.Errorf("eventlog: failed to open segment: %w", err)
+		}
+		r.file, r.reader, r.base = f, bufio.NewReader(f), base
+		for skipped := base; skipped < r.pos; skipped++ {
+			if err := skipRecord(r.reader); err != nil {
+				r.closeSegment()
+				return Record{}, err
+			}
+		}
+	}
+
+	e, _, err := readRecord(r.reader)
+	if err != nil {
+		r.closeSegment()
+		if !errors.Is(err, ErrCorrupted) {
+			err = fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		return Record{}, err
+	}
+	record := Record{Offset: r.pos, Event: e}
+	r.pos++
+	return record, nil
+}
+
+// Skipped возвращает количество записей, пропущенных читателем
+// из-за удаления сегментов по MaxSegments.
+func (r *Reader) Skipped() uint64 {
+	return r.skipped
+}
+
+// Close освобождает открытый сегмент.
+func (r *Reader) Close() error {
+	r.closeSegment()
+	return nil
+}
+
+func (r *Reader) closeSegment() {
+	if r.file != nil {
+		r.file.Close()
+		r.file, r.reader = nil, nil
+	}
+}
+
+// readRecord читает запись сегмента и возвращает событие и размер записи.
+func readRecord(r *bufio.Reader) (*event.Event, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size == 0 || size > maxRecordSize {
+		return nil, 0, fmt.Errorf("%w: record size %d", ErrCorrupted, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	e, err := event.ParseMsgPack(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return e, int64(recordHeaderSize) + int64(size), nil
+}
+
+// skipRecord пропускает запись сегмента без декодирования.
+func skipRecord(r *bufio.Reader) error {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if _, err := r.Discard(int(binary.BigEndian.Uint32(header[0:4]))); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return nil
+}
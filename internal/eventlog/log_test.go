@@ -0,0 +1,297 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// openTestLog открывает журнал в каталоге dir.
+func openTestLog(t *testing.T, config Config) *Log {
+	t.Helper()
+	l, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func testEvent(runID string, frame int) *event.Event {
+	return &event.Event{V: 1, RunID: runID, SourceID: "engine", Type: "body.state", FrameIndex: frame}
+}
+
+// readN читает n записей с offset'а from.
+func readN(t *testing.T, l *Log, from uint64, n int) []Record {
+	t.Helper()
+	r, err := l.NewReader(from)
+	if err != nil {
+		t.Fatalf("NewReader() вернула ошибку: %v", err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	records := make([]Record, 0, n)
+	for range n {
+		rec, err := r.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next() вернула ошибку: %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// TestLog_AppendRead проверяет запись и чтение с произвольного offset'а.
+func TestLog_AppendRead(t *testing.T) {
+	l := openTestLog(t, Config{Dir: t.TempDir()})
+
+	first, err := l.Append(testEvent("run-1", 0), testEvent("run-1", 1), testEvent("run-2", 0))
+	if err != nil || first != 0 {
+		t.Fatalf("Append() = %d, %v", first, err)
+	}
+	if first, _ := l.Append(testEvent("run-2", 1)); first != 3 {
+		t.Errorf("offset второй записи: %d, ожидался 3", first)
+	}
+
+	records := readN(t, l, 1, 3)
+	for i, rec := range records {
+		if rec.Offset != uint64(i+1) {
+			t.Errorf("запись %d: offset %d", i, rec.Offset)
+		}
+	}
+	if e := records[1].Event; e.RunID != "run-2" || e.FrameIndex != 0 || e.Type != "body.state" {
+		t.Errorf("событие: %+v", e)
+	}
+
+	if start, err := l.RunStart("run-2"); err != nil || start != 2 {
+		t.Errorf("RunStart(run-2) = %d, %v", start, err)
+	}
+	if _, err := l.RunStart("run-3"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("RunStart(run-3): %v", err)
+	}
+	if _, err := l.NewReader(5); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("NewReader(5): %v", err)
+	}
+}
+
+// TestLog_Follow проверяет ожидание новых записей и завершение при Close.
+func TestLog_Follow(t *testing.T) {
+	l := openTestLog(t, Config{Dir: t.TempDir()})
+
+	r, err := l.NewReader(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.Append(testEvent("run-1", 0))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rec, err := r.Next(ctx)
+	if err != nil || rec.Offset != 0 {
+		t.Fatalf("Next() = %+v, %v", rec, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.Close()
+	}()
+	if _, err := r.Next(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Next() после Close: %v, ожидалась ErrClosed", err)
+	}
+}
+
+// TestLog_Reopen проверяет восстановление журнала и позиций после перезапуска.
+func TestLog_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(testEvent("run-1", 0), testEvent("run-1", 1))
+	if err := l.Commit("batcher", 0); err != nil {
+		t.Fatalf("Commit() вернула ошибку: %v", err)
+	}
+	l.Close()
+
+	l = openTestLog(t, Config{Dir: dir})
+	if end := l.End(); end != 2 {
+		t.Errorf("End() = %d, ожидалось 2", end)
+	}
+	if offset, ok := l.Committed("batcher"); !ok || offset != 1 {
+		t.Errorf("Committed() = %d, %v", offset, ok)
+	}
+	if first, _ := l.Append(testEvent("run-2", 0)); first != 2 {
+		t.Errorf("offset после перезапуска: %d, ожидался 2", first)
+	}
+	if start, _ := l.RunStart("run-1"); start != 0 {
+		t.Errorf("RunStart(run-1) = %d", start)
+	}
+
+	records := readN(t, l, 1, 2)
+	if records[0].Event.RunID != "run-1" || records[1].Event.RunID != "run-2" {
+		t.Errorf("записи: %+v", records)
+	}
+}
+
+// TestLog_TruncatedTail проверяет отрезание недописанной записи при открытии.
+func TestLog_TruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(testEvent("run-1", 0), testEvent("run-1", 1))
+	l.Close()
+
+	// Заголовок записи без данных - падение во время записи
+	path := filepath.Join(dir, "00000000000000000000.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2, 3, 4, 5})
+	f.Close()
+
+	l = openTestLog(t, Config{Dir: dir})
+	if end := l.End(); end != 2 {
+		t.Fatalf("End() = %d, ожидалось 2", end)
+	}
+	l.Append(testEvent("run-1", 2))
+
+	records := readN(t, l, 0, 3)
+	if records[2].Event.FrameIndex != 2 {
+		t.Errorf("запись после восстановления: %+v", records[2].Event)
+	}
+}
+
+// TestLog_Retention проверяет удаление старых сегментов по MaxSegments.
+func TestLog_Retention(t *testing.T) {
+	// Каждое событие - в отдельном сегменте
+	l := openTestLog(t, Config{Dir: t.TempDir(), MaxSegmentBytes: 1, MaxSegments: 2})
+
+	l.Append(testEvent("run-1", 0), testEvent("run-1", 1), testEvent("run-2", 0))
+	l.Append(testEvent("run-2", 1), testEvent("run-2", 2))
+
+	stats := l.Stats()
+	if stats.Start != 3 || stats.End != 5 || stats.Segments != 2 || stats.Removed != 3 {
+		t.Errorf("статистика: %+v", stats)
+	}
+	if _, err := l.RunStart("run-1"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("RunStart(run-1): %v, ожидалась ErrRunNotFound", err)
+	}
+	if start, err := l.RunStart("run-2"); err != nil || start != 3 {
+		t.Errorf("RunStart(run-2) = %d, %v", start, err)
+	}
+
+	// Чтение с удалённого offset'а начинается с самой старой записи,
+	// пропущенные записи учитываются
+	records := readN(t, l, 0, 2)
+	if records[0].Offset != 3 || records[1].Offset != 4 {
+		t.Errorf("offsets: %d, %d", records[0].Offset, records[1].Offset)
+	}
+	if skipped := l.Stats().Skipped; skipped != 3 {
+		t.Errorf("Skipped = %d, ожидалось 3", skipped)
+	}
+
+	// Отставание считается от позиции потребителя или начала журнала
+	l.Commit("storage", 1)
+	if lag := l.Lag("storage"); lag != 2 {
+		t.Errorf("Lag(storage) = %d после удалённой позиции, ожидалось 2", lag)
+	}
+	l.Commit("storage", 3)
+	if lag := l.Lag("storage"); lag != 1 {
+		t.Errorf("Lag(storage) = %d, ожидалось 1", lag)
+	}
+	if lag := l.Lag("unknown"); lag != 2 {
+		t.Errorf("Lag(unknown) = %d, ожидалось 2", lag)
+	}
+}
+
+// TestLog_RecordTooLarge проверяет, что событие больше maxRecordSize
+// не записывается и не ломает журнал после перезапуска.
+func TestLog_RecordTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	big := testEvent("run-1", 1)
+	big.Payload = json.RawMessage(`"` + strings.Repeat("x", maxRecordSize) + `"`)
+	if _, err := l.Append(testEvent("run-1", 0), big, testEvent("run-1", 2)); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("Append() = %v, ожидалась ErrRecordTooLarge", err)
+	}
+	if stats := l.Stats(); stats.End != 2 || stats.Appended != 2 || stats.Failed != 1 {
+		t.Errorf("статистика: %+v", stats)
+	}
+	l.Close()
+
+	l = openTestLog(t, Config{Dir: dir})
+	if end := l.End(); end != 2 {
+		t.Fatalf("End() после перезапуска = %d, ожидалось 2", end)
+	}
+	records := readN(t, l, 0, 2)
+	if records[0].Event.FrameIndex != 0 || records[1].Event.FrameIndex != 2 {
+		t.Errorf("записи: %+v, %+v", records[0].Event, records[1].Event)
+	}
+}
+
+// TestLog_WriteErrorRecovery проверяет, что после ошибки записи
+// недописанный хвост отрезается, а следующие Append работают.
+func TestLog_WriteErrorRecovery(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append(testEvent("run-1", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Часть записи дошла до файла, после чего запись перестала работать
+	path := filepath.Join(dir, "00000000000000000000.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2, 3})
+	f.Close()
+	l.file.Close()
+
+	if _, err := l.Append(testEvent("run-1", 1)); err == nil {
+		t.Fatal("Append() после отказа записи должна вернуть ошибку")
+	}
+	if first, err := l.Append(testEvent("run-1", 2)); err != nil || first != 1 {
+		t.Fatalf("Append() после восстановления = %d, %v", first, err)
+	}
+	if stats := l.Stats(); stats.End != 2 || stats.Failed != 1 {
+		t.Errorf("статистика: %+v", stats)
+	}
+	l.Close()
+
+	l = openTestLog(t, Config{Dir: dir})
+	if end := l.End(); end != 2 {
+		t.Fatalf("End() после перезапуска = %d, ожидалось 2", end)
+	}
+	records := readN(t, l, 0, 2)
+	if records[0].Event.FrameIndex != 0 || records[1].Event.FrameIndex != 2 {
+		t.Errorf("записи: %+v, %+v", records[0].Event, records[1].Event)
+	}
+}
@@ -0,0 +1,37 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/teltel/teltel/internal/auth"
+)
+
+// authLineTimeout - время ожидания строки аутентификации в потоковом соединении.
+const authLineTimeout = 10 * time.Second
+
+// authLine - первая строка потокового соединения или UDP датаграммы
+// при включённой аутентификации: {"token":"..."}.
+type authLine struct {
+	Token string `json:"token"`
+}
+
+// parseAuthLine извлекает токен из строки аутентификации.
+// Для некорректной строки возвращается пустой токен.
+func parseAuthLine(line []byte) string {
+	var a authLine
+	if err := json.Unmarshal(line, &a); err != nil {
+		return ""
+	}
+	return a.Token
+}
+
+// authStatus возвращает HTTP-подобный код ошибки аутентификации (401/403).
+func authStatus(err error) int {
+	if errors.Is(err, auth.ErrUnauthorized) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
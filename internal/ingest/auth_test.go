@@ -0,0 +1,186 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/auth"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// newTestAuthenticator создаёт Authenticator с ingest токеном для source-1
+// и read токеном.
+func newTestAuthenticator(t *testing.T) *auth.Authenticator {
+	t.Helper()
+	a, err := auth.New(auth.FileConfig{
+		Tokens: []auth.TokenConfig{
+			{Token: "ingest-token", Role: auth.RoleIngest, Sources: []string{"source-1"}},
+			{Token: "read-token", Role: auth.RoleRead},
+		},
+	})
+	if err != nil {
+		t.Fatalf("auth.New() вернула ошибку: %v", err)
+	}
+	return a
+}
+
+// TestHandler_Auth проверяет аутентификацию POST /api/ingest.
+func TestHandler_Auth(t *testing.T) {
+	const allowed = `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0}`
+	const foreign = `{"v":1,"runId":"run-1","sourceId":"source-2","frameIndex":0,"simTime":0}`
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		wantAcc    int
+	}{
+		{"без токена → 401", "", allowed, http.StatusUnauthorized, 0},
+		{"неизвестный токен → 401", "wrong", allowed, http.StatusUnauthorized, 0},
+		{"read токен → 403", "read-token", allowed, http.StatusForbidden, 0},
+		{"разрешённый sourceId → 202", "ingest-token", allowed, http.StatusAccepted, 1},
+		{"только чужой sourceId → 403", "ingest-token", foreign, http.StatusForbidden, 0},
+		{"частично чужой sourceId → 207", "ingest-token", allowed + "\n" + foreign, http.StatusMultiStatus, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.New()
+			defer bus.Close()
+
+			handler := NewHandlerWithConfig(bus, Config{Auth: newTestAuthenticator(t)})
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.HandleIngest(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("статус = %d, ожидался %d (body: %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized || tt.token == "read-token" {
+				return // отчёт не формируется
+			}
+
+			report := decodeReport(t, w)
+			if report.Accepted != tt.wantAcc {
+				t.Errorf("Accepted = %d, ожидалось %d", report.Accepted, tt.wantAcc)
+			}
+			for _, le := range report.Errors {
+				if le.Code != "ErrSourceForbidden" {
+					t.Errorf("код ошибки = %q, ожидался ErrSourceForbidden", le.Code)
+				}
+			}
+		})
+	}
+
+	t.Run("WebSocket ingest без токена → 401 до upgrade", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{Auth: newTestAuthenticator(t)})
+		req := httptest.NewRequest(http.MethodGet, "/ws/ingest", nil)
+		w := httptest.NewRecorder()
+		handler.HandleWebSocket(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("статус = %d, ожидался 401", w.Code)
+		}
+	})
+}
+
+// TestStreamListener_Auth проверяет строку аутентификации потокового соединения.
+func TestStreamListener_Auth(t *testing.T) {
+	t.Run("невалидный токен → строка ошибки и закрытие", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startStreamListener(t, bus, StreamConfig{
+			Network: "tcp",
+			Addr:    "127.0.0.1:0",
+			Auth:    newTestAuthenticator(t),
+		})
+
+		conn.Write([]byte(`{"token":"read-token"}` + "\n" + streamLines(1)))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("ожидалась строка ошибки: %v", err)
+		}
+
+		var msg StreamError
+		if err := json.Unmarshal(line, &msg); err != nil || msg.Type != "error" || msg.Code != http.StatusForbidden {
+			t.Errorf("получено %q, ожидалась ошибка 403", line)
+		}
+
+		stats := waitStreamStats(l, func(s StreamStats) bool { return s.AuthFailures == 1 })
+		if stats.AuthFailures != 1 || stats.Accepted != 0 {
+			t.Errorf("статистика: %+v", stats)
+		}
+	})
+
+	t.Run("валидный токен → события принимаются", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startStreamListener(t, bus, StreamConfig{
+			Network: "tcp",
+			Addr:    "127.0.0.1:0",
+			Auth:    newTestAuthenticator(t),
+		})
+
+		foreign := `{"v":1,"runId":"run-1","sourceId":"source-2","frameIndex":0,"simTime":0}` + "\n"
+		conn.Write([]byte(`{"token":"ingest-token"}` + "\n" + streamLines(3) + foreign))
+		closeWrite(t, conn)
+
+		stats := waitStreamStats(l, func(s StreamStats) bool { return s.ActiveConnections == 0 && s.Connections == 1 })
+		if stats.Accepted != 3 || stats.Rejected != 1 || stats.AuthFailures != 0 {
+			t.Errorf("статистика: %+v", stats)
+		}
+	})
+}
+
+// TestUDPListener_Auth проверяет токен в первой строке датаграммы.
+func TestUDPListener_Auth(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	l, conn := startUDPListener(t, bus, UDPConfig{Auth: newTestAuthenticator(t)})
+
+	conn.Write([]byte(streamLines(2)))
+	conn.Write([]byte(`{"token":"ingest-token"}` + "\n" + streamLines(2)))
+
+	stats := waitUDPStats(l, func(s UDPStats) bool { return s.Packets == 2 && s.Accepted == 2 })
+	if stats.UnauthorizedPackets != 1 || stats.Accepted != 2 {
+		t.Errorf("статистика: %+v", stats)
+	}
+
+	// События с чужим sourceId и сверх лимита не делают датаграмму битой
+	limited := NewUDPListener(NewPipeline(bus, PipelineConfig{
+		RateLimits: RateLimitsConfig{Policy: RateLimitReject, Source: RateLimit{Rate: 0.001, Burst: 1}},
+	}), UDPConfig{Addr: "127.0.0.1:0", Auth: newTestAuthenticator(t)})
+	if err := limited.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer limited.Stop(context.Background())
+	conn, err := net.Dial("udp", limited.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte(`{"token":"ingest-token"}` + "\n" + streamLines(2) +
+		`{"v":1,"runId":"run-1","sourceId":"source-2","frameIndex":0,"simTime":0}`))
+	stats = waitUDPStats(limited, func(s UDPStats) bool { return s.Packets == 1 && s.Rejected == 2 })
+	if stats.Accepted != 1 || stats.Rejected != 2 || stats.MalformedPackets != 0 || stats.RateLimitedPackets != 1 || stats.ForbiddenPackets != 1 {
+		t.Errorf("статистика: %+v", stats)
+	}
+}
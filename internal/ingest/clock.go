@@ -0,0 +1,227 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// clockBucket - интервал, за который берётся минимальная задержка
+	clockBucket = 10 * time.Second
+
+	// clockBuckets - количество интервалов в окне оценки (5 минут)
+	clockBuckets = 30
+
+	// clockMinDriftBuckets - количество завершённых интервалов (1 минута),
+	// начиная с которого оценивается дрейф: по нескольким минимумам
+	// наклон определяется в основном разбросом сетевой задержки
+	clockMinDriftBuckets = 6
+
+	// clockMaxDriftPPM - предел оценки дрейфа. Кварцевые часы расходятся
+	// на десятки ppm; больший наклон - шум минимумов, а не дрейф
+	clockMaxDriftPPM = 500
+
+	// clockSourceTTL - время хранения оценки неактивного источника
+	clockSourceTTL = time.Hour
+
+	// clockSweepInterval - период удаления оценок неактивных источников
+	clockSweepInterval = time.Minute
+
+	// clockOutlierMs - допустимое отклонение разницы от текущей модели.
+	// Разница больше модели на эту величину - событие записано давно
+	// (replay, повтор после ошибки, bridge) и не учитывается в оценке.
+	// Разница меньше модели на эту величину - часы источника переведены
+	// вперёд или модель построена по старым событиям: оценка строится заново.
+	clockOutlierMs = 30_000
+)
+
+// ClockSkew - оценка расхождения часов хоста источника с часами сервера.
+type ClockSkew struct {
+	// OffsetMs - смещение часов: время сервера минус время источника
+	// (положительное - часы источника отстают). Включает минимальную
+	// сетевую задержку.
+	OffsetMs float64 `json:"offsetMs"`
+
+	// DriftPPM - скорость изменения смещения в миллионных долях
+	// (положительная - часы источника идут медленнее серверных)
+	DriftPPM float64 `json:"driftPpm"`
+
+	// Samples - количество событий с wallTimeMs, учтённых в оценке
+	Samples uint64 `json:"samples"`
+
+	// Outliers - количество событий, wallTimeMs которых отстаёт от модели
+	// больше чем на clockOutlierMs (старые события); в оценке не учтены
+	Outliers uint64 `json:"outliers"`
+
+	// LastSeen - время последнего события источника с wallTimeMs
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// clockSample - минимальная разница (время сервера - wallTimeMs) за интервал.
+// Минимум отбрасывает задержки сети и очередей, которые только увеличивают
+// разницу, и оставляет ближайшую к истинному смещению оценку.
+type clockSample struct {
+	start    time.Time
+	minDelta int64
+}
+
+// clockState - оценка смещения часов одного источника.
+type clockState struct {
+	samples  []clockSample
+	observed uint64
+	outliers uint64
+	lastSeen time.Time
+
+	// lastSample - время последнего учтённого события
+	lastSample time.Time
+
+	// Линейная модель смещения: offset(t) = base + slope * (t - origin)
+	origin time.Time
+	base   float64
+	slope  float64 // мс смещения на секунду
+}
+
+// observe учитывает событие и пересчитывает модель при изменении минимумов.
+// Старые события (разница больше модели на clockOutlierMs) отбрасываются,
+// пока модель не устарела: если учтённых событий не было дольше окна оценки,
+// часы источника, вероятно, переведены назад, и оценка строится заново.
+func (s *clockState) observe(now time.Time, delta int64) {
+	s.lastSeen = now
+	if len(s.samples) > 0 {
+		model := s.offset(now)
+		switch {
+		case float64(delta) > model+clockOutlierMs:
+			if now.Sub(s.lastSample) < clockBucket*clockBuckets {
+				s.outliers++
+				return
+			}
+			s.samples = s.samples[:0]
+		case float64(delta) < model-clockOutlierMs:
+			s.samples = s.samples[:0]
+		}
+	}
+	s.observed++
+	s.lastSample = now
+
+	start := now.Truncate(clockBucket)
+	if n := len(s.samples); n > 0 && s.samples[n-1].start.Equal(start) {
+		if delta >= s.samples[n-1].minDelta {
+			return
+		}
+		s.samples[n-1].minDelta = delta
+	} else {
+		s.samples = append(s.samples, clockSample{start: start, minDelta: delta})
+		if len(s.samples) > clockBuckets {
+			s.samples = s.samples[len(s.samples)-clockBuckets:]
+		}
+	}
+	s.fit()
+}
+
+// fit строит линейную регрессию минимумов по завершённым интервалам:
+// минимум текущего интервала ещё может уменьшиться и искажает наклон.
+// Пока завершённых интервалов меньше clockMinDriftBuckets, дрейф
+// не оценивается; наклон ограничен ±clockMaxDriftPPM.
+func (s *clockState) fit() {
+	s.origin = s.samples[0].start
+	complete := s.samples[:len(s.samples)-1]
+	if len(complete) < clockMinDriftBuckets {
+		minDelta := s.samples[0].minDelta
+		for _, sample := range s.samples[1:] {
+			minDelta = min(minDelta, sample.minDelta)
+		}
+		s.base = float64(minDelta)
+		s.slope = 0
+		return
+	}
+
+	var sumX, sumY, sumXX, sumXY float64
+	n := float64(len(complete))
+	for _, sample := range complete {
+		x := sample.start.Sub(s.origin).Seconds()
+		y := float64(sample.minDelta)
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	const maxSlope = clockMaxDriftPPM / 1000.0 // мс/с
+	s.slope = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	s.slope = max(-maxSlope, min(s.slope, maxSlope))
+	s.base = (sumY - s.slope*sumX) / n
+}
+
+// offset возвращает оценку смещения в момент now.
+func (s *clockState) offset(now time.Time) float64 {
+	return s.base + s.slope*now.Sub(s.origin).Seconds()
+}
+
+func (s *clockState) skew(now time.Time) ClockSkew {
+	return ClockSkew{
+		OffsetMs: math.Round(s.offset(now)*10) / 10,
+		DriftPPM: math.Round(s.slope*1000*10) / 10, // 1 мс/с = 1000 ppm
+		Samples:  s.observed,
+		Outliers: s.outliers,
+		LastSeen: s.lastSeen,
+	}
+}
+
+// clockEstimator оценивает смещение часов источников по wallTimeMs
+// и приводит wallTimeMs событий к часам сервера.
+type clockEstimator struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	sources   map[string]*clockState
+	lastSweep time.Time
+}
+
+func newClockEstimator() *clockEstimator {
+	return &clockEstimator{
+		now:       time.Now,
+		sources:   make(map[string]*clockState),
+		lastSweep: time.Now(),
+	}
+}
+
+// correct учитывает wallTimeMs события источника и возвращает его,
+// приведённым к часам сервера.
+func (c *clockEstimator) correct(sourceID string, wallTimeMs int64) int64 {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= clockSweepInterval {
+		c.lastSweep = now
+		for id, s := range c.sources {
+			if now.Sub(s.lastSeen) > clockSourceTTL {
+				delete(c.sources, id)
+			}
+		}
+	}
+
+	s, ok := c.sources[sourceID]
+	if !ok {
+		s = &clockState{}
+		c.sources[sourceID] = s
+	}
+	s.observe(now, now.UnixMilli()-wallTimeMs)
+
+	return wallTimeMs + int64(math.Round(s.offset(now)))
+}
+
+// skews возвращает оценки по sourceId.
+func (c *clockEstimator) skews() map[string]ClockSkew {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	skews := make(map[string]ClockSkew, len(c.sources))
+	for id, s := range c.sources {
+		skews[id] = s.skew(now)
+	}
+	return skews
+}
@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// newTestClock возвращает управляемые часы для clockEstimator.
+func newTestClock(c *clockEstimator) *time.Time {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return clock }
+	c.lastSweep = clock
+	return &clock
+}
+
+// TestClockEstimator проверяет оценку смещения и дрейфа часов источника.
+func TestClockEstimator(t *testing.T) {
+	t.Run("часы отстают на 2с, задержка 5..45мс → смещение ≈ 2005мс", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+
+		var corrected int64
+		for i := 0; i < 600; i++ {
+			*clock = clock.Add(100 * time.Millisecond)
+			latency := int64(5 + (i*7)%41)
+			wall := clock.UnixMilli() - 2000 - latency
+			corrected = c.correct("engine", wall)
+		}
+
+		skew := c.skews()["engine"]
+		if math.Abs(skew.OffsetMs-2005) > 1 {
+			t.Errorf("OffsetMs = %.1f, ожидалось ≈ 2005", skew.OffsetMs)
+		}
+		if math.Abs(skew.DriftPPM) > 1 {
+			t.Errorf("DriftPPM = %.1f, ожидалось ≈ 0", skew.DriftPPM)
+		}
+		if skew.Samples != 600 {
+			t.Errorf("Samples = %d, ожидалось 600", skew.Samples)
+		}
+		// Скорректированное время не опережает сервер больше, чем на минимальную задержку
+		if diff := clock.UnixMilli() - corrected; diff < -5 || diff > 45 {
+			t.Errorf("скорректированное время отличается от серверного на %dмс", diff)
+		}
+	})
+
+	t.Run("часы источника отстают на 100ppm → положительный дрейф", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+		start := *clock
+
+		for i := 0; i < 300; i++ {
+			*clock = clock.Add(time.Second)
+			elapsed := clock.Sub(start).Milliseconds()
+			wall := start.UnixMilli() + elapsed - elapsed/10000 - 10
+			c.correct("engine", wall)
+		}
+
+		skew := c.skews()["engine"]
+		if math.Abs(skew.DriftPPM-100) > 5 {
+			t.Errorf("DriftPPM = %.1f, ожидалось ≈ 100", skew.DriftPPM)
+		}
+		if math.Abs(skew.OffsetMs-40) > 2 {
+			t.Errorf("OffsetMs = %.1f, ожидалось ≈ 40", skew.OffsetMs)
+		}
+	})
+
+	t.Run("дрейф не оценивается по нескольким интервалам и ограничен", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+		start := *clock
+
+		// Часы источника отстают на 2000ppm: больше предела оценки
+		observe := func(seconds int) {
+			for i := 0; i < seconds; i++ {
+				*clock = clock.Add(time.Second)
+				elapsed := clock.Sub(start).Milliseconds()
+				c.correct("engine", start.UnixMilli()+elapsed-elapsed/500)
+			}
+		}
+
+		// Последний интервал ещё не завершён
+		observe(int(clockBucket/time.Second)*clockMinDriftBuckets - 1)
+		if skew := c.skews()["engine"]; skew.DriftPPM != 0 {
+			t.Errorf("DriftPPM = %.1f до %d завершённых интервалов, ожидалось 0", skew.DriftPPM, clockMinDriftBuckets)
+		}
+
+		observe(240)
+		if skew := c.skews()["engine"]; skew.DriftPPM != clockMaxDriftPPM {
+			t.Errorf("DriftPPM = %.1f, ожидалось %d", skew.DriftPPM, clockMaxDriftPPM)
+		}
+	})
+
+	t.Run("replay старых событий не смещает оценку", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+
+		for i := 0; i < 300; i++ {
+			*clock = clock.Add(100 * time.Millisecond)
+			c.correct("engine", clock.UnixMilli()-2000-10)
+		}
+		before := c.skews()["engine"]
+
+		// События, записанные час назад, заполняют целый интервал
+		*clock = clock.Truncate(clockBucket).Add(clockBucket)
+		for i := 0; i < 1000; i++ {
+			*clock = clock.Add(clockBucket / 1000)
+			c.correct("engine", clock.Add(-time.Hour).UnixMilli()+int64(i))
+		}
+		for i := 0; i < 300; i++ {
+			*clock = clock.Add(100 * time.Millisecond)
+			c.correct("engine", clock.UnixMilli()-2000-10)
+		}
+
+		skew := c.skews()["engine"]
+		if math.Abs(skew.OffsetMs-before.OffsetMs) > 1 || math.Abs(skew.DriftPPM) > 1 {
+			t.Errorf("оценка после replay: %+v, до: %+v", skew, before)
+		}
+		if skew.Outliers != 1000 || skew.Samples != 600 {
+			t.Errorf("Outliers = %d, Samples = %d, ожидалось 1000 и 600", skew.Outliers, skew.Samples)
+		}
+	})
+
+	t.Run("часы источника переведены → оценка строится заново", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+
+		for i := 0; i < 100; i++ {
+			*clock = clock.Add(time.Second)
+			c.correct("engine", clock.UnixMilli()-2000)
+		}
+
+		// Вперёд: новая оценка с первого события
+		*clock = clock.Add(time.Second)
+		c.correct("engine", clock.UnixMilli()+60_000)
+		if skew := c.skews()["engine"]; math.Abs(skew.OffsetMs+60_000) > 1 {
+			t.Errorf("после перевода вперёд OffsetMs = %.1f, ожидалось ≈ -60000", skew.OffsetMs)
+		}
+
+		// Назад: события считаются старыми, пока не истечёт окно оценки
+		for i := 0; i < clockBuckets*10+1; i++ {
+			*clock = clock.Add(time.Second)
+			c.correct("engine", clock.UnixMilli()-120_000)
+		}
+		if skew := c.skews()["engine"]; math.Abs(skew.OffsetMs-120_000) > 1 {
+			t.Errorf("после перевода назад OffsetMs = %.1f, ожидалось ≈ 120000", skew.OffsetMs)
+		}
+	})
+
+	t.Run("неактивный источник удаляется после clockSourceTTL", func(t *testing.T) {
+		c := newClockEstimator()
+		clock := newTestClock(c)
+
+		c.correct("old", clock.UnixMilli())
+		*clock = clock.Add(clockSourceTTL + clockSweepInterval)
+		c.correct("new", clock.UnixMilli())
+
+		skews := c.skews()
+		if _, ok := skews["old"]; ok || len(skews) != 1 {
+			t.Errorf("оценки: %v, ожидалась только new", skews)
+		}
+	})
+}
+
+// TestHandler_ClockCorrection проверяет запись скорректированного wallTime.
+func TestHandler_ClockCorrection(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	sub, _ := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 100})
+	defer sub.Close()
+
+	handler := NewHandler(bus)
+	behind := time.Now().Add(-time.Hour).UnixMilli()
+	body := strings.Join([]string{
+		`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0,"wallTimeMs":` + strconv.FormatInt(behind, 10) + `,"wallTimeCorrectedMs":1}`,
+		`{"v":1,"runId":"run-1","sourceId":"source-2","frameIndex":0,"simTime":0}`,
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleIngest(w, req)
+
+	if report := decodeReport(t, w); report.Accepted != 2 {
+		t.Fatalf("отчёт: %+v", report)
+	}
+
+	events := readAllAvailableEvents(sub, 100*time.Millisecond)
+	if len(events) != 2 {
+		t.Fatalf("опубликовано %d событий, ожидалось 2", len(events))
+	}
+	now := time.Now().UnixMilli()
+	for _, e := range events {
+		if e.WallTimeMs == nil || e.WallTimeCorrectedMs == nil {
+			t.Fatalf("%s: wallTime не установлено: %+v", e.SourceID, e)
+		}
+		if diff := now - *e.WallTimeCorrectedMs; diff < 0 || diff > 1000 {
+			t.Errorf("%s: wallTimeCorrectedMs отличается от времени сервера на %dмс", e.SourceID, diff)
+		}
+	}
+	if *events[0].WallTimeMs != behind {
+		t.Errorf("исходное wallTimeMs изменено: %d", *events[0].WallTimeMs)
+	}
+
+	skews := handler.Stats().Clocks
+	if skew := skews["source-1"]; skew.OffsetMs < float64(time.Hour.Milliseconds()) || skew.Samples != 1 {
+		t.Errorf("оценка source-1: %+v", skew)
+	}
+	if _, ok := skews["source-2"]; ok {
+		t.Error("источник без wallTimeMs не должен учитываться в оценке")
+	}
+}
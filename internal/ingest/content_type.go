@@ -0,0 +1,26 @@
+package ingest
+
+import (
+	"mime"
+	"strings"
+)
+
+// Content-Type для бинарного формата MessagePack.
+// Все остальные Content-Type (включая отсутствующий) обрабатываются как NDJSON.
+var msgPackContentTypes = map[string]bool{
+	"application/msgpack":     true,
+	"application/x-msgpack":   true,
+	"application/vnd.msgpack": true,
+}
+
+// isMsgPackContentType сообщает, указывает ли Content-Type на MessagePack.
+func isMsgPackContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return msgPackContentTypes[mediaType]
+}
@@ -0,0 +1,130 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teltel/teltel/internal/deadletter"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// readDeadLetters читает записи единственного файла хранилища.
+func readDeadLetters(t *testing.T, store *deadletter.Store) []deadletter.Entry {
+	t.Helper()
+
+	files, _ := store.Files()
+	if len(files) != 1 {
+		t.Fatalf("файлов: %d, ожидался 1", len(files))
+	}
+	f, err := store.OpenFile(files[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []deadletter.Entry
+	deadletter.ReadEntries(f, func(e deadletter.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries
+}
+
+// TestHandler_DeadLetter проверяет сохранение отклонённых строк.
+func TestHandler_DeadLetter(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	store, err := deadletter.Open(deadletter.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	handler := NewHandlerWithConfig(bus, Config{
+		Pipeline: PipelineConfig{
+			DeadLetter: store,
+			RateLimits: RateLimitsConfig{
+				Policy: RateLimitReject,
+				Source: RateLimit{Rate: 0.001, Burst: 2},
+			},
+		},
+	})
+
+	body := strings.Join([]string{
+		`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0}`,
+		`not json`,
+		`{"v":9,"runId":"run-1","sourceId":"source-1","frameIndex":1,"simTime":0}`,
+		// Третье валидное событие превышает лимит и не сохраняется
+		`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":2,"simTime":0}`,
+		`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":3,"simTime":0}`,
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleIngest(w, req)
+
+	if report := decodeReport(t, w); report.Rejected != 3 {
+		t.Fatalf("отчёт: %+v", report)
+	}
+
+	entries := readDeadLetters(t, store)
+	if len(entries) != 2 {
+		t.Fatalf("записей: %d, ожидалось 2: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Origin != originHTTP || e.Reason != "ErrInvalidJSON" || e.Line != 2 || e.Raw != "not json" || e.Event != nil {
+		t.Errorf("запись ошибки парсинга: %+v", e)
+	}
+	if e := entries[1]; e.Reason != "ErrUnsupportedVersion" || e.Line != 3 || e.Event != nil || !strings.Contains(e.Raw, `"v":9`) {
+		t.Errorf("запись неподдерживаемой версии: %+v", e)
+	}
+}
+
+// TestStreamListener_DeadLetterLongLine проверяет, что слишком длинная
+// строка потока сохраняется в dead-letter с кодом ErrLineTooLong.
+func TestStreamListener_DeadLetterLongLine(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	store, err := deadletter.Open(deadletter.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	l := NewStreamListener(NewPipeline(bus, PipelineConfig{DeadLetter: store}), StreamConfig{
+		Network:     "tcp",
+		Addr:        "127.0.0.1:0",
+		MaxLineSize: 256,
+	})
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop(context.Background())
+
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	long := `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0,"payload":{"pad":"` + strings.Repeat("x", 1000) + `"}}` + "\n"
+	conn.Write([]byte(streamLines(1) + long + streamLines(1)))
+	closeWrite(t, conn)
+
+	stats := waitStreamStats(l, func(s StreamStats) bool { return s.ActiveConnections == 0 })
+	if stats.Rejected != 1 || stats.Accepted != 2 {
+		t.Fatalf("ожидалось rejected=1 accepted=2, получено %+v", stats)
+	}
+
+	entries := readDeadLetters(t, store)
+	if len(entries) != 1 {
+		t.Fatalf("записей: %d, ожидалась 1: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Origin != "ingest.tcp" || e.Reason != "ErrLineTooLong" || e.Line != 2 || len(e.Raw) > 256 || !strings.HasPrefix(e.Raw, `{"v":1`) {
+		t.Errorf("запись слишком длинной строки: %+v", e)
+	}
+}
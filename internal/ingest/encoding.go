@@ -0,0 +1,177 @@
+package ingest
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Поддерживаемые значения заголовка Content-Encoding.
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+// DefaultMaxDecompressedBytes - лимит распакованного тела запроса по умолчанию.
+const DefaultMaxDecompressedBytes int64 = 512 << 20
+
+// maxZstdWindow ограничивает окно zstd, которое клиент может запросить
+// в заголовке кадра, и тем самым память, выделяемую на декодер.
+const maxZstdWindow = 64 << 20
+
+var (
+	// errUnsupportedEncoding возвращается для неизвестного Content-Encoding.
+	errUnsupportedEncoding = errors.New("ingest: unsupported content encoding")
+
+	// errDecompressedTooLarge возвращается при превышении лимита распакованного тела.
+	errDecompressedTooLarge = errors.New("ingest: decompressed body exceeds limit")
+
+	// errReadBody оборачивает ошибку чтения тела запроса.
+	errReadBody = errors.New("ingest: error reading request body")
+)
+
+// EncodingStats содержит счётчики трафика для одного Content-Encoding.
+type EncodingStats struct {
+	// Requests - количество запросов с данным Content-Encoding
+	Requests uint64 `json:"requests"`
+
+	// WireBytes - количество прочитанных байт в сжатом виде
+	WireBytes uint64 `json:"wireBytes"`
+
+	// DecodedBytes - количество байт после распаковки
+	DecodedBytes uint64 `json:"decodedBytes"`
+
+	// Ratio - фактическая степень сжатия (DecodedBytes / WireBytes)
+	Ratio float64 `json:"ratio"`
+}
+
+// encodingCounters - атомарные счётчики для одного Content-Encoding.
+type encodingCounters struct {
+	requests     atomic.Uint64
+	wireBytes    atomic.Uint64
+	decodedBytes atomic.Uint64
+}
+
+// snapshot возвращает копию счётчиков.
+func (c *encodingCounters) snapshot() EncodingStats {
+	s := EncodingStats{
+		Requests:     c.requests.Load(),
+		WireBytes:    c.wireBytes.Load(),
+		DecodedBytes: c.decodedBytes.Load(),
+	}
+	if s.WireBytes > 0 {
+		s.Ratio = float64(s.DecodedBytes) / float64(s.WireBytes)
+	}
+	return s
+}
+
+// newEncodingCounters создаёт счётчики для всех поддерживаемых encoding'ов.
+func newEncodingCounters() map[string]*encodingCounters {
+	return map[string]*encodingCounters{
+		EncodingIdentity: {},
+		EncodingGzip:     {},
+		EncodingZstd:     {},
+	}
+}
+
+// countingReader подсчитывает прочитанные байты в атомарный счётчик.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(uint64(n))
+	return n, err
+}
+
+// limitedReader возвращает errDecompressedTooLarge при превышении лимита,
+// в отличие от io.LimitedReader, который молча возвращает io.EOF.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Проверяем, остались ли данные за пределами лимита
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, errDecompressedTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// normalizeEncoding приводит значение Content-Encoding к одному из
+// поддерживаемых. Цепочки encoding'ов не поддерживаются.
+func normalizeEncoding(header string) (string, error) {
+	enc := strings.ToLower(strings.TrimSpace(header))
+	switch enc {
+	case "", EncodingIdentity:
+		return EncodingIdentity, nil
+	case EncodingGzip, "x-gzip":
+		return EncodingGzip, nil
+	case EncodingZstd:
+		return EncodingZstd, nil
+	default:
+		return "", fmt.Errorf("%w: %q", errUnsupportedEncoding, header)
+	}
+}
+
+// decodeBody оборачивает тело запроса в потоковый декодер для encoding.
+// Возвращает reader распакованных данных и функцию освобождения ресурсов.
+// Для сжатых тел размер распакованных данных ограничен maxDecoded байтами.
+func decodeBody(body io.Reader, encoding string, counters *encodingCounters, maxDecoded int64) (io.Reader, func(), error) {
+	counters.requests.Add(1)
+	wire := &countingReader{r: body, n: &counters.wireBytes}
+
+	var decoded io.Reader
+	release := func() {}
+
+	switch encoding {
+	case EncodingIdentity:
+		// Без сжатия: wire и decoded совпадают, лимит не применяется,
+		// чтобы не ограничивать долгоживущие NDJSON потоки.
+		return &countingReader{r: wire, n: &counters.decodedBytes}, release, nil
+
+	case EncodingGzip:
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, release, err
+		}
+		decoded = zr
+		release = func() { _ = zr.Close() }
+
+	case EncodingZstd:
+		zr, err := zstd.NewReader(wire,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(maxZstdWindow),
+		)
+		if err != nil {
+			return nil, release, err
+		}
+		decoded = zr
+		release = zr.Close
+
+	default:
+		return nil, release, fmt.Errorf("%w: %q", errUnsupportedEncoding, encoding)
+	}
+
+	limited := &limitedReader{r: decoded, remaining: maxDecoded}
+	return &countingReader{r: limited, n: &counters.decodedBytes}, release, nil
+}
@@ -0,0 +1,172 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// makeNDJSON создаёт NDJSON поток из count валидных событий.
+func makeNDJSON(count int) []byte {
+	var lines []string
+	for i := 0; i < count; i++ {
+		lines = append(lines, `{"v":1,"runId":"run-1","sourceId":"source-1","channel":"physics","type":"body.state","frameIndex":`+strconv.Itoa(i)+`,"simTime":0.0,"payload":{"x":1}}`)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// gzipBytes сжимает данные gzip.
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// zstdBytes сжимает данные zstd.
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+// TestHandler_ContentEncoding проверяет приём сжатых тел запросов.
+func TestHandler_ContentEncoding(t *testing.T) {
+	raw := makeNDJSON(200)
+
+	cases := []struct {
+		encoding string
+		body     func(t *testing.T) []byte
+	}{
+		{"gzip", func(t *testing.T) []byte { return gzipBytes(t, raw) }},
+		{"zstd", func(t *testing.T) []byte { return zstdBytes(t, raw) }},
+		{"", func(t *testing.T) []byte { return raw }},
+	}
+
+	for _, tc := range cases {
+		t.Run("Content-Encoding "+strconv.Quote(tc.encoding), func(t *testing.T) {
+			bus := eventbus.New()
+			defer bus.Close()
+
+			handler := NewHandler(bus)
+			wire := tc.body(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(wire))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			w := httptest.NewRecorder()
+
+			handler.HandleIngest(w, req)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("ожидался статус %d, получен %d (%s)", http.StatusAccepted, w.Code, w.Body.String())
+			}
+			report := decodeReport(t, w)
+			if report.Accepted != 200 || report.Published != 200 {
+				t.Errorf("ожидалось accepted=200 published=200, получено %+v", report)
+			}
+
+			name := tc.encoding
+			if name == "" {
+				name = EncodingIdentity
+			}
+			stats := handler.Stats().Encodings[name]
+			if stats.Requests != 1 {
+				t.Errorf("requests = %d, ожидалось 1", stats.Requests)
+			}
+			if stats.WireBytes != uint64(len(wire)) {
+				t.Errorf("wireBytes = %d, ожидалось %d", stats.WireBytes, len(wire))
+			}
+			if stats.DecodedBytes != uint64(len(raw)) {
+				t.Errorf("decodedBytes = %d, ожидалось %d", stats.DecodedBytes, len(raw))
+			}
+			if tc.encoding != "" && stats.Ratio <= 1 {
+				t.Errorf("ratio = %f, ожидалось > 1 для сжатых данных", stats.Ratio)
+			}
+		})
+	}
+
+	t.Run("неизвестный Content-Encoding → 415", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(raw))
+		req.Header.Set("Content-Encoding", "br")
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusUnsupportedMediaType, w.Code)
+		}
+	})
+
+	t.Run("битый gzip → 400", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(raw))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("превышение лимита распаковки → 413", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{MaxDecompressedBytes: 1024})
+
+		for _, enc := range []string{"gzip", "zstd"} {
+			var wire []byte
+			if enc == "gzip" {
+				wire = gzipBytes(t, raw)
+			} else {
+				wire = zstdBytes(t, raw)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(wire))
+			req.Header.Set("Content-Encoding", enc)
+			w := httptest.NewRecorder()
+
+			handler.HandleIngest(w, req)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("%s: ожидался статус %d, получен %d", enc, http.StatusRequestEntityTooLarge, w.Code)
+			}
+			if report := decodeReport(t, w); report.Rejected == 0 || report.Errors[len(report.Errors)-1].Code != "ErrBodyTooLarge" {
+				t.Errorf("%s: отчёт: %+v", enc, report)
+			}
+			if decoded := handler.Stats().Encodings[enc].DecodedBytes; decoded > 1024 {
+				t.Errorf("%s: распаковано %d байт, лимит 1024", enc, decoded)
+			}
+		}
+	})
+}
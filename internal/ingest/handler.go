@@ -2,74 +2,456 @@ package ingest
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/teltel/teltel/internal/auth"
 	"github.com/teltel/teltel/internal/event"
 	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
 )
 
+// Config содержит конфигурацию ingest handler.
+type Config struct {
+	// Strict - строгий режим по умолчанию: при ошибках строк возвращается
+	// 400 (ни одна строка не принята) или 207 (часть строк отклонена).
+	// Может быть включён для отдельного запроса параметром ?strict=true.
+	Strict bool
+
+	// MaxDecompressedBytes - лимит размера распакованного тела для
+	// Content-Encoding gzip/zstd (0 = DefaultMaxDecompressedBytes)
+	MaxDecompressedBytes int64
+
+	// WSAckInterval - период отправки ack в /ws/ingest (0 = 1s)
+	WSAckInterval time.Duration
+
+	// FlowHighWatermark - заполненность очередей block-подписчиков EventBus,
+	// при которой клиентам /ws/ingest отправляется slow_down (0 = 0.8)
+	FlowHighWatermark float64
+
+	// FlowLowWatermark - заполненность, при которой отправляется resume (0 = 0.5)
+	FlowLowWatermark float64
+
+	// FlowMaxLogLag - отставание durable потребителя журнала (в событиях),
+	// соответствующее полной заполненности (0 = 100000, см. SetFlowLog)
+	FlowMaxLogLag uint64
+
+	// Pipeline - параметры общего пути обработки событий (дедупликация и т.п.)
+	Pipeline PipelineConfig
+
+	// Auth - проверка токенов ingest (nil = аутентификация выключена)
+	Auth *auth.Authenticator
+}
+
+// Stats содержит статистику ingest handler.
+type Stats struct {
+	// Encodings - счётчики трафика по Content-Encoding
+	Encodings map[string]EncodingStats `json:"encodings"`
+
+	// UDP - статистика UDP listener'а (nil, если он не подключён)
+	UDP *UDPStats `json:"udp,omitempty"`
+
+	// Streams - статистика потоковых listener'ов по типу сети (tcp, unix)
+	Streams map[string]StreamStats `json:"streams,omitempty"`
+
+	// WebSocket - статистика /ws/ingest
+	WebSocket WSIngestStats `json:"websocket"`
+
+	// Versions - счётчики по версиям событий
+	Versions VersionStats `json:"versions"`
+
+	// Sequence - статистика дедупликации по seq
+	Sequence SequenceStats `json:"sequence"`
+
+	// Clocks - оценка смещения часов хостов по sourceId
+	Clocks map[string]ClockSkew `json:"clocks"`
+
+	// RateLimits - статистика лимитов по sourceId и runId (nil, если лимиты не заданы)
+	RateLimits *RateLimitStats `json:"rateLimits,omitempty"`
+
+	// Schemas - статистика проверки payload по схемам (nil, если реестр не задан)
+	Schemas *SchemaStats `json:"schemas,omitempty"`
+
+	// Processors - статистика processor'ов (nil, если цепочка не задана)
+	Processors []ProcessorStats `json:"processors,omitempty"`
+}
+
 // Handler обрабатывает HTTP запросы для ingest endpoint.
 type Handler struct {
-	bus eventbus.EventBus
+	bus      eventbus.EventBus
+	pipeline *Pipeline
+	config   Config
+
+	// Счётчики трафика по Content-Encoding (ключи фиксированы при создании)
+	encodings map[string]*encodingCounters
+
+	// Счётчики /ws/ingest
+	ws wsIngestCounters
+
+	// Дополнительные транспорты, статистика которых отдаётся в HandleStats
+	mu      sync.RWMutex
+	udp     *UDPListener
+	streams []*StreamListener
+
+	// Журнал и durable потребитель для flow control (см. SetFlowLog)
+	flowLog      *eventlog.Log
+	flowConsumer string
 }
 
 // NewHandler создаёт новый ingest handler.
 func NewHandler(bus eventbus.EventBus) *Handler {
+	return NewHandlerWithConfig(bus, Config{})
+}
+
+// NewHandlerWithConfig создаёт новый ingest handler с заданной конфигурацией.
+func NewHandlerWithConfig(bus eventbus.EventBus, config Config) *Handler {
+	if config.MaxDecompressedBytes <= 0 {
+		config.MaxDecompressedBytes = DefaultMaxDecompressedBytes
+	}
+	if config.WSAckInterval <= 0 {
+		config.WSAckInterval = defaultWSAckInterval
+	}
+	if config.FlowHighWatermark <= 0 {
+		config.FlowHighWatermark = defaultFlowHighWatermark
+	}
+	if config.FlowLowWatermark <= 0 {
+		config.FlowLowWatermark = defaultFlowLowWatermark
+	}
+	if config.FlowMaxLogLag == 0 {
+		config.FlowMaxLogLag = defaultFlowMaxLogLag
+	}
+
 	return &Handler{
-		bus: bus,
+		bus:       bus,
+		pipeline:  NewPipeline(bus, config.Pipeline),
+		config:    config,
+		encodings: newEncodingCounters(),
 	}
 }
 
-// HandleIngest обрабатывает POST /api/ingest запрос с NDJSON потоком.
-// Каждая строка обрабатывается независимо.
+// Pipeline возвращает общий путь обработки событий handler'а.
+// UDP и потоковые listener'ы должны использовать его же, чтобы
+// дедупликация по seq работала для всех транспортов.
+func (h *Handler) Pipeline() *Pipeline {
+	return h.pipeline
+}
+
+// HandleIngest обрабатывает POST /api/ingest запрос с NDJSON потоком
+// или потоком MessagePack (Content-Type: application/msgpack).
+// Каждая строка (событие) обрабатывается независимо.
 // Ошибка в одной строке не ломает обработку остальных.
+// В ответе возвращается Report с количеством принятых, отклонённых
+// и опубликованных событий и деталями по отклонённым строкам.
+// Тело может быть сжато (Content-Encoding: gzip или zstd) и распаковывается
+// потоково, без буферизации всего запроса в памяти.
+// При включённой аутентификации запрос без валидного ingest токена
+// отклоняется с 401 (403 для токена другого класса).
 func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	token, err := h.config.Auth.Authenticate(r, auth.RoleIngest)
+	if err != nil {
+		auth.WriteError(w, err)
+		return
+	}
+
+	strict, err := h.strictMode(r)
+	if err != nil {
+		http.Error(w, "Invalid strict parameter", http.StatusBadRequest)
+		return
+	}
+
+	encoding, err := normalizeEncoding(r.Header.Get("Content-Encoding"))
+	if err != nil {
+		http.Error(w, "Unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, release, err := decodeBody(r.Body, encoding, h.encodings[encoding], h.config.MaxDecompressedBytes)
+	if err != nil {
+		http.Error(w, "Invalid compressed body", http.StatusBadRequest)
+		return
+	}
+	defer release()
+
 	ctx := r.Context()
-	scanner := bufio.NewScanner(r.Body)
-	batch := make([]*event.Event, 0, 100) // начальный размер batch
-	batchSize := 100
+	report := newReport()
+	pub := newBatchPublisher(h.pipeline, originHTTP, token, defaultBatchSize, report)
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
+	if isMsgPackContentType(r.Header.Get("Content-Type")) {
+		err = readMsgPack(ctx, body, pub)
+	} else {
+		err = readNDJSON(ctx, body, bufio.MaxScanTokenSize, pub)
+	}
+
+	// Публикуем оставшиеся события; ошибка публикации отражается
+	// в Report.Unpublished и статусе ответа
+	pub.flush(ctx)
+
+	status := reportStatus(report, strict)
+	if err != nil {
+		// Ошибка чтения тела (не ошибка отдельной строки): события до неё
+		// уже обработаны, поэтому клиент получает отчёт о них
+		if !errors.Is(err, errDecompressedTooLarge) {
+			err = fmt.Errorf("%w: %v", errReadBody, err)
 		}
+		report.reject(&event.LineError{Err: err})
+		status = bodyErrorStatus(report, err)
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeReport(w, status, report)
+}
 
-		// Парсим строку NDJSON
-		evt, err := event.ParseNDJSONLine(line)
+// SetUDPListener подключает UDP listener для отображения его статистики.
+func (h *Handler) SetUDPListener(l *UDPListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.udp = l
+}
+
+// SetFlowLog подключает к flow control /ws/ingest отставание durable
+// потребителя consumer от конца журнала log. Потребитель журнала
+// не блокирует EventBus, поэтому без этого его отставание не видно
+// в заполненности очередей.
+func (h *Handler) SetFlowLog(log *eventlog.Log, consumer string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flowLog = log
+	h.flowConsumer = consumer
+}
+
+// flowFill возвращает заполненность (0..1) для flow control /ws/ingest:
+// максимум из заполненности очередей block-подписчиков EventBus
+// и отставания потребителя журнала, делённого на FlowMaxLogLag.
+func (h *Handler) flowFill() float64 {
+	fill := h.bus.Stats().MaxBlockingQueueFill
+
+	h.mu.RLock()
+	eventLog, consumer := h.flowLog, h.flowConsumer
+	h.mu.RUnlock()
+	if eventLog != nil {
+		lag := float64(eventLog.Lag(consumer)) / float64(h.config.FlowMaxLogLag)
+		fill = max(fill, min(lag, 1))
+	}
+	return fill
+}
+
+// AddStreamListener подключает потоковый listener для отображения его статистики.
+func (h *Handler) AddStreamListener(l *StreamListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams = append(h.streams, l)
+}
+
+// Stats возвращает статистику ingest handler.
+func (h *Handler) Stats() Stats {
+	encodings := make(map[string]EncodingStats, len(h.encodings))
+	for name, c := range h.encodings {
+		encodings[name] = c.snapshot()
+	}
+	stats := Stats{
+		Encodings:  encodings,
+		WebSocket:  h.ws.snapshot(),
+		Versions:   h.pipeline.VersionStats(),
+		Sequence:   h.pipeline.SequenceStats(),
+		Clocks:     h.pipeline.ClockSkews(),
+		RateLimits: h.pipeline.RateLimitStats(),
+		Schemas:    h.pipeline.SchemaStats(),
+		Processors: h.pipeline.ProcessorStats(),
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.udp != nil {
+		udp := h.udp.Stats()
+		stats.UDP = &udp
+	}
+	if len(h.streams) > 0 {
+		stats.Streams = make(map[string]StreamStats, len(h.streams))
+		for _, l := range h.streams {
+			stats.Streams[l.Network()] = l.Stats()
+		}
+	}
+	return stats
+}
+
+// HandleStats возвращает статистику ingest.
+// GET /api/ingest/stats
+func (h *Handler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Stats())
+}
+
+// readNDJSON читает NDJSON поток построчно. Строка длиннее maxLineSize
+// отклоняется целиком с ErrLineTooLong, как в потоковых listener'ах;
+// в отчёт и dead-letter попадает только её начало.
+// Ошибки отдельных строк фиксируются в отчёте и не прерывают чтение.
+// Возвращает только ошибки чтения потока.
+func readNDJSON(ctx context.Context, body io.Reader, maxLineSize int, pub *batchPublisher) error {
+	r := bufio.NewReader(body)
+	var long []byte // строка длиннее буфера r (не больше maxLineSize+1 байт)
+	lineNo := 0
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull || long != nil {
+			if len(long) <= maxLineSize {
+				long = append(long, line[:min(len(line), maxLineSize+1-len(long))]...)
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			line, long = long, nil
+		}
+
+		if len(line) > 0 {
+			lineNo++
+			line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte{'\n'}), []byte{'\r'})
+			switch {
+			case len(line) > maxLineSize:
+				pub.reject(lineNo, line, nil, ErrLineTooLong)
+			case len(bytes.TrimSpace(line)) == 0:
+			default:
+				// Ошибка строки фиксируется в отчёте, обработка продолжается
+				evt, v, perr := pub.pipeline.parseLine(string(line))
+				if perr == nil {
+					perr = pub.add(ctx, evt, v)
+				}
+				if perr != nil {
+					pub.reject(lineNo, line, evt, perr)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			// Ошибка парсинга - пропускаем строку, продолжаем обработку
-			continue
+			return err
 		}
+	}
+}
 
-		// Устанавливаем wallTime, если не задано
-		evt.SetWallTime()
+// readMsgPack читает поток MessagePack событий.
+// Номер "строки" в отчёте - порядковый номер события в потоке.
+// Ошибки валидации не прерывают чтение; структурная ошибка формата
+// фиксируется в отчёте и завершает чтение, т.к. синхронизация потока потеряна.
+func readMsgPack(ctx context.Context, body io.Reader, pub *batchPublisher) error {
+	dec := event.NewMsgPackDecoder(body)
 
-		batch = append(batch, evt)
+	for index := 1; ; index++ {
+		evt, v, err := pub.pipeline.decode(dec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !isEventError(err) {
+				return err
+			}
+			pub.reject(index, nil, nil, err)
+			if errors.Is(err, event.ErrInvalidMsgPack) {
+				return nil
+			}
+			continue
+		}
 
-		// Публикуем batch при достижении размера
-		if len(batch) >= batchSize {
-			_, _ = h.bus.PublishBatch(ctx, batch)
-			batch = batch[:0] // очищаем, сохраняя capacity
+		if err := pub.add(ctx, evt, v); err != nil {
+			pub.reject(index, nil, evt, err)
 		}
 	}
+}
+
+// isEventError сообщает, является ли ошибка ошибкой формата/валидации
+// события (а не ошибкой чтения потока).
+func isEventError(err error) bool {
+	return event.ErrorCode(err) != "ErrUnknown"
+}
+
+// strictMode определяет, включён ли строгий режим для запроса.
+func (h *Handler) strictMode(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("strict")
+	if v == "" {
+		return h.config.Strict, nil
+	}
+	return strconv.ParseBool(v)
+}
 
-	// Публикуем оставшиеся события
-	if len(batch) > 0 {
-		_, _ = h.bus.PublishBatch(ctx, batch)
+// reportStatus выбирает HTTP статус ответа по отчёту.
+// В обычном режиме всегда 202; в строгом - 400, если ни одна строка
+// не принята, и 207, если отклонена только часть строк.
+// События с sourceId, не разрешённым токену, всегда дают 403
+// (ни одно событие не принято) или 207, независимо от режима.
+// События, отклонённые по лимиту (политика reject), дают 429, если
+// ни одно событие не принято, иначе 207: принятые события уже
+// опубликованы, и повтор всего запроса продублировал бы их.
+// Принятые события, которые не удалось опубликовать, дают 503, если
+// ничего не опубликовано, иначе 207.
+func reportStatus(report *Report, strict bool) int {
+	if report.Unpublished > 0 {
+		if report.Published == 0 && report.Duplicates == 0 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusMultiStatus
 	}
+	if report.forbidden > 0 {
+		if report.Accepted == 0 && report.Duplicates == 0 {
+			return http.StatusForbidden
+		}
+		return http.StatusMultiStatus
+	}
+	if report.throttled > 0 {
+		if report.Accepted == 0 && report.Duplicates == 0 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusMultiStatus
+	}
+	if !strict || report.Rejected == 0 {
+		return http.StatusAccepted
+	}
+	if report.Accepted == 0 {
+		return http.StatusBadRequest
+	}
+	return http.StatusMultiStatus
+}
 
-	// Проверяем ошибки сканера (не ошибки парсинга отдельных строк)
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
+// bodyErrorStatus выбирает HTTP статус ответа, если тело прочитано
+// не полностью: 413 для слишком большого распакованного тела (запрос
+// нужно разделить); для остальных ошибок чтения - 207, если часть
+// событий принята (повтор всего запроса продублировал бы их), иначе 400.
+// В обоих случаях отчёт показывает, какие строки уже обработаны.
+func bodyErrorStatus(report *Report, err error) int {
+	switch {
+	case errors.Is(err, errDecompressedTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case report.Accepted > 0 || report.Duplicates > 0:
+		return http.StatusMultiStatus
+	default:
+		return http.StatusBadRequest
 	}
+}
 
-	w.WriteHeader(http.StatusAccepted)
+// writeReport записывает отчёт в ответ в формате JSON.
+func writeReport(w http.ResponseWriter, status int, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
 }
@@ -1,8 +1,11 @@
 package ingest
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -957,6 +960,84 @@ func TestHandler_RequestBodyError(t *testing.T) {
 			t.Error("handler должен установить статус код")
 		}
 	})
+
+	t.Run("ошибка чтения после принятых строк → 207 с отчётом", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		body := io.MultiReader(strings.NewReader(
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0,"payload":{}}`+"\n"+
+				`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":1,"simTime":0.0,"payload":{}}`+"\n",
+		), &errorReader{})
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", body)
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusMultiStatus {
+			t.Errorf("ожидался статус 207, получен %d", w.Code)
+		}
+		report := decodeReport(t, w)
+		if report.Accepted != 2 || report.Published != 2 || report.Rejected != 1 || report.Errors[0].Code != "ErrReadBody" {
+			t.Errorf("отчёт: %+v", report)
+		}
+	})
+
+	t.Run("ошибка чтения без принятых строк → 400 с отчётом", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", &errorReader{})
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус 400, получен %d", w.Code)
+		}
+		if report := decodeReport(t, w); report.Accepted != 0 || report.Rejected != 1 || report.Errors[0].Code != "ErrReadBody" {
+			t.Errorf("отчёт: %+v", report)
+		}
+	})
+
+	t.Run("строка длиннее лимита отклоняется, остальные принимаются", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		sub, _ := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 10})
+		defer sub.Close()
+
+		handler := NewHandler(bus)
+
+		long := `{"v":1,"runId":"run-1","sourceId":"source-1","payload":"` + strings.Repeat("x", bufio.MaxScanTokenSize) + `"}`
+		body := strings.Join([]string{
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0,"payload":{}}`,
+			long,
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":2,"simTime":0.0,"payload":{}}`,
+		}, "\n")
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest?strict=true", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusMultiStatus {
+			t.Errorf("ожидался статус 207, получен %d", w.Code)
+		}
+		report := decodeReport(t, w)
+		if report.Accepted != 2 || report.Rejected != 1 {
+			t.Fatalf("отчёт: %+v", report)
+		}
+		if e := report.Errors[0]; e.Line != 2 || e.Code != "ErrLineTooLong" || !strings.HasPrefix(e.Excerpt, `{"v":1`) {
+			t.Errorf("ошибка строки: %+v", e)
+		}
+		if events := readAllAvailableEvents(sub, 100*time.Millisecond); len(events) != 2 || events[1].FrameIndex != 2 {
+			t.Errorf("опубликованы события: %+v", events)
+		}
+	})
 }
 
 // errorReader - reader, который всегда возвращает ошибку
@@ -965,3 +1046,301 @@ type errorReader struct{}
 func (r *errorReader) Read(p []byte) (n int, err error) {
 	return 0, bytes.ErrTooLarge // возвращаем ошибку
 }
+
+// decodeReport декодирует Report из тела ответа.
+func decodeReport(t *testing.T, w *httptest.ResponseRecorder) Report {
+	t.Helper()
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("не удалось декодировать отчёт: %v (body: %q)", err, w.Body.String())
+	}
+	return report
+}
+
+// TestHandler_Report проверяет структурированный отчёт ingest.
+func TestHandler_Report(t *testing.T) {
+	body := strings.Join([]string{
+		`{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-1","frameIndex":0,"simTime":0.0,"payload":{}}`,
+		`invalid json`,
+		``,
+		`{"v":1,"sourceId":"source-1","frameIndex":1,"simTime":0.0}`,
+		`{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-2","frameIndex":2,"simTime":0.0,"payload":{}}`,
+	}, "\n")
+
+	t.Run("отчёт содержит счётчики и ошибки строк", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusAccepted, w.Code)
+		}
+
+		report := decodeReport(t, w)
+		if report.Accepted != 2 || report.Rejected != 2 || report.Published != 2 {
+			t.Errorf("ожидалось accepted=2 rejected=2 published=2, получено %+v", report)
+		}
+		if len(report.Errors) != 2 {
+			t.Fatalf("ожидалось 2 ошибки строк, получено %d", len(report.Errors))
+		}
+		if report.Errors[0].Line != 2 || report.Errors[0].Code != "ErrInvalidJSON" {
+			t.Errorf("первая ошибка: ожидалась строка 2 с ErrInvalidJSON, получено %+v", report.Errors[0])
+		}
+		if report.Errors[1].Line != 4 || report.Errors[1].Code != "ErrMissingRunID" {
+			t.Errorf("вторая ошибка: ожидалась строка 4 с ErrMissingRunID, получено %+v", report.Errors[1])
+		}
+		if report.Errors[0].Excerpt != "invalid json" {
+			t.Errorf("excerpt = %q, ожидалось %q", report.Errors[0].Excerpt, "invalid json")
+		}
+	})
+
+	t.Run("длинная строка усекается в excerpt", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(strings.Repeat("x", 1000)))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		report := decodeReport(t, w)
+		if len(report.Errors) != 1 {
+			t.Fatalf("ожидалась 1 ошибка, получено %d", len(report.Errors))
+		}
+		if len(report.Errors[0].Excerpt) >= 1000 {
+			t.Errorf("excerpt не усечён: длина %d", len(report.Errors[0].Excerpt))
+		}
+	})
+
+	t.Run("список ошибок ограничен", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		lines := make([]string, maxReportedErrors+10)
+		for i := range lines {
+			lines[i] = "invalid"
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(strings.Join(lines, "\n")))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		report := decodeReport(t, w)
+		if report.Rejected != len(lines) {
+			t.Errorf("rejected = %d, ожидалось %d", report.Rejected, len(lines))
+		}
+		if len(report.Errors) != maxReportedErrors || !report.ErrorsTruncated {
+			t.Errorf("ожидалось %d ошибок и errorsTruncated=true, получено %d/%v", maxReportedErrors, len(report.Errors), report.ErrorsTruncated)
+		}
+	})
+
+	t.Run("strict: частичные ошибки → 207", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest?strict=true", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusMultiStatus {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusMultiStatus, w.Code)
+		}
+	})
+
+	t.Run("strict: все строки невалидны → 400", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{Strict: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader("invalid\n{\"v\":1}"))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+		}
+		report := decodeReport(t, w)
+		if report.Rejected != 2 {
+			t.Errorf("rejected = %d, ожидалось 2", report.Rejected)
+		}
+	})
+
+	t.Run("strict: без ошибок → 202", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{Strict: true})
+
+		body := `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0}`
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusAccepted, w.Code)
+		}
+	})
+
+	t.Run("strict=false отключает строгий режим конфигурации", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{Strict: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest?strict=false", strings.NewReader("invalid"))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusAccepted, w.Code)
+		}
+	})
+
+	t.Run("неопубликованные события → 503 или 207", func(t *testing.T) {
+		inner := eventbus.New()
+		defer inner.Close()
+
+		body := strings.Join([]string{
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0}`,
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":1,"simTime":0.0}`,
+			`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":2,"simTime":0.0}`,
+		}, "\n")
+		tests := []struct {
+			name        string
+			limit       int
+			status      int
+			published   int
+			unpublished int
+		}{
+			{"ничего не опубликовано", 0, http.StatusServiceUnavailable, 0, 3},
+			{"опубликована часть", 1, http.StatusMultiStatus, 1, 2},
+		}
+		for _, tt := range tests {
+			handler := NewHandler(&failingBus{EventBus: inner, limit: tt.limit})
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.HandleIngest(w, req)
+
+			report := decodeReport(t, w)
+			if w.Code != tt.status || report.Accepted != 3 || report.Published != tt.published || report.Unpublished != tt.unpublished {
+				t.Errorf("%s: статус %d, отчёт %+v", tt.name, w.Code, report)
+			}
+		}
+	})
+
+	t.Run("некорректный параметр strict → 400", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest?strict=maybe", strings.NewReader(""))
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+// TestHandler_MsgPack проверяет приём событий в формате MessagePack.
+func TestHandler_MsgPack(t *testing.T) {
+	t.Run("поток MessagePack публикуется так же, как NDJSON", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		ctx := context.Background()
+		sub, err := bus.Subscribe(ctx, eventbus.Filter{}, eventbus.SubscriptionOptions{
+			BufferSize: 100,
+			Policy:     eventbus.BackpressureBlock,
+		})
+		if err != nil {
+			t.Fatalf("Subscribe() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		var body []byte
+		for i := 0; i < 3; i++ {
+			line := `{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-` + strconv.Itoa(i) + `","frameIndex":` + strconv.Itoa(i) + `,"simTime":0.0,"payload":{"i":` + strconv.Itoa(i) + `}}`
+			evt, err := event.ParseNDJSONLine(line)
+			if err != nil {
+				t.Fatalf("ParseNDJSONLine() вернула ошибку: %v", err)
+			}
+			body = append(body, event.MarshalMsgPack(evt)...)
+		}
+		invalid := &event.Event{V: 1, SourceID: "source-1"}
+		body = append(body, event.MarshalMsgPack(invalid)...)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/msgpack")
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("ожидался статус %d, получен %d", http.StatusAccepted, w.Code)
+		}
+		report := decodeReport(t, w)
+		if report.Accepted != 3 || report.Rejected != 1 {
+			t.Errorf("ожидалось accepted=3 rejected=1, получено %+v", report)
+		}
+		if len(report.Errors) == 1 && (report.Errors[0].Line != 4 || report.Errors[0].Code != "ErrMissingRunID") {
+			t.Errorf("неожиданная ошибка: %+v", report.Errors[0])
+		}
+
+		received := readEvents(sub, 3, 500*time.Millisecond)
+		if len(received) != 3 {
+			t.Fatalf("ожидалось 3 события, получено %d", len(received))
+		}
+		for i, evt := range received {
+			if evt.FrameIndex != i || string(evt.Payload) != `{"i":`+strconv.Itoa(i)+`}` {
+				t.Errorf("событие %d: неожиданное содержимое %+v", i, evt)
+			}
+			if evt.WallTimeMs == nil {
+				t.Errorf("событие %d: WallTimeMs должен быть установлен", i)
+			}
+		}
+	})
+
+	t.Run("битый MessagePack → событие отклонено, чтение завершено", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest?strict=true", bytes.NewReader([]byte{0x92, 0x01}))
+		req.Header.Set("Content-Type", "application/x-msgpack")
+		w := httptest.NewRecorder()
+
+		handler.HandleIngest(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус %d, получен %d", http.StatusBadRequest, w.Code)
+		}
+		report := decodeReport(t, w)
+		if report.Rejected != 1 || report.Errors[0].Code != "ErrInvalidMsgPack" {
+			t.Errorf("неожиданный отчёт: %+v", report)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/teltel/teltel/internal/auth"
+	"github.com/teltel/teltel/internal/deadletter"
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/schema"
+)
+
+// PipelineConfig определяет параметры общего пути обработки событий.
+type PipelineConfig struct {
+	// DedupWindow - количество последних номеров seq на (runId, sourceId),
+	// в пределах которого повторы отбрасываются (0 = DefaultDedupWindow)
+	DedupWindow int
+
+	// SequenceTTL - время хранения состояния seq неактивного источника (0 = 1h)
+	SequenceTTL time.Duration
+
+	// RateLimits - лимиты по sourceId и runId (нулевое значение = без лимитов)
+	RateLimits RateLimitsConfig
+
+	// Schemas - реестр схем payload (nil = payload не проверяется)
+	Schemas *schema.Registry
+
+	// Migrator - приведение старых версий событий к канонической
+	// (nil = event.DefaultMigrator())
+	Migrator *event.Migrator
+
+	// DeadLetter - хранилище отклонённых событий (nil = не сохраняются)
+	DeadLetter *deadletter.Store
+
+	// Processors - цепочка преобразований принятых событий перед
+	// публикацией в EventBus, в порядке применения (nil = без преобразований)
+	Processors []NamedProcessor
+}
+
+// errDuplicate - событие является повтором уже принятого seq.
+var errDuplicate = errors.New("ingest: duplicate seq")
+
+// Pipeline - общий для всех транспортов (HTTP, WebSocket, UDP, TCP/Unix)
+// путь принятого события до EventBus: приведение к канонической версии,
+// лимиты по источнику и run'у,
+// проверка payload по схеме, дедупликация по seq, установка и коррекция
+// wallTime по оценке часов источника, преобразование цепочкой processor'ов
+// и публикация batch'ами.
+type Pipeline struct {
+	bus        eventbus.EventBus
+	versions   *versionTracker
+	limiter    *rateLimiter
+	schemas    *schemaValidator
+	sequences  *sequenceTracker
+	clocks     *clockEstimator
+	processors *processorChain
+
+	deadLetters *deadletter.Store
+}
+
+// NewPipeline создаёт pipeline, публикующий события в bus.
+func NewPipeline(bus eventbus.EventBus, config PipelineConfig) *Pipeline {
+	return &Pipeline{
+		bus:        bus,
+		versions:   newVersionTracker(config.Migrator),
+		limiter:    newRateLimiter(config.RateLimits),
+		schemas:    newSchemaValidator(config.Schemas),
+		sequences:  newSequenceTracker(config.DedupWindow, config.SequenceTTL),
+		clocks:     newClockEstimator(),
+		processors: newProcessorChain(config.Processors),
+
+		deadLetters: config.DeadLetter,
+	}
+}
+
+// parseLine разбирает строку NDJSON, приводя событие старой версии
+// к канонической до строгого разбора, и возвращает исходную версию
+// события. Кроме ошибок event.ParseNDJSONLine возвращает
+// event.ErrUnsupportedVersion или event.ErrMigrationFailed, если событие
+// нельзя привести к канонической версии.
+func (p *Pipeline) parseLine(line string) (*event.Event, int, error) {
+	return p.versions.parseLine(line)
+}
+
+// decode читает следующее событие MessagePack, приводя его
+// к канонической версии. Ошибки - как у parseLine и MsgPackDecoder.Decode.
+func (p *Pipeline) decode(dec *event.MsgPackDecoder) (*event.Event, int, error) {
+	return p.versions.decode(dec)
+}
+
+// accept пропускает через pipeline событие канонической версии,
+// полученное от parseLine или decode; v - исходная версия события,
+// по которой выбирается схема payload.
+// Возвращает ErrRateLimited, если событие превысило лимит, и errDuplicate,
+// если это повтор уже принятого seq. В режиме schema.ModeEnforce payload,
+// не соответствующий схеме, даёт ошибку, совместимую с schema.ErrViolation.
+// Лимит и схема проверяются до дедупликации, чтобы отклонённое событие
+// можно было отправить повторно.
+func (p *Pipeline) accept(evt *event.Event, v int) error {
+	if p.limiter != nil && !p.limiter.allow(evt.SourceID, evt.RunID) {
+		return ErrRateLimited
+	}
+	if p.schemas != nil {
+		if err := p.schemas.check(evt, v); err != nil {
+			return err
+		}
+	}
+	if evt.Seq != nil && p.sequences.observe(evt.RunID, evt.SourceID, *evt.Seq) {
+		return errDuplicate
+	}
+
+	// wallTime клиента приводим к часам сервера; если wallTime не задано,
+	// устанавливаем время сервера, которое коррекции не требует
+	if evt.WallTimeMs != nil {
+		corrected := p.clocks.correct(evt.SourceID, *evt.WallTimeMs)
+		evt.WallTimeCorrectedMs = &corrected
+	} else {
+		evt.SetWallTime()
+		corrected := *evt.WallTimeMs
+		evt.WallTimeCorrectedMs = &corrected
+	}
+	return nil
+}
+
+// publish преобразует batch событий цепочкой processor'ов и публикует
+// его в EventBus. Возвращает количество опубликованных событий (первые n
+// событий batch'а) и ошибку, если опубликованы не все: ошибку EventBus,
+// ошибку ctx или eventbus.ErrClosed. Для неопубликованных событий
+// отменяется учёт seq, чтобы повторная отправка клиентом не считалась
+// дубликатом.
+func (p *Pipeline) publish(ctx context.Context, batch []*event.Event) (int, error) {
+	out := batch
+	if p.processors != nil {
+		// Исходные события нужны для отмены учёта seq
+		out = make([]*event.Event, len(batch))
+		for i, e := range batch {
+			out[i] = p.processors.apply(e)
+		}
+	}
+	n, err := p.bus.PublishBatch(ctx, out)
+	if n == len(batch) {
+		// Ошибка записи в журнал не отменяет fan-out опубликованных событий
+		return n, nil
+	}
+	if err == nil {
+		// Закрытый EventBus отбрасывает события без ошибки
+		err = eventbus.ErrClosed
+	}
+	for _, e := range batch[n:] {
+		if e.Seq != nil {
+			p.sequences.forget(e.RunID, e.SourceID, *e.Seq)
+		}
+	}
+	return n, err
+}
+
+// deadLetter сохраняет отклонённое событие в dead-letter хранилище.
+// raw - исходная строка NDJSON (nil для MessagePack), evt - разобранное
+// событие (nil, если ошибка возникла при парсинге). События, отклонённые
+// по лимиту или из-за sourceId, не сохраняются: клиент получает явный отказ
+// и повторная отправка в обход лимита или токена недопустима.
+func (p *Pipeline) deadLetter(origin string, line int, raw []byte, evt *event.Event, err error) {
+	if p.deadLetters == nil || errors.Is(err, ErrRateLimited) || errors.Is(err, auth.ErrSourceForbidden) {
+		return
+	}
+	p.deadLetters.Write(deadletter.Entry{
+		Origin: origin,
+		Reason: errorCode(err),
+		Error:  err.Error(),
+		Line:   line,
+		Raw:    string(bytes.TrimSpace(raw)),
+		Event:  evt,
+	})
+}
+
+// RunSequences возвращает состояние seq по источникам run'а
+// (пустой результат, если события run'а не содержали seq).
+func (p *Pipeline) RunSequences(runID string) []SourceSequence {
+	return p.sequences.run(runID)
+}
+
+// RateLimitStats возвращает статистику лимитов (nil, если лимиты не заданы).
+func (p *Pipeline) RateLimitStats() *RateLimitStats {
+	return p.limiter.stats()
+}
+
+// SchemaStats возвращает статистику проверки payload (nil, если реестр не задан).
+func (p *Pipeline) SchemaStats() *SchemaStats {
+	return p.schemas.stats()
+}
+
+// VersionStats возвращает статистику версий событий.
+func (p *Pipeline) VersionStats() VersionStats {
+	return p.versions.stats()
+}
+
+// ProcessorStats возвращает статистику processor'ов в порядке применения
+// (nil, если цепочка не задана).
+func (p *Pipeline) ProcessorStats() []ProcessorStats {
+	return p.processors.stats()
+}
+
+// ClockSkews возвращает оценку смещения и дрейфа часов по sourceId.
+func (p *Pipeline) ClockSkews() map[string]ClockSkew {
+	return p.clocks.skews()
+}
+
+// SequenceStats возвращает общую статистику дедупликации.
+func (p *Pipeline) SequenceStats() SequenceStats {
+	return p.sequences.stats()
+}
@@ -0,0 +1,611 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// Встроенные processor'ы (ProcessorConfig.Type).
+const (
+	// ProcessorTagsAdd - добавляет теги Tags (существующие значения заменяются)
+	ProcessorTagsAdd = "tags_add"
+
+	// ProcessorTagsRemove - удаляет теги Keys
+	ProcessorTagsRemove = "tags_remove"
+
+	// ProcessorTagsLookup - добавляет теги из таблицы Table по значению поля Key
+	ProcessorTagsLookup = "tags_lookup"
+
+	// ProcessorTypeRename - переименовывает типы событий по таблице Rename
+	ProcessorTypeRename = "type_rename"
+
+	// ProcessorPayloadDrop - удаляет поля payload Fields
+	ProcessorPayloadDrop = "payload_drop"
+
+	// ProcessorPayloadCopy - копирует значение payload From в поле payload
+	// или тег To
+	ProcessorPayloadCopy = "payload_copy"
+
+	// ProcessorPayloadScale - пересчитывает числовое поле payload Field
+	// как value*Factor + Offset (перевод единиц)
+	ProcessorPayloadScale = "payload_scale"
+)
+
+var (
+	// ErrInvalidProcessor - некорректное описание processor'а.
+	ErrInvalidProcessor = errors.New("ingest: invalid processor")
+
+	// ErrProcessorFailed - processor не смог преобразовать событие.
+	ErrProcessorFailed = errors.New("ingest: processor failed")
+)
+
+// Processor преобразует принятое событие до публикации в EventBus.
+type Processor interface {
+	// Process возвращает преобразованное событие. Исходное событие
+	// (в том числе Tags и Payload) не должно изменяться: при ошибке
+	// цепочка продолжается с ним.
+	Process(e *event.Event) (*event.Event, error)
+}
+
+// ProcessorFunc - функция, реализующая Processor.
+type ProcessorFunc func(e *event.Event) (*event.Event, error)
+
+// Process вызывает f(e).
+func (f ProcessorFunc) Process(e *event.Event) (*event.Event, error) {
+	return f(e)
+}
+
+// NamedProcessor - звено цепочки processor'ов.
+type NamedProcessor struct {
+	// Name - имя в статистике
+	Name string
+
+	// Types - типы событий, к которым применяется processor (пусто = все)
+	Types []string
+
+	Processor Processor
+}
+
+// ProcessorConfig описывает встроенный processor в JSON файле.
+//
+//	{
+//	  "processors": [
+//	    {"type": "type_rename", "rename": {"body.legacy": "body.state"}},
+//	    {"type": "tags_lookup", "key": "sourceId", "table": {"car01": {"team": "red"}}},
+//	    {"type": "tags_add", "tags": {"site": "lab1"}},
+//	    {"type": "tags_remove", "keys": ["debug"]},
+//	    {"type": "payload_drop", "types": ["body.state"], "fields": ["debug", "raw.samples"]},
+//	    {"type": "payload_copy", "from": "vehicle.id", "to": "tags.vehicle"},
+//	    {"name": "speed km/h", "type": "payload_scale", "field": "speed", "factor": 3.6}
+//	  ]
+//	}
+//
+// Пути payload - ключи объектов через точку ("raw.samples").
+type ProcessorConfig struct {
+	// Name - имя в статистике (по умолчанию Type)
+	Name string `json:"name,omitempty"`
+
+	// Type - тип встроенного processor'а
+	Type string `json:"type"`
+
+	// Types - типы событий, к которым применяется processor (пусто = все)
+	Types []string `json:"types,omitempty"`
+
+	// Tags - для tags_add
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Keys - для tags_remove
+	Keys []string `json:"keys,omitempty"`
+
+	// Key, Table - для tags_lookup: поле (runId, sourceId, channel, type,
+	// tags.<key>) и теги для каждого его значения
+	Key   string                       `json:"key,omitempty"`
+	Table map[string]map[string]string `json:"table,omitempty"`
+
+	// Rename - для type_rename: старый тип -> новый тип
+	Rename map[string]string `json:"rename,omitempty"`
+
+	// Fields - для payload_drop
+	Fields []string `json:"fields,omitempty"`
+
+	// From, To - для payload_copy: путь payload и путь payload или tags.<key>
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Field, Factor, Offset - для payload_scale
+	Field  string  `json:"field,omitempty"`
+	Factor float64 `json:"factor,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+}
+
+// ProcessorsConfig - содержимое файла processor'ов.
+type ProcessorsConfig struct {
+	Processors []ProcessorConfig `json:"processors"`
+}
+
+// LoadProcessorsFile загружает цепочку встроенных processor'ов из JSON файла.
+func LoadProcessorsFile(path string) ([]NamedProcessor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processors file: %w", err)
+	}
+	var config ProcessorsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse processors file: %w", err)
+	}
+	return BuildProcessors(config.Processors)
+}
+
+// BuildProcessors создаёт цепочку встроенных processor'ов в порядке configs.
+func BuildProcessors(configs []ProcessorConfig) ([]NamedProcessor, error) {
+	processors := make([]NamedProcessor, 0, len(configs))
+	for i, config := range configs {
+		p, err := NewProcessor(config)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d: %w", i, err)
+		}
+		name := config.Name
+		if name == "" {
+			name = config.Type
+		}
+		processors = append(processors, NamedProcessor{Name: name, Types: config.Types, Processor: p})
+	}
+	return processors, nil
+}
+
+// NewProcessor создаёт встроенный processor по описанию.
+func NewProcessor(config ProcessorConfig) (Processor, error) {
+	switch config.Type {
+	case ProcessorTagsAdd:
+		if len(config.Tags) == 0 {
+			return nil, fmt.Errorf("%w: %s requires tags", ErrInvalidProcessor, config.Type)
+		}
+		return tagsAdd(config.Tags), nil
+
+	case ProcessorTagsRemove:
+		if len(config.Keys) == 0 {
+			return nil, fmt.Errorf("%w: %s requires keys", ErrInvalidProcessor, config.Type)
+		}
+		return tagsRemove(config.Keys), nil
+
+	case ProcessorTagsLookup:
+		field, err := eventField(config.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(config.Table) == 0 {
+			return nil, fmt.Errorf("%w: %s requires table", ErrInvalidProcessor, config.Type)
+		}
+		return tagsLookup(field, config.Table), nil
+
+	case ProcessorTypeRename:
+		if len(config.Rename) == 0 {
+			return nil, fmt.Errorf("%w: %s requires rename", ErrInvalidProcessor, config.Type)
+		}
+		for from, to := range config.Rename {
+			if to == "" {
+				return nil, fmt.Errorf("%w: empty new name for type %q", ErrInvalidProcessor, from)
+			}
+		}
+		return typeRename(config.Rename), nil
+
+	case ProcessorPayloadDrop:
+		if len(config.Fields) == 0 {
+			return nil, fmt.Errorf("%w: %s requires fields", ErrInvalidProcessor, config.Type)
+		}
+		paths := make([][]string, len(config.Fields))
+		for i, field := range config.Fields {
+			path, err := payloadPath(field)
+			if err != nil {
+				return nil, err
+			}
+			paths[i] = path
+		}
+		return payloadDrop(paths), nil
+
+	case ProcessorPayloadCopy:
+		from, err := payloadPath(config.From)
+		if err != nil {
+			return nil, err
+		}
+		if tag, ok := strings.CutPrefix(config.To, "tags."); ok && tag != "" {
+			return payloadCopyToTag(from, tag), nil
+		}
+		to, err := payloadPath(config.To)
+		if err != nil {
+			return nil, err
+		}
+		return payloadCopy(from, to), nil
+
+	case ProcessorPayloadScale:
+		path, err := payloadPath(config.Field)
+		if err != nil {
+			return nil, err
+		}
+		if config.Factor == 0 {
+			return nil, fmt.Errorf("%w: %s requires non-zero factor", ErrInvalidProcessor, config.Type)
+		}
+		return payloadScale(path, config.Factor, config.Offset), nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidProcessor, config.Type)
+	}
+}
+
+// ProcessorStats содержит статистику processor'а цепочки.
+type ProcessorStats struct {
+	Name string `json:"name"`
+
+	// Processed - событий, переданных processor'у
+	Processed uint64 `json:"processed"`
+
+	// Errors - событий, которые processor не смог преобразовать
+	// (событие передаётся дальше без его изменений)
+	Errors uint64 `json:"errors"`
+
+	// LastError - текст последней ошибки
+	LastError string `json:"lastError,omitempty"`
+}
+
+// processorChain применяет processor'ы по порядку. Ошибка или panic
+// processor'а не прерывает цепочку: событие передаётся следующему
+// processor'у без изменений ошибочного.
+type processorChain struct {
+	stages []*processorStage
+}
+
+// processorStage - processor цепочки со своей статистикой.
+type processorStage struct {
+	name      string
+	types     map[string]bool
+	processor Processor
+
+	processed atomic.Uint64
+	errors    atomic.Uint64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// newProcessorChain создаёт цепочку; возвращает nil, если processor'ов нет.
+func newProcessorChain(processors []NamedProcessor) *processorChain {
+	if len(processors) == 0 {
+		return nil
+	}
+	c := &processorChain{}
+	for _, p := range processors {
+		stage := &processorStage{name: p.Name, processor: p.Processor}
+		if len(p.Types) > 0 {
+			stage.types = make(map[string]bool, len(p.Types))
+			for _, typ := range p.Types {
+				stage.types[typ] = true
+			}
+		}
+		c.stages = append(c.stages, stage)
+	}
+	return c
+}
+
+// apply пропускает событие через цепочку.
+func (c *processorChain) apply(e *event.Event) *event.Event {
+	for _, stage := range c.stages {
+		if stage.types != nil && !stage.types[e.Type] {
+			continue
+		}
+		stage.processed.Add(1)
+		out, err := stage.run(e)
+		if err != nil {
+			stage.errors.Add(1)
+			stage.mu.Lock()
+			stage.lastError = err.Error()
+			stage.mu.Unlock()
+			continue
+		}
+		e = out
+	}
+	return e
+}
+
+// run вызывает processor, превращая panic и nil результат в ошибку.
+func (s *processorStage) run(e *event.Event) (out *event.Event, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%w: panic: %v", ErrProcessorFailed, r)
+		}
+	}()
+	out, err = s.processor.Process(e)
+	if err == nil && out == nil {
+		err = fmt.Errorf("%w: nil event", ErrProcessorFailed)
+	}
+	return out, err
+}
+
+func (c *processorChain) stats() []ProcessorStats {
+	if c == nil {
+		return nil
+	}
+	stats := make([]ProcessorStats, len(c.stages))
+	for i, stage := range c.stages {
+		stage.mu.Lock()
+		lastError := stage.lastError
+		stage.mu.Unlock()
+		stats[i] = ProcessorStats{
+			Name:      stage.name,
+			Processed: stage.processed.Load(),
+			Errors:    stage.errors.Load(),
+			LastError: lastError,
+		}
+	}
+	return stats
+}
+
+// withTags возвращает копию события с копией тегов для изменения.
+func withTags(e *event.Event) *event.Event {
+	out := *e
+	out.Tags = make(map[string]string, len(e.Tags)+1)
+	for k, v := range e.Tags {
+		out.Tags[k] = v
+	}
+	return &out
+}
+
+func tagsAdd(tags map[string]string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		out := withTags(e)
+		for k, v := range tags {
+			out.Tags[k] = v
+		}
+		return out, nil
+	})
+}
+
+func tagsRemove(keys []string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		out := withTags(e)
+		for _, k := range keys {
+			delete(out.Tags, k)
+		}
+		if len(out.Tags) == 0 {
+			out.Tags = nil
+		}
+		return out, nil
+	})
+}
+
+func tagsLookup(field func(*event.Event) string, table map[string]map[string]string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		tags, ok := table[field(e)]
+		if !ok {
+			return e, nil
+		}
+		out := withTags(e)
+		for k, v := range tags {
+			out.Tags[k] = v
+		}
+		return out, nil
+	})
+}
+
+func typeRename(rename map[string]string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		typ, ok := rename[e.Type]
+		if !ok {
+			return e, nil
+		}
+		out := *e
+		out.Type = typ
+		return &out, nil
+	})
+}
+
+func payloadDrop(paths [][]string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		return editPayload(e, func(payload map[string]any) (bool, error) {
+			changed := false
+			for _, path := range paths {
+				if deletePath(payload, path) {
+					changed = true
+				}
+			}
+			return changed, nil
+		})
+	})
+}
+
+func payloadCopy(from, to []string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		return editPayload(e, func(payload map[string]any) (bool, error) {
+			v, ok := lookupPath(payload, from)
+			if !ok {
+				return false, nil
+			}
+			return true, setPath(payload, to, v)
+		})
+	})
+}
+
+func payloadCopyToTag(from []string, tag string) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		payload, err := decodePayload(e.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			return e, nil
+		}
+		v, ok := lookupPath(payload, from)
+		if !ok {
+			return e, nil
+		}
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			value = string(data)
+		}
+		out := withTags(e)
+		out.Tags[tag] = value
+		return out, nil
+	})
+}
+
+func payloadScale(path []string, factor, offset float64) Processor {
+	return ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+		return editPayload(e, func(payload map[string]any) (bool, error) {
+			v, ok := lookupPath(payload, path)
+			if !ok {
+				return false, nil
+			}
+			n, ok := v.(json.Number)
+			if !ok {
+				return false, fmt.Errorf("%w: payload.%s is not a number", ErrProcessorFailed, strings.Join(path, "."))
+			}
+			f, err := n.Float64()
+			if err != nil {
+				return false, fmt.Errorf("%w: payload.%s: %v", ErrProcessorFailed, strings.Join(path, "."), err)
+			}
+			return true, setPath(payload, path, f*factor+offset)
+		})
+	})
+}
+
+// eventField возвращает функцию чтения поля события для tags_lookup.
+func eventField(key string) (func(*event.Event) string, error) {
+	switch key {
+	case "runId":
+		return func(e *event.Event) string { return e.RunID }, nil
+	case "sourceId":
+		return func(e *event.Event) string { return e.SourceID }, nil
+	case "channel":
+		return func(e *event.Event) string { return e.Channel }, nil
+	case "type":
+		return func(e *event.Event) string { return e.Type }, nil
+	}
+	if tag, ok := strings.CutPrefix(key, "tags."); ok && tag != "" {
+		return func(e *event.Event) string { return e.Tags[tag] }, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidProcessor, key)
+}
+
+// payloadPath разбирает путь payload вида "a.b.c".
+func payloadPath(path string) ([]string, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: empty payload path", ErrInvalidProcessor)
+	}
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("%w: invalid payload path %q", ErrInvalidProcessor, path)
+		}
+	}
+	return keys, nil
+}
+
+// editPayload декодирует payload-объект, вызывает edit и возвращает копию
+// события с новым payload, если edit его изменил. События без payload
+// не изменяются.
+func editPayload(e *event.Event, edit func(map[string]any) (bool, error)) (*event.Event, error) {
+	payload, err := decodePayload(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return e, nil
+	}
+	changed, err := edit(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return e, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessorFailed, err)
+	}
+	out := *e
+	out.Payload = data
+	return &out, nil
+}
+
+// decodePayload декодирует payload-объект, сохраняя числа как json.Number.
+// Возвращает nil для пустого payload и null.
+func decodePayload(raw json.RawMessage) (map[string]any, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] != '{' {
+		return nil, fmt.Errorf("%w: payload is not an object", ErrProcessorFailed)
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var payload map[string]any
+	if err := d.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProcessorFailed, err)
+	}
+	return payload, nil
+}
+
+func lookupPath(m map[string]any, path []string) (any, bool) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	v, ok := m[path[len(path)-1]]
+	return v, ok
+}
+
+// setPath записывает значение, создавая недостающие объекты пути.
+func setPath(m map[string]any, path []string, v any) error {
+	for i, k := range path[:len(path)-1] {
+		next, ok := m[k]
+		if !ok || next == nil {
+			created := make(map[string]any)
+			m[k] = created
+			m = created
+			continue
+		}
+		obj, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: payload.%s is not an object", ErrProcessorFailed, strings.Join(path[:i+1], "."))
+		}
+		m = obj
+	}
+	m[path[len(path)-1]] = v
+	return nil
+}
+
+func deletePath(m map[string]any, path []string) bool {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			return false
+		}
+		m = next
+	}
+	k := path[len(path)-1]
+	if _, ok := m[k]; !ok {
+		return false
+	}
+	delete(m, k)
+	return true
+}
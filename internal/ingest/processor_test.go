@@ -0,0 +1,254 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// processorEvent возвращает событие с тегами и payload для тестов processor'ов.
+func processorEvent() *event.Event {
+	return &event.Event{
+		V:        1,
+		RunID:    "run-1",
+		SourceID: "car01",
+		Type:     "body.legacy",
+		Tags:     map[string]string{"debug": "1", "scene": "city"},
+		Payload:  json.RawMessage(`{"speed":10,"vehicle":{"id":"v-7","mass":1200},"debug":{"raw":[1,2]}}`),
+	}
+}
+
+// TestProcessors проверяет встроенные processor'ы.
+func TestProcessors(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      ProcessorConfig
+		wantType    string
+		wantTags    map[string]string
+		wantPayload string
+	}{
+		{
+			name:     "tags_add",
+			config:   ProcessorConfig{Type: ProcessorTagsAdd, Tags: map[string]string{"site": "lab1", "scene": "track"}},
+			wantTags: map[string]string{"debug": "1", "scene": "track", "site": "lab1"},
+		},
+		{
+			name:     "tags_remove",
+			config:   ProcessorConfig{Type: ProcessorTagsRemove, Keys: []string{"debug", "missing"}},
+			wantTags: map[string]string{"scene": "city"},
+		},
+		{
+			name: "tags_lookup",
+			config: ProcessorConfig{Type: ProcessorTagsLookup, Key: "sourceId", Table: map[string]map[string]string{
+				"car01": {"team": "red"},
+				"car02": {"team": "blue"},
+			}},
+			wantTags: map[string]string{"debug": "1", "scene": "city", "team": "red"},
+		},
+		{
+			name:     "type_rename",
+			config:   ProcessorConfig{Type: ProcessorTypeRename, Rename: map[string]string{"body.legacy": "body.state"}},
+			wantType: "body.state",
+		},
+		{
+			name:        "payload_drop",
+			config:      ProcessorConfig{Type: ProcessorPayloadDrop, Fields: []string{"debug", "vehicle.mass", "absent.field"}},
+			wantPayload: `{"speed":10,"vehicle":{"id":"v-7"}}`,
+		},
+		{
+			name:        "payload_copy",
+			config:      ProcessorConfig{Type: ProcessorPayloadCopy, From: "vehicle.id", To: "meta.vehicle"},
+			wantPayload: `{"debug":{"raw":[1,2]},"meta":{"vehicle":"v-7"},"speed":10,"vehicle":{"id":"v-7","mass":1200}}`,
+		},
+		{
+			name:     "payload_copy в тег",
+			config:   ProcessorConfig{Type: ProcessorPayloadCopy, From: "vehicle.mass", To: "tags.mass"},
+			wantTags: map[string]string{"debug": "1", "scene": "city", "mass": "1200"},
+		},
+		{
+			name:        "payload_scale",
+			config:      ProcessorConfig{Type: ProcessorPayloadScale, Field: "speed", Factor: 3.6},
+			wantPayload: `{"debug":{"raw":[1,2]},"speed":36,"vehicle":{"id":"v-7","mass":1200}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProcessor(tt.config)
+			if err != nil {
+				t.Fatalf("NewProcessor() вернула ошибку: %v", err)
+			}
+			in := processorEvent()
+			out, err := p.Process(in)
+			if err != nil {
+				t.Fatalf("Process() вернула ошибку: %v", err)
+			}
+
+			want := processorEvent()
+			if tt.wantType == "" {
+				tt.wantType = want.Type
+			}
+			if tt.wantTags == nil {
+				tt.wantTags = want.Tags
+			}
+			if out.Type != tt.wantType {
+				t.Errorf("Type = %q, ожидался %q", out.Type, tt.wantType)
+			}
+			if !maps.Equal(out.Tags, tt.wantTags) {
+				t.Errorf("Tags = %v, ожидались %v", out.Tags, tt.wantTags)
+			}
+			if tt.wantPayload != "" && string(out.Payload) != tt.wantPayload {
+				t.Errorf("Payload = %s, ожидался %s", out.Payload, tt.wantPayload)
+			}
+			if tt.wantPayload == "" && string(out.Payload) != string(want.Payload) {
+				t.Errorf("Payload изменён: %s", out.Payload)
+			}
+
+			// Исходное событие не изменяется
+			if in.Type != want.Type || !maps.Equal(in.Tags, want.Tags) || string(in.Payload) != string(want.Payload) {
+				t.Errorf("исходное событие изменено: %+v", in)
+			}
+		})
+	}
+}
+
+// TestProcessorChain проверяет порядок, фильтр по типам и изоляцию ошибок.
+func TestProcessorChain(t *testing.T) {
+	rename, _ := NewProcessor(ProcessorConfig{Type: ProcessorTypeRename, Rename: map[string]string{"body.legacy": "body.state"}})
+	addTags, _ := NewProcessor(ProcessorConfig{Type: ProcessorTagsAdd, Tags: map[string]string{"site": "lab1"}})
+	scale, _ := NewProcessor(ProcessorConfig{Type: ProcessorPayloadScale, Field: "vehicle", Factor: 2})
+
+	chain := newProcessorChain([]NamedProcessor{
+		{Name: "rename", Processor: rename},
+		{Name: "failing", Processor: ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+			return nil, errors.New("lookup unavailable")
+		})},
+		{Name: "panicking", Processor: ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+			panic("bug")
+		})},
+		{Name: "scale", Processor: scale},
+		// Применяется к новому типу после rename
+		{Name: "tags", Types: []string{"body.state"}, Processor: addTags},
+		{Name: "legacy only", Types: []string{"body.legacy"}, Processor: ProcessorFunc(func(e *event.Event) (*event.Event, error) {
+			return nil, errors.New("unexpected")
+		})},
+	})
+
+	out := chain.apply(processorEvent())
+	if out.Type != "body.state" || out.Tags["site"] != "lab1" {
+		t.Errorf("событие: %+v", out)
+	}
+
+	stats := chain.stats()
+	want := []struct {
+		name      string
+		processed uint64
+		errors    uint64
+		lastError string
+	}{
+		{"rename", 1, 0, ""},
+		{"failing", 1, 1, "lookup unavailable"},
+		{"panicking", 1, 1, "panic: bug"},
+		{"scale", 1, 1, "payload.vehicle is not a number"},
+		{"tags", 1, 0, ""},
+		{"legacy only", 0, 0, ""},
+	}
+	for i, w := range want {
+		s := stats[i]
+		if s.Name != w.name || s.Processed != w.processed || s.Errors != w.errors || !strings.Contains(s.LastError, w.lastError) {
+			t.Errorf("статистика %d: %+v, ожидалось %+v", i, s, w)
+		}
+	}
+}
+
+// TestLoadProcessorsFile проверяет загрузку и проверку файла processor'ов.
+func TestLoadProcessorsFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "processors.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("корректный файл", func(t *testing.T) {
+		processors, err := LoadProcessorsFile(write(t, `{"processors": [
+			{"type": "type_rename", "rename": {"body.legacy": "body.state"}},
+			{"name": "speed km/h", "type": "payload_scale", "types": ["body.state"], "field": "speed", "factor": 3.6}
+		]}`))
+		if err != nil {
+			t.Fatalf("LoadProcessorsFile() вернула ошибку: %v", err)
+		}
+		if len(processors) != 2 || processors[0].Name != "type_rename" || processors[1].Name != "speed km/h" || processors[1].Types[0] != "body.state" {
+			t.Errorf("processor'ы: %+v", processors)
+		}
+	})
+
+	invalid := []string{
+		`{"processors": [{"type": "unknown"}]}`,
+		`{"processors": [{"type": "tags_add"}]}`,
+		`{"processors": [{"type": "tags_lookup", "key": "payload.x", "table": {"a": {"b": "c"}}}]}`,
+		`{"processors": [{"type": "type_rename", "rename": {"a": ""}}]}`,
+		`{"processors": [{"type": "payload_drop", "fields": ["a..b"]}]}`,
+		`{"processors": [{"type": "payload_copy", "from": "a"}]}`,
+		`{"processors": [{"type": "payload_scale", "field": "speed"}]}`,
+	}
+	for _, content := range invalid {
+		if _, err := LoadProcessorsFile(write(t, content)); !errors.Is(err, ErrInvalidProcessor) {
+			t.Errorf("%s: ошибка %v, ожидалась ErrInvalidProcessor", content, err)
+		}
+	}
+}
+
+// TestHandler_Processors проверяет применение цепочки перед публикацией.
+func TestHandler_Processors(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	sub, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 10, Policy: eventbus.BackpressureDropNew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	processors, err := BuildProcessors([]ProcessorConfig{
+		{Type: ProcessorTypeRename, Rename: map[string]string{"body.legacy": "body.state"}},
+		{Type: ProcessorPayloadDrop, Fields: []string{"debug"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandlerWithConfig(bus, Config{Pipeline: PipelineConfig{Processors: processors}})
+
+	body := `{"v":1,"runId":"run-1","sourceId":"car01","type":"body.legacy","frameIndex":0,"simTime":0,"payload":{"speed":1,"debug":true}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleIngest(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("статус = %d (body: %q)", w.Code, w.Body.String())
+	}
+
+	events := readEvents(sub, 1, time.Second)
+	if len(events) != 1 {
+		t.Fatalf("событий: %d, ожидалось 1", len(events))
+	}
+	if e := events[0]; e.Type != "body.state" || string(e.Payload) != `{"speed":1}` {
+		t.Errorf("событие: type %q, payload %s", e.Type, e.Payload)
+	}
+
+	stats := handler.Stats().Processors
+	if len(stats) != 2 || stats[0].Processed != 1 || stats[1].Processed != 1 {
+		t.Errorf("статистика processor'ов: %+v", stats)
+	}
+}
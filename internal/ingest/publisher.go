@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/teltel/teltel/internal/auth"
+	"github.com/teltel/teltel/internal/event"
+)
+
+// defaultBatchSize - размер batch для публикации в EventBus.
+const defaultBatchSize = 100
+
+// Транспорты ingest в dead-letter записях (потоковые listener'ы
+// используют "ingest." + сеть: "ingest.tcp", "ingest.unix").
+const (
+	originHTTP      = "ingest.http"
+	originWebSocket = "ingest.websocket"
+	originUDP       = "ingest.udp"
+)
+
+// batchPublisher накапливает принятые события и публикует их
+// в EventBus пачками через PublishBatch.
+type batchPublisher struct {
+	pipeline *Pipeline
+	origin   string
+	token    *auth.Token
+	batch    []*event.Event
+	size     int
+	report   *Report
+
+	// err - первая ошибка публикации; события после неё не считаются
+	// обработанными, даже если следующие batch'и опубликованы
+	err error
+}
+
+// newBatchPublisher создаёт publisher, который ведёт учёт в report.
+// origin - транспорт ("ingest.http", "ingest.udp", ...) для dead-letter записей.
+// События принимаются только для sourceId, разрешённых token
+// (nil - аутентификация выключена).
+func newBatchPublisher(pipeline *Pipeline, origin string, token *auth.Token, size int, report *Report) *batchPublisher {
+	if size < 1 {
+		size = defaultBatchSize
+	}
+	return &batchPublisher{
+		pipeline: pipeline,
+		origin:   origin,
+		token:    token,
+		batch:    make([]*event.Event, 0, size),
+		size:     size,
+		report:   report,
+	}
+}
+
+// add принимает валидное событие исходной версии v и публикует batch
+// при достижении размера.
+// Повторы уже принятых seq и события сверх лимита учитываются в отчёте
+// и не публикуются.
+// Возвращает auth.ErrSourceForbidden, если токену не разрешён sourceId
+// события, ErrRateLimited для события сверх лимита при политике reject
+// и ошибку несоответствия схеме в режиме enforce; такое событие должно
+// быть отклонено вызывающим кодом.
+func (p *batchPublisher) add(ctx context.Context, evt *event.Event, v int) error {
+	if !p.token.AllowsSource(evt.SourceID) {
+		p.report.forbidden++
+		return auth.ErrSourceForbidden
+	}
+	switch err := p.pipeline.accept(evt, v); {
+	case errors.Is(err, errDuplicate):
+		p.report.Duplicates++
+		return nil
+	case errors.Is(err, ErrRateLimited):
+		p.report.RateLimited++
+		if p.pipeline.limiter.rejects() {
+			p.report.throttled++
+			return err
+		}
+		return nil
+	case err != nil:
+		return err
+	}
+	p.report.Accepted++
+
+	p.batch = append(p.batch, evt)
+	if len(p.batch) >= p.size {
+		// Ошибка публикации относится ко всему batch'у, а не к evt:
+		// она сохраняется в p.err и возвращается следующим flush
+		p.flush(ctx)
+	}
+	return nil
+}
+
+// reject учитывает отклонённое событие в отчёте и сохраняет его
+// в dead-letter хранилище. raw и evt - см. Pipeline.deadLetter.
+func (p *batchPublisher) reject(line int, raw []byte, evt *event.Event, err error) {
+	p.report.reject(&event.LineError{Line: line, Excerpt: event.Excerpt(string(raw)), Err: err})
+	p.pipeline.deadLetter(p.origin, line, raw, evt, err)
+}
+
+// flush публикует накопленные события. Неопубликованные события
+// учитываются в Report.Unpublished. Возвращает первую ошибку публикации
+// за время жизни publisher'а.
+func (p *batchPublisher) flush(ctx context.Context) error {
+	if len(p.batch) > 0 {
+		n, err := p.pipeline.publish(ctx, p.batch)
+		p.report.Published += n
+		if err != nil {
+			p.report.Unpublished += len(p.batch) - n
+			if p.err == nil {
+				p.err = err
+			}
+		}
+		p.batch = p.batch[:0] // очищаем, сохраняя capacity
+	}
+	return p.err
+}
+
+// pending сообщает, есть ли принятые события, ещё не переданные в EventBus.
+func (p *batchPublisher) pending() bool {
+	return len(p.batch) > 0
+}
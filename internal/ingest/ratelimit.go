@@ -0,0 +1,354 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Политики обработки событий сверх лимита.
+const (
+	// RateLimitDrop - событие отбрасывается, запрос считается успешным
+	RateLimitDrop = "drop"
+
+	// RateLimitReject - событие отклоняется (ErrRateLimited), HTTP ответ 429
+	RateLimitReject = "reject"
+)
+
+const (
+	// rateLimitIdleTTL - время, после которого неиспользуемый bucket удаляется
+	rateLimitIdleTTL = 10 * time.Minute
+
+	// rateLimitSweepInterval - период удаления неиспользуемых bucket'ов
+	rateLimitSweepInterval = time.Minute
+
+	// rateLimitCounterTTL - время, после которого счётчики неиспользуемого
+	// ключа переносятся в итог удалённых ключей
+	rateLimitCounterTTL = time.Hour
+)
+
+// ErrRateLimited - событие превысило лимит источника или run'а.
+var ErrRateLimited = errors.New("ingest: rate limit exceeded")
+
+// RateLimit - параметры token bucket.
+type RateLimit struct {
+	// Rate - событий в секунду (0 = без ограничения)
+	Rate float64 `json:"rate"`
+
+	// Burst - размер bucket'а (0 = Rate, но не меньше 1)
+	Burst int `json:"burst,omitempty"`
+}
+
+// RateLimitsConfig определяет лимиты ingest по sourceId и runId.
+// Событие должно пройти оба лимита: своего источника и своего run'а.
+//
+//	{
+//	  "policy": "reject",
+//	  "source": {"rate": 20000, "burst": 40000},
+//	  "run": {"rate": 50000},
+//	  "sources": {"flight-engine": {"rate": 100000}}
+//	}
+type RateLimitsConfig struct {
+	// Policy - "drop" (по умолчанию) или "reject"
+	Policy string `json:"policy,omitempty"`
+
+	// Source - лимит по умолчанию для каждого sourceId
+	Source RateLimit `json:"source"`
+
+	// Run - лимит по умолчанию для каждого runId
+	Run RateLimit `json:"run"`
+
+	// Sources - индивидуальные лимиты sourceId (заменяют Source)
+	Sources map[string]RateLimit `json:"sources,omitempty"`
+
+	// Runs - индивидуальные лимиты runId (заменяют Run)
+	Runs map[string]RateLimit `json:"runs,omitempty"`
+}
+
+// LoadRateLimitsFile загружает лимиты из JSON файла.
+func LoadRateLimitsFile(path string) (RateLimitsConfig, error) {
+	var config RateLimitsConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read rate limits file: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse rate limits file: %w", err)
+	}
+
+	switch config.Policy {
+	case "":
+		config.Policy = RateLimitDrop
+	case RateLimitDrop, RateLimitReject:
+	default:
+		return config, fmt.Errorf("unknown rate limit policy %q", config.Policy)
+	}
+	return config, nil
+}
+
+// LimiterStats содержит статистику одного token bucket.
+type LimiterStats struct {
+	Rate    float64 `json:"rate"`
+	Burst   int     `json:"burst"`
+	Allowed uint64  `json:"allowed"`
+	Limited uint64  `json:"limited"`
+}
+
+// EvictedLimiterStats содержит суммарные счётчики ключей, удалённых
+// из статистики после rateLimitCounterTTL без событий.
+type EvictedLimiterStats struct {
+	Keys    uint64 `json:"keys"`
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+}
+
+// RateLimitStats содержит статистику лимитов ingest.
+type RateLimitStats struct {
+	Policy string `json:"policy"`
+
+	// Sources - bucket'ы по sourceId
+	Sources map[string]LimiterStats `json:"sources"`
+
+	// Runs - bucket'ы по runId
+	Runs map[string]LimiterStats `json:"runs"`
+
+	// EvictedSources, EvictedRuns - итоги удалённых ключей
+	EvictedSources EvictedLimiterStats `json:"evictedSources"`
+	EvictedRuns    EvictedLimiterStats `json:"evictedRuns"`
+}
+
+// tokenBucket - классический token bucket.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// counters переживают удаление bucket'а при sweep
+	counters *bucketCounters
+}
+
+// bucketCounters - счётчики событий ключа.
+type bucketCounters struct {
+	allowed uint64
+	limited uint64
+
+	// last - время последнего события ключа
+	last time.Time
+}
+
+// newTokenBucket создаёт заполненный bucket, который ведёт учёт в counters.
+func newTokenBucket(limit RateLimit, counters *bucketCounters, now time.Time) *tokenBucket {
+	burst := limit.burst()
+	return &tokenBucket{
+		rate:     limit.Rate,
+		burst:    burst,
+		tokens:   burst,
+		last:     now,
+		counters: counters,
+	}
+}
+
+// burst возвращает ёмкость bucket'а: Burst, по умолчанию Rate, не меньше 1.
+func (l RateLimit) burst() float64 {
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = l.Rate
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return burst
+}
+
+// take забирает один токен, если он есть.
+func (b *tokenBucket) take(now time.Time) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	b.counters.last = now
+	if b.tokens < 1 {
+		b.counters.limited++
+		return false
+	}
+	b.tokens--
+	b.counters.allowed++
+	return true
+}
+
+// refund возвращает токен, взятый для события, которое не прошло другой лимит.
+func (b *tokenBucket) refund() {
+	b.tokens++
+	b.counters.allowed--
+}
+
+// idle сообщает, что bucket заполнен и не использовался дольше ttl.
+func (b *tokenBucket) idle(now time.Time, ttl time.Duration) bool {
+	return now.Sub(b.last) > ttl && b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// keyedLimiter - набор token bucket'ов по ключу (sourceId или runId).
+type keyedLimiter struct {
+	def       RateLimit
+	overrides map[string]RateLimit
+	buckets   map[string]*tokenBucket
+
+	// counters - счётчики по ключу; они переживают удаление bucket'а
+	// и удаляются после rateLimitCounterTTL, перенося значения в evicted,
+	// поэтому итоги статистики не уменьшаются
+	counters map[string]*bucketCounters
+	evicted  EvictedLimiterStats
+}
+
+func newKeyedLimiter(def RateLimit, overrides map[string]RateLimit) *keyedLimiter {
+	return &keyedLimiter{
+		def:       def,
+		overrides: overrides,
+		buckets:   make(map[string]*tokenBucket),
+		counters:  make(map[string]*bucketCounters),
+	}
+}
+
+// limit возвращает лимит ключа.
+func (k *keyedLimiter) limit(key string) RateLimit {
+	if limit, ok := k.overrides[key]; ok {
+		return limit
+	}
+	return k.def
+}
+
+// bucket возвращает bucket ключа или nil, если ключ не ограничен.
+func (k *keyedLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if b, ok := k.buckets[key]; ok {
+		return b
+	}
+	limit := k.limit(key)
+	if limit.Rate <= 0 {
+		return nil
+	}
+	counters, ok := k.counters[key]
+	if !ok {
+		counters = &bucketCounters{}
+		k.counters[key] = counters
+	}
+	b := newTokenBucket(limit, counters, now)
+	k.buckets[key] = b
+	return b
+}
+
+func (k *keyedLimiter) sweep(now time.Time) {
+	for key, b := range k.buckets {
+		if b.idle(now, rateLimitIdleTTL) {
+			delete(k.buckets, key)
+		}
+	}
+	for key, c := range k.counters {
+		if _, active := k.buckets[key]; active || now.Sub(c.last) <= rateLimitCounterTTL {
+			continue
+		}
+		k.evicted.Keys++
+		k.evicted.Allowed += c.allowed
+		k.evicted.Limited += c.limited
+		delete(k.counters, key)
+	}
+}
+
+func (k *keyedLimiter) stats() map[string]LimiterStats {
+	stats := make(map[string]LimiterStats, len(k.counters))
+	for key, c := range k.counters {
+		limit := k.limit(key)
+		stats[key] = LimiterStats{
+			Rate:    limit.Rate,
+			Burst:   int(limit.burst()),
+			Allowed: c.allowed,
+			Limited: c.limited,
+		}
+	}
+	return stats
+}
+
+// rateLimiter применяет лимиты по sourceId и runId.
+type rateLimiter struct {
+	policy  string
+	sources *keyedLimiter
+	runs    *keyedLimiter
+	now     func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// newRateLimiter создаёт limiter; возвращает nil, если лимиты не заданы.
+func newRateLimiter(config RateLimitsConfig) *rateLimiter {
+	if config.Source.Rate <= 0 && config.Run.Rate <= 0 && len(config.Sources) == 0 && len(config.Runs) == 0 {
+		return nil
+	}
+	if config.Policy == "" {
+		config.Policy = RateLimitDrop
+	}
+
+	return &rateLimiter{
+		policy:    config.Policy,
+		sources:   newKeyedLimiter(config.Source, config.Sources),
+		runs:      newKeyedLimiter(config.Run, config.Runs),
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+// allow сообщает, укладывается ли событие в лимиты источника и run'а.
+func (r *rateLimiter) allow(sourceID, runID string) bool {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) >= rateLimitSweepInterval {
+		r.lastSweep = now
+		r.sources.sweep(now)
+		r.runs.sweep(now)
+	}
+
+	source := r.sources.bucket(sourceID, now)
+	if source != nil && !source.take(now) {
+		return false
+	}
+	if run := r.runs.bucket(runID, now); run != nil && !run.take(now) {
+		if source != nil {
+			source.refund()
+		}
+		return false
+	}
+	return true
+}
+
+// rejects сообщает, что события сверх лимита отклоняются, а не отбрасываются.
+func (r *rateLimiter) rejects() bool {
+	return r != nil && r.policy == RateLimitReject
+}
+
+func (r *rateLimiter) stats() *RateLimitStats {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &RateLimitStats{
+		Policy:         r.policy,
+		Sources:        r.sources.stats(),
+		Runs:           r.runs.stats(),
+		EvictedSources: r.sources.evicted,
+		EvictedRuns:    r.runs.evicted,
+	}
+}
@@ -0,0 +1,263 @@
+package ingest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// TestTokenBucket проверяет пополнение и ограничение token bucket.
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	counters := &bucketCounters{}
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 5}, counters, now)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if b.take(now) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("без пополнения пропущено %d событий, ожидалось 5 (burst)", allowed)
+	}
+
+	// За 300ms при 10/s добавляется 3 токена
+	now = now.Add(300 * time.Millisecond)
+	allowed = 0
+	for i := 0; i < 10; i++ {
+		if b.take(now) {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("после 300ms пропущено %d событий, ожидалось 3", allowed)
+	}
+
+	if counters.allowed != 8 || counters.limited != 12 {
+		t.Errorf("counters = %+v, ожидалось allowed=8 limited=12", *counters)
+	}
+}
+
+// TestRateLimiter проверяет лимиты по sourceId и runId.
+func TestRateLimiter(t *testing.T) {
+	t.Run("лимиты не заданы → limiter не создаётся", func(t *testing.T) {
+		if newRateLimiter(RateLimitsConfig{Policy: RateLimitReject}) != nil {
+			t.Error("ожидался nil limiter")
+		}
+	})
+
+	t.Run("источники ограничиваются независимо, индивидуальный лимит заменяет общий", func(t *testing.T) {
+		r := newRateLimiter(RateLimitsConfig{
+			Source:  RateLimit{Rate: 1, Burst: 2},
+			Sources: map[string]RateLimit{"fast": {Rate: 1, Burst: 5}},
+		})
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		count := func(source, run string) int {
+			n := 0
+			for i := 0; i < 10; i++ {
+				if r.allow(source, run) {
+					n++
+				}
+			}
+			return n
+		}
+		if got := count("runaway", "run-1"); got != 2 {
+			t.Errorf("runaway: пропущено %d, ожидалось 2", got)
+		}
+		if got := count("other", "run-1"); got != 2 {
+			t.Errorf("other: пропущено %d, ожидалось 2", got)
+		}
+		if got := count("fast", "run-2"); got != 5 {
+			t.Errorf("fast: пропущено %d, ожидалось 5", got)
+		}
+
+		stats := r.stats()
+		if stats.Policy != RateLimitDrop || stats.Sources["runaway"].Limited != 8 {
+			t.Errorf("stats = %+v", stats)
+		}
+		if len(stats.Runs) != 0 {
+			t.Errorf("лимит run'ов не задан, bucket'ов быть не должно: %v", stats.Runs)
+		}
+	})
+
+	t.Run("отказ по лимиту run'а возвращает токен источника", func(t *testing.T) {
+		r := newRateLimiter(RateLimitsConfig{
+			Source: RateLimit{Rate: 1, Burst: 3},
+			Runs:   map[string]RateLimit{"run-1": {Rate: 1, Burst: 1}},
+		})
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		r.allow("s", "run-1")
+		if r.allow("s", "run-1") {
+			t.Fatal("лимит run-1 должен быть исчерпан")
+		}
+		if !r.allow("s", "run-2") || !r.allow("s", "run-2") {
+			t.Error("токены источника не должны тратиться на события, отклонённые лимитом run'а")
+		}
+	})
+
+	t.Run("неиспользуемые bucket'ы удаляются, счётчики сохраняются", func(t *testing.T) {
+		r := newRateLimiter(RateLimitsConfig{Source: RateLimit{Rate: 100, Burst: 1}})
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		r.allow("old", "run-1")
+		r.allow("old", "run-1")
+		now = now.Add(rateLimitIdleTTL + time.Minute)
+		r.allow("new", "run-1")
+
+		if _, ok := r.sources.buckets["old"]; ok {
+			t.Error("bucket old должен быть удалён")
+		}
+		if _, ok := r.sources.buckets["new"]; !ok {
+			t.Error("bucket new должен сохраниться")
+		}
+		stats := r.stats()
+		if s := stats.Sources["old"]; s.Allowed != 1 || s.Limited != 1 || s.Rate != 100 || s.Burst != 1 {
+			t.Errorf("статистика old после удаления bucket'а: %+v", s)
+		}
+
+		// Новый bucket продолжает счётчики ключа
+		now = now.Add(time.Second)
+		r.allow("old", "run-1")
+		if s := r.stats().Sources["old"]; s.Allowed != 2 || s.Limited != 1 {
+			t.Errorf("статистика old: %+v", s)
+		}
+	})
+
+	t.Run("счётчики неиспользуемых ключей переносятся в итог удалённых", func(t *testing.T) {
+		r := newRateLimiter(RateLimitsConfig{Source: RateLimit{Rate: 100, Burst: 1}, Run: RateLimit{Rate: 100}})
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		r.allow("old", "run-1")
+		r.allow("old", "run-1")
+		now = now.Add(rateLimitIdleTTL + time.Minute)
+		r.allow("new", "run-2")
+
+		// Bucket удалён, счётчики ещё в статистике
+		if _, ok := r.stats().Sources["old"]; !ok {
+			t.Fatal("счётчики old должны сохраниться до rateLimitCounterTTL")
+		}
+
+		now = now.Add(rateLimitCounterTTL)
+		r.allow("new", "run-2")
+
+		stats := r.stats()
+		if _, ok := stats.Sources["old"]; ok {
+			t.Error("счётчики old должны быть удалены")
+		}
+		if _, ok := stats.Runs["run-1"]; ok {
+			t.Error("счётчики run-1 должны быть удалены")
+		}
+		if stats.EvictedSources != (EvictedLimiterStats{Keys: 1, Allowed: 1, Limited: 1}) {
+			t.Errorf("EvictedSources = %+v", stats.EvictedSources)
+		}
+		if stats.EvictedRuns != (EvictedLimiterStats{Keys: 1, Allowed: 1}) {
+			t.Errorf("EvictedRuns = %+v", stats.EvictedRuns)
+		}
+		if s := stats.Sources["new"]; s.Allowed != 2 {
+			t.Errorf("статистика new: %+v", s)
+		}
+	})
+}
+
+// TestLoadRateLimitsFile проверяет загрузку лимитов из файла.
+func TestLoadRateLimitsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "limits.json")
+	os.WriteFile(path, []byte(`{"source":{"rate":100},"sources":{"flight-engine":{"rate":1000,"burst":2000}}}`), 0o600)
+	config, err := LoadRateLimitsFile(path)
+	if err != nil {
+		t.Fatalf("LoadRateLimitsFile() вернула ошибку: %v", err)
+	}
+	if config.Policy != RateLimitDrop || config.Sources["flight-engine"].Burst != 2000 {
+		t.Errorf("config = %+v", config)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"policy":"queue"}`), 0o600)
+	if _, err := LoadRateLimitsFile(bad); err == nil {
+		t.Error("ожидалась ошибка для неизвестной политики")
+	}
+}
+
+// TestHandler_RateLimit проверяет политики drop и reject в HTTP ingest.
+func TestHandler_RateLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, `{"v":1,"runId":"run-1","sourceId":"runaway","frameIndex":%d,"simTime":0}`+"\n", i)
+	}
+	body := b.String()
+
+	tests := []struct {
+		policy     string
+		wantStatus int
+		wantRej    int
+	}{
+		{RateLimitDrop, http.StatusAccepted, 0},
+		{RateLimitReject, http.StatusMultiStatus, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			bus := eventbus.New()
+			defer bus.Close()
+
+			handler := NewHandlerWithConfig(bus, Config{
+				Pipeline: PipelineConfig{
+					RateLimits: RateLimitsConfig{
+						Policy: tt.policy,
+						Source: RateLimit{Rate: 0.001, Burst: 4},
+					},
+				},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.HandleIngest(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("статус = %d, ожидался %d", w.Code, tt.wantStatus)
+			}
+			report := decodeReport(t, w)
+			if report.Accepted != 4 || report.Published != 4 || report.RateLimited != 6 || report.Rejected != tt.wantRej {
+				t.Errorf("отчёт: %+v", report)
+			}
+			if tt.wantRej > 0 && report.Errors[0].Code != "ErrRateLimited" {
+				t.Errorf("код ошибки = %q, ожидался ErrRateLimited", report.Errors[0].Code)
+			}
+
+			stats := handler.Stats().RateLimits
+			if stats == nil || stats.Sources["runaway"].Limited != 6 {
+				t.Errorf("Stats().RateLimits = %+v", stats)
+			}
+
+			if tt.policy != RateLimitReject {
+				return
+			}
+			// Лимит исчерпан: ни одно событие не принято → 429
+			req = httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+			w = httptest.NewRecorder()
+			handler.HandleIngest(w, req)
+			if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+				t.Errorf("статус = %d, Retry-After = %q, ожидался 429 с Retry-After", w.Code, w.Header().Get("Retry-After"))
+			}
+			if report := decodeReport(t, w); report.Accepted != 0 || report.Rejected != 10 {
+				t.Errorf("отчёт: %+v", report)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"errors"
+
+	"github.com/teltel/teltel/internal/auth"
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/schema"
+)
+
+// maxReportedErrors - максимальное количество ошибок строк в одном отчёте.
+// Остальные ошибки учитываются только в счётчике Rejected.
+const maxReportedErrors = 100
+
+// LineError описывает отклонённую строку в отчёте ingest.
+type LineError struct {
+	Line    int    `json:"line"`
+	Code    string `json:"code"`
+	Error   string `json:"error"`
+	Excerpt string `json:"excerpt"`
+}
+
+// Report - структурированный результат обработки ingest запроса.
+type Report struct {
+	// Accepted - количество строк, успешно прошедших парсинг и валидацию
+	Accepted int `json:"accepted"`
+
+	// Rejected - количество отклонённых строк
+	Rejected int `json:"rejected"`
+
+	// Published - количество событий, опубликованных в EventBus
+	Published int `json:"published"`
+
+	// Unpublished - количество принятых событий, которые не удалось
+	// опубликовать (EventBus закрыт или запрос прерван); их можно
+	// отправить повторно
+	Unpublished int `json:"unpublished,omitempty"`
+
+	// Duplicates - количество повторов уже принятых seq (не публикуются
+	// и не считаются ошибкой)
+	Duplicates int `json:"duplicates"`
+
+	// RateLimited - количество событий сверх лимита источника или run'а
+	// (при политике reject они также входят в Rejected)
+	RateLimited int `json:"rateLimited,omitempty"`
+
+	// Errors - детали по отклонённым строкам (не более maxReportedErrors)
+	Errors []LineError `json:"errors"`
+
+	// ErrorsTruncated - true, если список Errors был усечён
+	ErrorsTruncated bool `json:"errorsTruncated,omitempty"`
+
+	// forbidden - количество событий с sourceId, не разрешённым токену
+	forbidden int
+
+	// throttled - количество событий, отклонённых по лимиту (политика reject)
+	throttled int
+}
+
+// newReport создаёт пустой отчёт.
+func newReport() *Report {
+	return &Report{
+		Errors: make([]LineError, 0),
+	}
+}
+
+// reject учитывает отклонённую строку.
+func (r *Report) reject(le *event.LineError) {
+	r.Rejected++
+	if len(r.Errors) >= maxReportedErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, LineError{
+		Line:    le.Line,
+		Code:    errorCode(le.Err),
+		Error:   le.Err.Error(),
+		Excerpt: le.Excerpt,
+	})
+}
+
+// errorCode возвращает машиночитаемый код ошибки строки.
+func errorCode(err error) string {
+	if errors.Is(err, auth.ErrSourceForbidden) {
+		return "ErrSourceForbidden"
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return "ErrRateLimited"
+	}
+	if errors.Is(err, ErrLineTooLong) {
+		return "ErrLineTooLong"
+	}
+	if errors.Is(err, errDecompressedTooLarge) {
+		return "ErrBodyTooLarge"
+	}
+	if errors.Is(err, errReadBody) {
+		return "ErrReadBody"
+	}
+	if errors.Is(err, schema.ErrViolation) {
+		return "ErrSchemaViolation"
+	}
+	return event.ErrorCode(err)
+}
@@ -0,0 +1,100 @@
+package ingest
+
+import (
+	"sync"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/schema"
+)
+
+// SchemaStats содержит статистику проверки payload по реестру схем.
+type SchemaStats struct {
+	// Mode - "warn" или "enforce"
+	Mode schema.Mode `json:"mode"`
+
+	// Validated - количество событий, для которых нашлась схема
+	Validated uint64 `json:"validated"`
+
+	// Violations - несоответствия схеме по type события
+	Violations map[string]TypeViolations `json:"violations"`
+}
+
+// TypeViolations - несоответствия схеме для одного type.
+type TypeViolations struct {
+	Count uint64 `json:"count"`
+
+	// LastSourceID и LastError описывают последнее несоответствие
+	LastSourceID string `json:"lastSourceId"`
+	LastError    string `json:"lastError"`
+}
+
+// schemaValidator проверяет payload событий по реестру схем.
+type schemaValidator struct {
+	registry *schema.Registry
+
+	mu         sync.Mutex
+	validated  uint64
+	violations map[string]*TypeViolations
+}
+
+// newSchemaValidator создаёт validator; возвращает nil, если реестр не задан.
+func newSchemaValidator(registry *schema.Registry) *schemaValidator {
+	if registry == nil {
+		return nil
+	}
+	return &schemaValidator{
+		registry:   registry,
+		violations: make(map[string]*TypeViolations),
+	}
+}
+
+// check проверяет payload события по схеме (sourceId, type, version),
+// где version - версия события, отправленная источником (до приведения
+// к канонической). Проверяется payload в той же версии, до upgrade'ов.
+// События без зарегистрированной схемы принимаются.
+// Возвращает ошибку несоответствия только в режиме enforce.
+func (v *schemaValidator) check(evt *event.Event, version int) error {
+	s := v.registry.Lookup(evt.SourceID, evt.Type, version)
+	if s == nil {
+		return nil
+	}
+	err := s.Validate(evt.SourcePayload())
+
+	v.mu.Lock()
+	v.validated++
+	if err != nil {
+		tv, ok := v.violations[evt.Type]
+		if !ok {
+			tv = &TypeViolations{}
+			v.violations[evt.Type] = tv
+		}
+		tv.Count++
+		tv.LastSourceID = evt.SourceID
+		tv.LastError = err.Error()
+	}
+	v.mu.Unlock()
+
+	if err != nil && v.registry.Mode() == schema.ModeEnforce {
+		return err
+	}
+	return nil
+}
+
+func (v *schemaValidator) stats() *SchemaStats {
+	if v == nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	violations := make(map[string]TypeViolations, len(v.violations))
+	for typ, tv := range v.violations {
+		violations[typ] = *tv
+	}
+	return &SchemaStats{
+		Mode:       v.registry.Mode(),
+		Validated:  v.validated,
+		Violations: violations,
+	}
+}
@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/schema"
+)
+
+// TestHandler_Schema проверяет проверку payload по реестру схем.
+func TestHandler_Schema(t *testing.T) {
+	const valid = `{"v":1,"runId":"run-1","sourceId":"source-1","type":"body.state","frameIndex":0,"simTime":0,"payload":{"pos":{"x":1}}}`
+	const invalid = `{"v":1,"runId":"run-1","sourceId":"source-1","type":"body.state","frameIndex":1,"simTime":0,"payload":{"pos":{"x":"1"}}}`
+	const unregistered = `{"v":1,"runId":"run-1","sourceId":"source-1","type":"log","frameIndex":2,"simTime":0,"payload":"text"}`
+	body := valid + "\n" + invalid + "\n" + unregistered
+
+	tests := []struct {
+		mode       schema.Mode
+		wantStatus int
+		wantAcc    int
+	}{
+		{schema.ModeWarn, http.StatusAccepted, 3},
+		{schema.ModeEnforce, http.StatusAccepted, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			bus := eventbus.New()
+			defer bus.Close()
+
+			registry, err := schema.New(schema.FileConfig{
+				Mode: tt.mode,
+				Schemas: []schema.Entry{{
+					SourceID: schema.AnySource,
+					Type:     "body.state",
+					V:        1,
+					Schema:   json.RawMessage(`{"type":"object","properties":{"pos":{"properties":{"x":{"type":"number"}}}}}`),
+				}},
+			})
+			if err != nil {
+				t.Fatalf("schema.New() вернула ошибку: %v", err)
+			}
+
+			handler := NewHandlerWithConfig(bus, Config{Pipeline: PipelineConfig{Schemas: registry}})
+			req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.HandleIngest(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("статус = %d, ожидался %d (body: %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			report := decodeReport(t, w)
+			if report.Accepted != tt.wantAcc {
+				t.Errorf("Accepted = %d, ожидалось %d", report.Accepted, tt.wantAcc)
+			}
+			if tt.mode == schema.ModeEnforce {
+				if len(report.Errors) != 1 || report.Errors[0].Code != "ErrSchemaViolation" || report.Errors[0].Line != 2 {
+					t.Errorf("ошибки: %+v", report.Errors)
+				}
+			}
+
+			stats := handler.Stats().Schemas
+			if stats == nil || stats.Mode != tt.mode || stats.Validated != 2 {
+				t.Fatalf("статистика схем: %+v", stats)
+			}
+			v := stats.Violations["body.state"]
+			if v.Count != 1 || v.LastSourceID != "source-1" || !strings.Contains(v.LastError, "pos.x") {
+				t.Errorf("несоответствия body.state: %+v", v)
+			}
+		})
+	}
+
+	t.Run("payload проверяется в версии источника до миграции", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		registry, err := schema.New(schema.FileConfig{
+			Mode: schema.ModeEnforce,
+			Schemas: []schema.Entry{{
+				SourceID: schema.AnySource,
+				Type:     "body.state",
+				V:        1,
+				Schema:   json.RawMessage(`{"type":"object","required":["pos"],"properties":{"pos":{"properties":{"x":{"type":"number"}}}}}`),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("schema.New() вернула ошибку: %v", err)
+		}
+		// Upgrade v1 → v2 переименовывает pos в position
+		migrator := event.NewMigrator(2)
+		migrator.Register(1, func(raw event.RawEvent) error {
+			var payload map[string]json.RawMessage
+			if err := json.Unmarshal(raw["payload"], &payload); err != nil {
+				return err
+			}
+			payload["position"] = payload["pos"]
+			delete(payload, "pos")
+			data, err := json.Marshal(payload)
+			raw["payload"] = data
+			return err
+		})
+
+		// События v1 проверяются по схеме v1 до upgrade'а, событие v2 схемы не имеет
+		body := `{"v":1,"runId":"run-1","sourceId":"source-1","type":"body.state","payload":{"pos":{"x":1}}}` + "\n" +
+			`{"v":1,"runId":"run-1","sourceId":"source-1","type":"body.state","payload":{"pos":{"x":"1"}}}` + "\n" +
+			`{"v":2,"runId":"run-1","sourceId":"source-1","type":"body.state","payload":{"pos":{"x":"1"}}}`
+		handler := NewHandlerWithConfig(bus, Config{Pipeline: PipelineConfig{Schemas: registry, Migrator: migrator}})
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.HandleIngest(w, req)
+
+		report := decodeReport(t, w)
+		if report.Accepted != 2 || len(report.Errors) != 1 || report.Errors[0].Code != "ErrSchemaViolation" || report.Errors[0].Line != 2 {
+			t.Errorf("отчёт: %+v", report)
+		}
+	})
+
+	t.Run("без реестра статистика не отдаётся", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		handler := NewHandler(bus)
+		if stats := handler.Stats().Schemas; stats != nil {
+			t.Errorf("Schemas = %+v, ожидался nil", stats)
+		}
+	})
+}
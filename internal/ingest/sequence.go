@@ -0,0 +1,352 @@
+package ingest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDedupWindow - размер окна дедупликации по seq по умолчанию
+	DefaultDedupWindow = 4096
+
+	// defaultSequenceTTL - время хранения состояния неактивного источника
+	defaultSequenceTTL = time.Hour
+
+	// sequenceSweepInterval - период удаления состояний неактивных источников
+	sequenceSweepInterval = time.Minute
+
+	// maxTrackedGaps - максимальное количество хранимых диапазонов пропусков
+	// на источник; при переполнении отбрасываются самые старые
+	maxTrackedGaps = 100
+)
+
+// SeqRange - диапазон пропущенных номеров seq (включительно).
+type SeqRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// SourceSequence содержит состояние seq одного источника в run'е.
+type SourceSequence struct {
+	SourceID string `json:"sourceId"`
+
+	// LastSeq - наибольший полученный seq
+	LastSeq uint64 `json:"lastSeq"`
+
+	// Received - количество принятых событий с seq (без дубликатов)
+	Received uint64 `json:"received"`
+
+	// Duplicates - количество отброшенных повторов
+	Duplicates uint64 `json:"duplicates"`
+
+	// Missing - количество номеров seq, которые так и не были получены
+	Missing uint64 `json:"missing"`
+
+	// Gaps - незаполненные диапазоны пропусков (не более maxTrackedGaps)
+	Gaps []SeqRange `json:"gaps"`
+
+	// GapsTruncated - true, если старые диапазоны были отброшены
+	GapsTruncated bool `json:"gapsTruncated,omitempty"`
+}
+
+// SequenceStats содержит общую статистику дедупликации.
+type SequenceStats struct {
+	// Sources - количество отслеживаемых пар (runId, sourceId)
+	Sources int `json:"sources"`
+
+	// Duplicates - количество отброшенных повторов
+	Duplicates uint64 `json:"duplicates"`
+
+	// Missing - суммарное количество пропущенных номеров seq
+	Missing uint64 `json:"missing"`
+}
+
+// seqState - состояние seq одного источника.
+// Окно последних window номеров хранится кольцевым битовым множеством:
+// бит seq%window установлен, если seq получен. Номера за пределами окна
+// считаются полученными, если не попадают в известный пропуск и не могли
+// попасть в отброшенный (не больше truncatedTo).
+type seqState struct {
+	first uint64
+	last  uint64
+	seen  []uint64
+
+	received      uint64
+	duplicates    uint64
+	missing       uint64
+	gaps          []SeqRange
+	gapsTruncated bool
+	truncatedTo   uint64
+
+	lastSeen time.Time
+}
+
+// sequenceTracker отслеживает seq по (runId, sourceId): отбрасывает
+// повторы в пределах окна и ведёт учёт пропущенных диапазонов.
+type sequenceTracker struct {
+	window uint64
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	runs       map[string]map[string]*seqState
+	lastSweep  time.Time
+	duplicates uint64
+}
+
+// newSequenceTracker создаёт tracker с окном window номеров.
+func newSequenceTracker(window int, ttl time.Duration) *sequenceTracker {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	// Окно кратно 64, чтобы битовое множество не имело хвоста
+	window = (window + 63) &^ 63
+	if ttl <= 0 {
+		ttl = defaultSequenceTTL
+	}
+
+	return &sequenceTracker{
+		window:    uint64(window),
+		ttl:       ttl,
+		now:       time.Now,
+		runs:      make(map[string]map[string]*seqState),
+		lastSweep: time.Now(),
+	}
+}
+
+// observe учитывает seq события. Возвращает true, если событие - повтор
+// и не должно публиковаться.
+func (t *sequenceTracker) observe(runID, sourceID string, seq uint64) bool {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= sequenceSweepInterval {
+		t.sweep(now)
+	}
+
+	sources := t.runs[runID]
+	if sources == nil {
+		sources = make(map[string]*seqState)
+		t.runs[runID] = sources
+	}
+	st := sources[sourceID]
+	if st == nil {
+		// Первый seq источника - точка отсчёта, пропусков до него не знаем
+		st = &seqState{
+			first: seq,
+			last:  seq,
+			seen:  make([]uint64, t.window/64),
+		}
+		sources[sourceID] = st
+		st.mark(seq, t.window)
+		st.received++
+		st.lastSeen = now
+		return false
+	}
+	st.lastSeen = now
+
+	switch {
+	case seq > st.last:
+		if seq-st.last > 1 {
+			st.addGap(SeqRange{From: st.last + 1, To: seq - 1})
+			st.missing += seq - st.last - 1
+		}
+		st.advance(seq, t.window)
+
+	case st.last-seq < t.window:
+		if st.isMarked(seq, t.window) {
+			st.duplicates++
+			t.duplicates++
+			return true
+		}
+		st.mark(seq, t.window)
+		if st.fillGap(seq) {
+			st.missing--
+		}
+
+	default:
+		// За пределами окна: повтор, если seq не попадает в известный пропуск.
+		// Номер из отброшенного пропуска проверить нельзя, он принимается
+		// (missing не уменьшается: номер мог быть и повтором)
+		switch {
+		case st.fillGap(seq):
+			st.missing--
+		case seq >= st.first && !(st.gapsTruncated && seq <= st.truncatedTo):
+			st.duplicates++
+			t.duplicates++
+			return true
+		}
+	}
+
+	st.received++
+	return false
+}
+
+// forget отменяет учёт seq, принятого observe, если событие так и не было
+// опубликовано: номер снова считается пропущенным, и повторная отправка
+// события клиентом не отбрасывается как дубликат.
+func (t *sequenceTracker) forget(runID, sourceID string, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := t.runs[runID][sourceID]
+	if st == nil {
+		return
+	}
+	if st.last-seq < t.window {
+		st.unmark(seq, t.window)
+	}
+	st.insertGap(seq)
+	st.missing++
+	st.received--
+}
+
+// sweep удаляет состояния источников, неактивных дольше ttl.
+func (t *sequenceTracker) sweep(now time.Time) {
+	t.lastSweep = now
+	for runID, sources := range t.runs {
+		for sourceID, st := range sources {
+			if now.Sub(st.lastSeen) > t.ttl {
+				delete(sources, sourceID)
+			}
+		}
+		if len(sources) == 0 {
+			delete(t.runs, runID)
+		}
+	}
+}
+
+// run возвращает состояние seq всех источников run'а, отсортированное по sourceId.
+func (t *sequenceTracker) run(runID string) []SourceSequence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sources := t.runs[runID]
+	if len(sources) == 0 {
+		return nil
+	}
+
+	result := make([]SourceSequence, 0, len(sources))
+	for sourceID, st := range sources {
+		gaps := make([]SeqRange, len(st.gaps))
+		copy(gaps, st.gaps)
+		result = append(result, SourceSequence{
+			SourceID:      sourceID,
+			LastSeq:       st.last,
+			Received:      st.received,
+			Duplicates:    st.duplicates,
+			Missing:       st.missing,
+			Gaps:          gaps,
+			GapsTruncated: st.gapsTruncated,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SourceID < result[j].SourceID
+	})
+	return result
+}
+
+// stats возвращает общую статистику.
+func (t *sequenceTracker) stats() SequenceStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := SequenceStats{Duplicates: t.duplicates}
+	for _, sources := range t.runs {
+		stats.Sources += len(sources)
+		for _, st := range sources {
+			stats.Missing += st.missing
+		}
+	}
+	return stats
+}
+
+// advance сдвигает окно до seq, очищая биты номеров, вышедших из окна.
+func (st *seqState) advance(seq, window uint64) {
+	if seq-st.last >= window {
+		clear(st.seen)
+	} else {
+		for s := st.last + 1; s < seq; s++ {
+			st.unmark(s, window)
+		}
+	}
+	st.mark(seq, window)
+	st.last = seq
+}
+
+func (st *seqState) mark(seq, window uint64) {
+	i := seq % window
+	st.seen[i/64] |= 1 << (i % 64)
+}
+
+func (st *seqState) unmark(seq, window uint64) {
+	i := seq % window
+	st.seen[i/64] &^= 1 << (i % 64)
+}
+
+func (st *seqState) isMarked(seq, window uint64) bool {
+	i := seq % window
+	return st.seen[i/64]&(1<<(i%64)) != 0
+}
+
+// addGap добавляет новый пропуск; пропуски упорядочены по возрастанию.
+func (st *seqState) addGap(r SeqRange) {
+	st.gaps = append(st.gaps, r)
+	if len(st.gaps) > maxTrackedGaps {
+		st.truncateGaps()
+	}
+}
+
+// insertGap добавляет пропуск из одного номера seq, сохраняя порядок
+// пропусков. seq не должен входить в другой пропуск.
+func (st *seqState) insertGap(seq uint64) {
+	i := sort.Search(len(st.gaps), func(i int) bool {
+		return st.gaps[i].From > seq
+	})
+	st.gaps = append(st.gaps, SeqRange{})
+	copy(st.gaps[i+1:], st.gaps[i:])
+	st.gaps[i] = SeqRange{From: seq, To: seq}
+	if len(st.gaps) > maxTrackedGaps {
+		st.truncateGaps()
+	}
+}
+
+// truncateGaps отбрасывает самый старый пропуск и запоминает его конец.
+func (st *seqState) truncateGaps() {
+	st.truncatedTo = max(st.truncatedTo, st.gaps[0].To)
+	st.gaps = st.gaps[1:]
+	st.gapsTruncated = true
+}
+
+// fillGap убирает seq из пропуска, если он туда попадает.
+func (st *seqState) fillGap(seq uint64) bool {
+	i := sort.Search(len(st.gaps), func(i int) bool {
+		return st.gaps[i].To >= seq
+	})
+	if i == len(st.gaps) || st.gaps[i].From > seq {
+		return false
+	}
+
+	g := st.gaps[i]
+	switch {
+	case g.From == g.To:
+		st.gaps = append(st.gaps[:i], st.gaps[i+1:]...)
+	case seq == g.From:
+		st.gaps[i].From++
+	case seq == g.To:
+		st.gaps[i].To--
+	default:
+		// Разбиваем пропуск на два
+		st.gaps[i].To = seq - 1
+		st.gaps = append(st.gaps, SeqRange{})
+		copy(st.gaps[i+2:], st.gaps[i+1:])
+		st.gaps[i+1] = SeqRange{From: seq + 1, To: g.To}
+		if len(st.gaps) > maxTrackedGaps {
+			st.truncateGaps()
+		}
+	}
+	return true
+}
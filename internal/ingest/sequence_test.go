@@ -0,0 +1,291 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// observeAll передаёт tracker'у последовательность seq и возвращает
+// номера, признанные повторами.
+func observeAll(tr *sequenceTracker, seqs ...uint64) []uint64 {
+	var dups []uint64
+	for _, seq := range seqs {
+		if tr.observe("run-1", "engine", seq) {
+			dups = append(dups, seq)
+		}
+	}
+	return dups
+}
+
+// TestSequenceTracker проверяет дедупликацию и учёт пропусков seq.
+func TestSequenceTracker(t *testing.T) {
+	t.Run("повторы в пределах окна отбрасываются", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		dups := observeAll(tr, 1, 2, 3, 2, 3, 4, 1)
+		if !reflect.DeepEqual(dups, []uint64{2, 3, 1}) {
+			t.Errorf("повторы = %v, ожидалось [2 3 1]", dups)
+		}
+
+		seqs := tr.run("run-1")
+		if len(seqs) != 1 {
+			t.Fatalf("ожидался 1 источник, получено %d", len(seqs))
+		}
+		if seqs[0].Received != 4 || seqs[0].Duplicates != 3 || seqs[0].LastSeq != 4 {
+			t.Errorf("получено %+v", seqs[0])
+		}
+	})
+
+	t.Run("пропуски фиксируются диапазонами и заполняются опоздавшими событиями", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		observeAll(tr, 0, 1, 5, 6, 10)
+
+		s := tr.run("run-1")[0]
+		want := []SeqRange{{From: 2, To: 4}, {From: 7, To: 9}}
+		if !reflect.DeepEqual(s.Gaps, want) || s.Missing != 6 {
+			t.Fatalf("gaps = %v, missing = %d; ожидалось %v, 6", s.Gaps, s.Missing, want)
+		}
+
+		// Заполнение середины пропуска разбивает его на два
+		if dups := observeAll(tr, 3, 7, 9); dups != nil {
+			t.Fatalf("опоздавшие события не должны считаться повторами: %v", dups)
+		}
+		s = tr.run("run-1")[0]
+		want = []SeqRange{{From: 2, To: 2}, {From: 4, To: 4}, {From: 8, To: 8}}
+		if !reflect.DeepEqual(s.Gaps, want) || s.Missing != 3 {
+			t.Errorf("gaps = %v, missing = %d; ожидалось %v, 3", s.Gaps, s.Missing, want)
+		}
+
+		// Повтор опоздавшего события - дубликат
+		if dups := observeAll(tr, 3); len(dups) != 1 {
+			t.Errorf("повтор seq=3 должен быть отброшен")
+		}
+	})
+
+	t.Run("за пределами окна проверяются только известные пропуски", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		observeAll(tr, 100, 102)
+		for seq := uint64(103); seq < 400; seq++ {
+			observeAll(tr, seq)
+		}
+
+		if dups := observeAll(tr, 100); len(dups) != 1 {
+			t.Errorf("старый принятый seq должен считаться повтором")
+		}
+		if dups := observeAll(tr, 101); dups != nil {
+			t.Errorf("seq из известного пропуска должен быть принят")
+		}
+		if dups := observeAll(tr, 50); dups != nil {
+			t.Errorf("seq меньше первого полученного должен быть принят")
+		}
+		if s := tr.run("run-1")[0]; s.Missing != 0 || len(s.Gaps) != 0 {
+			t.Errorf("пропусков не должно остаться: %+v", s)
+		}
+	})
+
+	t.Run("скачок больше окна", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		observeAll(tr, 1, 2, 1000)
+		if dups := observeAll(tr, 2, 1000); len(dups) != 2 {
+			t.Errorf("повторы = %v, ожидалось [2 1000]", dups)
+		}
+		if s := tr.run("run-1")[0]; s.Missing != 997 {
+			t.Errorf("missing = %d, ожидалось 997", s.Missing)
+		}
+	})
+
+	t.Run("количество хранимых пропусков ограничено", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		for i := uint64(0); i <= maxTrackedGaps+10; i++ {
+			observeAll(tr, i*2)
+		}
+		s := tr.run("run-1")[0]
+		if len(s.Gaps) != maxTrackedGaps || !s.GapsTruncated {
+			t.Errorf("len(gaps) = %d, truncated = %v", len(s.Gaps), s.GapsTruncated)
+		}
+		if s.Missing != maxTrackedGaps+10 {
+			t.Errorf("missing = %d, ожидалось %d", s.Missing, maxTrackedGaps+10)
+		}
+
+		// Номера до конца отброшенных пропусков (19) принимаются: опоздавшие
+		// события не теряются, а повтор 18 отличить от них нельзя.
+		// Полученные номера после них за пределами окна - повторы
+		if dups := observeAll(tr, 1, 19, 18, 20, 150); len(dups) != 2 || dups[0] != 20 || dups[1] != 150 {
+			t.Errorf("повторы: %v, ожидалось [20 150]", dups)
+		}
+	})
+
+	t.Run("источники и run'ы независимы", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		tr.observe("run-1", "a", 1)
+		if tr.observe("run-1", "b", 1) || tr.observe("run-2", "a", 1) {
+			t.Error("одинаковый seq разных источников не должен считаться повтором")
+		}
+		if got := len(tr.run("run-1")); got != 2 {
+			t.Errorf("run-1: ожидалось 2 источника, получено %d", got)
+		}
+		if stats := tr.stats(); stats.Sources != 3 {
+			t.Errorf("stats.Sources = %d, ожидалось 3", stats.Sources)
+		}
+	})
+
+	t.Run("forget возвращает номер в пропуски", func(t *testing.T) {
+		tr := newSequenceTracker(64, 0)
+		observeAll(tr, 1, 2, 3, 4)
+		tr.forget("run-1", "engine", 4)
+		tr.forget("run-1", "engine", 2)
+
+		s := tr.run("run-1")[0]
+		want := []SeqRange{{From: 2, To: 2}, {From: 4, To: 4}}
+		if !reflect.DeepEqual(s.Gaps, want) || s.Missing != 2 || s.Received != 2 {
+			t.Fatalf("gaps = %v, missing = %d, received = %d", s.Gaps, s.Missing, s.Received)
+		}
+		if dups := observeAll(tr, 4, 2, 4); !reflect.DeepEqual(dups, []uint64{4}) {
+			t.Errorf("повторы = %v, ожидалось [4]", dups)
+		}
+		if s := tr.run("run-1")[0]; len(s.Gaps) != 0 || s.Missing != 0 || s.Received != 4 {
+			t.Errorf("получено %+v", s)
+		}
+	})
+
+	t.Run("неактивные источники удаляются по TTL", func(t *testing.T) {
+		tr := newSequenceTracker(64, time.Minute)
+		now := time.Now()
+		tr.now = func() time.Time { return now }
+		tr.observe("run-1", "a", 1)
+
+		now = now.Add(2 * time.Minute)
+		tr.observe("run-2", "a", 1)
+
+		if tr.run("run-1") != nil {
+			t.Error("состояние run-1 должно быть удалено")
+		}
+		if tr.run("run-2") == nil {
+			t.Error("состояние run-2 должно сохраниться")
+		}
+	})
+}
+
+// TestHandler_Dedup проверяет, что повторная отправка запроса не дублирует события.
+func TestHandler_Dedup(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	sub, _ := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 100})
+	defer sub.Close()
+
+	handler := NewHandler(bus)
+
+	var b strings.Builder
+	for seq := 1; seq <= 5; seq++ {
+		fmt.Fprintf(&b, `{"v":1,"runId":"run-1","sourceId":"engine","frameIndex":%d,"simTime":0,"seq":%d}`+"\n", seq, seq)
+	}
+	// Событие без seq не участвует в дедупликации
+	b.WriteString(`{"v":1,"runId":"run-1","sourceId":"engine","frameIndex":0,"simTime":0}` + "\n")
+	body := b.String()
+
+	post := func() Report {
+		req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.HandleIngest(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("ожидался статус 202, получен %d", w.Code)
+		}
+		return decodeReport(t, w)
+	}
+
+	first := post()
+	if first.Accepted != 6 || first.Duplicates != 0 || first.Published != 6 {
+		t.Errorf("первый запрос: %+v", first)
+	}
+
+	// Повтор после таймаута клиента
+	retry := post()
+	if retry.Accepted != 1 || retry.Duplicates != 5 || retry.Published != 1 || retry.Rejected != 0 {
+		t.Errorf("повторный запрос: %+v", retry)
+	}
+
+	if got := len(readAllAvailableEvents(sub, 200*time.Millisecond)); got != 7 {
+		t.Errorf("ожидалось 7 опубликованных событий, получено %d", got)
+	}
+
+	seqs := handler.Pipeline().RunSequences("run-1")
+	if len(seqs) != 1 || seqs[0].Duplicates != 5 || seqs[0].Missing != 0 {
+		t.Errorf("RunSequences() = %+v", seqs)
+	}
+	if stats := handler.Stats().Sequence; stats.Duplicates != 5 {
+		t.Errorf("Stats().Sequence.Duplicates = %d, ожидалось 5", stats.Duplicates)
+	}
+}
+
+// failingBus - EventBus, PublishBatch которого публикует не больше limit
+// событий и затем возвращает ошибку.
+type failingBus struct {
+	eventbus.EventBus
+	limit int
+}
+
+func (b *failingBus) PublishBatch(ctx context.Context, events []*event.Event) (int, error) {
+	if len(events) <= b.limit {
+		return b.EventBus.PublishBatch(ctx, events)
+	}
+	n, _ := b.EventBus.PublishBatch(ctx, events[:b.limit])
+	return n, eventbus.ErrClosed
+}
+
+// TestPipeline_UnpublishedSeq проверяет, что seq событий, которые не удалось
+// опубликовать, не считаются принятыми при повторной отправке.
+func TestPipeline_UnpublishedSeq(t *testing.T) {
+	inner := eventbus.New()
+	defer inner.Close()
+	sub, _ := inner.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 100})
+	defer sub.Close()
+
+	bus := &failingBus{EventBus: inner, limit: 2}
+	pipeline := NewPipeline(bus, PipelineConfig{})
+
+	batch := make([]*event.Event, 0, 4)
+	for seq := uint64(1); seq <= 4; seq++ {
+		e := &event.Event{V: 1, RunID: "run-1", SourceID: "engine", Seq: &seq}
+		if err := pipeline.accept(e, 1); err != nil {
+			t.Fatalf("accept(seq %d) вернул ошибку: %v", seq, err)
+		}
+		batch = append(batch, e)
+	}
+	if n, err := pipeline.publish(context.Background(), batch); n != 2 || !errors.Is(err, eventbus.ErrClosed) {
+		t.Fatalf("publish() = %d, %v; ожидалось 2, ErrClosed", n, err)
+	}
+
+	// Повтор всего batch'а: опубликованные seq - дубликаты, остальные принимаются
+	bus.limit = 4
+	var retry []*event.Event
+	for seq := uint64(1); seq <= 4; seq++ {
+		e := &event.Event{V: 1, RunID: "run-1", SourceID: "engine", Seq: &seq}
+		switch err := pipeline.accept(e, 1); {
+		case seq <= 2 && !errors.Is(err, errDuplicate):
+			t.Errorf("seq %d: accept() = %v, ожидалась errDuplicate", seq, err)
+		case seq > 2 && err != nil:
+			t.Errorf("seq %d: accept() = %v", seq, err)
+		case err == nil:
+			retry = append(retry, e)
+		}
+	}
+	if n, err := pipeline.publish(context.Background(), retry); n != 2 || err != nil {
+		t.Errorf("publish() = %d, %v; ожидалось 2", n, err)
+	}
+	if got := len(readAllAvailableEvents(sub, 100*time.Millisecond)); got != 4 {
+		t.Errorf("опубликовано %d событий, ожидалось 4", got)
+	}
+	if seqs := pipeline.RunSequences("run-1"); seqs[0].Missing != 0 || seqs[0].Received != 4 {
+		t.Errorf("RunSequences() = %+v", seqs)
+	}
+}
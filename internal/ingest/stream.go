@@ -0,0 +1,500 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teltel/teltel/internal/auth"
+)
+
+const (
+	// DefaultMaxLineSize - максимальная длина строки NDJSON в потоке
+	// (совпадает с лимитом bufio.Scanner в HandleIngest)
+	DefaultMaxLineSize = bufio.MaxScanTokenSize
+
+	// ackWriteWait - таймаут записи ack строки клиенту
+	ackWriteWait = 5 * time.Second
+
+	// minAcceptBackoff, maxAcceptBackoff - пауза после ошибки Accept
+	// (удваивается при повторных ошибках, как в net/http.Server)
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// ErrLineTooLong - строка потока длиннее StreamConfig.MaxLineSize.
+// Такая строка отклоняется целиком, поток продолжается со следующей.
+var ErrLineTooLong = errors.New("ingest: line exceeds max line size")
+
+// StreamConfig определяет параметры потокового listener'а.
+type StreamConfig struct {
+	// Network - "tcp" или "unix"
+	Network string
+
+	// Addr - адрес (":8091") или путь к Unix сокету
+	Addr string
+
+	// BatchSize - максимальный размер micro-batch для PublishBatch
+	BatchSize int
+
+	// MaxLineSize - максимальная длина строки; более длинные строки отклоняются
+	MaxLineSize int
+
+	// AckInterval - период отправки ack строк клиенту (0 = без ack)
+	AckInterval time.Duration
+
+	// Auth - проверка токенов (nil = аутентификация выключена). Если задана,
+	// первая строка соединения - {"token":"..."}
+	Auth *auth.Authenticator
+}
+
+// StreamAck - строка подтверждения, которую сервер периодически
+// отправляет клиенту в том же соединении.
+type StreamAck struct {
+	Type      string `json:"type"` // всегда "ack"
+	Accepted  uint64 `json:"accepted"`
+	Rejected  uint64 `json:"rejected"`
+	Published uint64 `json:"published"`
+
+	// Lines - обработанные непустые строки соединения, включая
+	// отклонённые, повторы seq и отброшенные лимитом. Строка считается
+	// обработанной, когда её событие опубликовано в EventBus. Клиент может
+	// считать первые Lines отправленных строк обработанными и после
+	// переподключения повторить только остальные.
+	Lines uint64 `json:"lines"`
+}
+
+// StreamError - строка ошибки, которую сервер отправляет клиенту
+// перед закрытием соединения.
+type StreamError struct {
+	Type  string `json:"type"` // всегда "error"
+	Code  int    `json:"code"` // 401, 403 или 503 (ошибка публикации)
+	Error string `json:"error"`
+}
+
+// StreamStats содержит статистику потокового listener'а.
+type StreamStats struct {
+	// Connections - общее количество принятых соединений
+	Connections uint64 `json:"connections"`
+
+	// ActiveConnections - количество открытых соединений
+	ActiveConnections int64 `json:"activeConnections"`
+
+	// Bytes - количество прочитанных байт
+	Bytes uint64 `json:"bytes"`
+
+	// Accepted - количество принятых событий
+	Accepted uint64 `json:"accepted"`
+
+	// Rejected - количество отклонённых строк
+	Rejected uint64 `json:"rejected"`
+
+	// Published - количество событий, опубликованных в EventBus
+	Published uint64 `json:"published"`
+
+	// ReadErrors - соединения, завершённые ошибкой чтения
+	ReadErrors uint64 `json:"readErrors"`
+
+	// AuthFailures - соединения, закрытые из-за отсутствия валидного токена
+	AuthFailures uint64 `json:"authFailures"`
+}
+
+// StreamListener принимает долгоживущие NDJSON потоки через TCP или
+// Unix сокет. Каждое соединение - непрерывный NDJSON поток; события
+// проходят тот же путь, что и в Handler, и публикуются micro-batch'ами:
+// batch отправляется при достижении BatchSize или когда прочитанные
+// данные закончились и следующая строка ещё не пришла.
+type StreamListener struct {
+	pipeline *Pipeline
+	config   StreamConfig
+
+	// Состояние
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	started  bool
+	stopped  bool
+	wg       sync.WaitGroup
+
+	// Статистика
+	connections       atomic.Uint64
+	activeConnections atomic.Int64
+	bytes             atomic.Uint64
+	accepted          atomic.Uint64
+	rejected          atomic.Uint64
+	published         atomic.Uint64
+	readErrors        atomic.Uint64
+	authFailures      atomic.Uint64
+}
+
+// NewStreamListener создаёт новый потоковый listener.
+func NewStreamListener(pipeline *Pipeline, config StreamConfig) *StreamListener {
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = DefaultMaxLineSize
+	}
+
+	return &StreamListener{
+		pipeline: pipeline,
+		config:   config,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Network возвращает тип сети listener'а ("tcp" или "unix").
+func (l *StreamListener) Network() string {
+	return l.config.Network
+}
+
+// Start открывает сокет и начинает принимать соединения в фоне.
+func (l *StreamListener) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.started {
+		return fmt.Errorf("%s listener already started", l.config.Network)
+	}
+
+	if l.config.Network == "unix" {
+		// Удаляем сокет, оставшийся от предыдущего запуска
+		if fi, err := os.Stat(l.config.Addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(l.config.Addr)
+		}
+	}
+
+	ln, err := net.Listen(l.config.Network, l.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen %s: %w", l.config.Network, err)
+	}
+
+	l.listener = ln
+	l.started = true
+
+	l.wg.Add(1)
+	go l.acceptLoop(ctx)
+
+	return nil
+}
+
+// Addr возвращает фактический адрес listener'а (nil до Start).
+func (l *StreamListener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Addr()
+}
+
+// acceptLoop принимает соединения до закрытия listener'а.
+func (l *StreamListener) acceptLoop(ctx context.Context) {
+	defer l.wg.Done()
+
+	var backoff time.Duration
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Ошибка Accept (например, EMFILE) обычно повторяется:
+			// пауза не даёт циклу занять CPU и засорить лог
+			backoff = min(max(backoff*2, minAcceptBackoff), maxAcceptBackoff)
+			log.Printf("%s ingest accept error: %v; retrying in %v", l.config.Network, err, backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		if !l.track(conn) {
+			conn.Close()
+			return
+		}
+
+		l.wg.Add(1)
+		go l.serveConn(ctx, conn)
+	}
+}
+
+// track регистрирует соединение; возвращает false, если listener остановлен.
+func (l *StreamListener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.connections.Add(1)
+	l.activeConnections.Add(1)
+	return true
+}
+
+// untrack удаляет соединение из списка активных.
+func (l *StreamListener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	l.activeConnections.Add(-1)
+}
+
+// streamConn - состояние одного соединения.
+type streamConn struct {
+	conn net.Conn
+
+	// Счётчики соединения, читаются goroutine отправки ack
+	accepted  atomic.Uint64
+	rejected  atomic.Uint64
+	published atomic.Uint64
+	lines     atomic.Uint64
+
+	// writeMu защищает запись ack строк в соединение
+	writeMu   sync.Mutex
+	ackFailed bool
+}
+
+// serveConn читает NDJSON поток одного соединения.
+func (l *StreamListener) serveConn(ctx context.Context, conn net.Conn) {
+	defer l.wg.Done()
+	defer l.untrack(conn)
+	defer conn.Close()
+
+	sc := &streamConn{conn: conn}
+	r := bufio.NewReaderSize(&countingReader{r: conn, n: &l.bytes}, l.config.MaxLineSize)
+
+	var token *auth.Token
+	if l.config.Auth != nil {
+		var err error
+		if token, err = l.authenticate(conn, r); err != nil {
+			l.authFailures.Add(1)
+			sc.writeLine(StreamError{Type: "error", Code: authStatus(err), Error: err.Error()})
+			return
+		}
+	}
+
+	report := newReport()
+	pub := newBatchPublisher(l.pipeline, "ingest."+l.Network(), token, l.config.BatchSize, report)
+
+	// Периодические ack строки
+	ackDone := make(chan struct{})
+	ackStopped := make(chan struct{})
+	if l.config.AckInterval > 0 {
+		go sc.ackLoop(l.config.AckInterval, ackDone, ackStopped)
+	} else {
+		close(ackStopped)
+	}
+
+	skipping := false // пропускаем остаток слишком длинной строки
+	lineNo := 0
+	var lines uint64
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Строка длиннее MaxLineSize - отклоняем её целиком;
+			// в dead-letter попадает только её начало
+			if !skipping {
+				lineNo++
+				pub.reject(lineNo, line, nil, ErrLineTooLong)
+				skipping = true
+			}
+			continue
+		}
+
+		if skipping {
+			// Конец слишком длинной строки, она уже отклонена
+			skipping = false
+			lines++
+		} else {
+			lineNo++
+			if len(bytes.TrimSpace(line)) > 0 {
+				evt, v, perr := pub.pipeline.parseLine(string(line))
+				if perr == nil {
+					perr = pub.add(ctx, evt, v)
+				}
+				if perr != nil {
+					pub.reject(lineNo, line, evt, perr)
+				}
+				lines++
+			}
+		}
+
+		// Micro-batch: публикуем, когда в буфере не осталось данных
+		if err != nil || r.Buffered() == 0 {
+			pub.flush(ctx)
+		}
+		l.update(sc, report)
+		if pub.err != nil {
+			// События не опубликованы: подтверждённые строки больше
+			// не увеличиваются, клиент повторит остальные после
+			// переподключения
+			break
+		}
+		if !pub.pending() {
+			sc.lines.Store(lines)
+		}
+
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				l.readErrors.Add(1)
+			}
+			break
+		}
+	}
+
+	perr := pub.flush(ctx)
+	l.update(sc, report)
+	if perr == nil {
+		sc.lines.Store(lines)
+	}
+
+	// Финальный ack после завершения потока клиента
+	close(ackDone)
+	<-ackStopped
+	if l.config.AckInterval > 0 {
+		sc.writeAck()
+	}
+	if perr != nil {
+		log.Printf("%s ingest publish error: %v", l.config.Network, perr)
+		sc.writeLine(StreamError{Type: "error", Code: http.StatusServiceUnavailable, Error: perr.Error()})
+	}
+}
+
+// authenticate читает первую непустую строку соединения и проверяет токен.
+func (l *StreamListener) authenticate(conn net.Conn, r *bufio.Reader) (*auth.Token, error) {
+	conn.SetReadDeadline(time.Now().Add(authLineTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(bytes.TrimSpace(line)) > 0 && err != bufio.ErrBufferFull {
+			return l.config.Auth.Check(parseAuthLine(line), auth.RoleIngest)
+		}
+		if err != nil {
+			return nil, auth.ErrUnauthorized
+		}
+	}
+}
+
+// update копирует счётчики отчёта в атомарные счётчики соединения
+// и добавляет прирост к общим счётчикам listener'а.
+func (l *StreamListener) update(sc *streamConn, report *Report) {
+	accepted := uint64(report.Accepted)
+	rejected := uint64(report.Rejected)
+	published := uint64(report.Published)
+
+	l.accepted.Add(accepted - sc.accepted.Swap(accepted))
+	l.rejected.Add(rejected - sc.rejected.Swap(rejected))
+	l.published.Add(published - sc.published.Swap(published))
+}
+
+// ackLoop периодически отправляет ack строки до закрытия done.
+func (sc *streamConn) ackLoop(interval time.Duration, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sc.writeAck()
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeAck отправляет клиенту ack строку с текущими счётчиками.
+// После первой ошибки записи ack для соединения отключаются,
+// чтобы клиент, не читающий ответы, не влиял на приём событий.
+func (sc *streamConn) writeAck() {
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
+
+	if sc.ackFailed {
+		return
+	}
+
+	sc.writeLine(StreamAck{
+		Type:      "ack",
+		Accepted:  sc.accepted.Load(),
+		Rejected:  sc.rejected.Load(),
+		Published: sc.published.Load(),
+		Lines:     sc.lines.Load(),
+	})
+}
+
+// writeLine отправляет клиенту служебную JSON строку.
+// Ошибка записи отключает дальнейшие ack для соединения.
+func (sc *streamConn) writeLine(v interface{}) {
+	data, _ := json.Marshal(v)
+	data = append(data, '\n')
+
+	sc.conn.SetWriteDeadline(time.Now().Add(ackWriteWait))
+	if _, err := sc.conn.Write(data); err != nil {
+		sc.ackFailed = true
+	}
+}
+
+// Stop закрывает listener и все открытые соединения и ждёт их завершения.
+func (l *StreamListener) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.started || l.stopped {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stopped = true
+	err := l.listener.Close()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats возвращает статистику потокового listener'а.
+func (l *StreamListener) Stats() StreamStats {
+	return StreamStats{
+		Connections:       l.connections.Load(),
+		ActiveConnections: l.activeConnections.Load(),
+		Bytes:             l.bytes.Load(),
+		Accepted:          l.accepted.Load(),
+		Rejected:          l.rejected.Load(),
+		Published:         l.published.Load(),
+		ReadErrors:        l.readErrors.Load(),
+		AuthFailures:      l.authFailures.Load(),
+	}
+}
@@ -0,0 +1,289 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// startStreamListener запускает потоковый listener и подключается к нему.
+func startStreamListener(t *testing.T, bus eventbus.EventBus, config StreamConfig) (*StreamListener, net.Conn) {
+	t.Helper()
+
+	l := NewStreamListener(NewPipeline(bus, PipelineConfig{}), config)
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { l.Stop(context.Background()) })
+
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return l, conn
+}
+
+// closeWrite закрывает запись в соединение (half-close).
+func closeWrite(t *testing.T, conn net.Conn) {
+	t.Helper()
+	type closeWriter interface{ CloseWrite() error }
+	cw, ok := conn.(closeWriter)
+	if !ok {
+		t.Fatalf("соединение %T не поддерживает CloseWrite", conn)
+	}
+	if err := cw.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() вернула ошибку: %v", err)
+	}
+}
+
+// streamLines создаёт count валидных NDJSON строк.
+func streamLines(count int) string {
+	var b strings.Builder
+	for i := 0; i < count; i++ {
+		b.WriteString(`{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-1","frameIndex":` + strconv.Itoa(i) + `,"simTime":0.0,"payload":{}}` + "\n")
+	}
+	return b.String()
+}
+
+// TestStreamListener проверяет потоковый ingest через TCP и Unix сокет.
+func TestStreamListener(t *testing.T) {
+	configs := map[string]func(t *testing.T) StreamConfig{
+		"tcp": func(t *testing.T) StreamConfig {
+			return StreamConfig{Network: "tcp", Addr: "127.0.0.1:0"}
+		},
+		"unix": func(t *testing.T) StreamConfig {
+			return StreamConfig{Network: "unix", Addr: filepath.Join(t.TempDir(), "ingest.sock")}
+		},
+	}
+
+	for network, makeConfig := range configs {
+		t.Run(network+": поток публикуется с сохранением порядка", func(t *testing.T) {
+			bus := eventbus.New()
+			defer bus.Close()
+
+			sub, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{
+				BufferSize: 1000,
+				Policy:     eventbus.BackpressureBlock,
+			})
+			if err != nil {
+				t.Fatalf("Subscribe() вернула ошибку: %v", err)
+			}
+			defer sub.Close()
+
+			config := makeConfig(t)
+			config.BatchSize = 16
+			l, conn := startStreamListener(t, bus, config)
+
+			if _, err := conn.Write([]byte(streamLines(250) + "invalid json\n")); err != nil {
+				t.Fatalf("Write() вернула ошибку: %v", err)
+			}
+
+			received := readEvents(sub, 250, 2*time.Second)
+			if len(received) != 250 {
+				t.Fatalf("ожидалось 250 событий, получено %d", len(received))
+			}
+			for i, evt := range received {
+				if evt.FrameIndex != i {
+					t.Fatalf("событие %d: FrameIndex = %d, порядок нарушен", i, evt.FrameIndex)
+				}
+			}
+
+			closeWrite(t, conn)
+			stats := waitStreamStats(l, func(s StreamStats) bool { return s.ActiveConnections == 0 })
+			if stats.Connections != 1 || stats.Accepted != 250 || stats.Rejected != 1 || stats.Published != 250 {
+				t.Errorf("неожиданная статистика: %+v", stats)
+			}
+		})
+	}
+
+	t.Run("периодические ack строки и финальный ack", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		_, conn := startStreamListener(t, bus, StreamConfig{
+			Network:     "tcp",
+			Addr:        "127.0.0.1:0",
+			AckInterval: 20 * time.Millisecond,
+		})
+
+		conn.Write([]byte(streamLines(3) + "invalid\n"))
+
+		reader := bufio.NewReader(conn)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var ack StreamAck
+		for ack.Accepted < 3 {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				t.Fatalf("ожидался периодический ack: %v", err)
+			}
+			if err := json.Unmarshal(line, &ack); err != nil {
+				t.Fatalf("невалидный ack %q: %v", line, err)
+			}
+		}
+		if ack.Type != "ack" || ack.Rejected != 1 {
+			t.Errorf("неожиданный ack: %+v", ack)
+		}
+
+		conn.Write([]byte(streamLines(2)))
+		closeWrite(t, conn)
+
+		var last StreamAck
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			json.Unmarshal(line, &last)
+		}
+		if last.Accepted != 5 || last.Published != 5 || last.Rejected != 1 || last.Lines != 6 {
+			t.Errorf("финальный ack: ожидалось accepted=5 published=5 rejected=1 lines=6, получено %+v", last)
+		}
+	})
+
+	t.Run("неопубликованные события не подтверждаются", func(t *testing.T) {
+		bus := eventbus.New()
+		bus.Close()
+
+		_, conn := startStreamListener(t, bus, StreamConfig{
+			Network:     "tcp",
+			Addr:        "127.0.0.1:0",
+			AckInterval: time.Hour,
+		})
+		conn.Write([]byte(streamLines(3)))
+
+		// Сервер отправляет финальный ack и ошибку, затем закрывает соединение
+		reader := bufio.NewReader(conn)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var ack StreamAck
+		var streamErr StreamError
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			switch {
+			case strings.Contains(string(line), `"type":"ack"`):
+				json.Unmarshal(line, &ack)
+			case strings.Contains(string(line), `"type":"error"`):
+				json.Unmarshal(line, &streamErr)
+			}
+		}
+		if ack.Accepted != 3 || ack.Published != 0 || ack.Lines != 0 {
+			t.Errorf("финальный ack: %+v", ack)
+		}
+		if streamErr.Code != 503 {
+			t.Errorf("ошибка: %+v, ожидался код 503", streamErr)
+		}
+	})
+
+	t.Run("слишком длинная строка отклоняется, поток продолжается", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startStreamListener(t, bus, StreamConfig{
+			Network:     "tcp",
+			Addr:        "127.0.0.1:0",
+			MaxLineSize: 256,
+		})
+
+		long := `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0,"payload":{"pad":"` + strings.Repeat("x", 1000) + `"}}` + "\n"
+		conn.Write([]byte(long + streamLines(2)))
+		closeWrite(t, conn)
+
+		stats := waitStreamStats(l, func(s StreamStats) bool { return s.ActiveConnections == 0 })
+		if stats.Rejected != 1 || stats.Accepted != 2 {
+			t.Errorf("ожидалось rejected=1 accepted=2, получено %+v", stats)
+		}
+	})
+
+	t.Run("Stop закрывает активные соединения", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startStreamListener(t, bus, StreamConfig{Network: "tcp", Addr: "127.0.0.1:0"})
+		conn.Write([]byte(streamLines(1)))
+		waitStreamStats(l, func(s StreamStats) bool { return s.Accepted == 1 })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := l.Stop(ctx); err != nil {
+			t.Fatalf("Stop() вернула ошибку: %v", err)
+		}
+		if active := l.Stats().ActiveConnections; active != 0 {
+			t.Errorf("activeConnections = %d, ожидалось 0", active)
+		}
+	})
+
+	t.Run("статистика доступна через Handler", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, _ := startStreamListener(t, bus, StreamConfig{Network: "tcp", Addr: "127.0.0.1:0"})
+		handler := NewHandler(bus)
+		handler.AddStreamListener(l)
+
+		if _, ok := handler.Stats().Streams["tcp"]; !ok {
+			t.Error("статистика tcp listener'а должна присутствовать")
+		}
+	})
+}
+
+// failingListener - net.Listener, Accept которого всегда возвращает ошибку.
+type failingListener struct {
+	net.Listener
+	accepts atomic.Int64
+	closed  atomic.Bool
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts.Add(1)
+	if l.closed.Load() {
+		return nil, net.ErrClosed
+	}
+	return nil, errors.New("accept: too many open files")
+}
+
+// TestStreamListener_AcceptBackoff проверяет паузу между повторными
+// ошибками Accept.
+func TestStreamListener_AcceptBackoff(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	fl := &failingListener{}
+	l := NewStreamListener(NewPipeline(bus, PipelineConfig{}), StreamConfig{Network: "tcp"})
+	l.listener = fl
+	l.wg.Add(1)
+	go l.acceptLoop(context.Background())
+
+	// Паузы 5, 10, 20, 40, 80 ms: за 100 ms не больше 6 попыток
+	time.Sleep(100 * time.Millisecond)
+	fl.closed.Store(true)
+	l.wg.Wait()
+	if accepts := fl.accepts.Load(); accepts > 8 {
+		t.Errorf("Accept вызван %d раз за 100ms", accepts)
+	}
+}
+
+// waitStreamStats ждёт, пока статистика не удовлетворит условию.
+func waitStreamStats(l *StreamListener, cond func(StreamStats) bool) StreamStats {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats := l.Stats(); cond(stats) {
+			return stats
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return l.Stats()
+}
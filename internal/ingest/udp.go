@@ -0,0 +1,300 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teltel/teltel/internal/auth"
+)
+
+const (
+	// DefaultMaxDatagramSize - максимальный размер UDP датаграммы по умолчанию.
+	DefaultMaxDatagramSize = 65507
+
+	// minReadBackoff, maxReadBackoff - пауза после ошибки чтения из сокета
+	// (удваивается при повторных ошибках, как пауза после ошибки Accept)
+	minReadBackoff = 5 * time.Millisecond
+	maxReadBackoff = time.Second
+)
+
+// UDPConfig определяет параметры UDP listener'а.
+type UDPConfig struct {
+	// Addr - адрес для прослушивания (например, ":8090")
+	Addr string
+
+	// MaxDatagramSize - максимальный размер датаграммы; датаграммы
+	// большего размера считаются обрезанными и отбрасываются
+	MaxDatagramSize int
+
+	// ReadBufferSize - размер буфера сокета (SO_RCVBUF), 0 = системный
+	ReadBufferSize int
+
+	// Auth - проверка токенов (nil = аутентификация выключена). Если задана,
+	// первая строка каждой датаграммы - {"token":"..."}
+	Auth *auth.Authenticator
+}
+
+// UDPStats содержит статистику UDP listener'а.
+type UDPStats struct {
+	// Packets - количество принятых датаграмм
+	Packets uint64 `json:"packets"`
+
+	// Bytes - количество принятых байт
+	Bytes uint64 `json:"bytes"`
+
+	// Accepted - количество принятых событий
+	Accepted uint64 `json:"accepted"`
+
+	// Rejected - количество отклонённых событий (ошибки парсинга/валидации)
+	Rejected uint64 `json:"rejected"`
+
+	// Published - количество событий, опубликованных в EventBus
+	Published uint64 `json:"published"`
+
+	// MalformedPackets - датаграммы, в которых хотя бы одно событие отклонено
+	// из-за ошибки парсинга, валидации или схемы
+	MalformedPackets uint64 `json:"malformedPackets"`
+
+	// RateLimitedPackets - датаграммы, в которых хотя бы одно событие
+	// превысило лимит источника или run'а
+	RateLimitedPackets uint64 `json:"rateLimitedPackets"`
+
+	// ForbiddenPackets - датаграммы, в которых хотя бы одно событие
+	// отклонено из-за sourceId, не разрешённого токену
+	ForbiddenPackets uint64 `json:"forbiddenPackets"`
+
+	// TruncatedPackets - датаграммы, превысившие MaxDatagramSize (отброшены целиком)
+	TruncatedPackets uint64 `json:"truncatedPackets"`
+
+	// ReadErrors - ошибки чтения из сокета
+	ReadErrors uint64 `json:"readErrors"`
+
+	// UnauthorizedPackets - датаграммы без валидного ingest токена (отброшены целиком)
+	UnauthorizedPackets uint64 `json:"unauthorizedPackets"`
+}
+
+// UDPListener принимает события в UDP датаграммах (fire-and-forget).
+// Каждая датаграмма содержит одно или несколько NDJSON событий,
+// разделённых переводом строки. События проходят тот же путь, что
+// и в Handler: парсинг, SetWallTime, PublishBatch.
+type UDPListener struct {
+	pipeline *Pipeline
+	config   UDPConfig
+
+	// Состояние
+	mu      sync.Mutex
+	conn    *net.UDPConn
+	started bool
+	doneCh  chan struct{}
+
+	// Статистика
+	packets          atomic.Uint64
+	bytes            atomic.Uint64
+	accepted         atomic.Uint64
+	rejected         atomic.Uint64
+	published        atomic.Uint64
+	malformedPackets atomic.Uint64
+	limitedPackets   atomic.Uint64
+	forbiddenPackets atomic.Uint64
+	truncatedPackets atomic.Uint64
+	readErrors       atomic.Uint64
+	unauthorized     atomic.Uint64
+}
+
+// NewUDPListener создаёт новый UDP listener.
+func NewUDPListener(pipeline *Pipeline, config UDPConfig) *UDPListener {
+	if config.MaxDatagramSize <= 0 {
+		config.MaxDatagramSize = DefaultMaxDatagramSize
+	}
+
+	return &UDPListener{
+		pipeline: pipeline,
+		config:   config,
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// Start открывает UDP сокет и запускает чтение датаграмм в фоне.
+func (l *UDPListener) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.started {
+		return fmt.Errorf("udp listener already started")
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", l.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve udp address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen udp: %w", err)
+	}
+
+	if l.config.ReadBufferSize > 0 {
+		if err := conn.SetReadBuffer(l.config.ReadBufferSize); err != nil {
+			log.Printf("UDP listener: failed to set read buffer: %v", err)
+		}
+	}
+
+	l.conn = conn
+	l.started = true
+
+	go l.run(ctx)
+
+	return nil
+}
+
+// Addr возвращает фактический адрес listener'а (nil до Start).
+func (l *UDPListener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.LocalAddr()
+}
+
+// run читает датаграммы до закрытия сокета.
+func (l *UDPListener) run(ctx context.Context) {
+	defer close(l.doneCh)
+
+	// Буфер на 1 байт больше лимита позволяет обнаружить обрезанные
+	// датаграммы: ядро молча обрезает датаграмму по размеру буфера.
+	buf := make([]byte, l.config.MaxDatagramSize+1)
+
+	var backoff time.Duration
+	for {
+		n, _, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.readErrors.Add(1)
+			// Ошибка чтения может повторяться: пауза не даёт циклу
+			// занять CPU и засорить лог
+			backoff = min(max(backoff*2, minReadBackoff), maxReadBackoff)
+			log.Printf("UDP ingest read error: %v; retrying in %v", err, backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		l.packets.Add(1)
+		l.bytes.Add(uint64(n))
+
+		if n > l.config.MaxDatagramSize {
+			l.truncatedPackets.Add(1)
+			continue
+		}
+
+		l.handleDatagram(ctx, buf[:n])
+	}
+}
+
+// handleDatagram обрабатывает одну датаграмму.
+func (l *UDPListener) handleDatagram(ctx context.Context, data []byte) {
+	var token *auth.Token
+	if l.config.Auth != nil {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte{'\n'})
+		var err error
+		token, err = l.config.Auth.Check(parseAuthLine(line), auth.RoleIngest)
+		if err != nil {
+			l.unauthorized.Add(1)
+			return
+		}
+	}
+
+	report := newReport()
+	pub := newBatchPublisher(l.pipeline, originUDP, token, defaultBatchSize, report)
+
+	for lineNo := 1; len(data) > 0; lineNo++ {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		evt, v, err := pub.pipeline.parseLine(string(line))
+		if err != nil {
+			pub.reject(lineNo, line, nil, err)
+			continue
+		}
+
+		if err := pub.add(ctx, evt, v); err != nil {
+			pub.reject(lineNo, line, evt, err)
+		}
+	}
+
+	pub.flush(ctx)
+
+	l.accepted.Add(uint64(report.Accepted))
+	l.rejected.Add(uint64(report.Rejected))
+	l.published.Add(uint64(report.Published))
+	// Отклонённые по лимиту (политика reject) и по токену события
+	// учитываются отдельно от битых
+	if report.Rejected > report.throttled+report.forbidden {
+		l.malformedPackets.Add(1)
+	}
+	if report.RateLimited > 0 {
+		l.limitedPackets.Add(1)
+	}
+	if report.forbidden > 0 {
+		l.forbiddenPackets.Add(1)
+	}
+}
+
+// Stop закрывает сокет и ждёт завершения чтения.
+func (l *UDPListener) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.started {
+		l.mu.Unlock()
+		return nil
+	}
+	conn := l.conn
+	l.mu.Unlock()
+
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	select {
+	case <-l.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats возвращает статистику UDP listener'а.
+func (l *UDPListener) Stats() UDPStats {
+	return UDPStats{
+		Packets:             l.packets.Load(),
+		Bytes:               l.bytes.Load(),
+		Accepted:            l.accepted.Load(),
+		Rejected:            l.rejected.Load(),
+		Published:           l.published.Load(),
+		MalformedPackets:    l.malformedPackets.Load(),
+		RateLimitedPackets:  l.limitedPackets.Load(),
+		ForbiddenPackets:    l.forbiddenPackets.Load(),
+		TruncatedPackets:    l.truncatedPackets.Load(),
+		ReadErrors:          l.readErrors.Load(),
+		UnauthorizedPackets: l.unauthorized.Load(),
+	}
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// startUDPListener запускает UDP listener на случайном порту.
+func startUDPListener(t *testing.T, bus eventbus.EventBus, config UDPConfig) (*UDPListener, net.Conn) {
+	t.Helper()
+
+	config.Addr = "127.0.0.1:0"
+	l := NewUDPListener(NewPipeline(bus, PipelineConfig{}), config)
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { l.Stop(context.Background()) })
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return l, conn
+}
+
+// waitUDPStats ждёт, пока статистика не удовлетворит условию.
+func waitUDPStats(l *UDPListener, cond func(UDPStats) bool) UDPStats {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if stats := l.Stats(); cond(stats) {
+			return stats
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return l.Stats()
+}
+
+// TestUDPListener проверяет приём событий через UDP.
+func TestUDPListener(t *testing.T) {
+	t.Run("несколько событий в одной датаграмме публикуются", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		sub, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{
+			BufferSize: 100,
+			Policy:     eventbus.BackpressureBlock,
+		})
+		if err != nil {
+			t.Fatalf("Subscribe() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		_, conn := startUDPListener(t, bus, UDPConfig{})
+
+		datagram := strings.Join([]string{
+			`{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-1","frameIndex":0,"simTime":0.0,"payload":{}}`,
+			`{"v":1,"runId":"run-1","sourceId":"source-1","type":"type-2","frameIndex":1,"simTime":0.016,"payload":{}}`,
+		}, "\n")
+		if _, err := conn.Write([]byte(datagram)); err != nil {
+			t.Fatalf("Write() вернула ошибку: %v", err)
+		}
+
+		received := readEvents(sub, 2, time.Second)
+		if len(received) != 2 {
+			t.Fatalf("ожидалось 2 события, получено %d", len(received))
+		}
+		if received[0].Type != "type-1" || received[1].Type != "type-2" {
+			t.Errorf("нарушен порядок событий: %s, %s", received[0].Type, received[1].Type)
+		}
+		if received[0].WallTimeMs == nil {
+			t.Error("WallTimeMs должен быть установлен")
+		}
+	})
+
+	t.Run("битые события учитываются как malformed", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startUDPListener(t, bus, UDPConfig{})
+
+		datagram := "invalid json\n" + `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0}`
+		conn.Write([]byte(datagram))
+
+		stats := waitUDPStats(l, func(s UDPStats) bool { return s.Packets == 1 && s.Published == 1 })
+		if stats.Accepted != 1 || stats.Rejected != 1 || stats.Published != 1 {
+			t.Errorf("ожидалось accepted=1 rejected=1 published=1, получено %+v", stats)
+		}
+		if stats.MalformedPackets != 1 {
+			t.Errorf("malformedPackets = %d, ожидалось 1", stats.MalformedPackets)
+		}
+	})
+
+	t.Run("датаграмма больше лимита отбрасывается как truncated", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, conn := startUDPListener(t, bus, UDPConfig{MaxDatagramSize: 64})
+
+		line := `{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0.0,"payload":{"pad":"` + strings.Repeat("x", 100) + `"}}`
+		conn.Write([]byte(line))
+
+		stats := waitUDPStats(l, func(s UDPStats) bool { return s.TruncatedPackets == 1 })
+		if stats.TruncatedPackets != 1 {
+			t.Errorf("truncatedPackets = %d, ожидалось 1", stats.TruncatedPackets)
+		}
+		if stats.Accepted != 0 || stats.Published != 0 {
+			t.Errorf("обрезанная датаграмма не должна публиковаться: %+v", stats)
+		}
+	})
+
+	t.Run("статистика UDP доступна через Handler", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, _ := startUDPListener(t, bus, UDPConfig{})
+		handler := NewHandler(bus)
+
+		if handler.Stats().UDP != nil {
+			t.Error("UDP статистика должна отсутствовать до SetUDPListener")
+		}
+		handler.SetUDPListener(l)
+		if handler.Stats().UDP == nil {
+			t.Error("UDP статистика должна присутствовать после SetUDPListener")
+		}
+	})
+
+	t.Run("повторный Start → ошибка, Stop идемпотентен", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		l, _ := startUDPListener(t, bus, UDPConfig{})
+		if err := l.Start(context.Background()); err == nil {
+			t.Error("повторный Start() должен вернуть ошибку")
+		}
+		if err := l.Stop(context.Background()); err != nil {
+			t.Errorf("Stop() вернула ошибку: %v", err)
+		}
+		if err := l.Stop(context.Background()); err != nil {
+			t.Errorf("повторный Stop() вернула ошибку: %v", err)
+		}
+	})
+}
+
+// TestUDPListener_ReadBackoff проверяет паузу между повторными ошибками
+// чтения из сокета.
+func TestUDPListener_ReadBackoff(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	l, _ := startUDPListener(t, bus, UDPConfig{})
+
+	// Истёкший deadline: каждое чтение сразу возвращает ошибку
+	l.conn.SetReadDeadline(time.Now())
+
+	// Паузы 5, 10, 20, 40, 80 ms: за 100 ms не больше 6 ошибок
+	time.Sleep(100 * time.Millisecond)
+	if errs := l.Stats().ReadErrors; errs == 0 || errs > 8 {
+		t.Errorf("ошибок чтения за 100ms: %d", errs)
+	}
+}
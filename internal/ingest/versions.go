@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/teltel/teltel/internal/event"
+)
+
+// VersionCounts - счётчики событий одной версии (поле v до миграции).
+type VersionCounts struct {
+	// Received - количество полученных событий версии
+	Received uint64 `json:"received"`
+
+	// Upgraded - количество событий, приведённых к канонической версии
+	Upgraded uint64 `json:"upgraded"`
+
+	// Rejected - количество событий, отклонённых из-за версии или ошибки миграции
+	Rejected uint64 `json:"rejected"`
+}
+
+// VersionStats содержит статистику версий событий.
+type VersionStats struct {
+	// Current - каноническая версия, в которой события публикуются
+	Current int `json:"current"`
+
+	// Supported - версии, которые принимает сервер
+	Supported []int `json:"supported"`
+
+	// Counts - счётчики по исходной версии (-1 - все неподдерживаемые версии)
+	Counts map[int]VersionCounts `json:"counts"`
+}
+
+// versionTracker приводит события к канонической версии и ведёт
+// счётчики по исходной версии.
+type versionTracker struct {
+	migrator *event.Migrator
+
+	mu     sync.Mutex
+	counts map[int]*VersionCounts
+}
+
+func newVersionTracker(migrator *event.Migrator) *versionTracker {
+	if migrator == nil {
+		migrator = event.DefaultMigrator()
+	}
+	return &versionTracker{
+		migrator: migrator,
+		counts:   make(map[int]*VersionCounts),
+	}
+}
+
+// parseLine разбирает строку NDJSON в событие канонической версии
+// и возвращает исходную версию события.
+func (t *versionTracker) parseLine(line string) (*event.Event, int, error) {
+	evt, v, err := t.migrator.ParseNDJSONLine(line)
+	t.count(v, err)
+	return evt, v, err
+}
+
+// decode читает следующее событие MessagePack в канонической версии
+// и возвращает исходную версию события.
+func (t *versionTracker) decode(dec *event.MsgPackDecoder) (*event.Event, int, error) {
+	evt, v, err := t.migrator.DecodeMsgPack(dec)
+	t.count(v, err)
+	return evt, v, err
+}
+
+// count учитывает событие исходной версии v. Ошибки разбора, не связанные
+// с версией, не учитываются.
+func (t *versionTracker) count(v int, err error) {
+	switch {
+	case errors.Is(err, event.ErrUnsupportedVersion):
+		// Счётчики неподдерживаемых версий не заводятся, чтобы клиент
+		// с произвольными v не раздувал статистику
+		v = -1
+	case err != nil && !errors.Is(err, event.ErrMigrationFailed):
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counts[v]
+	if !ok {
+		c = &VersionCounts{}
+		t.counts[v] = c
+	}
+	c.Received++
+	switch {
+	case err != nil:
+		c.Rejected++
+	case v < t.migrator.Current():
+		c.Upgraded++
+	}
+}
+
+func (t *versionTracker) stats() VersionStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[int]VersionCounts, len(t.counts))
+	for v, c := range t.counts {
+		counts[v] = *c
+	}
+	return VersionStats{
+		Current:   t.migrator.Current(),
+		Supported: t.migrator.Versions(),
+		Counts:    counts,
+	}
+}
@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+)
+
+// TestHandler_Versions проверяет приведение версий и счётчики по версиям.
+func TestHandler_Versions(t *testing.T) {
+	bus := eventbus.New()
+	defer bus.Close()
+
+	sub, _ := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{BufferSize: 100})
+	defer sub.Close()
+
+	// v1 передавал payload без обёртки "state"
+	migrator := event.NewMigrator(2)
+	migrator.Register(1, func(raw event.RawEvent) error {
+		raw["payload"] = json.RawMessage(`{"state":` + string(raw["payload"]) + `}`)
+		return nil
+	})
+
+	handler := NewHandlerWithConfig(bus, Config{Pipeline: PipelineConfig{Migrator: migrator}})
+	body := strings.Join([]string{
+		`{"v":1,"runId":"run-1","sourceId":"source-1","frameIndex":0,"simTime":0,"payload":{"x":1}}`,
+		`{"v":2,"runId":"run-1","sourceId":"source-1","frameIndex":1,"simTime":0,"payload":{"state":{"x":2}}}`,
+		`{"v":3,"runId":"run-1","sourceId":"source-1","frameIndex":2,"simTime":0,"payload":{"state":{"x":3}}}`,
+		`{"v":-1,"runId":"run-1","sourceId":"source-1","frameIndex":3,"simTime":0,"payload":{}}`,
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/api/ingest", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.HandleIngest(w, req)
+
+	report := decodeReport(t, w)
+	if report.Accepted != 2 || report.Rejected != 2 || report.Errors[0].Code != "ErrUnsupportedVersion" || report.Errors[1].Code != "ErrUnsupportedVersion" {
+		t.Fatalf("отчёт: %+v", report)
+	}
+
+	events := readAllAvailableEvents(sub, 100*time.Millisecond)
+	if len(events) != 2 {
+		t.Fatalf("опубликовано %d событий, ожидалось 2", len(events))
+	}
+	for _, e := range events {
+		if e.V != 2 || !strings.HasPrefix(string(e.Payload), `{"state":`) {
+			t.Errorf("событие не приведено к v2: v=%d payload=%s", e.V, e.Payload)
+		}
+	}
+
+	stats := handler.Stats().Versions
+	want := map[int]VersionCounts{
+		-1: {Received: 2, Rejected: 2},
+		1:  {Received: 1, Upgraded: 1},
+		2:  {Received: 1},
+	}
+	if stats.Current != 2 || len(stats.Supported) != 2 || len(stats.Counts) != len(want) {
+		t.Errorf("статистика версий: %+v", stats)
+	}
+	for v, c := range want {
+		if stats.Counts[v] != c {
+			t.Errorf("счётчики v%d = %+v, ожидалось %+v", v, stats.Counts[v], c)
+		}
+	}
+}
+
+// TestVersionTracker_Default проверяет счётчики встроенного Migrator'а:
+// старые версии приводятся к канонической, произвольные v учитываются
+// под одним ключом -1.
+func TestVersionTracker_Default(t *testing.T) {
+	tracker := newVersionTracker(nil)
+	for v := 1; v <= event.CurrentVersion; v++ {
+		line := `{"v":` + strconv.Itoa(v) + `,"runId":"run-1","sourceId":"source-1","payload":{}}`
+		evt, from, err := tracker.parseLine(line)
+		if err != nil || from != v || evt.V != event.CurrentVersion {
+			t.Fatalf("v%d: parseLine() = %+v, v%d, %v", v, evt, from, err)
+		}
+	}
+	for v := event.CurrentVersion + 1; v <= event.CurrentVersion+20; v++ {
+		line := `{"v":` + strconv.Itoa(v) + `,"runId":"run-1","sourceId":"source-1","payload":{}}`
+		if _, _, err := tracker.parseLine(line); !errors.Is(err, event.ErrUnsupportedVersion) {
+			t.Fatalf("v%d: parseLine() = %v, ожидалась ErrUnsupportedVersion", v, err)
+		}
+	}
+
+	stats := tracker.stats()
+	want := map[int]VersionCounts{
+		-1: {Received: 20, Rejected: 20},
+		1:  {Received: 1, Upgraded: 1},
+		2:  {Received: 1, Upgraded: 1},
+		3:  {Received: 1},
+	}
+	if len(stats.Counts) != len(want) {
+		t.Errorf("счётчики: %+v", stats.Counts)
+	}
+	for v, c := range want {
+		if stats.Counts[v] != c {
+			t.Errorf("счётчики v%d = %+v, ожидалось %+v", v, stats.Counts[v], c)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/teltel/teltel/internal/auth"
+)
+
+const (
+	// wsWriteWait - таймаут записи служебного сообщения клиенту
+	wsWriteWait = 10 * time.Second
+
+	// wsPongWait - таймаут ожидания сообщения или pong от клиента
+	wsPongWait = 60 * time.Second
+
+	// wsPingPeriod - период отправки ping (должен быть меньше wsPongWait)
+	wsPingPeriod = (wsPongWait * 9) / 10
+
+	// wsMaxMessageSize - максимальный размер одного фрейма с событиями
+	wsMaxMessageSize = 8 << 20
+
+	// wsFlowCheckInterval - период проверки заполненности очередей EventBus
+	wsFlowCheckInterval = 100 * time.Millisecond
+
+	// Значения по умолчанию для flow control и ack
+	defaultWSAckInterval     = time.Second
+	defaultFlowHighWatermark = 0.8
+	defaultFlowLowWatermark  = 0.5
+	defaultFlowMaxLogLag     = 100000
+)
+
+// Действия flow control в сообщениях WSFlowControl.
+const (
+	FlowSlowDown = "slow_down"
+	FlowResume   = "resume"
+)
+
+var wsIngestUpgrader = websocket.Upgrader{
+	ReadBufferSize:  64 << 10,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		// Как и /ws, разрешаем все origin (локальный сервис)
+		return true
+	},
+}
+
+// WSFlowControl - сообщение flow control для клиента /ws/ingest.
+// slow_down отправляется, когда очереди подписчиков EventBus с политикой
+// block (например, ClickHouse batcher) заполнены выше верхней границы
+// или durable потребитель журнала отстал (см. Handler.SetFlowLog);
+// resume - когда заполненность опустилась ниже нижней границы.
+type WSFlowControl struct {
+	Type      string  `json:"type"` // всегда "flow"
+	Action    string  `json:"action"`
+	QueueFill float64 `json:"queueFill"`
+}
+
+// WSAck - подтверждение, которое сервер периодически отправляет клиенту
+// /ws/ingest, и финальное подтверждение перед закрытием соединения.
+type WSAck struct {
+	Type      string `json:"type"` // всегда "ack"
+	Accepted  uint64 `json:"accepted"`
+	Rejected  uint64 `json:"rejected"`
+	Published uint64 `json:"published"`
+
+	// Messages - обработанные фреймы подключения. Фрейм считается
+	// обработанным, когда все его принятые события опубликованы в EventBus.
+	// Клиент может считать первые Messages отправленных фреймов
+	// обработанными и после переподключения повторить только остальные.
+	Messages uint64 `json:"messages"`
+}
+
+// WSIngestStats содержит статистику WebSocket ingest.
+type WSIngestStats struct {
+	// Connections - общее количество подключений
+	Connections uint64 `json:"connections"`
+
+	// ActiveConnections - количество открытых подключений
+	ActiveConnections int64 `json:"activeConnections"`
+
+	// Messages - количество принятых фреймов с событиями
+	Messages uint64 `json:"messages"`
+
+	// Accepted - количество принятых событий
+	Accepted uint64 `json:"accepted"`
+
+	// Rejected - количество отклонённых событий
+	Rejected uint64 `json:"rejected"`
+
+	// Published - количество событий, опубликованных в EventBus
+	Published uint64 `json:"published"`
+
+	// SlowDownSignals - количество отправленных сигналов slow_down
+	SlowDownSignals uint64 `json:"slowDownSignals"`
+}
+
+// wsIngestCounters - атомарные счётчики WebSocket ingest.
+type wsIngestCounters struct {
+	connections       atomic.Uint64
+	activeConnections atomic.Int64
+	messages          atomic.Uint64
+	accepted          atomic.Uint64
+	rejected          atomic.Uint64
+	published         atomic.Uint64
+	slowDownSignals   atomic.Uint64
+}
+
+// snapshot возвращает копию счётчиков.
+func (c *wsIngestCounters) snapshot() WSIngestStats {
+	return WSIngestStats{
+		Connections:       c.connections.Load(),
+		ActiveConnections: c.activeConnections.Load(),
+		Messages:          c.messages.Load(),
+		Accepted:          c.accepted.Load(),
+		Rejected:          c.rejected.Load(),
+		Published:         c.published.Load(),
+		SlowDownSignals:   c.slowDownSignals.Load(),
+	}
+}
+
+// wsIngestConn - счётчики одного подключения, читаются goroutine записи.
+type wsIngestConn struct {
+	accepted  atomic.Uint64
+	rejected  atomic.Uint64
+	published atomic.Uint64
+	messages  atomic.Uint64
+}
+
+// ack возвращает подтверждение по текущим счётчикам подключения.
+func (wc *wsIngestConn) ack() WSAck {
+	return WSAck{
+		Type:      "ack",
+		Accepted:  wc.accepted.Load(),
+		Rejected:  wc.rejected.Load(),
+		Published: wc.published.Load(),
+		Messages:  wc.messages.Load(),
+	}
+}
+
+// HandleWebSocket обрабатывает WebSocket подключение /ws/ingest.
+// Клиент отправляет события текстовыми фреймами (одна или несколько
+// строк NDJSON) или бинарными фреймами (одно или несколько событий
+// MessagePack). Каждый фрейм публикуется в EventBus одним batch'ем.
+// Сервер отправляет в том же соединении периодические ack, сообщения
+// flow control (slow_down / resume) и финальный ack перед закрытием.
+func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Токен проверяется до upgrade, чтобы вернуть обычный 401/403
+	token, err := h.config.Auth.Authenticate(r, auth.RoleIngest)
+	if err != nil {
+		auth.WriteError(w, err)
+		return
+	}
+
+	conn, err := wsIngestUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket ingest upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	h.ws.connections.Add(1)
+	h.ws.activeConnections.Add(1)
+	defer h.ws.activeConnections.Add(-1)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
+	// Запись выполняется только goroutine writeLoop; финальный ack
+	// отправляется после её остановки
+	wc := &wsIngestConn{}
+	done := make(chan struct{})
+	writerDone := make(chan struct{})
+	go h.wsWriteLoop(conn, wc, done, writerDone)
+	finalAck := sync.OnceFunc(func() {
+		close(done)
+		<-writerDone
+		writeWSJSON(conn, wc.ack())
+	})
+
+	// Финальный ack отправляется до ответного close фрейма,
+	// после которого писать в соединение нельзя
+	conn.SetCloseHandler(func(code int, text string) error {
+		finalAck()
+		message := websocket.FormatCloseMessage(code, "")
+		if code == websocket.CloseNoStatusReceived {
+			message = []byte{}
+		}
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+		return nil
+	})
+
+	var publishErr error
+	defer func() {
+		finalAck()
+		if publishErr != nil {
+			// Клиент повторит неопубликованные события после переподключения
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "publish failed"),
+				time.Now().Add(wsWriteWait))
+		}
+	}()
+
+	ctx := r.Context()
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket ingest read error: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		h.ws.messages.Add(1)
+
+		report := newReport()
+		pub := newBatchPublisher(h.pipeline, originWebSocket, token, defaultBatchSize, report)
+		switch msgType {
+		case websocket.TextMessage:
+			// Буфер вмещает фрейм целиком, поэтому строка любой длины
+			// в пределах wsMaxMessageSize читается полностью
+			err = readNDJSON(ctx, bytes.NewReader(data), wsMaxMessageSize+1, pub)
+		case websocket.BinaryMessage:
+			err = readMsgPack(ctx, bytes.NewReader(data), pub)
+		}
+		if err != nil {
+			// Остаток фрейма не прочитан: клиент видит отклонение в ack
+			pub.reject(0, nil, nil, err)
+			log.Printf("WebSocket ingest frame read error: %v", err)
+		}
+		publishErr = pub.flush(ctx)
+
+		wc.accepted.Add(uint64(report.Accepted))
+		wc.rejected.Add(uint64(report.Rejected))
+		wc.published.Add(uint64(report.Published))
+		if publishErr == nil {
+			wc.messages.Add(1)
+		}
+		h.ws.accepted.Add(uint64(report.Accepted))
+		h.ws.rejected.Add(uint64(report.Rejected))
+		h.ws.published.Add(uint64(report.Published))
+		if publishErr != nil {
+			log.Printf("WebSocket ingest publish error: %v", publishErr)
+			return
+		}
+	}
+}
+
+// wsWriteLoop отправляет клиенту ack, flow control и ping до закрытия done.
+func (h *Handler) wsWriteLoop(conn *websocket.Conn, wc *wsIngestConn, done <-chan struct{}, writerDone chan<- struct{}) {
+	defer close(writerDone)
+
+	ackTicker := time.NewTicker(h.config.WSAckInterval)
+	defer ackTicker.Stop()
+	flowTicker := time.NewTicker(wsFlowCheckInterval)
+	defer flowTicker.Stop()
+	pingTicker := time.NewTicker(wsPingPeriod)
+	defer pingTicker.Stop()
+
+	var lastAck WSAck
+	slowDown := false
+
+	for {
+		select {
+		case <-ackTicker.C:
+			ack := wc.ack()
+			if ack == lastAck {
+				continue // нет новых событий
+			}
+			if err := writeWSJSON(conn, ack); err != nil {
+				return
+			}
+			lastAck = ack
+
+		case <-flowTicker.C:
+			fill := h.flowFill()
+			var action string
+			switch {
+			case !slowDown && fill >= h.config.FlowHighWatermark:
+				action = FlowSlowDown
+				h.ws.slowDownSignals.Add(1)
+			case slowDown && fill <= h.config.FlowLowWatermark:
+				action = FlowResume
+			default:
+				continue
+			}
+			slowDown = action == FlowSlowDown
+			msg := WSFlowControl{Type: "flow", Action: action, QueueFill: fill}
+			if err := writeWSJSON(conn, msg); err != nil {
+				return
+			}
+
+		case <-pingTicker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeWSJSON отправляет служебное сообщение текстовым фреймом.
+func writeWSJSON(conn *websocket.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
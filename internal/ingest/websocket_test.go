@@ -0,0 +1,262 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
+)
+
+// dialWSIngest запускает тестовый сервер /ws/ingest и подключается к нему.
+func dialWSIngest(t *testing.T, handler *Handler) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(handler.HandleWebSocket))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() вернула ошибку: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readWSMessage читает служебные сообщения, пока не встретится сообщение
+// заданного типа, и декодирует его в v.
+func readWSMessage(t *testing.T, conn *websocket.Conn, msgType string, v interface{}) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ожидалось сообщение %q: %v", msgType, err)
+		}
+		var head struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &head); err != nil {
+			t.Fatalf("невалидное сообщение %q: %v", data, err)
+		}
+		if head.Type == msgType {
+			if err := json.Unmarshal(data, v); err != nil {
+				t.Fatalf("невалидное сообщение %q: %v", data, err)
+			}
+			return
+		}
+	}
+}
+
+// TestHandler_WebSocketIngest проверяет ingest через /ws/ingest.
+func TestHandler_WebSocketIngest(t *testing.T) {
+	t.Run("текстовые и бинарные фреймы публикуются, приходит ack", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		sub, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{
+			BufferSize: 100,
+			Policy:     eventbus.BackpressureBlock,
+		})
+		if err != nil {
+			t.Fatalf("Subscribe() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{WSAckInterval: 10 * time.Millisecond})
+		conn := dialWSIngest(t, handler)
+
+		text := streamLines(2) + "invalid json"
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		evt, _ := event.ParseNDJSONLine(`{"v":1,"runId":"run-1","sourceId":"source-1","type":"binary","frameIndex":2,"simTime":0.0,"payload":{}}`)
+		if err := conn.WriteMessage(websocket.BinaryMessage, event.MarshalMsgPack(evt)); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		received := readEvents(sub, 3, time.Second)
+		if len(received) != 3 {
+			t.Fatalf("ожидалось 3 события, получено %d", len(received))
+		}
+		if received[2].Type != "binary" {
+			t.Errorf("третье событие: Type = %q, ожидалось %q", received[2].Type, "binary")
+		}
+
+		var ack WSAck
+		for ack.Accepted < 3 {
+			readWSMessage(t, conn, "ack", &ack)
+		}
+		if ack.Rejected != 1 || ack.Published != 3 {
+			t.Errorf("неожиданный ack: %+v", ack)
+		}
+
+		stats := handler.Stats().WebSocket
+		if stats.Connections != 1 || stats.Messages != 2 || stats.Accepted != 3 {
+			t.Errorf("неожиданная статистика: %+v", stats)
+		}
+	})
+
+	t.Run("slow_down при заполнении block-подписчика и resume после разгрузки", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		// Медленный подписчик с политикой block, который пока не читает
+		slow, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{
+			BufferSize: 10,
+			Policy:     eventbus.BackpressureBlock,
+			Name:       "slow-batcher",
+		})
+		if err != nil {
+			t.Fatalf("Subscribe() вернула ошибку: %v", err)
+		}
+		defer slow.Close()
+
+		handler := NewHandler(bus)
+		conn := dialWSIngest(t, handler)
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(streamLines(9))); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		var flow WSFlowControl
+		readWSMessage(t, conn, "flow", &flow)
+		if flow.Action != FlowSlowDown || flow.QueueFill < 0.8 {
+			t.Errorf("ожидался slow_down с queueFill >= 0.8, получено %+v", flow)
+		}
+
+		readEvents(slow, 9, time.Second)
+
+		readWSMessage(t, conn, "flow", &flow)
+		if flow.Action != FlowResume {
+			t.Errorf("ожидался resume, получено %+v", flow)
+		}
+		if signals := handler.Stats().WebSocket.SlowDownSignals; signals != 1 {
+			t.Errorf("slowDownSignals = %d, ожидалось 1", signals)
+		}
+	})
+
+	t.Run("slow_down при отставании потребителя журнала", func(t *testing.T) {
+		log, err := eventlog.Open(eventlog.Config{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer log.Close()
+		bus := eventbus.NewWithConfig(eventbus.Config{Log: log})
+		defer bus.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{FlowMaxLogLag: 10})
+		handler.SetFlowLog(log, "storage")
+		conn := dialWSIngest(t, handler)
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(streamLines(9))); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		var flow WSFlowControl
+		readWSMessage(t, conn, "flow", &flow)
+		if flow.Action != FlowSlowDown || flow.QueueFill < 0.8 {
+			t.Errorf("ожидался slow_down с queueFill >= 0.8, получено %+v", flow)
+		}
+
+		// Потребитель обработал журнал
+		log.Commit("storage", log.End()-1)
+		readWSMessage(t, conn, "flow", &flow)
+		if flow.Action != FlowResume {
+			t.Errorf("ожидался resume, получено %+v", flow)
+		}
+	})
+
+	t.Run("строка длиннее 64 KiB в текстовом фрейме не обрывает фрейм", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		sub, err := bus.Subscribe(context.Background(), eventbus.Filter{}, eventbus.SubscriptionOptions{
+			BufferSize: 10,
+			Policy:     eventbus.BackpressureBlock,
+		})
+		if err != nil {
+			t.Fatalf("Subscribe() вернула ошибку: %v", err)
+		}
+		defer sub.Close()
+
+		handler := NewHandlerWithConfig(bus, Config{WSAckInterval: 10 * time.Millisecond})
+		conn := dialWSIngest(t, handler)
+
+		long := `{"v":1,"runId":"run-1","sourceId":"source-1","type":"long","payload":{"data":"` + strings.Repeat("x", 100<<10) + `"}}`
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(long+"\n"+streamLines(1))); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		received := readEvents(sub, 2, time.Second)
+		if len(received) != 2 || received[0].Type != "long" {
+			t.Fatalf("получено %d событий", len(received))
+		}
+		var ack WSAck
+		for ack.Accepted < 2 {
+			readWSMessage(t, conn, "ack", &ack)
+		}
+		if ack.Rejected != 0 {
+			t.Errorf("неожиданный ack: %+v", ack)
+		}
+	})
+
+	t.Run("финальный ack перед закрытием клиентом", func(t *testing.T) {
+		bus := eventbus.New()
+		defer bus.Close()
+
+		// Периодический ack не успевает, приходит только финальный
+		handler := NewHandlerWithConfig(bus, Config{WSAckInterval: time.Hour})
+		conn := dialWSIngest(t, handler)
+
+		for i := 0; i < 2; i++ {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(streamLines(2))); err != nil {
+				t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+			}
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+
+		var ack WSAck
+		readWSMessage(t, conn, "ack", &ack)
+		if ack.Accepted != 4 || ack.Published != 4 || ack.Messages != 2 {
+			t.Errorf("финальный ack: %+v", ack)
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Errorf("после ack ожидался close 1000, получено %v", err)
+		}
+	})
+
+	t.Run("ошибка публикации: финальный ack и close 1013", func(t *testing.T) {
+		inner := eventbus.New()
+		defer inner.Close()
+
+		handler := NewHandlerWithConfig(&failingBus{EventBus: inner, limit: 2}, Config{WSAckInterval: time.Hour})
+		conn := dialWSIngest(t, handler)
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(streamLines(2))); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(streamLines(3))); err != nil {
+			t.Fatalf("WriteMessage() вернула ошибку: %v", err)
+		}
+
+		var ack WSAck
+		readWSMessage(t, conn, "ack", &ack)
+		if ack.Accepted != 5 || ack.Published != 4 || ack.Messages != 1 {
+			t.Errorf("финальный ack: %+v", ack)
+		}
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Errorf("после ack ожидался close 1013, получено %v", err)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Mode - режим проверки payload в ingest.
+type Mode string
+
+const (
+	// ModeWarn - несоответствия считаются, события принимаются
+	ModeWarn Mode = "warn"
+
+	// ModeEnforce - события с несоответствием отклоняются
+	ModeEnforce Mode = "enforce"
+)
+
+// AnySource в поле sourceId регистрирует схему для всех источников.
+// Схема конкретного источника имеет приоритет.
+const AnySource = "*"
+
+// Entry описывает одну схему в файле реестра.
+type Entry struct {
+	SourceID string          `json:"sourceId"`
+	Type     string          `json:"type"`
+	V        int             `json:"v"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+// FileConfig - формат файла реестра.
+//
+//	{
+//	  "mode": "warn",
+//	  "schemas": [
+//	    {"sourceId": "flight-engine", "type": "body.state", "v": 1,
+//	     "schema": {"type": "object", "required": ["pos"], "properties": {...}}}
+//	  ]
+//	}
+type FileConfig struct {
+	Mode    Mode    `json:"mode"`
+	Schemas []Entry `json:"schemas"`
+}
+
+// Info - описание зарегистрированной схемы для API.
+type Info struct {
+	SourceID string          `json:"sourceId"`
+	Type     string          `json:"type"`
+	V        int             `json:"v"`
+	Paths    []FieldPath     `json:"paths"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+// key - ключ схемы в реестре.
+type key struct {
+	sourceID string
+	typ      string
+	v        int
+}
+
+// Registry сопоставляет (sourceId, type, v) со схемой payload.
+// Реестр неизменяем после создания и безопасен для конкурентного чтения.
+type Registry struct {
+	mode    Mode
+	schemas map[key]*Schema
+	infos   []Info
+}
+
+// New создаёт реестр из конфигурации.
+func New(config FileConfig) (*Registry, error) {
+	mode := config.Mode
+	switch mode {
+	case "":
+		mode = ModeWarn
+	case ModeWarn, ModeEnforce:
+	default:
+		return nil, fmt.Errorf("unknown schema mode %q", mode)
+	}
+
+	r := &Registry{
+		mode:    mode,
+		schemas: make(map[key]*Schema, len(config.Schemas)),
+		infos:   make([]Info, 0, len(config.Schemas)),
+	}
+
+	for i, e := range config.Schemas {
+		if e.SourceID == "" || e.Type == "" || e.V == 0 {
+			return nil, fmt.Errorf("schema %d: sourceId, type and v are required", i)
+		}
+		k := key{sourceID: e.SourceID, typ: e.Type, v: e.V}
+		if _, exists := r.schemas[k]; exists {
+			return nil, fmt.Errorf("schema %d: duplicate schema for %s/%s/v%d", i, e.SourceID, e.Type, e.V)
+		}
+
+		s, err := Compile(e.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s/%s/v%d: %w", e.SourceID, e.Type, e.V, err)
+		}
+		r.schemas[k] = s
+		r.infos = append(r.infos, Info{
+			SourceID: e.SourceID,
+			Type:     e.Type,
+			V:        e.V,
+			Paths:    s.Paths(),
+			Schema:   e.Schema,
+		})
+	}
+
+	sort.Slice(r.infos, func(i, j int) bool {
+		a, b := r.infos[i], r.infos[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.SourceID != b.SourceID {
+			return a.SourceID < b.SourceID
+		}
+		return a.V < b.V
+	})
+
+	return r, nil
+}
+
+// LoadFile загружает реестр из JSON файла.
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry: %w", err)
+	}
+
+	var config FileConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse schema registry: %w", err)
+	}
+
+	return New(config)
+}
+
+// Mode возвращает режим проверки.
+func (r *Registry) Mode() Mode {
+	return r.mode
+}
+
+// Lookup возвращает схему для (sourceId, type, v) или nil, если схема
+// не зарегистрирована. Схема для AnySource используется, если нет
+// схемы конкретного источника.
+func (r *Registry) Lookup(sourceID, typ string, v int) *Schema {
+	if s, ok := r.schemas[key{sourceID: sourceID, typ: typ, v: v}]; ok {
+		return s
+	}
+	return r.schemas[key{sourceID: AnySource, typ: typ, v: v}]
+}
+
+// List возвращает зарегистрированные схемы, отсортированные по type,
+// sourceId и v. Пустые sourceID и typ не фильтруют.
+func (r *Registry) List(sourceID, typ string) []Info {
+	result := make([]Info, 0, len(r.infos))
+	for _, info := range r.infos {
+		if sourceID != "" && info.SourceID != sourceID && info.SourceID != AnySource {
+			continue
+		}
+		if typ != "" && info.Type != typ {
+			continue
+		}
+		result = append(result, info)
+	}
+	return result
+}
@@ -0,0 +1,362 @@
+// Package schema реализует реестр JSON Schema для payload событий.
+//
+// Payload остаётся opaque для EventBus и хранилища; реестр лишь позволяет
+// ingest проверять его по схеме, зарегистрированной для (sourceId, type, v).
+// Поддерживается подмножество JSON Schema, достаточное для телеметрии:
+// type, properties, required, additionalProperties, items, enum, const,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength,
+// maxLength, minItems, maxItems. Остальные ключевые слова игнорируются,
+// как того требует спецификация для неизвестных ключевых слов.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrViolation - payload не соответствует схеме.
+var ErrViolation = errors.New("schema: payload does not match schema")
+
+// ValidationError описывает первое найденное несоответствие схеме.
+type ValidationError struct {
+	// Path - путь к значению в payload в формате jsonPath ("pos.x", "" - корень)
+	Path string
+
+	// Message - описание несоответствия
+	Message string
+}
+
+// Error реализует интерфейс error.
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return "schema: " + e.Message
+	}
+	return "schema: " + e.Path + ": " + e.Message
+}
+
+// Is позволяет проверять ошибку через errors.Is(err, ErrViolation).
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrViolation
+}
+
+// FieldPath - путь к значению payload, описанному схемой.
+type FieldPath struct {
+	Path string `json:"path"`
+	Type string `json:"type,omitempty"`
+}
+
+// Schema - скомпилированная схема.
+type Schema struct {
+	types      []string
+	properties map[string]*Schema
+	required   []string
+
+	// additional - схема дополнительных свойств; noAdditional - они запрещены
+	additional   *Schema
+	noAdditional bool
+
+	items *Schema
+
+	enum     []interface{}
+	constVal interface{}
+	hasConst bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	minLength        *int
+	maxLength        *int
+	minItems         *int
+	maxItems         *int
+}
+
+// rawSchema - JSON представление поддерживаемых ключевых слов.
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+}
+
+// validTypes - допустимые значения ключевого слова type.
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Compile разбирает JSON Schema.
+func Compile(data json.RawMessage) (*Schema, error) {
+	// Схема true/false допустима в JSON Schema
+	switch strings.TrimSpace(string(data)) {
+	case "true":
+		return &Schema{}, nil
+	case "false":
+		return &Schema{enum: []interface{}{}}, nil
+	}
+
+	var raw rawSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	s := &Schema{
+		required:         raw.Required,
+		enum:             raw.Enum,
+		minimum:          raw.Minimum,
+		maximum:          raw.Maximum,
+		exclusiveMinimum: raw.ExclusiveMinimum,
+		exclusiveMaximum: raw.ExclusiveMaximum,
+		minLength:        raw.MinLength,
+		maxLength:        raw.MaxLength,
+		minItems:         raw.MinItems,
+		maxItems:         raw.MaxItems,
+	}
+
+	if len(raw.Type) > 0 {
+		var one string
+		if err := json.Unmarshal(raw.Type, &one); err == nil {
+			s.types = []string{one}
+		} else if err := json.Unmarshal(raw.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("invalid schema: type must be a string or an array of strings")
+		}
+		for _, t := range s.types {
+			if !validTypes[t] {
+				return nil, fmt.Errorf("invalid schema: unknown type %q", t)
+			}
+		}
+	}
+
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			compiled, err := Compile(prop)
+			if err != nil {
+				return nil, fmt.Errorf("property %q: %w", name, err)
+			}
+			s.properties[name] = compiled
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		switch strings.TrimSpace(string(raw.AdditionalProperties)) {
+		case "false":
+			s.noAdditional = true
+		case "true":
+		default:
+			compiled, err := Compile(raw.AdditionalProperties)
+			if err != nil {
+				return nil, fmt.Errorf("additionalProperties: %w", err)
+			}
+			s.additional = compiled
+		}
+	}
+
+	if len(raw.Items) > 0 {
+		compiled, err := Compile(raw.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		s.items = compiled
+	}
+
+	if len(raw.Const) > 0 {
+		if err := json.Unmarshal(raw.Const, &s.constVal); err != nil {
+			return nil, fmt.Errorf("invalid schema: const: %w", err)
+		}
+		s.hasConst = true
+	}
+
+	return s, nil
+}
+
+// Validate проверяет payload события. Отсутствующий payload
+// проверяется как null.
+func (s *Schema) Validate(payload json.RawMessage) error {
+	var v interface{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &v); err != nil {
+			return &ValidationError{Message: "payload is not valid JSON"}
+		}
+	}
+	return s.validate(v, "")
+}
+
+// validate проверяет значение v, находящееся по пути path.
+func (s *Schema) validate(v interface{}, path string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if len(s.types) > 0 && !s.matchesType(v) {
+		return fail("expected %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+	}
+
+	if s.enum != nil && !containsValue(s.enum, v) {
+		return fail("value is not one of the allowed values")
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constVal, v) {
+		return fail("value does not match const")
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.minimum != nil && val < *s.minimum {
+			return fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && val > *s.maximum {
+			return fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && val <= *s.exclusiveMinimum {
+			return fail("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && val >= *s.exclusiveMaximum {
+			return fail("must be < %v", *s.exclusiveMaximum)
+		}
+
+	case string:
+		n := utf8.RuneCountInString(val)
+		if s.minLength != nil && n < *s.minLength {
+			return fail("length must be >= %d", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return fail("length must be <= %d", *s.maxLength)
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(val) < *s.minItems {
+			return fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(val) > *s.maxItems {
+			return fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range val {
+				if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := val[name]; !ok {
+				return &ValidationError{Path: joinPath(path, name), Message: "required property is missing"}
+			}
+		}
+		// Обходим свойства в стабильном порядке, чтобы ошибка была детерминированной
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.properties[name]
+			switch {
+			case ok:
+			case s.noAdditional:
+				return &ValidationError{Path: joinPath(path, name), Message: "property is not allowed"}
+			case s.additional != nil:
+				prop = s.additional
+			default:
+				continue
+			}
+			if err := prop.validate(val[name], joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchesType проверяет ключевое слово type.
+func (s *Schema) matchesType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range s.types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// Paths возвращает пути к значениям, описанным схемой (свойства объектов
+// в формате jsonPath, например "pos.x"), отсортированные по пути.
+// Используется, чтобы подсказать допустимые jsonPath для /api/analysis/series.
+func (s *Schema) Paths() []FieldPath {
+	var paths []FieldPath
+	s.collectPaths("", &paths)
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+	return paths
+}
+
+func (s *Schema) collectPaths(prefix string, paths *[]FieldPath) {
+	for name, prop := range s.properties {
+		path := joinPath(prefix, name)
+		if len(prop.properties) > 0 {
+			prop.collectPaths(path, paths)
+			continue
+		}
+		*paths = append(*paths, FieldPath{Path: path, Type: strings.Join(prop.types, "|")})
+	}
+}
+
+// typeOf возвращает JSON Schema тип декодированного значения.
+func typeOf(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// containsValue проверяет наличие значения в enum.
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPath добавляет имя свойства к пути.
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
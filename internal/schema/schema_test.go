@@ -0,0 +1,208 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// bodyState - схема payload body.state для тестов.
+const bodyState = `{
+	"type": "object",
+	"required": ["pos"],
+	"additionalProperties": false,
+	"properties": {
+		"pos": {
+			"type": "object",
+			"required": ["x", "y"],
+			"properties": {"x": {"type": "number"}, "y": {"type": "number"}}
+		},
+		"mode": {"enum": ["idle", "flight"]},
+		"fuel": {"type": "number", "minimum": 0, "maximum": 100},
+		"name": {"type": "string", "maxLength": 4},
+		"wheels": {"type": "array", "maxItems": 4, "items": {"type": "integer"}}
+	}
+}`
+
+// TestSchema_Validate проверяет поддерживаемые ключевые слова.
+func TestSchema_Validate(t *testing.T) {
+	s, err := Compile(json.RawMessage(bodyState))
+	if err != nil {
+		t.Fatalf("Compile() вернула ошибку: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		payload  string
+		wantErr  bool
+		wantPath string
+	}{
+		{"валидный payload", `{"pos":{"x":1.5,"y":2},"mode":"idle","fuel":50,"wheels":[1,2]}`, false, ""},
+		{"отсутствует обязательное поле", `{"pos":{"x":1}}`, true, "pos.y"},
+		{"неверный тип", `{"pos":{"x":"1","y":2}}`, true, "pos.x"},
+		{"лишнее свойство", `{"pos":{"x":1,"y":2},"extra":1}`, true, "extra"},
+		{"значение вне enum", `{"pos":{"x":1,"y":2},"mode":"drive"}`, true, "mode"},
+		{"больше maximum", `{"pos":{"x":1,"y":2},"fuel":101}`, true, "fuel"},
+		{"длиннее maxLength", `{"pos":{"x":1,"y":2},"name":"rover"}`, true, "name"},
+		{"нецелый элемент массива", `{"pos":{"x":1,"y":2},"wheels":[1,2.5]}`, true, "wheels[1]"},
+		{"слишком много элементов", `{"pos":{"x":1,"y":2},"wheels":[1,2,3,4,5]}`, true, "wheels"},
+		{"payload не объект", `[1]`, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(json.RawMessage(tt.payload))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Validate() вернула ошибку: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, ожидалась ValidationError", err)
+			}
+			if verr.Path != tt.wantPath {
+				t.Errorf("Path = %q, ожидался %q (%v)", verr.Path, tt.wantPath, err)
+			}
+			if !errors.Is(err, ErrViolation) {
+				t.Error("ошибка должна быть совместима с ErrViolation")
+			}
+		})
+	}
+
+	t.Run("отсутствующий payload проверяется как null", func(t *testing.T) {
+		if err := s.Validate(nil); err == nil {
+			t.Error("ожидалась ошибка для отсутствующего payload")
+		}
+		nullable, _ := Compile(json.RawMessage(`{"type":["object","null"]}`))
+		if err := nullable.Validate(nil); err != nil {
+			t.Errorf("Validate() вернула ошибку: %v", err)
+		}
+	})
+}
+
+// TestSchema_Paths проверяет пути полей для /api/analysis/series.
+func TestSchema_Paths(t *testing.T) {
+	s, err := Compile(json.RawMessage(bodyState))
+	if err != nil {
+		t.Fatalf("Compile() вернула ошибку: %v", err)
+	}
+
+	want := []FieldPath{
+		{Path: "fuel", Type: "number"},
+		{Path: "mode"},
+		{Path: "name", Type: "string"},
+		{Path: "pos.x", Type: "number"},
+		{Path: "pos.y", Type: "number"},
+		{Path: "wheels", Type: "array"},
+	}
+	if got := s.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths() = %+v, ожидалось %+v", got, want)
+	}
+}
+
+// TestCompile_Invalid проверяет ошибки разбора схемы.
+func TestCompile_Invalid(t *testing.T) {
+	schemas := map[string]string{
+		"не JSON":                       `{`,
+		"неизвестный тип":               `{"type":"float"}`,
+		"неверный тип в properties":     `{"properties":{"x":{"type":7}}}`,
+		"неверная схема items":          `{"items":{"type":"nope"}}`,
+		"неверный additionalProperties": `{"additionalProperties":{"type":"nope"}}`,
+	}
+	for name, data := range schemas {
+		if _, err := Compile(json.RawMessage(data)); err == nil {
+			t.Errorf("%s: ожидалась ошибка", name)
+		}
+	}
+}
+
+// TestRegistry проверяет поиск и список схем.
+func TestRegistry(t *testing.T) {
+	r, err := New(FileConfig{
+		Mode: ModeEnforce,
+		Schemas: []Entry{
+			{SourceID: "flight-engine", Type: "body.state", V: 1, Schema: json.RawMessage(bodyState)},
+			{SourceID: AnySource, Type: "body.state", V: 1, Schema: json.RawMessage(`{"type":"object"}`)},
+			{SourceID: AnySource, Type: "log", V: 1, Schema: json.RawMessage(`{"properties":{"msg":{"type":"string"}}}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() вернула ошибку: %v", err)
+	}
+	if r.Mode() != ModeEnforce {
+		t.Errorf("Mode() = %q, ожидался enforce", r.Mode())
+	}
+
+	t.Run("схема источника имеет приоритет", func(t *testing.T) {
+		s := r.Lookup("flight-engine", "body.state", 1)
+		if s == nil || s.Validate(json.RawMessage(`{}`)) == nil {
+			t.Error("ожидалась схема flight-engine")
+		}
+		s = r.Lookup("drive-engine", "body.state", 1)
+		if s == nil || s.Validate(json.RawMessage(`{}`)) != nil {
+			t.Error("ожидалась схема для \"*\"")
+		}
+		if r.Lookup("flight-engine", "body.state", 2) != nil {
+			t.Error("для незарегистрированной версии ожидался nil")
+		}
+	})
+
+	t.Run("фильтры списка", func(t *testing.T) {
+		if got := len(r.List("", "")); got != 3 {
+			t.Errorf("List() вернула %d схем, ожидалось 3", got)
+		}
+		if got := len(r.List("drive-engine", "")); got != 2 {
+			t.Errorf("List(drive-engine) вернула %d схем, ожидалось 2", got)
+		}
+		list := r.List("", "log")
+		if len(list) != 1 || list[0].Paths[0].Path != "msg" {
+			t.Errorf("List(type=log) = %+v", list)
+		}
+	})
+}
+
+// TestNew_InvalidConfig проверяет ошибки конфигурации реестра.
+func TestNew_InvalidConfig(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object"}`)
+	configs := map[string]FileConfig{
+		"неизвестный режим": {Mode: "strict"},
+		"без sourceId":      {Schemas: []Entry{{Type: "t", V: 1, Schema: schema}}},
+		"без v":             {Schemas: []Entry{{SourceID: "s", Type: "t", Schema: schema}}},
+		"повторяющаяся схема": {Schemas: []Entry{
+			{SourceID: "s", Type: "t", V: 1, Schema: schema},
+			{SourceID: "s", Type: "t", V: 1, Schema: schema},
+		}},
+		"невалидная схема": {Schemas: []Entry{{SourceID: "s", Type: "t", V: 1, Schema: json.RawMessage(`{"type":"x"}`)}}},
+	}
+	for name, config := range configs {
+		if _, err := New(config); err == nil {
+			t.Errorf("%s: ожидалась ошибка", name)
+		}
+	}
+}
+
+// TestLoadFile проверяет загрузку реестра из файла.
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	data := `{"schemas":[{"sourceId":"*","type":"body.state","v":1,"schema":` + bodyState + `}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() вернула ошибку: %v", err)
+	}
+	if r.Mode() != ModeWarn {
+		t.Errorf("Mode() = %q, по умолчанию ожидался warn", r.Mode())
+	}
+	if r.Lookup("any", "body.state", 1) == nil {
+		t.Error("схема не найдена")
+	}
+}
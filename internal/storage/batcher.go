@@ -3,15 +3,30 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/teltel/teltel/internal/deadletter"
 	"github.com/teltel/teltel/internal/event"
 	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
 )
 
+// Значения dead-letter записей для батчей, которые не удалось записать.
+const (
+	// DeadLetterOrigin - источник записи
+	DeadLetterOrigin = "storage.clickhouse"
+
+	// DeadLetterReason - причина записи
+	DeadLetterReason = "ErrInsertFailed"
+)
+
+// DurableName - имя durable подписки batcher'а в журнале событий.
+const DurableName = "clickhouse-batcher"
+
 // Batcher собирает события из EventBus и записывает их в ClickHouse батчами.
 type Batcher interface {
 	// Start запускает batcher и подписывается на EventBus.
@@ -60,6 +75,19 @@ type BatcherConfig struct {
 	// Retry политика
 	MaxRetries   int
 	RetryBackoff time.Duration
+
+	// DeadLetter - хранилище для событий батчей, не записанных после
+	// MaxRetries (nil = такие события теряются)
+	DeadLetter *deadletter.Store
+
+	// Log - журнал событий EventBus (nil = обычная подписка на EventBus).
+	// Batcher читает журнал durable подпиской DurableName и сохраняет
+	// позицию после записи батча в ClickHouse или dead-letter хранилище,
+	// поэтому после перезапуска продолжает с незаписанных событий.
+	// Батч, который не удалось сохранить, повторяется каждые FlushInterval;
+	// до его записи журнал дальше не читается.
+	// BufferSize и Policy при этом не используются.
+	Log *eventlog.Log
 }
 
 // batcher реализует Batcher интерфейс.
@@ -73,9 +101,17 @@ type batcher struct {
 	mu            sync.Mutex
 	batch         []*event.Event
 	lastFlushTime time.Time
-	started       bool
-	stopCh        chan struct{}
-	doneCh        chan struct{}
+
+	// Durable режим (config.Log): подписка, offset последнего события
+	// батча и батч, не сохранённый ни в ClickHouse, ни в dead-letter
+	durable      eventbus.DurableSubscription
+	batchOffset  uint64
+	hasOffset    bool
+	failed       []*event.Event
+	failedOffset uint64
+	started      bool
+	stopCh       chan struct{}
+	doneCh       chan struct{}
 
 	// Статистика
 	totalBatches atomic.Uint64
@@ -105,46 +141,81 @@ func (b *batcher) Start(ctx context.Context) error {
 		return fmt.Errorf("batcher already started")
 	}
 
-	// Создаём подписку на EventBus
-	sub, err := b.eventBus.Subscribe(ctx, b.config.Filter, eventbus.SubscriptionOptions{
-		BufferSize: b.config.BufferSize,
-		Policy:     b.config.Policy,
-		Name:       "clickhouse-batcher",
-	})
-	if err != nil {
-		return fmt.Errorf("failed to subscribe to eventbus: %w", err)
+	// В durable режиме читаем журнал, иначе подписываемся на EventBus
+	var events <-chan *event.Event
+	var records <-chan eventlog.Record
+	if b.config.Log != nil {
+		durable, err := eventbus.SubscribeDurable(ctx, b.config.Log, b.config.Filter, eventbus.DurableOptions{
+			Name: DurableName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to event log: %w", err)
+		}
+		if err := durable.Err(); errors.Is(err, eventlog.ErrOffsetOutOfRange) {
+			// Позиция за концом журнала: чтение продолжается с конца
+			fmt.Printf("Batcher event log position reset: %v\n", err)
+		}
+		b.durable = durable
+		records = durable.C()
+	} else {
+		sub, err := b.eventBus.Subscribe(ctx, b.config.Filter, eventbus.SubscriptionOptions{
+			BufferSize: b.config.BufferSize,
+			Policy:     b.config.Policy,
+			Name:       "clickhouse-batcher",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to eventbus: %w", err)
+		}
+		events = sub.C()
 	}
 
 	b.started = true
 	b.lastFlushTime = time.Now()
 
 	// Запускаем фоновую goroutine
-	go b.run(ctx, sub)
+	go b.run(ctx, events, records)
 
 	return nil
 }
 
-// run обрабатывает события из подписки.
-func (b *batcher) run(ctx context.Context, sub eventbus.Subscription) {
+// run обрабатывает события из подписки на EventBus (events)
+// или durable подписки на журнал (records); второй канал - nil.
+func (b *batcher) run(ctx context.Context, events <-chan *event.Event, records <-chan eventlog.Record) {
 	defer close(b.doneCh)
+	if b.durable != nil {
+		defer b.durable.Close()
+	}
 
 	// Таймер для периодического flush
 	flushTicker := time.NewTicker(b.config.FlushInterval)
 	defer flushTicker.Stop()
 
 	for {
+		// Пока не записан предыдущий батч, журнал не читается:
+		// позиция сохраняется только по порядку
+		in := records
+		if b.hasFailed() {
+			in = nil
+		}
+
 		select {
 		case <-ctx.Done():
 			// Контекст отменён, выполняем финальный flush
+			b.retry(ctx)
 			b.flush(ctx)
 			return
 
 		case <-b.stopCh:
 			// Stop вызван, выполняем финальный flush
+			b.retry(ctx)
 			b.flush(ctx)
 			return
 
 		case <-flushTicker.C:
+			if b.hasFailed() {
+				b.retry(ctx)
+				continue
+			}
 			// Периодический flush по времени
 			b.mu.Lock()
 			if len(b.batch) > 0 {
@@ -154,29 +225,46 @@ func (b *batcher) run(ctx context.Context, sub eventbus.Subscription) {
 				b.mu.Unlock()
 			}
 
-		case e, ok := <-sub.C():
+		case e, ok := <-events:
 			if !ok {
 				// Канал закрыт, выполняем финальный flush
 				b.flush(ctx)
 				return
 			}
+			b.add(ctx, e)
 
-			// Добавляем событие в батч
+		case r, ok := <-in:
+			if !ok {
+				if err := b.durable.Err(); err != nil {
+					fmt.Printf("Batcher event log error: %v\n", err)
+				}
+				b.flush(ctx)
+				return
+			}
 			b.mu.Lock()
-			b.batch = append(b.batch, e)
-			batchSize := len(b.batch)
+			b.batchOffset = r.Offset
+			b.hasOffset = true
 			b.mu.Unlock()
+			b.add(ctx, r.Event)
+		}
+	}
+}
 
-			// Проверяем flush по размеру батча
-			if batchSize >= b.config.BatchSize {
-				b.flush(ctx)
-			}
+// add добавляет событие в батч и выполняет flush по размеру батча или run.end.
+func (b *batcher) add(ctx context.Context, e *event.Event) {
+	b.mu.Lock()
+	b.batch = append(b.batch, e)
+	batchSize := len(b.batch)
+	b.mu.Unlock()
 
-			// Проверяем flush по run.end
-			if e.Type == "run.end" {
-				b.flush(ctx)
-			}
-		}
+	// Проверяем flush по размеру батча
+	if batchSize >= b.config.BatchSize {
+		b.flush(ctx)
+	}
+
+	// Проверяем flush по run.end
+	if e.Type == "run.end" {
+		b.flush(ctx)
 	}
 }
 
@@ -193,20 +281,57 @@ func (b *batcher) flush(ctx context.Context) {
 	copy(batch, b.batch)
 	b.batch = b.batch[:0] // Очищаем батч
 	b.lastFlushTime = time.Now()
+	offset, hasOffset := b.batchOffset, b.hasOffset
+	b.hasOffset = false
 	b.mu.Unlock()
 
+	b.write(ctx, batch, offset, hasOffset)
+}
+
+// retry повторяет запись батча, который не удалось сохранить.
+func (b *batcher) retry(ctx context.Context) {
+	b.mu.Lock()
+	batch, offset := b.failed, b.failedOffset
+	b.failed = nil
+	b.mu.Unlock()
+
+	if len(batch) > 0 {
+		b.write(ctx, batch, offset, true)
+	}
+}
+
+// hasFailed сообщает, ожидает ли повтора несохранённый батч.
+func (b *batcher) hasFailed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failed != nil
+}
+
+// write записывает батч в ClickHouse, а при ошибке - в dead-letter
+// хранилище, и сохраняет позицию durable подписки. В durable режиме
+// батч, не сохранённый никуда, остаётся для повтора (см. retry).
+func (b *batcher) write(ctx context.Context, batch []*event.Event, offset uint64, hasOffset bool) {
 	// Записываем события
 	if err := b.writeBatch(ctx, batch); err != nil {
 		b.totalErrors.Add(1)
 		// Логируем ошибку, но продолжаем работу
 		// В production здесь должен быть proper logger
 		fmt.Printf("Batcher flush error: %v\n", err)
+		switch {
+		case b.deadLetter(batch, err):
+			b.commit(offset, hasOffset)
+		case hasOffset:
+			b.mu.Lock()
+			b.failed, b.failedOffset = batch, offset
+			b.mu.Unlock()
+		}
 		return
 	}
 
 	// Обновляем статистику
 	b.totalBatches.Add(1)
 	b.totalEvents.Add(uint64(len(batch)))
+	b.commit(offset, hasOffset)
 
 	// Обновляем метаданные run'ов
 	b.updateMetadata(ctx, batch)
@@ -218,24 +343,9 @@ func (b *batcher) writeBatch(ctx context.Context, events []*event.Event) error {
 		return nil
 	}
 
-	// Сериализуем события в JSONEachRow формат
-	jsonRows := make([][]byte, 0, len(events))
-	for _, e := range events {
-		row := b.eventToRow(e)
-		jsonData, err := json.Marshal(row)
-		if err != nil {
-			return fmt.Errorf("failed to marshal event: %w", err)
-		}
-		jsonRows = append(jsonRows, jsonData)
-	}
-
-	// Объединяем в NDJSON формат
-	ndjson := make([]byte, 0)
-	for i, row := range jsonRows {
-		if i > 0 {
-			ndjson = append(ndjson, '\n')
-		}
-		ndjson = append(ndjson, row...)
+	ndjson, err := encodeRows(events)
+	if err != nil {
+		return err
 	}
 
 	// Вставляем в ClickHouse с retry
@@ -260,8 +370,69 @@ func (b *batcher) writeBatch(ctx context.Context, events []*event.Event) error {
 	return fmt.Errorf("failed to insert batch after %d retries: %w", b.config.MaxRetries, lastErr)
 }
 
+// commit сохраняет позицию durable подписки после обработки батча.
+func (b *batcher) commit(offset uint64, hasOffset bool) {
+	if !hasOffset {
+		return
+	}
+	if err := b.durable.Commit(offset); err != nil {
+		fmt.Printf("Batcher commit error: %v\n", err)
+	}
+}
+
+// deadLetter сохраняет события батча, который не удалось записать.
+// Возвращает true, если события сохранены.
+func (b *batcher) deadLetter(events []*event.Event, err error) bool {
+	if b.config.DeadLetter == nil {
+		return false
+	}
+	entries := make([]deadletter.Entry, len(events))
+	for i, e := range events {
+		entries[i] = deadletter.Entry{
+			Origin: DeadLetterOrigin,
+			Reason: DeadLetterReason,
+			Error:  err.Error(),
+			Event:  e,
+		}
+	}
+	if err := b.config.DeadLetter.Write(entries...); err != nil {
+		fmt.Printf("Batcher dead-letter error: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// InsertEvents записывает события в ClickHouse одним запросом без повторов.
+// Используется для повторной записи событий из dead-letter хранилища.
+func InsertEvents(ctx context.Context, client Client, events []*event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ndjson, err := encodeRows(events)
+	if err != nil {
+		return err
+	}
+	return client.InsertBatch(ctx, "telemetry_events", ndjson)
+}
+
+// encodeRows сериализует события в JSONEachRow формат.
+func encodeRows(events []*event.Event) ([]byte, error) {
+	ndjson := make([]byte, 0)
+	for i, e := range events {
+		jsonData, err := json.Marshal(eventToRow(e))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if i > 0 {
+			ndjson = append(ndjson, '\n')
+		}
+		ndjson = append(ndjson, jsonData...)
+	}
+	return ndjson, nil
+}
+
 // eventToRow преобразует Event в строку для ClickHouse.
-func (b *batcher) eventToRow(e *event.Event) map[string]interface{} {
+func eventToRow(e *event.Event) map[string]interface{} {
 	row := map[string]interface{}{
 		"run_id":      e.RunID,
 		"source_id":   e.SourceID,
@@ -274,6 +445,9 @@ func (b *batcher) eventToRow(e *event.Event) map[string]interface{} {
 	if e.WallTimeMs != nil {
 		row["wall_time_ms"] = *e.WallTimeMs
 	}
+	if e.WallTimeCorrectedMs != nil {
+		row["wall_time_corrected_ms"] = *e.WallTimeCorrectedMs
+	}
 
 	// Сериализуем tags и payload как JSON строки
 	if e.Tags != nil {
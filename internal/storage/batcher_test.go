@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teltel/teltel/internal/deadletter"
+	"github.com/teltel/teltel/internal/event"
+	"github.com/teltel/teltel/internal/eventbus"
+	"github.com/teltel/teltel/internal/eventlog"
+)
+
+// failingClient - Client, у которого любая вставка завершается ошибкой.
+type failingClient struct {
+	inserts int
+}
+
+func (c *failingClient) Exec(ctx context.Context, query string) error { return nil }
+
+func (c *failingClient) InsertBatch(ctx context.Context, table string, data []byte) error {
+	c.inserts++
+	return errors.New("clickhouse unavailable")
+}
+
+func (c *failingClient) Query(ctx context.Context, query string) ([]byte, error) { return nil, nil }
+
+// TestBatcher_DeadLetter проверяет сохранение батча, не записанного после MaxRetries.
+func TestBatcher_DeadLetter(t *testing.T) {
+	store, err := deadletter.Open(deadletter.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	bus := eventbus.New()
+	defer bus.Close()
+
+	client := &failingClient{}
+	b := NewBatcher(bus, client, BatcherConfig{
+		BatchSize:  10,
+		MaxRetries: 2,
+		DeadLetter: store,
+	}).(*batcher)
+
+	b.batch = append(b.batch,
+		&event.Event{V: 1, RunID: "run-1", SourceID: "engine", FrameIndex: 0},
+		&event.Event{V: 1, RunID: "run-1", SourceID: "engine", FrameIndex: 1},
+	)
+	b.flush(context.Background())
+
+	if client.inserts != 3 {
+		t.Errorf("попыток вставки: %d, ожидалось 3", client.inserts)
+	}
+	if stats := b.Stats(); stats.TotalErrors != 1 || stats.TotalEvents != 0 {
+		t.Errorf("статистика: %+v", stats)
+	}
+
+	files, _ := store.Files()
+	if len(files) != 1 {
+		t.Fatalf("файлов: %d, ожидался 1", len(files))
+	}
+	f, _ := store.OpenFile(files[0].Name)
+	defer f.Close()
+
+	var entries []deadletter.Entry
+	deadletter.ReadEntries(f, func(e deadletter.Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if len(entries) != 2 {
+		t.Fatalf("записей: %d, ожидалось 2", len(entries))
+	}
+	for i, e := range entries {
+		if e.Origin != DeadLetterOrigin || e.Reason != DeadLetterReason || e.Event == nil || e.Event.FrameIndex != i {
+			t.Errorf("запись %d: %+v", i, e)
+		}
+	}
+}
+
+// recordingClient - Client, который считает строки, вставленные в telemetry_events.
+// Первые failures вставок завершаются ошибкой.
+type recordingClient struct {
+	mu       sync.Mutex
+	rows     int
+	failures int
+}
+
+func (c *recordingClient) Exec(ctx context.Context, query string) error { return nil }
+
+func (c *recordingClient) InsertBatch(ctx context.Context, table string, data []byte) error {
+	if table != "telemetry_events" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("clickhouse unavailable")
+	}
+	c.rows += bytes.Count(data, []byte("\n")) + 1
+	return nil
+}
+
+// waitCommitted ждёт, пока позиция batcher'а в журнале не станет offset.
+func waitCommitted(t *testing.T, log *eventlog.Log, offset uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if committed, ok := log.Committed(DurableName); ok && committed == offset {
+			return
+		}
+		if time.Now().After(deadline) {
+			committed, _ := log.Committed(DurableName)
+			t.Fatalf("позиция batcher'а: %d, ожидалась %d", committed, offset)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (c *recordingClient) Query(ctx context.Context, query string) ([]byte, error) { return nil, nil }
+
+// TestBatcher_Durable проверяет чтение журнала событий и сохранение позиции
+// после записи батча.
+func TestBatcher_Durable(t *testing.T) {
+	log, err := eventlog.Open(eventlog.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	bus := eventbus.NewWithConfig(eventbus.Config{Log: log})
+	defer bus.Close()
+
+	// События, опубликованные до запуска batcher'а, тоже записываются
+	ctx := context.Background()
+	bus.PublishBatch(ctx, []*event.Event{
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "body.state", FrameIndex: 0},
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "body.state", FrameIndex: 1},
+	})
+
+	client := &recordingClient{}
+	b := NewBatcher(bus, client, BatcherConfig{
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+		Log:           log,
+	})
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	bus.Publish(ctx, &event.Event{V: 1, RunID: "run-1", SourceID: "engine", Type: "run.end", FrameIndex: 2})
+
+	waitCommitted(t, log, 3)
+	if err := b.Stop(ctx); err != nil {
+		t.Fatalf("Stop() вернула ошибку: %v", err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.rows != 3 {
+		t.Errorf("записано строк: %d, ожидалось 3", client.rows)
+	}
+}
+
+// TestBatcher_DurableRetry проверяет, что батч, не записанный без
+// dead-letter хранилища, повторяется и позиция сохраняется дальше.
+func TestBatcher_DurableRetry(t *testing.T) {
+	log, err := eventlog.Open(eventlog.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	bus := eventbus.NewWithConfig(eventbus.Config{Log: log})
+	defer bus.Close()
+
+	client := &recordingClient{failures: 2}
+	b := NewBatcher(bus, client, BatcherConfig{
+		BatchSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+		Log:           log,
+	})
+	ctx := context.Background()
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("Start() вернула ошибку: %v", err)
+	}
+	defer b.Stop(ctx)
+
+	bus.PublishBatch(ctx, []*event.Event{
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "body.state", FrameIndex: 0},
+		{V: 1, RunID: "run-1", SourceID: "engine", Type: "run.end", FrameIndex: 1},
+	})
+	waitCommitted(t, log, 2)
+
+	// После восстановления позиция продолжает сохраняться
+	bus.Publish(ctx, &event.Event{V: 1, RunID: "run-2", SourceID: "engine", Type: "run.end", FrameIndex: 0})
+	waitCommitted(t, log, 3)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.rows != 3 {
+		t.Errorf("записано строк: %d, ожидалось 3", client.rows)
+	}
+	if stats := b.Stats(); stats.TotalErrors != 2 {
+		t.Errorf("статистика: %+v", stats)
+	}
+}
@@ -15,6 +15,7 @@ CREATE TABLE IF NOT EXISTS telemetry_events (
   frame_index UInt32,
   sim_time Float64,
   wall_time_ms Nullable(UInt64),
+  wall_time_corrected_ms Nullable(UInt64),  -- wall_time_ms in server clock
   
   -- Metadata
   tags String,  -- JSON string for filtering
@@ -28,6 +29,9 @@ ORDER BY (run_id, frame_index, source_id)
 PARTITION BY toYYYYMM(inserted_at)
 SETTINGS index_granularity = 8192;
 
+-- Column added after the initial schema (for existing tables)
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS wall_time_corrected_ms Nullable(UInt64) AFTER wall_time_ms;
+
 -- Table for run metadata
 CREATE TABLE IF NOT EXISTS run_metadata (
   run_id String,